@@ -14,13 +14,19 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
+	// Embed the zone database: the windows/amd64 CGO_ENABLED=0 deploy has no
+	// Go zoneinfo, so news.time_zone would otherwise only accept UTC.
+	_ "time/tzdata"
 
+	"open-zone/internal/admin"
 	"open-zone/internal/autoupdate"
 	"open-zone/internal/config"
 	"open-zone/internal/dp8"
 	"open-zone/internal/dp8shim"
+	"open-zone/internal/dp8shim/replayshim"
 	"open-zone/internal/news"
 	"open-zone/internal/packetlog"
 	"open-zone/internal/proto"
@@ -55,9 +61,22 @@ func preflightPort(port int) error {
 	return nil
 }
 
+// shortDuration formats d without trailing zero units ("10m", not "10m0s").
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
+
 func main() {
 	// Set up logging first so early failures are captured consistently.
 	runID := proto.MakeRunID()
+	startedAt := time.Now()
 	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
 		Level: slog.LevelInfo,
 	})).With("run_id", runID))
@@ -89,15 +108,23 @@ func main() {
 		"shim", cfg.ShimPath,
 	)
 
-	var pl *packetlog.Logger
+	// pl stays a nil Sink when telemetry is disabled so call sites can nil-check it.
+	var pl packetlog.Sink
+	telemetryDropped := func() uint64 { return 0 }
 	if cfg.DP8LogPath != "" {
-		var err error
-		pl, err = packetlog.New(cfg.DP8LogPath)
+		fileLog, err := packetlog.New(cfg.DP8LogPath, cfg.DP8Log)
 		if err != nil {
 			fatal("open ndjson telemetry file failed", err, "path", cfg.DP8LogPath)
 		}
-		defer func() { _ = pl.Close() }()
-		slog.Info("ndjson telemetry enabled", "path", cfg.DP8LogPath)
+		pl = fileLog
+		telemetryDropped = fileLog.Dropped
+		defer func() {
+			_ = fileLog.Close()
+			if n := fileLog.Dropped(); n > 0 {
+				slog.Warn("ndjson telemetry dropped records (queue full)", "dropped", n)
+			}
+		}()
+		slog.Info("ndjson telemetry enabled", "path", cfg.DP8LogPath, "max_bytes", cfg.DP8Log.MaxBytes, "max_files", cfg.DP8Log.MaxBackups)
 	} else {
 		slog.Info("ndjson telemetry disabled (default); set OZ_DP8_NDJSON to enable")
 	}
@@ -105,8 +132,15 @@ func main() {
 	// Best-effort: AutoUpdate uses port 80 with no explicit port field in DS configs.
 	// We accept and immediately close to avoid long timeouts.
 	if cfg.AutoPort != 0 {
-		if err := autoupdate.StartSink(ctx, fmt.Sprintf(":%d", cfg.AutoPort), runID, pl); err != nil {
-			slog.Warn("autoupdate sink disabled (listen failed)", "port", cfg.AutoPort, "err", err)
+		addr := fmt.Sprintf(":%d", cfg.AutoPort)
+		var err error
+		if cfg.AutoMode == config.AutoModeHTTP {
+			err = autoupdate.StartHTTPSink(ctx, addr, cfg.AutoManifest, runID, pl)
+		} else {
+			err = autoupdate.StartSink(ctx, addr, cfg.AutoSink, runID, pl)
+		}
+		if err != nil {
+			slog.Warn("autoupdate sink disabled (listen failed)", "port", cfg.AutoPort, "mode", cfg.AutoMode, "err", err)
 		}
 	}
 
@@ -127,33 +161,166 @@ func main() {
 		fatal("dp8shim start failed", err, "port", cfg.DP8Port, "path", cfg.ShimPath)
 	}
 	defer shim.StopServer()
-	slog.Info("dp8shim started DirectPlay8Server", "port", cfg.DP8Port, "path", cfg.ShimPath)
 
-	hostStore := state.NewHostStore()
+	// Prefer the port the shim actually bound (ConInfoRes must match it); older shims
+	// without DP8_GetListenInfo fall back to the configured port.
+	listen, err := shim.ListenInfo()
+	if err != nil {
+		slog.Info("dp8shim listen info unavailable; using configured port", "port", cfg.DP8Port, "err", err)
+	} else if bound := listen.PortOr(cfg.DP8Port); bound != cfg.DP8Port {
+		slog.Warn("dp8shim bound a different port than configured", "configured", cfg.DP8Port, "bound", bound)
+		cfg.DP8Port = bound
+		cfg.Proto.Port = bound
+	}
+	slog.Info("dp8shim started DirectPlay8Server", "port", cfg.DP8Port, "adapter", listen.Adapter, "path", cfg.ShimPath)
+
+	hostStore := state.NewHostStoreWithConfig(cfg.Host)
+	if cfg.SnapshotPath != "" {
+		snapFile := reserveHostRids(hostStore, cfg.SnapshotPath)
+		snapDone := make(chan struct{})
+		go func() {
+			defer close(snapDone)
+			saveHostSnapshots(ctx, hostStore, snapFile)
+		}()
+		// The final save runs once ctx ends; end it here too in case the engine
+		// stopped on its own.
+		defer func() { stop(); <-snapDone }()
+	}
+	if cfg.SeedPath != "" {
+		if err := hostStore.LoadSeed(cfg.SeedPath); err != nil {
+			fatal("host seed load failed", err, "path", cfg.SeedPath)
+		}
+		slog.Info("seeded games listed", "path", cfg.SeedPath, "games", hostStore.VisibleGamesCount())
+	}
 	playerStore := state.NewPlayerStore()
+	if cfg.PlayerSnapshotPath != "" {
+		restorePlayerSnapshot(playerStore, cfg.PlayerSnapshotPath)
+		snapDone := make(chan struct{})
+		go func() {
+			defer close(snapDone)
+			savePlayerSnapshots(ctx, playerStore, cfg.PlayerSnapshotPath)
+		}()
+		defer func() { stop(); <-snapDone }()
+	}
 	protoEngine := proto.NewEngine(cfg.Proto, hostStore, playerStore)
+	// A broken connect bundle strands every client at "Connecting to ZoneMatch
+	// Server...", so refuse to start rather than serve it.
+	if err := protoEngine.SelfCheck(); err != nil {
+		fatal("proto engine self-check failed", err, "advertise_ip", cfg.Proto.AdvertiseIP, "advertise_port", cfg.Proto.AdvertisePort)
+	}
+	slog.Info("proto engine self-check passed", "bundle", "ConnectRes+ConInfoRes+ConnectEv")
 
 	engine, err := dp8.NewEngine(cfg, runID, shim, pl, protoEngine, playerStore)
 	if err != nil {
 		fatal("dp8 engine init error", err)
 	}
+	hostStore.SetGameRemovedHook(engine.GameRemoved)
+	if cfg.RawCapturePath != "" {
+		rec, err := replayshim.CreateRecorder(cfg.RawCapturePath)
+		if err != nil {
+			fatal("open raw capture file failed", err, "path", cfg.RawCapturePath)
+		}
+		defer func() {
+			if err := rec.Err(); err != nil {
+				slog.Warn("raw capture stopped after write error", "path", cfg.RawCapturePath, "err", err)
+			}
+			_ = rec.Close()
+		}()
+		engine.SetEventRecorder(rec)
+		slog.Warn("raw event capture enabled; file contains client payloads, restrict access", "path", cfg.RawCapturePath)
+	}
+	if cfg.RawPayloadPath != "" {
+		rawLog, err := packetlog.New(cfg.RawPayloadPath, packetlog.Options{Private: true})
+		if err != nil {
+			fatal("open raw payload log failed", err, "path", cfg.RawPayloadPath)
+		}
+		defer func() { _ = rawLog.Close() }()
+		engine.SetRawPayloadSink(rawLog)
+		slog.Warn("RAW PAYLOAD LOGGING ENABLED: every client payload (player names, chat, addresses) is written in full; "+
+			"this is personal data, so restrict access to the file, keep it only while debugging, and unset telemetry.raw_payload_path when done",
+			"path", cfg.RawPayloadPath)
+	}
 
-	_, err = news.Start(ctx, fmt.Sprintf(":%d", cfg.NewsPort), func() news.Data {
-		return news.Data{
+	if cfg.News.GamesFeed {
+		cfg.News.Games = func() []news.FeedGame {
+			rows := hostStore.GamesRows(0, nil)
+			out := make([]news.FeedGame, 0, len(rows))
+			for _, r := range rows {
+				out = append(out, news.FeedGame{
+					Rid:     r.Rid,
+					Name:    r.Items["GName"],
+					Map:     r.Items["Map"],
+					Players: r.Items["NumP"],
+					MaxP:    r.Items["MaxP"],
+				})
+			}
+			return out
+		}
+	}
+	_, err = news.Start(ctx, fmt.Sprintf(":%d", cfg.NewsPort), cfg.News, func() news.Data {
+		now := time.Now().UTC()
+		d := news.Data{
 			Tagline:       cfg.ServerTagline,
 			CreatedBy:     cfg.ServerCreatedBy,
 			Version:       cfg.ServerVersion,
-			ServerTime:    time.Now().UTC().Format(time.RFC3339),
+			ServerTime:    cfg.News.FormatServerTime(now),
 			PlayersOnline: playerStore.Count(),
 			GamesHosted:   hostStore.VisibleGamesCount(),
 		}
+		d.Full = cfg.Proto.MaxPlayers > 0 && d.PlayersOnline >= cfg.Proto.MaxPlayers
+		if cfg.News.ShowActiveGames {
+			window := hostStore.ActiveWindow()
+			d.GamesActive = hostStore.ActiveGamesCount(now, window)
+			d.ActiveWindow = shortDuration(window)
+		}
+		if cfg.News.PopularMaps > 0 {
+			d.PopularMaps = hostStore.TopMaps(cfg.News.PopularMaps)
+		}
+		return d
 	})
 	if err != nil {
-		fatal("news server start failed", err, "port", cfg.NewsPort)
+		fatal("news server start failed", err, "port", cfg.NewsPort, "template", cfg.News.TemplatePath)
+	}
+
+	if cfg.AdminPort > 0 {
+		_, err = admin.Start(ctx, fmt.Sprintf(":%d", cfg.AdminPort), admin.Options{
+			Token:            cfg.AdminToken,
+			Hosts:            hostStore,
+			Kick:             engine.Kick,
+			SetSweeperPaused: engine.SetSweeperPaused,
+			ReadOnly:         !cfg.Features.Enabled(config.FeatureAdminActions),
+			TLSCert:          cfg.AdminTLSCert,
+			TLSKey:           cfg.AdminTLSKey,
+		}, func() admin.Status {
+			return admin.Status{
+				Version:          cfg.ServerVersion,
+				ServerTime:       time.Now().UTC().Format(time.RFC3339),
+				Uptime:           time.Since(startedAt).Round(time.Second),
+				Engine:           engine.Stats(),
+				Games:            hostStore.GamesRows(0, nil),
+				TelemetryDropped: telemetryDropped(),
+			}
+		})
+		if err != nil {
+			fatal("admin server start failed", err, "port", cfg.AdminPort)
+		}
+		slog.Info("admin server enabled", "port", cfg.AdminPort, "tls", cfg.AdminTLSCert != "")
 	}
 
+	watchStatsSignal(ctx, func() {
+		logStatsSnapshot(engine.Stats(), time.Since(startedAt), telemetryDropped())
+	})
+
 	if err := engine.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
 		fatal("dp8 engine error", err)
 	}
 	slog.Info("shutdown requested")
+	st := engine.Stats()
+	logRunSummary(pl, runID, runSummary{
+		Uptime:       time.Since(startedAt),
+		PlayersSeen:  playerStore.Seen(),
+		PlayersPeak:  playerStore.Peak(),
+		GamesHosted:  hostStore.TotalGamesHosted(),
+		SendsDropped: st.Drops["queue-full"] + st.Drops["departed"],
+	})
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"open-zone/internal/state"
+)
+
+// snapshotEvery bounds how many player session changes a crash can forget. Rids
+// are not at risk: they are reserved ridReserveBlock at a time before use.
+const snapshotEvery = time.Minute
+
+// ridReserveBlock is how many rids each persisted reservation covers (and how
+// many a restart may skip).
+const ridReserveBlock = 100
+
+// hostSnapshotFile serializes host snapshot writes from rid reservations and the
+// periodic saver, never replacing a counter with a lower one.
+type hostSnapshotFile struct {
+	path string
+
+	mu      sync.Mutex
+	written uint32
+}
+
+func (f *hostSnapshotFile) write(snap state.HostSnapshot) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if snap.NextRid <= f.written {
+		return nil
+	}
+	if err := state.WriteHostSnapshot(f.path, snap); err != nil {
+		slog.Warn("host snapshot write failed", "path", f.path, "err", err)
+		return err
+	}
+	f.written = snap.NextRid
+	return nil
+}
+
+// restoreHostSnapshot resumes the rid counter from path. A missing file is a
+// first run; anything else unreadable is logged and ignored (rids restart at
+// state.rid_base, as without a snapshot).
+func restoreHostSnapshot(hosts *state.HostStore, path string) {
+	snap, err := state.ReadHostSnapshot(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		slog.Info("no host snapshot yet; starting fresh", "path", path)
+	case err != nil:
+		slog.Warn("host snapshot unreadable; ignoring", "path", path, "err", err)
+	default:
+		hosts.Restore(snap)
+		slog.Info("host snapshot restored", "path", path, "next_rid", hosts.Snapshot().NextRid)
+	}
+}
+
+// restorePlayerSnapshot restores player sessions from path, treating a missing
+// or unreadable file like restoreHostSnapshot does.
+func restorePlayerSnapshot(players *state.PlayerStore, path string) {
+	snap, err := state.ReadPlayerSnapshot(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		slog.Info("no player snapshot yet; starting fresh", "path", path)
+	case err != nil:
+		slog.Warn("player snapshot unreadable; ignoring", "path", path, "err", err)
+	default:
+		players.Restore(snap, time.Now().UTC())
+		slog.Info("player snapshot restored", "path", path, "players", len(snap.Players), "online", players.Count())
+	}
+}
+
+// reserveHostRids restores the rid counter from path and has hosts keep a
+// synced reservation there ahead of the rids it hands out, so a crash does not
+// reissue one as long as the writes keep up (see state.HostStore.SetRidReservation).
+// A failed write is logged by hostSnapshotFile.write. It returns the file for
+// saveHostSnapshots.
+func reserveHostRids(hosts *state.HostStore, path string) *hostSnapshotFile {
+	restoreHostSnapshot(hosts, path)
+	f := &hostSnapshotFile{path: path}
+	_ = hosts.SetRidReservation(ridReserveBlock, f.write)
+	return f
+}
+
+// saveHostSnapshots writes the snapshot every snapshotEvery and once more when
+// ctx ends. It returns after the final write.
+func saveHostSnapshots(ctx context.Context, hosts *state.HostStore, f *hostSnapshotFile) {
+	saveSnapshots(ctx, func() { _ = f.write(hosts.Snapshot()) })
+}
+
+// savePlayerSnapshots is saveHostSnapshots for the PlayerStore.
+func savePlayerSnapshots(ctx context.Context, players *state.PlayerStore, path string) {
+	saveSnapshots(ctx, func() {
+		if err := state.WritePlayerSnapshot(path, players.Snapshot()); err != nil {
+			slog.Warn("player snapshot write failed", "path", path, "err", err)
+		}
+	})
+}
+
+// saveSnapshots calls save every snapshotEvery and once more when ctx ends.
+func saveSnapshots(ctx context.Context, save func()) {
+	t := time.NewTicker(snapshotEvery)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			save()
+			return
+		case <-t.C:
+			save()
+		}
+	}
+}
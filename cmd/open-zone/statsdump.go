@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"open-zone/internal/dp8"
+)
+
+// statsDumps counts SIGUSR1 snapshots so consecutive dumps are easy to tell apart.
+var statsDumps atomic.Uint64
+
+// logStatsSnapshot logs one structured stats line (SIGUSR1 on Unix).
+func logStatsSnapshot(st dp8.Stats, uptime time.Duration, telemetryDropped uint64) {
+	slog.Info(
+		"stats snapshot",
+		"seq", statsDumps.Add(1),
+		"uptime", uptime.Round(time.Second).String(),
+		"players_online", st.PlayersOnline,
+		"games_hosted", st.GamesHosted,
+		"stale_hosts", st.StaleHosts,
+		"active_games", st.ActiveGames,
+		"send_queue_depth", st.SendQueueDepth,
+		"shim_queue_depth", st.ShimQueueDepth,
+		"shim_queue_peak", st.ShimQueuePeak,
+		"shim_backlogged", st.ShimBacklogged,
+		"send_dropped", st.SendDropped,
+		"recv_throttled", st.RecvThrottled,
+		"recv_evicted_dropped", st.RecvEvictedDropped,
+		"handler_panics", st.HandlerPanics,
+		"slow_handlers", st.SlowHandlers,
+		"drops", st.Drops,
+		"proto_tags", st.ProtoTags,
+		"top_talkers", talkerAttrs(st.TopTalkers),
+		"telemetry_dropped", telemetryDropped,
+	)
+}
+
+// talkerAttrs renders top talkers as "0x0000abcd=120" (messages in the last minute).
+func talkerAttrs(ts []dp8.Talker) []string {
+	out := make([]string, 0, len(ts))
+	for _, t := range ts {
+		out = append(out, fmt.Sprintf("0x%08x=%d", t.DPNID, t.Msgs))
+	}
+	return out
+}
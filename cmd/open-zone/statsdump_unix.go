@@ -0,0 +1,28 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchStatsSignal calls dump on every SIGUSR1 until ctx is done. It uses its own
+// channel, so shutdown signals (NotifyContext) are unaffected.
+func watchStatsSignal(ctx context.Context, dump func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ch:
+				dump()
+			}
+		}
+	}()
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"log/slog"
+)
+
+// watchStatsSignal is a no-op: Windows has no SIGUSR1. Use GET /admin/status.
+func watchStatsSignal(ctx context.Context, dump func()) {
+	slog.Debug("SIGUSR1 stats dump unavailable on windows; use the admin status page")
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"open-zone/internal/packetlog"
+	"open-zone/internal/proto"
+)
+
+// runSummary is the end-of-run totals logged at shutdown.
+type runSummary struct {
+	Uptime       time.Duration
+	PlayersSeen  int
+	PlayersPeak  int
+	GamesHosted  int
+	SendsDropped uint64
+}
+
+// logRunSummary logs the run totals and, when telemetry is on, writes them as one
+// "shutdown" NDJSON record so a run's file ends with its own summary.
+func logRunSummary(pl packetlog.Sink, runID string, s runSummary) {
+	uptime := s.Uptime.Round(time.Second)
+	slog.Info(
+		"run summary",
+		"uptime", uptime.String(),
+		"players_seen", s.PlayersSeen,
+		"players_peak", s.PlayersPeak,
+		"games_hosted", s.GamesHosted,
+		"sends_dropped", s.SendsDropped,
+	)
+	if pl == nil {
+		return
+	}
+	pl.Log(packetlog.Record{
+		RunID:      runID,
+		Timestamp:  proto.NowTS(),
+		Type:       "shutdown",
+		Experiment: "run-summary",
+		Message: fmt.Sprintf(
+			"uptime_s=%d players_seen=%d players_peak=%d games_hosted=%d sends_dropped=%d",
+			int64(uptime/time.Second), s.PlayersSeen, s.PlayersPeak, s.GamesHosted, s.SendsDropped,
+		),
+	})
+}
@@ -0,0 +1,67 @@
+// Command oz-ndjson-verify checks a captured NDJSON telemetry file before it is
+// archived or analysed: every line must decode as a packetlog.Record. It prints
+// the line count, each malformed line with its number, and the run_ids present,
+// and exits 1 if any line failed to decode. Gzipped captures (telemetry.gzip)
+// are read as-is.
+//
+//	oz-ndjson-verify telemetry.ndjson
+//	oz-ndjson-verify telemetry.ndjson.gz
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run is main without the process exit, so tests can check the status.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintln(stderr, "usage: oz-ndjson-verify telemetry.ndjson")
+		return 2
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintln(stderr, "open:", err)
+		return 1
+	}
+	defer f.Close()
+
+	r, err := input(f, args[0])
+	if err != nil {
+		fmt.Fprintln(stderr, "open:", err)
+		return 1
+	}
+	rep, err := verify(r)
+	if err != nil {
+		fmt.Fprintln(stderr, "read:", err)
+		return 1
+	}
+	rep.write(stdout)
+	if len(rep.Malformed) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// gzipMagic starts every gzip member.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// input returns the decompressed contents of f when it is gzipped (a .gz name
+// or the gzip magic bytes), and f itself otherwise.
+func input(f *os.File, name string) (io.Reader, error) {
+	br := bufio.NewReader(f)
+	head, _ := br.Peek(len(gzipMagic))
+	if !strings.HasSuffix(name, ".gz") && !bytes.Equal(head, gzipMagic) {
+		return br, nil
+	}
+	return gzip.NewReader(br)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"open-zone/internal/packetlog"
+)
+
+// badLine is a line that did not decode as a packetlog.Record.
+type badLine struct {
+	Line int
+	Err  error
+}
+
+// report summarizes one verified file.
+type report struct {
+	Lines     int
+	Malformed []badLine
+	RunIDs    []string
+}
+
+// verify decodes every non-blank line of r. Only read errors are returned;
+// undecodable lines are collected in the report.
+func verify(r io.Reader) (report, error) {
+	var rep report
+	runIDs := make(map[string]struct{})
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		rep.Lines++
+		raw := sc.Bytes()
+		if len(strings.TrimSpace(string(raw))) == 0 {
+			continue
+		}
+		rec, err := packetlog.DecodeRecord(raw)
+		if err != nil {
+			rep.Malformed = append(rep.Malformed, badLine{Line: rep.Lines, Err: err})
+			continue
+		}
+		runIDs[rec.RunID] = struct{}{}
+	}
+	if err := sc.Err(); err != nil {
+		return rep, fmt.Errorf("line %d: %w", rep.Lines+1, err)
+	}
+	for id := range runIDs {
+		rep.RunIDs = append(rep.RunIDs, id)
+	}
+	sort.Strings(rep.RunIDs)
+	return rep, nil
+}
+
+// write prints the report; an empty run_id is shown as "(none)".
+func (rep report) write(w io.Writer) {
+	fmt.Fprintf(w, "lines: %d\n", rep.Lines)
+	for _, b := range rep.Malformed {
+		fmt.Fprintf(w, "malformed line %d: %v\n", b.Line, b.Err)
+	}
+	ids := make([]string, 0, len(rep.RunIDs))
+	for _, id := range rep.RunIDs {
+		if id == "" {
+			id = "(none)"
+		}
+		ids = append(ids, id)
+	}
+	fmt.Fprintf(w, "run_ids: %s\n", strings.Join(ids, " "))
+	if len(rep.Malformed) == 0 {
+		fmt.Fprintln(w, "ok")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun_BadLineFailsWithLineNumber(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dp8.ndjson")
+	body := `{"schema_ver":1,"run_id":"r1","type":"dp8","direction":"in","tag":"Connect"}
+{"schema_ver":1,"run_id":"r1","type":"dp8","direction":"out","tag":
+{"schema_ver":1,"run_id":"r2","type":"dp8","direction":"in","tag":"Page"}
+`
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out, errOut bytes.Buffer
+	if code := run([]string{path}, &out, &errOut); code != 1 {
+		t.Fatalf("exit=%d want 1\nstdout:\n%s\nstderr:\n%s", code, out.String(), errOut.String())
+	}
+	s := out.String()
+	for _, want := range []string{"lines: 3\n", "malformed line 2: ", "run_ids: r1 r2\n"} {
+		if !strings.Contains(s, want) {
+			t.Fatalf("missing %q in:\n%s", want, s)
+		}
+	}
+	if strings.Contains(s, "malformed line 1") || strings.Contains(s, "malformed line 3") || strings.Contains(s, "ok\n") {
+		t.Fatalf("unexpected report:\n%s", s)
+	}
+
+	good := strings.Replace(body, `"tag":`+"\n", `"tag":"PageRes"}`+"\n", 1)
+	if err := os.WriteFile(path, []byte(good), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if code := run([]string{path}, &out, &errOut); code != 0 || !strings.HasSuffix(out.String(), "ok\n") {
+		t.Fatalf("clean file exit=%d\n%s", code, out.String())
+	}
+}
+
+func TestRun_ReadsGzippedCapture(t *testing.T) {
+	body := `{"schema_ver":1,"run_id":"r1","type":"dp8","direction":"in","tag":"Connect"}
+{"schema_ver":1,"run_id":"r1","type":"dp8","direction":"out","tag":
+`
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	if _, err := zw.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Detected by name and, without the suffix, by the magic bytes.
+	dir := t.TempDir()
+	for _, name := range []string{"dp8.ndjson.gz", "dp8.ndjson"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, gz.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		var out, errOut bytes.Buffer
+		if code := run([]string{path}, &out, &errOut); code != 1 ||
+			!strings.Contains(out.String(), "lines: 2\n") || !strings.Contains(out.String(), "malformed line 2: ") {
+			t.Fatalf("%s: exit=%d\nstdout:\n%s\nstderr:\n%s", name, code, out.String(), errOut.String())
+		}
+	}
+
+	// A .gz name that is not gzip fails to open rather than reporting garbage.
+	path := filepath.Join(dir, "plain.ndjson.gz")
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var out, errOut bytes.Buffer
+	if code := run([]string{path}, &out, &errOut); code != 1 || !strings.HasPrefix(errOut.String(), "open:") {
+		t.Fatalf("plain .gz exit=%d stderr=%s", code, errOut.String())
+	}
+}
@@ -0,0 +1,49 @@
+// Command oz-proto runs app-protocol messages typed on stdin (one per line)
+// through a fresh proto.Engine with in-memory stores and prints every Outbound.
+//
+// It is for protocol experiments without the game: no shim, no DirectPlay, no
+// Windows. A line may start with "@0x<dpnid>" to speak as another client
+// (default 0x00000001); "#" lines are comments. -seed preloads a HostData (inline
+// XML or a file path) so Page/RowPg requests return rows.
+//
+//	oz-proto [-port 2300] [-advertise-ip 203.0.113.1] [-seed hostdata.xml] [-seed-ip 198.51.100.10]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"open-zone/internal/proto"
+	"open-zone/internal/state"
+)
+
+func main() {
+	port := flag.Int("port", 2300, "dp8 port the proto engine advertises (ConInfoRes)")
+	advIP := flag.String("advertise-ip", "", "advertised IP (ConInfoRes); defaults like the server")
+	seed := flag.String("seed", "", "HostData to preload: inline XML or a file path")
+	seedIP := flag.String("seed-ip", "198.51.100.10", "remote IP the seeded host appears to connect from")
+	flag.Parse()
+
+	eng := proto.NewEngine(proto.EngineConfig{Port: *port, AdvertiseIP: *advIP}, state.NewHostStore(), state.NewPlayerStore())
+	if *seed != "" {
+		raw := *seed
+		if !strings.HasPrefix(strings.TrimSpace(raw), "<") {
+			b, err := os.ReadFile(raw)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "seed:", err)
+				os.Exit(1)
+			}
+			raw = string(b)
+		}
+		if err := seedHost(eng, raw, *seedIP); err != nil {
+			fmt.Fprintln(os.Stderr, "seed:", err)
+			os.Exit(1)
+		}
+	}
+	if err := repl(os.Stdin, os.Stdout, eng); err != nil {
+		fmt.Fprintln(os.Stderr, "oz-proto:", err)
+		os.Exit(1)
+	}
+}
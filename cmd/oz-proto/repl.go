@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"open-zone/internal/proto"
+)
+
+const (
+	defaultDPNID uint32 = 0x00000001
+	seedDPNID    uint32 = 0x0000beef
+)
+
+// seedHost applies raw (a HostData message) as if seedDPNID had sent it from ip.
+func seedHost(eng *proto.Engine, raw, ip string) error {
+	msg, ok := proto.Parse(strings.TrimSpace(raw))
+	if !ok || msg.Tag != "HostData" {
+		return fmt.Errorf("seed is not a HostData message")
+	}
+	eng.Handle(time.Now().UTC(), seedDPNID, ip, msg)
+	return nil
+}
+
+// repl handles one message per input line and writes its responses:
+//
+//	> 0x00000001 HdrRow
+//	< HdrRowRes exp=send-hdrrow
+//	  <HdrRowRes .../>
+//
+// Unparseable lines are reported and skipped; only read errors stop the loop.
+func repl(r io.Reader, w io.Writer, eng *proto.Engine) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		dpnid := defaultDPNID
+		if rest, ok := strings.CutPrefix(line, "@"); ok {
+			id, msg, _ := strings.Cut(rest, " ")
+			v, err := strconv.ParseUint(id, 0, 32)
+			if err != nil {
+				fmt.Fprintf(w, "! bad dpnid %q\n", id)
+				continue
+			}
+			dpnid, line = uint32(v), strings.TrimSpace(msg)
+		}
+		msg, ok := proto.Parse(line)
+		if !ok {
+			fmt.Fprintf(w, "! not a message: %q\n", line)
+			continue
+		}
+		fmt.Fprintf(w, "> 0x%08x %s\n", dpnid, msg.Tag)
+		outs := eng.Handle(time.Now().UTC(), dpnid, "", msg)
+		if len(outs) == 0 {
+			fmt.Fprintln(w, "< (no response)")
+		}
+		for _, o := range outs {
+			fmt.Fprintf(w, "< %s exp=%s\n  %s\n", o.Tag, o.Exp, o.PayloadXML)
+			if len(o.Tail) > 0 {
+				fmt.Fprintf(w, "  tail=% x\n", o.Tail)
+			}
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"open-zone/internal/proto"
+	"open-zone/internal/state"
+)
+
+func TestREPL_ScriptedSession(t *testing.T) {
+	eng := proto.NewEngine(proto.EngineConfig{Port: 2300}, state.NewHostStore(), state.NewPlayerStore())
+	seed := `<HostData Cx="0x0"><HostData><New><Item ItemId="0" GName="Arena" Map="Tundra" NumP="2" MaxP="8" /></New></HostData></HostData>`
+	if err := seedHost(eng, seed, "198.51.100.10"); err != nil {
+		t.Fatalf("seedHost: %v", err)
+	}
+	if err := seedHost(eng, `<HdrRow Cx="0x1" />`, ""); err == nil {
+		t.Fatalf("non-HostData seed accepted")
+	}
+
+	script := strings.Join([]string{
+		"# browse as a second client",
+		`<Connect Cx="0x123" ProtoVer="3.3" />`,
+		"",
+		`@0x2 <Page Cx="0x0" Vid="101" PageNo="0" Num="0" Str="" />`,
+		"not xml",
+		"@zz <HdrRow />",
+	}, "\n")
+	var out bytes.Buffer
+	if err := repl(strings.NewReader(script), &out, eng); err != nil {
+		t.Fatal(err)
+	}
+	s := out.String()
+
+	for _, want := range []string{
+		"> 0x00000001 Connect\n< ConnectRes exp=",
+		"< ConInfoRes exp=",
+		"< ConnectEv exp=",
+		"> 0x00000002 Page\n< PageRes exp=",
+		`GName="Arena"`,
+		`IpAddr="198.51.100.10"`,
+		`! not a message: "not xml"`,
+		`! bad dpnid "zz"`,
+	} {
+		if !strings.Contains(s, want) {
+			t.Fatalf("missing %q in:\n%s", want, s)
+		}
+	}
+	if strings.Contains(s, "browse as a second client") {
+		t.Fatalf("comment was echoed:\n%s", s)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"open-zone/internal/config"
+	"open-zone/internal/dp8"
+	"open-zone/internal/dp8shim/replayshim"
+	"open-zone/internal/packetlog"
+	"open-zone/internal/proto"
+	"open-zone/internal/state"
+)
+
+// replayEngine runs the capture through dp8.Engine.Replay (connect/disconnect
+// events, stores, role caps, logging) with the read-only replay transport, and
+// writes a final summary. raw selects the Recorder capture format instead of
+// NDJSON telemetry. Telemetry goes to sink when non-nil.
+func replayEngine(r io.Reader, w io.Writer, raw bool, pc proto.EngineConfig, sink packetlog.Sink) error {
+	read := replayshim.ReadNDJSON
+	if raw {
+		read = replayshim.ReadCapture
+	}
+	events, err := read(r)
+	if err != nil {
+		return err
+	}
+	players := state.NewPlayerStore()
+	hosts := state.NewHostStore()
+	shim := replayshim.New(events)
+	eng, err := dp8.NewEngine(config.Config{DP8Port: pc.Port, Proto: pc}, "replay", shim, sink, proto.NewEngine(pc, hosts, players), players)
+	if err != nil {
+		return err
+	}
+	n, err := eng.Replay(context.Background())
+	if err != nil {
+		return err
+	}
+	st := eng.Stats()
+	fmt.Fprintf(w, "events=%d players=%d hosts=%d browsers=%d games=%d parsed=%d parse_failed=%d non_xml=%d evicted_dropped=%d\n",
+		n, st.PlayersOnline, st.Hosts, st.Browsers, st.GamesHosted,
+		st.RecvXMLParsed, st.RecvXMLParseFailed, st.RecvNonXML, st.RecvEvictedDropped)
+	for _, dpnid := range players.Connected() {
+		fmt.Fprintf(w, "connected dpnid=0x%08x\n", dpnid)
+	}
+	return nil
+}
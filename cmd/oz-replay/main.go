@@ -0,0 +1,71 @@
+// Command oz-replay re-feeds inbound dp8 records from a captured NDJSON telemetry
+// file through proto.Engine.Handle and prints the outbound tags per record.
+//
+// With -engine the capture instead runs through the full dp8 engine (connect and
+// disconnect events, player/host stores, role caps) on a read-only transport and
+// prints a final summary; -out writes the engine's telemetry, with every
+// response marked reply_mode "replay". -raw reads a raw event capture
+// (telemetry.raw_capture_path) instead, which replays payloads byte for byte.
+//
+// It is read-only and runs offline: no shim, no DirectPlay, no Windows.
+//
+//	oz-replay [-port 2300] [-advertise-ip 203.0.113.1] [-v] telemetry.ndjson
+//	oz-replay -engine [-out replay.ndjson] telemetry.ndjson
+//	oz-replay -raw [-out replay.ndjson] capture.jsonl
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"open-zone/internal/packetlog"
+	"open-zone/internal/proto"
+	"open-zone/internal/state"
+)
+
+func main() {
+	port := flag.Int("port", 2300, "dp8 port the proto engine advertises (ConInfoRes)")
+	advIP := flag.String("advertise-ip", "", "advertised IP (ConInfoRes); defaults like the server")
+	verbose := flag.Bool("v", false, "print full outbound payloads")
+	engine := flag.Bool("engine", false, "replay through the dp8 engine and print a store/stats summary")
+	raw := flag.Bool("raw", false, "input is a raw event capture (implies -engine)")
+	outPath := flag.String("out", "", "with -engine: write engine telemetry NDJSON here")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: oz-replay [flags] telemetry.ndjson")
+		os.Exit(2)
+	}
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "open:", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	pc := proto.EngineConfig{Port: *port, AdvertiseIP: *advIP}
+	if *engine || *raw {
+		var sink packetlog.Sink
+		if *outPath != "" {
+			l, err := packetlog.New(*outPath, packetlog.Options{})
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "open out:", err)
+				os.Exit(1)
+			}
+			defer l.Close()
+			sink = l
+		}
+		if err := replayEngine(f, os.Stdout, *raw, pc, sink); err != nil {
+			fmt.Fprintln(os.Stderr, "replay:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	eng := proto.NewEngine(pc, state.NewHostStore(), state.NewPlayerStore())
+	if err := replay(f, os.Stdout, eng, *verbose); err != nil {
+		fmt.Fprintln(os.Stderr, "replay:", err)
+		os.Exit(1)
+	}
+}
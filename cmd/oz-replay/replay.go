@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"open-zone/internal/dp8shim/replayshim"
+	"open-zone/internal/packetlog"
+	"open-zone/internal/proto"
+)
+
+// step is one replayable inbound record.
+type step struct {
+	Line  int
+	DPNID uint32
+	When  time.Time
+	Msg   proto.Msg
+}
+
+var (
+	dpnidPattern = regexp.MustCompile(`dpnid=0x([0-9a-fA-F]+)`)
+)
+
+// parseStep turns an NDJSON line into a step. ok is false for records that are
+// not inbound dp8 app-protocol messages (events, outbound, other sinks).
+func parseStep(line int, raw []byte) (step, bool, error) {
+	rec, err := packetlog.DecodeRecord(raw)
+	if err != nil {
+		return step{}, false, fmt.Errorf("line %d: %w", line, err)
+	}
+	if rec.Type != "dp8" || rec.Direction != "in" || rec.Tag == "" {
+		return step{}, false, nil
+	}
+	st := step{Line: line, Msg: proto.Msg{Tag: rec.Tag, Attrs: replayshim.ParseAttrs(rec.Message)}}
+	if m := dpnidPattern.FindStringSubmatch(rec.Source); m != nil {
+		if v, err := strconv.ParseUint(m[1], 16, 32); err == nil {
+			st.DPNID = uint32(v)
+		}
+	}
+	if ts, err := time.Parse(time.RFC3339Nano, rec.Timestamp); err == nil {
+		st.When = ts
+	} else {
+		st.When = time.Now().UTC()
+	}
+	return st, true, nil
+}
+
+// replay feeds every inbound record in r to eng in file order and writes one line
+// per record: "line N dpnid=0x... Tag -> OutTag1 OutTag2". verbose adds each
+// outbound payload on its own indented line.
+func replay(r io.Reader, w io.Writer, eng *proto.Engine, verbose bool) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		raw := sc.Bytes()
+		if len(strings.TrimSpace(string(raw))) == 0 {
+			continue
+		}
+		st, ok, err := parseStep(line, raw)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		outs := eng.Handle(st.When, st.DPNID, "", st.Msg)
+		tags := make([]string, 0, len(outs))
+		for _, o := range outs {
+			tags = append(tags, o.Tag)
+		}
+		fmt.Fprintf(w, "line %d dpnid=0x%08x %s -> %s\n", st.Line, st.DPNID, st.Msg.Tag, strings.Join(tags, " "))
+		if verbose {
+			for _, o := range outs {
+				fmt.Fprintf(w, "    %s\n", o.PayloadXML)
+			}
+		}
+	}
+	return sc.Err()
+}
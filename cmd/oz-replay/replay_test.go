@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"open-zone/internal/proto"
+	"open-zone/internal/state"
+)
+
+func TestReplay_ConnectProducesBundle(t *testing.T) {
+	f, err := os.Open("testdata/session.ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	eng := proto.NewEngine(proto.EngineConfig{Port: 2300}, state.NewHostStore(), state.NewPlayerStore())
+	var out bytes.Buffer
+	if err := replay(f, &out, eng, true); err != nil {
+		t.Fatal(err)
+	}
+
+	s := out.String()
+	if !strings.Contains(s, "line 2 dpnid=0x0013a1f2 Connect -> ConnectRes ConInfoRes ConnectEv\n") {
+		t.Fatalf("missing Connect bundle:\n%s", s)
+	}
+	if !strings.Contains(s, `Cx="0x123"`) {
+		t.Fatalf("expected Cx echoed from the logged attrs:\n%s", s)
+	}
+	if !strings.Contains(s, "line 4 dpnid=0x0013a1f2 HdrRow -> HdrRowRes\n") {
+		t.Fatalf("missing HdrRow response:\n%s", s)
+	}
+	// Events, outbound, and non-dp8 records are skipped.
+	for _, skipped := range []string{"line 1 ", "line 3 ", "line 6 "} {
+		if strings.Contains(s, skipped) {
+			t.Fatalf("unexpected replay of %q:\n%s", skipped, s)
+		}
+	}
+}
@@ -690,6 +690,53 @@ int32_t DP8_PopEvent(DP8Event* outEvt, uint8_t* outBuf, uint32_t outCap)
     return 1;
 }
 
+int32_t DP8_GetListenInfo(uint16_t* outPort, char* outAdapter, uint32_t adapterCap)
+{
+    if (!outPort)
+        return (int32_t)E_POINTER;
+    *outPort = 0;
+    if (outAdapter && adapterCap > 0)
+        outAdapter[0] = 0;
+    if (!g_dpServer)
+        return (int32_t)DPNERR_NOTREADY;
+
+    // First call sizes the array (DPNERR_BUFFERTOOSMALL is the expected result).
+    DWORD count = 0;
+    HRESULT hr = g_dpServer->GetLocalHostAddresses(NULL, &count, 0);
+    if (hr != DPNERR_BUFFERTOOSMALL || count == 0)
+        return (int32_t)(FAILED(hr) ? hr : E_FAIL);
+
+    IDirectPlay8Address** addrs = (IDirectPlay8Address**)HeapAlloc(
+        GetProcessHeap(), HEAP_ZERO_MEMORY, count * sizeof(IDirectPlay8Address*));
+    if (!addrs)
+        return (int32_t)E_OUTOFMEMORY;
+
+    hr = g_dpServer->GetLocalHostAddresses(addrs, &count, 0);
+    if (SUCCEEDED(hr) && addrs[0])
+    {
+        DWORD dwPort = 0;
+        DWORD size = sizeof(dwPort);
+        DWORD dataType = 0;
+        hr = addrs[0]->GetComponentByName(DPNA_KEY_PORT, &dwPort, &size, &dataType);
+        if (SUCCEEDED(hr))
+            *outPort = (uint16_t)dwPort;
+
+        GUID dev;
+        if (outAdapter && adapterCap >= 37 && SUCCEEDED(addrs[0]->GetDevice(&dev)))
+        {
+            snprintf(outAdapter, adapterCap, "%08lX-%04X-%04X-%02X%02X-%02X%02X%02X%02X%02X%02X",
+                     dev.Data1, dev.Data2, dev.Data3,
+                     dev.Data4[0], dev.Data4[1], dev.Data4[2], dev.Data4[3],
+                     dev.Data4[4], dev.Data4[5], dev.Data4[6], dev.Data4[7]);
+        }
+    }
+
+    for (DWORD i = 0; i < count; i++)
+        SafeRelease((IUnknown**)&addrs[i]);
+    HeapFree(GetProcessHeap(), 0, addrs);
+    return (int32_t)hr;
+}
+
 uint32_t DP8_GetQueueDepth(void)
 {
     if (!g_qCsInit)
@@ -700,6 +747,15 @@ uint32_t DP8_GetQueueDepth(void)
     return n;
 }
 
+int32_t DP8_DisconnectClient(uint32_t dpnid)
+{
+    if (!g_dpServer)
+        return (int32_t)DPNERR_UNINITIALIZED;
+    HRESULT hr = g_dpServer->DestroyClient((DPNID)dpnid, NULL, 0, 0);
+    logline("DestroyClient dpnid=0x%08lx hr=0x%08lx (%s)\n", (unsigned long)dpnid, (unsigned long)hr, dp8_hr_name(hr));
+    return (int32_t)hr;
+}
+
 int32_t DP8_SendTo(uint32_t dpnid, const uint8_t* buf, uint32_t len, uint32_t flags)
 {
     if (!g_dpServer)
@@ -48,6 +48,18 @@ __declspec(dllexport) int32_t DP8_PopEvent(DP8Event* outEvt, uint8_t* outBuf, ui
 // Returns current queued event count (best-effort).
 __declspec(dllexport) uint32_t DP8_GetQueueDepth(void);
 
+// Report the address the server actually bound (first local host address).
+// outPort: required; receives the bound port.
+// outAdapter/adapterCap: optional; receives the device (adapter) GUID as a
+// NUL-terminated "XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX" string (needs 37 bytes).
+// Returns HRESULT as int32.
+__declspec(dllexport) int32_t DP8_GetListenInfo(uint16_t* outPort, char* outAdapter, uint32_t adapterCap);
+
+// Terminate a connected player's transport session (IDirectPlay8Server::DestroyClient).
+// The player receives DPN_MSGID_TERMINATE_SESSION; the server sees DESTROY_PLAYER.
+// Returns HRESULT as int32.
+__declspec(dllexport) int32_t DP8_DisconnectClient(uint32_t dpnid);
+
 // Send bytes to a connected player.
 // Returns HRESULT as int32.
 __declspec(dllexport) int32_t DP8_SendTo(uint32_t dpnid, const uint8_t* buf, uint32_t len, uint32_t flags);
@@ -0,0 +1,96 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"open-zone/internal/state"
+)
+
+type kickJSON struct {
+	DPNID string `json:"dpnid"`
+	Found bool   `json:"found"`
+	Error string `json:"error,omitempty"`
+}
+
+type removeJSON struct {
+	Rid     string `json:"rid"`
+	Removed bool   `json:"removed"`
+}
+
+type sweeperJSON struct {
+	Paused bool `json:"paused"`
+}
+
+// kickHandler serves POST /admin/kick?dpnid=0x... (hex with 0x, or decimal).
+func kickHandler(kick func(dpnid uint32) (bool, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requirePost(w, r) {
+			return
+		}
+		raw := strings.TrimSpace(r.URL.Query().Get("dpnid"))
+		dpnid, err := strconv.ParseUint(raw, 0, 32)
+		if raw == "" || err != nil {
+			http.Error(w, "invalid dpnid", http.StatusBadRequest)
+			return
+		}
+		found, err := kick(uint32(dpnid))
+		out := kickJSON{DPNID: fmt.Sprintf("0x%08x", dpnid), Found: found}
+		status := http.StatusOK
+		if err != nil {
+			out.Error = err.Error()
+			status = http.StatusInternalServerError
+		}
+		writeJSON(w, status, out)
+	}
+}
+
+// removeGameHandler serves POST /admin/games/remove?rid=N.
+func removeGameHandler(hosts *state.HostStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requirePost(w, r) {
+			return
+		}
+		rid := strings.TrimSpace(r.URL.Query().Get("rid"))
+		if rid == "" {
+			http.Error(w, "missing rid", http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, removeJSON{Rid: rid, Removed: hosts.RemoveByRid(rid)})
+	}
+}
+
+// sweeperHandler serves POST /admin/sweeper?paused=true|false.
+func sweeperHandler(setPaused func(paused bool)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requirePost(w, r) {
+			return
+		}
+		paused, err := strconv.ParseBool(strings.TrimSpace(r.URL.Query().Get("paused")))
+		if err != nil {
+			http.Error(w, "invalid paused", http.StatusBadRequest)
+			return
+		}
+		setPaused(paused)
+		writeJSON(w, http.StatusOK, sweeperJSON{Paused: paused})
+	}
+}
+
+func requirePost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodPost {
+		return true
+	}
+	w.Header().Set("Allow", "POST")
+	http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
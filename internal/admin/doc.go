@@ -0,0 +1,5 @@
+// Package admin serves operator-only HTTP endpoints on a separate listener.
+//
+// Every request must carry "Authorization: Bearer <admin.token>". The game never
+// talks to this server; keep it off the public internet or behind a proxy.
+package admin
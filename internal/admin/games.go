@@ -0,0 +1,51 @@
+package admin
+
+import (
+	"net/http"
+
+	"open-zone/internal/state"
+)
+
+// gameJSON is one GET /admin/games entry. Values are passed through as the host
+// reported them; Items holds every browse column (see state.GameRow).
+type gameJSON struct {
+	Rid        string            `json:"rid"`
+	Name       string            `json:"name"`
+	Map        string            `json:"map"`
+	IP         string            `json:"ip"`
+	IP2        string            `json:"ip2"`
+	Players    string            `json:"players"`
+	MaxPlayers string            `json:"max_players"`
+	Items      map[string]string `json:"items"`
+}
+
+type gamesJSON struct {
+	Count int        `json:"count"`
+	Games []gameJSON `json:"games"`
+}
+
+// gamesHandler serves the visible games in browse order.
+func gamesHandler(hosts *state.HostStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		rows := hosts.GamesRows(0, nil)
+		out := gamesJSON{Count: len(rows), Games: make([]gameJSON, 0, len(rows))}
+		for _, row := range rows {
+			out.Games = append(out.Games, gameJSON{
+				Rid:        row.Rid,
+				Name:       row.Items["GName"],
+				Map:        row.Items["Map"],
+				IP:         row.Items["IpAddr"],
+				IP2:        row.Items["Ip2"],
+				Players:    row.Items["NumP"],
+				MaxPlayers: row.Items["MaxP"],
+				Items:      row.Items,
+			})
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
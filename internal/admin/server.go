@@ -0,0 +1,159 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"embed"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"open-zone/internal/state"
+)
+
+//go:embed templates/status.tmpl
+var templatesFS embed.FS
+
+type Server struct {
+	srv *http.Server
+	ln  net.Listener
+}
+
+// Addr is the address the server listens on (the bound port when started on :0).
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Options configures the admin server.
+type Options struct {
+	// Token is the required bearer token. Start refuses to run without one.
+	Token string
+
+	// Hosts, when set, enables GET /admin/games (visible games as JSON) and
+	// POST /admin/games/remove?rid=N.
+	Hosts *state.HostStore
+
+	// Kick, when set, enables POST /admin/kick?dpnid=0x... (see dp8.Engine.Kick).
+	Kick func(dpnid uint32) (found bool, err error)
+
+	// SetSweeperPaused, when set, enables POST /admin/sweeper?paused=true|false
+	// (see dp8.Engine.SetSweeperPaused) to hold max-age eviction during
+	// maintenance.
+	SetSweeperPaused func(paused bool)
+
+	// ReadOnly leaves the mutating endpoints (kick, game removal, sweeper)
+	// unmounted.
+	ReadOnly bool
+
+	// TLSCert and TLSKey (PEM files, admin.tls_cert and admin.tls_key) serve the
+	// endpoints over HTTPS when both are set. Start fails if they do not load.
+	TLSCert string
+	TLSKey  string
+}
+
+func Start(ctx context.Context, addr string, opts Options, status func() Status) (*Server, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("admin addr is empty")
+	}
+	h, err := newHandler(opts, status)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	useTLS := opts.TLSCert != "" && opts.TLSKey != ""
+	if useTLS {
+		cert, err := tls.LoadX509KeyPair(opts.TLSCert, opts.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("admin tls: %w", err)
+		}
+		s.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	as := &Server{srv: s, ln: ln}
+	go func() {
+		<-ctx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_ = s.Shutdown(ctx)
+	}()
+
+	if useTLS {
+		go func() { _ = s.ServeTLS(ln, "", "") }()
+	} else {
+		go func() { _ = s.Serve(ln) }()
+	}
+	return as, nil
+}
+
+// newHandler builds the authenticated admin mux.
+func newHandler(opts Options, status func() Status) (http.Handler, error) {
+	token := strings.TrimSpace(opts.Token)
+	if token == "" {
+		return nil, fmt.Errorf("admin token is empty")
+	}
+	tmpl, err := template.ParseFS(templatesFS, "templates/status.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("parse admin status template: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var st Status
+		if status != nil {
+			st = status()
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, st); err != nil {
+			http.Error(w, "Status Template Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(buf.Bytes())
+	})
+	if opts.Hosts != nil {
+		mux.HandleFunc("/admin/games", gamesHandler(opts.Hosts))
+		if !opts.ReadOnly {
+			mux.HandleFunc("/admin/games/remove", removeGameHandler(opts.Hosts))
+		}
+	}
+	if opts.Kick != nil && !opts.ReadOnly {
+		mux.HandleFunc("/admin/kick", kickHandler(opts.Kick))
+	}
+	if opts.SetSweeperPaused != nil && !opts.ReadOnly {
+		mux.HandleFunc("/admin/sweeper", sweeperHandler(opts.SetSweeperPaused))
+	}
+	return requireToken(token, mux), nil
+}
+
+// requireToken rejects requests without "Authorization: Bearer <token>".
+func requireToken(token string, next http.Handler) http.Handler {
+	want := []byte(token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(got)), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="open-zone admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,339 @@
+package admin
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"open-zone/internal/dp8"
+	"open-zone/internal/state"
+)
+
+const testToken = "s3cret"
+
+func newTestHandler(t *testing.T, status func() Status) http.Handler {
+	t.Helper()
+	h, err := newHandler(Options{Token: testToken}, status)
+	if err != nil {
+		t.Fatalf("newHandler: %v", err)
+	}
+	return h
+}
+
+func get(h http.Handler, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestStatus_RequiresToken(t *testing.T) {
+	h := newTestHandler(t, nil)
+	for _, tok := range []string{"", "wrong"} {
+		if rec := get(h, "/admin/status", tok); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("token %q: status=%d want 401", tok, rec.Code)
+		}
+	}
+	if _, err := newHandler(Options{Token: " "}, nil); err == nil {
+		t.Fatalf("expected error for empty token")
+	}
+}
+
+func TestStatus_RendersSections(t *testing.T) {
+	h := newTestHandler(t, func() Status {
+		return Status{
+			Version: "1.2.3",
+			Uptime:  90 * time.Minute,
+			Engine: dp8.Stats{
+				PlayersOnline:  5,
+				GamesHosted:    1,
+				Hosts:          1,
+				Browsers:       4,
+				SendQueueDepth: 7,
+				SendDropped:    3,
+				RecvThrottled:  11,
+				ProtoTags:      map[string]uint64{"Connect": 5, "fallback": 1},
+				TopTalkers:     []dp8.Talker{{DPNID: 0xabc, Msgs: 90, Rate: 1.5}},
+			},
+			Games: []state.GameRow{{Rid: "1", Items: map[string]string{
+				"GName": "<Friday Night>", "Map": "Alps", "NumP": "2", "MaxP": "8", "IpAddr": "203.0.113.5",
+			}}},
+			TelemetryDropped: 2,
+		}
+	})
+
+	rec := get(h, "/admin/status", testToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%q", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"open-zone 1.2.3", "uptime 1h30m0s",
+		"<h2>Players</h2>", "<tr><td>Hosts</td><td>1</td></tr>", "<tr><td>Browsers</td><td>4</td></tr>",
+		"<h2>Queues</h2>", "<tr><td>Send queue depth</td><td>7</td></tr>",
+		"<h2>Drops</h2>", "<tr><td>Send queue full</td><td>3</td></tr>", "<tr><td>Rate limited</td><td>11</td></tr>",
+		"<tr><td>Telemetry</td><td>2</td></tr>",
+		"<h2>Top talkers (last minute)</h2>", "<tr><td>0x00000abc</td><td>90</td><td>1.50</td></tr>",
+		"<h2>Messages</h2>", "<tr><td>Connect</td><td>5</td></tr>", "<tr><td>fallback</td><td>1</td></tr>",
+		"<h2>Games (1)</h2>", "&lt;Friday Night&gt;", "Alps", "2/8", "203.0.113.5",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("missing %q in:\n%s", want, body)
+		}
+	}
+}
+
+func TestGames_ListsVisibleGamesAsJSON(t *testing.T) {
+	hosts := state.NewHostStore()
+	hosts.ApplyHostData(0x1, `<HostData><New><Item ItemId="0" GName="Arena" Map="Tundra" NumP="3" MaxP="8" IpAddr="203.0.113.5" /></New></HostData>`)
+	h, err := newHandler(Options{Token: testToken, Hosts: hosts}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := get(h, "/admin/games", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthorized status=%d want 401", rec.Code)
+	}
+
+	rec := get(h, "/admin/games", testToken)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("status=%d content-type=%q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var got gamesJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v\n%s", err, rec.Body.String())
+	}
+	if got.Count != 1 || len(got.Games) != 1 {
+		t.Fatalf("games=%+v", got)
+	}
+	g := got.Games[0]
+	if g.Rid != "1" || g.Name != "Arena" || g.Map != "Tundra" || g.Players != "3" || g.MaxPlayers != "8" || g.IP != "203.0.113.5" {
+		t.Fatalf("game=%+v", g)
+	}
+}
+
+func post(h http.Handler, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestKick_ReportsWhetherPlayerExisted(t *testing.T) {
+	var kicked []uint32
+	h, err := newHandler(Options{Token: testToken, Kick: func(dpnid uint32) (bool, error) {
+		kicked = append(kicked, dpnid)
+		return dpnid == 0x0013a1f2, nil
+	}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := post(h, "/admin/kick?dpnid=0x0013a1f2", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthorized status=%d", rec.Code)
+	}
+	if rec := get(h, "/admin/kick?dpnid=0x1", testToken); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET status=%d want 405", rec.Code)
+	}
+	if rec := post(h, "/admin/kick?dpnid=nope", testToken); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad dpnid status=%d want 400", rec.Code)
+	}
+
+	for _, tc := range []struct {
+		q     string
+		found bool
+	}{
+		{"0x0013a1f2", true},
+		{"99", false},
+	} {
+		rec := post(h, "/admin/kick?dpnid="+tc.q, testToken)
+		var got kickJSON
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("%s: status=%d body=%s err=%v", tc.q, rec.Code, rec.Body.String(), err)
+		}
+		if got.Found != tc.found {
+			t.Fatalf("%s: found=%v want %v", tc.q, got.Found, tc.found)
+		}
+	}
+	if len(kicked) != 2 || kicked[1] != 99 {
+		t.Fatalf("kick calls=%v", kicked)
+	}
+}
+
+func TestSweeper_TogglesPauseOnlyWithActions(t *testing.T) {
+	var calls []bool
+	opts := Options{Token: testToken, SetSweeperPaused: func(paused bool) { calls = append(calls, paused) }}
+	h, err := newHandler(opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := post(h, "/admin/sweeper?paused=true", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthorized status=%d", rec.Code)
+	}
+	if rec := get(h, "/admin/sweeper?paused=true", testToken); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET status=%d want 405", rec.Code)
+	}
+	if rec := post(h, "/admin/sweeper?paused=maybe", testToken); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad paused status=%d want 400", rec.Code)
+	}
+	for _, want := range []bool{true, false} {
+		rec := post(h, "/admin/sweeper?paused="+strconv.FormatBool(want), testToken)
+		var got sweeperJSON
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%s err=%v", rec.Code, rec.Body.String(), err)
+		}
+		if got.Paused != want {
+			t.Fatalf("paused=%v want %v", got.Paused, want)
+		}
+	}
+	if len(calls) != 2 || !calls[0] || calls[1] {
+		t.Fatalf("SetSweeperPaused calls=%v want [true false]", calls)
+	}
+
+	// Without admin_actions the endpoint is not mounted.
+	opts.ReadOnly = true
+	ro, err := newHandler(opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := post(ro, "/admin/sweeper?paused=true", testToken); rec.Code != http.StatusNotFound {
+		t.Fatalf("read-only status=%d want 404", rec.Code)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("read-only handler paused the sweeper: %v", calls)
+	}
+}
+
+func TestRemoveGame_ReportsWhetherGameExisted(t *testing.T) {
+	hosts := state.NewHostStore()
+	hosts.ApplyHostData(0x1, `<HostData><New><Item ItemId="0" GName="Arena" /></New></HostData>`)
+	h, err := newHandler(Options{Token: testToken, Hosts: hosts}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := post(h, "/admin/games/remove?rid=1", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthorized status=%d", rec.Code)
+	}
+	for _, want := range []bool{true, false} {
+		rec := post(h, "/admin/games/remove?rid=1", testToken)
+		var got removeJSON
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%s err=%v", rec.Code, rec.Body.String(), err)
+		}
+		if got.Rid != "1" || got.Removed != want {
+			t.Fatalf("got %+v, want removed=%v", got, want)
+		}
+	}
+	if n := hosts.VisibleGamesCount(); n != 0 {
+		t.Fatalf("visible games=%d after remove", n)
+	}
+}
+
+// writeSelfSignedCert writes a PEM certificate and key for 127.0.0.1 and returns
+// their paths and a pool trusting the certificate.
+func writeSelfSignedCert(t *testing.T) (certPath, keyPath string, pool *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "open-zone test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certPath, keyPath = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool = x509.NewCertPool()
+	pool.AddCert(cert)
+	return certPath, keyPath, pool
+}
+
+func TestStart_TLSServesStatusOverHTTPS(t *testing.T) {
+	certPath, keyPath, pool := writeSelfSignedCert(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, err := Start(ctx, "127.0.0.1:0", Options{Token: testToken, TLSCert: certPath, TLSKey: keyPath}, func() Status {
+		return Status{Version: "9.9.9"}
+	})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	req, err := http.NewRequest(http.MethodGet, "https://"+s.Addr()+"/admin/status", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("GET over https: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.TLS == nil || !strings.Contains(string(body), "9.9.9") {
+		t.Fatalf("status=%d tls=%v body=%s", resp.StatusCode, resp.TLS != nil, body)
+	}
+
+	// Plain HTTP to the TLS port is refused.
+	if resp, err := client.Get("http://" + s.Addr() + "/admin/status"); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Fatal("plain HTTP served the status page")
+		}
+	}
+
+	// A key that does not load fails Start instead of serving without TLS.
+	if _, err := Start(ctx, "127.0.0.1:0", Options{Token: testToken, TLSCert: certPath, TLSKey: certPath}, nil); err == nil {
+		t.Fatal("Start accepted a bad key")
+	}
+}
@@ -0,0 +1,21 @@
+package admin
+
+import (
+	"time"
+
+	"open-zone/internal/dp8"
+	"open-zone/internal/state"
+)
+
+// Status is the template model for GET /admin/status.
+type Status struct {
+	Version    string
+	ServerTime string
+	Uptime     time.Duration
+
+	Engine dp8.Stats
+	Games  []state.GameRow
+
+	// TelemetryDropped counts NDJSON records dropped by the async logger.
+	TelemetryDropped uint64
+}
@@ -2,5 +2,14 @@
 //
 // The implementation intentionally accepts connections and closes them quickly.
 // It exists to keep the client moving through UI flows that expect an update
-// endpoint to be reachable.
+// endpoint to be reachable; SinkOptions.Hold makes it read the client's first
+// bytes before closing. StartHTTPSink is the alternative for clients that
+// wait for an HTTP answer: it serves a static "no update available" response.
+//
+// Behind a TCP load balancer the peer address is the balancer's.
+// SinkOptions.ProxyProtocol reads the PROXY protocol v1 header the balancer
+// prepends and logs the client address from it. Other raw-TCP listeners can
+// do the same: call readProxyV1 before touching the connection's bytes and
+// use its address wherever RemoteAddr would go. (DP8 runs over UDP in the
+// shim, so the engine cannot use this.)
 package autoupdate
@@ -0,0 +1,96 @@
+package autoupdate
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"open-zone/internal/packetlog"
+	"open-zone/internal/proto"
+)
+
+// Manifest is the static "no update available" answer served by StartHTTPSink.
+type Manifest struct {
+	Status      int
+	Body        string
+	ContentType string
+}
+
+// DefaultManifest answers 200 with a short plain-text body.
+func DefaultManifest() Manifest {
+	return Manifest{Status: http.StatusOK, Body: "no update available\r\n", ContentType: "text/plain"}
+}
+
+// StartHTTPSink serves manifest to every request. Some clients issue an HTTP
+// request for a version manifest and hang until a body arrives, which the
+// accept+close StartSink can't satisfy. GET is the documented probe; POST (the
+// updateserver.dll?checkclient form) and HEAD get the same answer.
+func StartHTTPSink(ctx context.Context, addr string, manifest Manifest, runID string, log packetlog.Sink) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if log != nil {
+		log.Log(packetlog.Record{
+			RunID:      runID,
+			Timestamp:  proto.NowTS(),
+			Type:       "startup",
+			Experiment: "autoupdate-http",
+			Message:    fmt.Sprintf("listening addr=%s status=%d", addr, manifest.Status),
+		})
+	}
+
+	s := &http.Server{
+		Handler:           manifestHandler(manifest, runID, log),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	s.SetKeepAlivesEnabled(false)
+
+	go func() {
+		<-ctx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_ = s.Shutdown(ctx)
+	}()
+
+	go func() { _ = s.Serve(ln) }()
+	return nil
+}
+
+func manifestHandler(m Manifest, runID string, log packetlog.Sink) http.Handler {
+	if m.Status == 0 {
+		m.Status = http.StatusOK
+	}
+	if m.ContentType == "" {
+		m.ContentType = "text/plain"
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if log != nil {
+			log.Log(packetlog.Record{
+				RunID:      runID,
+				Timestamp:  proto.NowTS(),
+				Type:       "autoupdate",
+				Direction:  "in",
+				Source:     r.RemoteAddr,
+				Experiment: "autoupdate-http",
+				Message:    fmt.Sprintf("%s %s", r.Method, r.URL.RequestURI()),
+			})
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodPost:
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", m.ContentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(m.Body)))
+		w.WriteHeader(m.Status)
+		if r.Method != http.MethodHead {
+			_, _ = w.Write([]byte(m.Body))
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package autoupdate
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestManifestHandler_ServesConfiguredResponse(t *testing.T) {
+	// Default manifest on GET.
+	def := httptest.NewServer(manifestHandler(DefaultManifest(), "run-test", nil))
+	defer def.Close()
+	resp, err := http.Get(def.URL + "/us/updateserver.dll?checkclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "no update available\r\n" {
+		t.Fatalf("status=%d body=%q", resp.StatusCode, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/plain" {
+		t.Fatalf("Content-Type=%q", ct)
+	}
+
+	// Custom status/body, and POST gets the same answer.
+	custom := httptest.NewServer(manifestHandler(Manifest{Status: http.StatusNotFound, Body: "none"}, "run-test", nil))
+	defer custom.Close()
+	resp, err = http.Post(custom.URL+"/us/updateserver.dll?enumpackages&ver=3", "application/octet-stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound || string(body) != "none" {
+		t.Fatalf("status=%d body=%q", resp.StatusCode, body)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, custom.URL+"/", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("DELETE status=%d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,61 @@
+package autoupdate
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// proxyV1MaxLen is the longest PROXY protocol v1 header, CRLF included.
+const proxyV1MaxLen = 107
+
+var errProxyHeader = errors.New("invalid PROXY v1 header")
+
+// readProxyV1 reads one PROXY protocol v1 header line from c, a byte at a time
+// so nothing after the CRLF is consumed. It returns the client address
+// ("ip:port"), or "" for "PROXY UNKNOWN" (the balancer's own health checks).
+func readProxyV1(c net.Conn) (string, error) {
+	line := make([]byte, 0, proxyV1MaxLen)
+	b := make([]byte, 1)
+	for len(line) < proxyV1MaxLen {
+		if _, err := c.Read(b); err != nil {
+			return "", fmt.Errorf("%w: %v", errProxyHeader, err)
+		}
+		line = append(line, b[0])
+		if b[0] == '\n' {
+			return parseProxyV1(string(line))
+		}
+	}
+	return "", fmt.Errorf("%w: no CRLF in %d bytes", errProxyHeader, proxyV1MaxLen)
+}
+
+// parseProxyV1 parses "PROXY TCP4|TCP6 src dst sport dport\r\n" and returns
+// "src:sport". "PROXY UNKNOWN ..." returns "".
+func parseProxyV1(line string) (string, error) {
+	body, ok := strings.CutSuffix(line, "\r\n")
+	if !ok {
+		return "", fmt.Errorf("%w: missing CRLF", errProxyHeader)
+	}
+	f := strings.Split(body, " ")
+	if len(f) < 2 || f[0] != "PROXY" {
+		return "", fmt.Errorf("%w: missing PROXY prefix", errProxyHeader)
+	}
+	if f[1] == "UNKNOWN" {
+		return "", nil
+	}
+	if len(f) != 6 || (f[1] != "TCP4" && f[1] != "TCP6") {
+		return "", fmt.Errorf("%w: %q", errProxyHeader, body)
+	}
+	src := net.ParseIP(f[2])
+	if src == nil || net.ParseIP(f[3]) == nil || (src.To4() != nil) != (f[1] == "TCP4") {
+		return "", fmt.Errorf("%w: bad address in %q", errProxyHeader, body)
+	}
+	for _, p := range f[4:] {
+		if n, err := strconv.Atoi(p); err != nil || n < 0 || n > 65535 {
+			return "", fmt.Errorf("%w: bad port in %q", errProxyHeader, body)
+		}
+	}
+	return net.JoinHostPort(f[2], f[4]), nil
+}
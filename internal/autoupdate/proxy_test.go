@@ -0,0 +1,30 @@
+package autoupdate
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseProxyV1(t *testing.T) {
+	for _, tc := range []struct {
+		line, want string
+		ok         bool
+	}{
+		{"PROXY TCP4 198.51.100.7 192.0.2.1 40001 80\r\n", "198.51.100.7:40001", true},
+		{"PROXY TCP6 2001:db8::7 2001:db8::1 40001 80\r\n", "[2001:db8::7]:40001", true},
+		{"PROXY UNKNOWN\r\n", "", true},
+		{"PROXY TCP4 198.51.100.7 192.0.2.1 40001 80\n", "", false},
+		{"PROXY TCP4 2001:db8::7 192.0.2.1 40001 80\r\n", "", false},
+		{"PROXY TCP4 198.51.100.7 192.0.2.1 70000 80\r\n", "", false},
+		{"PROXY TCP4 198.51.100.7 40001 80\r\n", "", false},
+		{"GET / HTTP/1.0\r\n", "", false},
+	} {
+		got, err := parseProxyV1(tc.line)
+		if tc.ok != (err == nil) || got != tc.want {
+			t.Fatalf("parseProxyV1(%q)=%q, %v", tc.line, got, err)
+		}
+		if err != nil && !errors.Is(err, errProxyHeader) {
+			t.Fatalf("parseProxyV1(%q) err=%v not errProxyHeader", tc.line, err)
+		}
+	}
+}
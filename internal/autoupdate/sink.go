@@ -10,9 +10,32 @@ import (
 	"open-zone/internal/proto"
 )
 
+// sinkDrainMax caps how many bytes a held connection reads before it is closed.
+const sinkDrainMax = 512
+
+// proxyHeaderTimeout bounds the wait for a PROXY header when Hold is shorter.
+const proxyHeaderTimeout = time.Second
+
+// SinkOptions controls optional StartSink behavior. The zero value accepts and
+// closes without reading.
+type SinkOptions struct {
+	// Hold keeps each connection open this long (autoupdate.hold_ms), then reads
+	// whatever the client has sent (at most sinkDrainMax bytes) and closes it.
+	// Some clients log an error if the server closes before reading their
+	// request. A timer does the waiting, so held connections cost no goroutine.
+	// <= 0 closes immediately.
+	Hold time.Duration
+
+	// ProxyProtocol expects every connection to start with a PROXY protocol v1
+	// header from a TCP load balancer (autoupdate.proxy_protocol) and logs the
+	// client address it carries instead of the balancer's. A connection with a
+	// missing or malformed header is logged and closed.
+	ProxyProtocol bool
+}
+
 // StartSink starts a best-effort TCP listener that accepts and immediately closes connections.
 // This prevents long UI timeouts if the client attempts to contact an AutoUpdate endpoint.
-func StartSink(ctx context.Context, addr string, runID string, log *packetlog.Logger) error {
+func StartSink(ctx context.Context, addr string, opts SinkOptions, runID string, log packetlog.Sink) error {
 	ln, err := net.Listen("tcp", addr)
 	if err != nil {
 		return err
@@ -23,10 +46,16 @@ func StartSink(ctx context.Context, addr string, runID string, log *packetlog.Lo
 			Timestamp:  proto.NowTS(),
 			Type:       "startup",
 			Experiment: "autoupdate-sink",
-			Message:    fmt.Sprintf("listening addr=%s", addr),
+			Message:    fmt.Sprintf("listening addr=%s hold=%s", addr, opts.Hold),
 		})
 	}
 
+	serveSink(ctx, ln, opts, runID, log)
+	return nil
+}
+
+// serveSink accepts on ln until ctx ends, handling each connection per opts.
+func serveSink(ctx context.Context, ln net.Listener, opts SinkOptions, runID string, log packetlog.Sink) {
 	go func() {
 		<-ctx.Done()
 		_ = ln.Close()
@@ -38,21 +67,74 @@ func StartSink(ctx context.Context, addr string, runID string, log *packetlog.Lo
 			if err != nil {
 				return
 			}
-			// Close immediately; do not read/write any bytes.
-			_ = c.SetDeadline(time.Now().Add(10 * time.Millisecond))
-			_ = c.Close()
-			if log != nil {
-				log.Log(packetlog.Record{
-					RunID:      runID,
-					Timestamp:  proto.NowTS(),
-					Type:       "autoupdate",
-					Direction:  "in",
-					Experiment: "autoupdate-sink",
-					Message:    "accept+close",
-				})
+			if opts.ProxyProtocol {
+				go sinkProxy(c, opts.Hold, runID, log)
+				continue
+			}
+			if opts.Hold <= 0 {
+				sinkClose(c, c.RemoteAddr().String(), runID, log)
+				continue
 			}
+			sinkHold(c, c.RemoteAddr().String(), opts.Hold, runID, log)
 		}
 	}()
+}
 
-	return nil
+// sinkClose closes c without reading or writing any bytes.
+func sinkClose(c net.Conn, remote, runID string, log packetlog.Sink) {
+	_ = c.SetDeadline(time.Now().Add(10 * time.Millisecond))
+	_ = c.Close()
+	logSinkConn(log, runID, remote, "accept+close")
+}
+
+// sinkProxy reads c's PROXY v1 header, then closes or holds c as usual, logging
+// the client address from the header. UNKNOWN headers keep the peer address.
+// A bad header is logged as a fixed class: the parse error quotes the header,
+// whose addresses and free text would bypass telemetry.redact_ips.
+func sinkProxy(c net.Conn, hold time.Duration, runID string, log packetlog.Sink) {
+	_ = c.SetReadDeadline(time.Now().Add(max(hold, proxyHeaderTimeout)))
+	remote, err := readProxyV1(c)
+	if err != nil {
+		_ = c.Close()
+		logSinkConn(log, runID, c.RemoteAddr().String(), "accept+close bad-proxy-header")
+		return
+	}
+	if remote == "" {
+		remote = c.RemoteAddr().String()
+	}
+	if hold <= 0 {
+		sinkClose(c, remote, runID, log)
+		return
+	}
+	sinkHold(c, remote, hold, runID, log)
+}
+
+// sinkHold closes c after hold, first reading what the client sent so the close
+// does not reset the connection over unread bytes.
+func sinkHold(c net.Conn, remote string, hold time.Duration, runID string, log packetlog.Sink) {
+	start := time.Now()
+	time.AfterFunc(hold, func() {
+		_ = c.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+		n, _ := c.Read(make([]byte, sinkDrainMax))
+		held := time.Since(start)
+		_ = c.Close()
+		logSinkConn(log, runID, remote, fmt.Sprintf("accept+hold+close read=%d held_ms=%d", n, held.Milliseconds()))
+	})
+}
+
+// logSinkConn writes one "autoupdate" record. The remote goes in Source so the
+// telemetry Redactor (telemetry.redact_ips) masks it like the dp8 engine's.
+func logSinkConn(log packetlog.Sink, runID, remote, msg string) {
+	if log == nil {
+		return
+	}
+	log.Log(packetlog.Record{
+		RunID:      runID,
+		Timestamp:  proto.NowTS(),
+		Type:       "autoupdate",
+		Direction:  "in",
+		Source:     remote,
+		Experiment: "autoupdate-sink",
+		Message:    msg,
+	})
 }
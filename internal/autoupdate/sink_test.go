@@ -0,0 +1,132 @@
+package autoupdate
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"open-zone/internal/packetlog"
+)
+
+type chanSink struct{ recs chan packetlog.Record }
+
+func (s *chanSink) Log(rec packetlog.Record) { s.recs <- rec }
+
+func (s *chanSink) Close() error { return nil }
+
+func startTestSink(t *testing.T, opts SinkOptions) (string, *chanSink) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	sink := &chanSink{recs: make(chan packetlog.Record, 4)}
+	serveSink(ctx, ln, opts, "run-test", sink)
+	return ln.Addr().String(), sink
+}
+
+func nextRecord(t *testing.T, s *chanSink) packetlog.Record {
+	t.Helper()
+	select {
+	case rec := <-s.recs:
+		return rec
+	case <-time.After(2 * time.Second):
+		t.Fatal("no autoupdate record")
+		return packetlog.Record{}
+	}
+}
+
+func TestSink_HoldReadsRequestBeforeClosing(t *testing.T) {
+	addr, sink := startTestSink(t, SinkOptions{Hold: time.Second})
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// The sink must still be open after a short pause, then close at the end of
+	// the hold having read the request.
+	time.Sleep(50 * time.Millisecond)
+	if _, err := c.Write([]byte("GET / HTTP/1.0\r\n\r\n")); err != nil {
+		t.Fatalf("write while held: %v", err)
+	}
+	_ = c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read after request err=%v want EOF", err)
+	}
+
+	rec := nextRecord(t, sink)
+	if !strings.HasPrefix(rec.Message, "accept+hold+close read=18 ") {
+		t.Fatalf("message=%q", rec.Message)
+	}
+	if rec.Source != c.LocalAddr().String() {
+		t.Fatalf("source=%q want %q", rec.Source, c.LocalAddr())
+	}
+}
+
+func TestSink_HoldExpiresWithoutData(t *testing.T) {
+	addr, sink := startTestSink(t, SinkOptions{Hold: 50 * time.Millisecond})
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	start := time.Now()
+	_ = c.SetReadDeadline(start.Add(2 * time.Second))
+	if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read err=%v want EOF", err)
+	}
+	if held := time.Since(start); held < 40*time.Millisecond {
+		t.Fatalf("closed after %s, want the ~50ms hold", held)
+	}
+	if rec := nextRecord(t, sink); !strings.HasPrefix(rec.Message, "accept+hold+close read=0 ") {
+		t.Fatalf("message=%q", rec.Message)
+	}
+}
+
+func TestSink_NoHoldClosesImmediately(t *testing.T) {
+	addr, sink := startTestSink(t, SinkOptions{})
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if rec := nextRecord(t, sink); rec.Message != "accept+close" {
+		t.Fatalf("message=%q", rec.Message)
+	}
+}
+
+func TestSink_ProxyProtocolLogsClientAddress(t *testing.T) {
+	addr, sink := startTestSink(t, SinkOptions{ProxyProtocol: true})
+	for _, tc := range []struct {
+		header, source, message string
+	}{
+		{"PROXY TCP4 198.51.100.7 192.0.2.1 40001 80\r\n", "198.51.100.7:40001", "accept+close"},
+		{"GET / HTTP/1.0\r\n", "", "accept+close bad-proxy-header"},
+		// The rejected header (and its addresses) never reaches the message.
+		{"PROXY TCP4 198.51.100.7 192.0.2.1 40001 99999\r\n", "", "accept+close bad-proxy-header"},
+	} {
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Write([]byte(tc.header)); err != nil {
+			t.Fatal(err)
+		}
+		rec := nextRecord(t, sink)
+		c.Close()
+		want := tc.source
+		if want == "" {
+			want = c.LocalAddr().String()
+		}
+		if rec.Source != want || rec.Message != tc.message {
+			t.Fatalf("%q: source=%q message=%q, want %q %q", tc.header, rec.Source, rec.Message, want, tc.message)
+		}
+	}
+}
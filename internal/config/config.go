@@ -2,17 +2,27 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 
+	"open-zone/internal/autoupdate"
+	"open-zone/internal/news"
+	"open-zone/internal/packetlog"
 	"open-zone/internal/proto"
+	"open-zone/internal/state"
 )
 
 const (
 	defaultConfigName = "config"
+
+	AutoModeTCP  = "tcp"
+	AutoModeHTTP = "http"
 )
 
 type Config struct {
@@ -20,15 +30,95 @@ type Config struct {
 	NewsPort int
 	AutoPort int
 
+	// AutoMode is AutoModeTCP (accept+close) or AutoModeHTTP (serve AutoManifest).
+	AutoMode     string
+	AutoManifest autoupdate.Manifest
+	AutoSink     autoupdate.SinkOptions
+
+	// AdminPort serves the operator endpoints (/admin/...) when > 0; AdminToken is
+	// the required bearer token.
+	AdminPort  int
+	AdminToken string
+
+	// AdminTLSCert/AdminTLSKey serve the admin endpoints over HTTPS when both are
+	// set, independently of the News listener.
+	AdminTLSCert string
+	AdminTLSKey  string
+
 	ServerCreatedBy string
 	ServerVersion   string
 	ServerTagline   string
 
 	ShimPath string
 
+	// MaxHostsPerIP/MaxBrowsersPerIP cap sessions per remote IP by role. 0 means
+	// no limit for that role.
+	MaxHostsPerIP    int
+	MaxBrowsersPerIP int
+
+	// ClientMsgsPerSec/ClientBurst rate-limit inbound requests per DPNID (token bucket).
+	// ClientMsgsPerSec <= 0 disables limiting.
+	ClientMsgsPerSec float64
+	ClientBurst      int
+
+	// TopTalkers is how many of the busiest clients (inbound messages in the last
+	// minute) the stats report; 0 turns per-client counting off.
+	TopTalkers int
+
+	// SendBatchSize is how many queued messages the send worker sends per wake
+	// before its single pacing delay.
+	SendBatchSize int
+
+	// PollMin/PollMax bound the engine's idle event poll: the sleep starts at
+	// PollMin after an event and doubles toward PollMax while the shim is quiet.
+	PollMin time.Duration
+	PollMax time.Duration
+
+	// ShimQueueWarn logs a warning when the shim's pending event count exceeds it
+	// (sampled every few seconds). 0 disables the check.
+	ShimQueueWarn int
+
+	// HandlerTimeout logs a warning when handling one message takes longer (it is
+	// not cancelled; see dp8.Engine.handleTimed). 0 disables the check.
+	HandlerTimeout time.Duration
+
+	// Features are the named optional behaviors from the `features` section.
+	Features Features
+
+	// PlayerSweepPaused starts with max-age player eviction paused.
+	PlayerSweepPaused bool
+
+	// EvictedRetention is how long an evicted player stays in the PlayerStore
+	// before the sweeper purges it. 0 keeps evicted entries until disconnect.
+	EvictedRetention time.Duration
+
+	// SnapshotPath is where HostStore state (the rid counter) is saved and
+	// restored across restarts. Empty disables it.
+	SnapshotPath string
+
+	// PlayerSnapshotPath is where PlayerStore sessions (connect and eviction
+	// times) are saved and restored across restarts. Empty disables it.
+	PlayerSnapshotPath string
+
+	// SeedPath lists the synthetic games in this JSON file at startup, for demos
+	// and UI testing (see state.HostStore.LoadSeed). Empty disables.
+	SeedPath string
+
 	// DP8LogPath enables NDJSON telemetry when set. Leave empty to disable file logging.
 	DP8LogPath string
+	DP8Log     packetlog.Options
+
+	// RawCapturePath records every inbound DP8 event with its raw payload for
+	// exact replay (oz-replay -raw). Empty disables. Contains user data.
+	RawCapturePath string
+
+	// RawPayloadPath logs every complete inbound and outbound payload as NDJSON,
+	// which then stay out of the main telemetry log. Empty disables. Contains
+	// user data.
+	RawPayloadPath string
 
+	News  news.Options
+	Host  state.HostConfig
 	Proto proto.EngineConfig
 }
 
@@ -50,15 +140,88 @@ func Load() (Config, error) {
 	v.SetDefault("dp8.port", 2300)
 	v.SetDefault("dp8.advertise_ip", "")
 	v.SetDefault("dp8.advertise_port", 0)
+	v.SetDefault("dp8.send_batch_size", 1)
+	v.SetDefault("dp8.poll_min", "1ms")
+	v.SetDefault("dp8.poll_max", "20ms")
+	v.SetDefault("dp8.shim_queue_warn", 1000)
+	v.SetDefault("dp8.handler_timeout", "1s")
+	v.SetDefault("proto.con_info_ip", "")
+	v.SetDefault("proto.max_page_rows", proto.DefaultMaxPageRows)
+	v.SetDefault("proto.page_version", false)
+	v.SetDefault("proto.strict_parse", false)
+	v.SetDefault("proto.max_attrs", 0)
+	v.SetDefault("proto.max_attr_len", 0)
+	v.SetDefault("proto.framing", proto.FramingNUL)
+	v.SetDefault("players.sweep_paused", false)
+	v.SetDefault("players.evicted_retention", "24h")
+	v.SetDefault("players.snapshot_path", "")
+	v.SetDefault("state.rid_base", 1)
+	v.SetDefault("state.snapshot_path", "")
+	v.SetDefault("state.seed_path", "")
+	v.SetDefault("state.trust_observed_ip", true)
+	v.SetDefault("state.region_map", []string{})
+	v.SetDefault("limits.max_hosts_per_ip", 1)
+	v.SetDefault("limits.max_browsers_per_ip", 0)
+	v.SetDefault("limits.client_msgs_per_sec", 0)
+	v.SetDefault("limits.client_burst", 50)
+	v.SetDefault("limits.top_talkers", 5)
 	v.SetDefault("news.port", 2301)
+	v.SetDefault("news.template_path", "")
+	v.SetDefault("news.legacy_format", false)
+	v.SetDefault("news.cache_ttl", "5s")
+	v.SetDefault("news.real_ip_header", "X-Forwarded-For")
+	v.SetDefault("news.trusted_proxies", []string{})
+	v.SetDefault("news.show_active_games", false)
+	v.SetDefault("news.popular_maps", 0)
+	v.SetDefault("news.line_ending", news.LineEndingCRLF)
+	v.SetDefault("news.allow_gzip_text", false)
+	v.SetDefault("news.time_format", "")
+	v.SetDefault("news.time_zone", "")
+	v.SetDefault("news.tls_cert", "")
+	v.SetDefault("news.tls_key", "")
+	v.SetDefault("browse.sort", state.SortDPNID)
+	v.SetDefault("host.allowed_gamev", []string{})
+	v.SetDefault("browse.allow_private_ips", false)
+	v.SetDefault("browse.stale_factor", 3)
+	v.SetDefault("browse.stale_min", "30s")
+	v.SetDefault("browse.active_window", "10m")
+	qw := state.DefaultQualityWeights()
+	v.SetDefault("browse.quality.has_players", qw.HasPlayers)
+	v.SetDefault("browse.quality.not_full", qw.NotFull)
+	v.SetDefault("browse.quality.recent", qw.Recent)
+	v.SetDefault("browse.quality.no_password", qw.NoPassword)
+	v.SetDefault("browse.quality.recent_window", qw.RecentWindow.String())
 	v.SetDefault("autoupdate.port", 80)
+	v.SetDefault("autoupdate.mode", AutoModeTCP)
+	v.SetDefault("autoupdate.hold_ms", 0)
+	v.SetDefault("autoupdate.proxy_protocol", false)
+	dm := autoupdate.DefaultManifest()
+	v.SetDefault("autoupdate.http_status", dm.Status)
+	v.SetDefault("autoupdate.http_body", dm.Body)
+	v.SetDefault("autoupdate.http_content_type", dm.ContentType)
+	v.SetDefault("admin.port", 0)
+	v.SetDefault("admin.token", "")
+	v.SetDefault("admin.tls_cert", "")
+	v.SetDefault("admin.tls_key", "")
 	v.SetDefault("shim.path", "bin\\dp8shim.dll")
 
 	v.SetDefault("server.created_by", "")
 	v.SetDefault("server.version", "0.1.0")
 	v.SetDefault("server.tagline", "Open ZoneMatch server")
+	v.SetDefault("server.motd", "")
+	v.SetDefault("server.max_players", 0)
+	v.SetDefault("server.reject_when_full", false)
 
 	v.SetDefault("telemetry.dp8_ndjson_path", "")
+	v.SetDefault("telemetry.max_bytes", 0)
+	v.SetDefault("telemetry.max_files", 5)
+	v.SetDefault("telemetry.async", false)
+	v.SetDefault("telemetry.queue_size", 4096)
+	v.SetDefault("telemetry.flush_interval", "250ms")
+	v.SetDefault("telemetry.redact_ips", false)
+	v.SetDefault("telemetry.gzip", false)
+	v.SetDefault("telemetry.raw_capture_path", "")
+	v.SetDefault("telemetry.raw_payload_path", "")
 
 	// Config file is optional; env-only is fine.
 	_ = v.ReadInConfig()
@@ -67,17 +230,125 @@ func Load() (Config, error) {
 		DP8Port:         v.GetInt("dp8.port"),
 		NewsPort:        v.GetInt("news.port"),
 		AutoPort:        v.GetInt("autoupdate.port"),
+		AutoMode:        strings.ToLower(strings.TrimSpace(v.GetString("autoupdate.mode"))),
+		AdminPort:       v.GetInt("admin.port"),
+		AdminToken:      strings.TrimSpace(v.GetString("admin.token")),
+		AdminTLSCert:    strings.TrimSpace(v.GetString("admin.tls_cert")),
+		AdminTLSKey:     strings.TrimSpace(v.GetString("admin.tls_key")),
 		ServerCreatedBy: strings.TrimSpace(v.GetString("server.created_by")),
 		ServerVersion:   strings.TrimSpace(v.GetString("server.version")),
 		ServerTagline:   strings.TrimSpace(v.GetString("server.tagline")),
 		ShimPath:        v.GetString("shim.path"),
 		DP8LogPath:      v.GetString("telemetry.dp8_ndjson_path"),
+		RawCapturePath:  strings.TrimSpace(v.GetString("telemetry.raw_capture_path")),
+		RawPayloadPath:  strings.TrimSpace(v.GetString("telemetry.raw_payload_path")),
+		DP8Log: packetlog.Options{
+			MaxBytes:   v.GetInt64("telemetry.max_bytes"),
+			MaxBackups: v.GetInt("telemetry.max_files"),
+
+			Async:         v.GetBool("telemetry.async"),
+			QueueSize:     v.GetInt("telemetry.queue_size"),
+			FlushInterval: v.GetDuration("telemetry.flush_interval"),
+			Gzip:          v.GetBool("telemetry.gzip"),
+		},
+
+		PlayerSweepPaused:  v.GetBool("players.sweep_paused"),
+		EvictedRetention:   v.GetDuration("players.evicted_retention"),
+		SnapshotPath:       strings.TrimSpace(v.GetString("state.snapshot_path")),
+		PlayerSnapshotPath: strings.TrimSpace(v.GetString("players.snapshot_path")),
+		SeedPath:           strings.TrimSpace(v.GetString("state.seed_path")),
+		MaxHostsPerIP:      v.GetInt("limits.max_hosts_per_ip"),
+		MaxBrowsersPerIP:   v.GetInt("limits.max_browsers_per_ip"),
+		ClientMsgsPerSec:   v.GetFloat64("limits.client_msgs_per_sec"),
+		ClientBurst:        v.GetInt("limits.client_burst"),
+		TopTalkers:         v.GetInt("limits.top_talkers"),
+		SendBatchSize:      v.GetInt("dp8.send_batch_size"),
+		PollMin:            v.GetDuration("dp8.poll_min"),
+		PollMax:            v.GetDuration("dp8.poll_max"),
+		ShimQueueWarn:      v.GetInt("dp8.shim_queue_warn"),
+		HandlerTimeout:     v.GetDuration("dp8.handler_timeout"),
+		News: news.Options{
+			TemplatePath: strings.TrimSpace(v.GetString("news.template_path")),
+			LegacyFormat: v.GetBool("news.legacy_format"),
+			CacheTTL:     v.GetDuration("news.cache_ttl"),
+			RealIPHeader: strings.TrimSpace(v.GetString("news.real_ip_header")),
+
+			ShowActiveGames: v.GetBool("news.show_active_games"),
+			PopularMaps:     v.GetInt("news.popular_maps"),
+			LineEnding:      strings.ToLower(strings.TrimSpace(v.GetString("news.line_ending"))),
+			AllowGzipText:   v.GetBool("news.allow_gzip_text"),
+			TimeFormat:      v.GetString("news.time_format"),
+			TLSCert:         strings.TrimSpace(v.GetString("news.tls_cert")),
+			TLSKey:          strings.TrimSpace(v.GetString("news.tls_key")),
+		},
+		Host: state.HostConfig{
+			Sort:            strings.ToLower(strings.TrimSpace(v.GetString("browse.sort"))),
+			AllowPrivateIPs: v.GetBool("browse.allow_private_ips"),
+			StaleFactor:     v.GetFloat64("browse.stale_factor"),
+			StaleMin:        v.GetDuration("browse.stale_min"),
+			ActiveWindow:    v.GetDuration("browse.active_window"),
+			RidBase:         uint32(max(v.GetInt64("state.rid_base"), 0)),
+
+			IgnoreObservedIP: !v.GetBool("state.trust_observed_ip"),
+			AllowedGameV:     trimmedNonEmpty(v.GetStringSlice("host.allowed_gamev")),
+			MaxAttrs:         v.GetInt("proto.max_attrs"),
+			MaxAttrLen:       v.GetInt("proto.max_attr_len"),
+			Quality: state.QualityWeights{
+				HasPlayers:   v.GetFloat64("browse.quality.has_players"),
+				NotFull:      v.GetFloat64("browse.quality.not_full"),
+				Recent:       v.GetFloat64("browse.quality.recent"),
+				NoPassword:   v.GetFloat64("browse.quality.no_password"),
+				RecentWindow: v.GetDuration("browse.quality.recent_window"),
+			},
+		},
 		Proto: proto.EngineConfig{
-			Port:          0, // set below
-			AdvertiseIP:   strings.TrimSpace(v.GetString("dp8.advertise_ip")),
-			AdvertisePort: v.GetInt("dp8.advertise_port"),
+			Port:           0, // set below
+			AdvertiseIP:    strings.TrimSpace(v.GetString("dp8.advertise_ip")),
+			AdvertisePort:  v.GetInt("dp8.advertise_port"),
+			ConInfoIP:      strings.TrimSpace(v.GetString("proto.con_info_ip")),
+			MaxPageRows:    v.GetInt("proto.max_page_rows"),
+			PageVersion:    v.GetBool("proto.page_version"),
+			StrictParse:    v.GetBool("proto.strict_parse"),
+			MaxAttrs:       v.GetInt("proto.max_attrs"),
+			MaxAttrLen:     v.GetInt("proto.max_attr_len"),
+			Framing:        strings.ToLower(strings.TrimSpace(v.GetString("proto.framing"))),
+			MOTD:           v.GetString("server.motd"),
+			MaxPlayers:     v.GetInt("server.max_players"),
+			RejectWhenFull: v.GetBool("server.reject_when_full"),
 		},
 	}
+	cfg.AutoManifest = autoupdate.Manifest{
+		Status:      v.GetInt("autoupdate.http_status"),
+		Body:        v.GetString("autoupdate.http_body"),
+		ContentType: strings.TrimSpace(v.GetString("autoupdate.http_content_type")),
+	}
+
+	holdMS := v.GetInt("autoupdate.hold_ms")
+	if holdMS < 0 || holdMS > 30000 {
+		return Config{}, fmt.Errorf("invalid autoupdate.hold_ms %d (must be 0..30000)", holdMS)
+	}
+	cfg.AutoSink = autoupdate.SinkOptions{
+		Hold:          time.Duration(holdMS) * time.Millisecond,
+		ProxyProtocol: v.GetBool("autoupdate.proxy_protocol"),
+	}
+
+	features, err := ParseFeatures(v.GetStringMap("features"))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid features: %w", err)
+	}
+	cfg.Features = features
+	views, err := ParseViews(v.GetStringMap("proto.views"))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid proto.views: %w", err)
+	}
+	cfg.Proto.Views = views
+	cfg.News.GamesFeed = features.Enabled(FeatureGamesFeed)
+	if v.IsSet("news.games_feed") {
+		// Deprecated alias for features.games_feed; true still enables the feed.
+		slog.Warn("news.games_feed is deprecated; use features.games_feed", "news.games_feed", v.GetBool("news.games_feed"))
+		cfg.News.GamesFeed = cfg.News.GamesFeed || v.GetBool("news.games_feed")
+	}
+	cfg.Proto.DisableLANJoiner = !features.Enabled(FeatureLANJoiner)
 
 	if cfg.DP8Port <= 0 || cfg.DP8Port > 65535 {
 		return Config{}, fmt.Errorf("invalid dp8.port %d", cfg.DP8Port)
@@ -85,12 +356,131 @@ func Load() (Config, error) {
 	if cfg.Proto.AdvertisePort < 0 || cfg.Proto.AdvertisePort > 65535 {
 		return Config{}, fmt.Errorf("invalid dp8.advertise_port %d", cfg.Proto.AdvertisePort)
 	}
+	if cfg.Proto.MaxPageRows < 1 {
+		return Config{}, fmt.Errorf("invalid proto.max_page_rows %d (must be >= 1)", cfg.Proto.MaxPageRows)
+	}
+	if cfg.Proto.MaxAttrs < 0 {
+		return Config{}, fmt.Errorf("invalid proto.max_attrs %d", cfg.Proto.MaxAttrs)
+	}
+	if cfg.Proto.MaxAttrLen < 0 {
+		return Config{}, fmt.Errorf("invalid proto.max_attr_len %d", cfg.Proto.MaxAttrLen)
+	}
+	switch cfg.Proto.Framing {
+	case proto.FramingNUL, proto.FramingLenPrefix:
+	default:
+		return Config{}, fmt.Errorf("invalid proto.framing %q (want %q or %q)", cfg.Proto.Framing, proto.FramingNUL, proto.FramingLenPrefix)
+	}
+	if cfg.Proto.ConInfoIP != "" && net.ParseIP(cfg.Proto.ConInfoIP) == nil {
+		return Config{}, fmt.Errorf("invalid proto.con_info_ip %q: not an IP address", cfg.Proto.ConInfoIP)
+	}
 	if cfg.NewsPort <= 0 || cfg.NewsPort > 65535 {
 		return Config{}, fmt.Errorf("invalid news.port %d", cfg.NewsPort)
 	}
+	if cfg.News.PopularMaps < 0 {
+		return Config{}, fmt.Errorf("invalid news.popular_maps %d", cfg.News.PopularMaps)
+	}
+	if cfg.Proto.MaxPlayers < 0 {
+		return Config{}, fmt.Errorf("invalid server.max_players %d", cfg.Proto.MaxPlayers)
+	}
+	if cfg.EvictedRetention < 0 {
+		return Config{}, fmt.Errorf("invalid players.evicted_retention %s", cfg.EvictedRetention)
+	}
+	if cfg.News.CacheTTL < 0 {
+		return Config{}, fmt.Errorf("invalid news.cache_ttl %s", cfg.News.CacheTTL)
+	}
+	switch cfg.News.LineEnding {
+	case news.LineEndingCRLF, news.LineEndingLF:
+	default:
+		return Config{}, fmt.Errorf("invalid news.line_ending %q (want %q or %q)", cfg.News.LineEnding, news.LineEndingCRLF, news.LineEndingLF)
+	}
+	trusted, err := news.ParseTrustedProxies(v.GetStringSlice("news.trusted_proxies"))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid news.trusted_proxies: %w", err)
+	}
+	cfg.News.TrustedProxies = trusted
+	regions, err := state.ParseRegionMap(v.GetStringSlice("state.region_map"))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid state.region_map: %w", err)
+	}
+	cfg.Host.RegionMap = regions
+	if name := strings.TrimSpace(v.GetString("news.time_zone")); name != "" {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid news.time_zone %q: %w", name, err)
+		}
+		cfg.News.TimeZone = loc
+	}
 	if cfg.AutoPort < 0 || cfg.AutoPort > 65535 {
 		return Config{}, fmt.Errorf("invalid autoupdate.port %d", cfg.AutoPort)
 	}
+	switch cfg.AutoMode {
+	case AutoModeTCP:
+	case AutoModeHTTP:
+		if cfg.AutoManifest.Status < 100 || cfg.AutoManifest.Status > 599 {
+			return Config{}, fmt.Errorf("invalid autoupdate.http_status %d", cfg.AutoManifest.Status)
+		}
+	default:
+		return Config{}, fmt.Errorf("invalid autoupdate.mode %q (want %q or %q)", cfg.AutoMode, AutoModeTCP, AutoModeHTTP)
+	}
+	if cfg.AdminPort < 0 || cfg.AdminPort > 65535 {
+		return Config{}, fmt.Errorf("invalid admin.port %d", cfg.AdminPort)
+	}
+	if cfg.AdminPort > 0 && cfg.AdminToken == "" {
+		return Config{}, fmt.Errorf("admin.token must be set when admin.port is enabled")
+	}
+	if (cfg.AdminTLSCert == "") != (cfg.AdminTLSKey == "") {
+		return Config{}, fmt.Errorf("admin.tls_cert and admin.tls_key must be set together")
+	}
+	if (cfg.News.TLSCert == "") != (cfg.News.TLSKey == "") {
+		return Config{}, fmt.Errorf("news.tls_cert and news.tls_key must be set together")
+	}
+	if cfg.MaxHostsPerIP < 0 || cfg.MaxBrowsersPerIP < 0 {
+		return Config{}, fmt.Errorf("invalid limits: max_hosts_per_ip=%d max_browsers_per_ip=%d", cfg.MaxHostsPerIP, cfg.MaxBrowsersPerIP)
+	}
+	if cfg.ClientMsgsPerSec < 0 {
+		return Config{}, fmt.Errorf("invalid limits.client_msgs_per_sec %v", cfg.ClientMsgsPerSec)
+	}
+	if cfg.SendBatchSize < 1 || cfg.SendBatchSize > 256 {
+		return Config{}, fmt.Errorf("invalid dp8.send_batch_size %d (must be 1..256)", cfg.SendBatchSize)
+	}
+	if cfg.PollMin <= 0 || cfg.PollMax < cfg.PollMin || cfg.PollMax > time.Second {
+		return Config{}, fmt.Errorf("invalid dp8.poll_min %s / dp8.poll_max %s (want 0 < min <= max <= 1s)", cfg.PollMin, cfg.PollMax)
+	}
+	if cfg.ShimQueueWarn < 0 {
+		return Config{}, fmt.Errorf("invalid dp8.shim_queue_warn %d", cfg.ShimQueueWarn)
+	}
+	if cfg.HandlerTimeout < 0 {
+		return Config{}, fmt.Errorf("invalid dp8.handler_timeout %s", cfg.HandlerTimeout)
+	}
+	if cfg.TopTalkers < 0 {
+		return Config{}, fmt.Errorf("invalid limits.top_talkers %d", cfg.TopTalkers)
+	}
+	if cfg.ClientMsgsPerSec > 0 && cfg.ClientBurst < 1 {
+		return Config{}, fmt.Errorf("invalid limits.client_burst %d (must be >= 1)", cfg.ClientBurst)
+	}
+	switch cfg.Host.Sort {
+	case state.SortDPNID, state.SortQuality:
+	default:
+		return Config{}, fmt.Errorf("invalid browse.sort %q (want %q or %q)", cfg.Host.Sort, state.SortDPNID, state.SortQuality)
+	}
+	if cfg.Host.StaleFactor < 1 {
+		return Config{}, fmt.Errorf("invalid browse.stale_factor %v (must be >= 1)", cfg.Host.StaleFactor)
+	}
+	if cfg.Host.StaleMin < 0 {
+		return Config{}, fmt.Errorf("invalid browse.stale_min %s", cfg.Host.StaleMin)
+	}
+	if rb := v.GetInt64("state.rid_base"); rb < 1 || rb >= 0x7fffffff {
+		return Config{}, fmt.Errorf("invalid state.rid_base %d (must be 1..2147483646)", rb)
+	}
+	if cfg.Host.ActiveWindow <= 0 {
+		return Config{}, fmt.Errorf("invalid browse.active_window %s (must be > 0)", cfg.Host.ActiveWindow)
+	}
+	if cfg.DP8Log.MaxBytes < 0 {
+		return Config{}, fmt.Errorf("invalid telemetry.max_bytes %d", cfg.DP8Log.MaxBytes)
+	}
+	if cfg.DP8Log.MaxBackups < 1 {
+		return Config{}, fmt.Errorf("invalid telemetry.max_files %d (must be >= 1)", cfg.DP8Log.MaxBackups)
+	}
 	if strings.TrimSpace(cfg.ShimPath) == "" {
 		return Config{}, fmt.Errorf("shim.path must not be empty")
 	}
@@ -98,6 +488,9 @@ func Load() (Config, error) {
 		return Config{}, fmt.Errorf("server.version must not be empty")
 	}
 	cfg.Proto.Port = cfg.DP8Port
+	if v.GetBool("telemetry.redact_ips") {
+		cfg.DP8Log.Redactor = packetlog.MaskIPv4LastOctet
+	}
 
 	if strings.TrimSpace(cfg.DP8LogPath) != "" {
 		if err := os.MkdirAll(filepath.Dir(cfg.DP8LogPath), 0o755); err != nil {
@@ -106,3 +499,14 @@ func Load() (Config, error) {
 	}
 	return cfg, nil
 }
+
+// trimmedNonEmpty trims each entry and drops the empty ones.
+func trimmedNonEmpty(in []string) []string {
+	var out []string
+	for _, s := range in {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
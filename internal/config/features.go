@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Feature names a toggle in the `features` config section.
+type Feature string
+
+const (
+	// FeatureAdminActions enables the mutating admin endpoints (kick, game removal).
+	FeatureAdminActions Feature = "admin_actions"
+	// FeatureLANJoiner offers a same-subnet host LAN IP to joiners behind the host's NAT.
+	FeatureLANJoiner Feature = "lan_joiner"
+	// FeatureGamesFeed serves /games.atom on the News port. news.games_feed is a
+	// deprecated alias.
+	FeatureGamesFeed Feature = "games_feed"
+	// FeatureGamesUpdatedPush pushes <GamesUpdated /> to connected players when a
+	// listed game disappears. Off by default: it is one send per player per removal.
+	FeatureGamesUpdatedPush Feature = "games_updated_push"
+)
+
+// featureDefaults is the set of known flags and their value when not configured.
+var featureDefaults = map[Feature]bool{
+	FeatureAdminActions:     true,
+	FeatureLANJoiner:        true,
+	FeatureGamesFeed:        false,
+	FeatureGamesUpdatedPush: false,
+}
+
+// Features holds the `features` section. The zero value reports every flag at
+// its default.
+type Features struct {
+	set map[Feature]bool
+}
+
+// ParseFeatures validates a raw `features` map. Unknown names are rejected so a
+// typo does not silently leave a behavior at its default. Values may be bools
+// or bool strings (env overrides).
+func ParseFeatures(raw map[string]any) (Features, error) {
+	f := Features{set: make(map[Feature]bool, len(raw))}
+	for name, v := range raw {
+		key := Feature(strings.ToLower(strings.TrimSpace(name)))
+		if _, ok := featureDefaults[key]; !ok {
+			return Features{}, fmt.Errorf("unknown feature %q (known: %s)", name, strings.Join(KnownFeatures(), ", "))
+		}
+		var on bool
+		switch b := v.(type) {
+		case bool:
+			on = b
+		case string:
+			parsed, err := strconv.ParseBool(strings.TrimSpace(b))
+			if err != nil {
+				return Features{}, fmt.Errorf("feature %q: %q is not a bool", name, b)
+			}
+			on = parsed
+		default:
+			return Features{}, fmt.Errorf("feature %q: %v is not a bool", name, v)
+		}
+		f.set[key] = on
+	}
+	return f, nil
+}
+
+// Enabled reports whether name is on, falling back to its default.
+func (f Features) Enabled(name Feature) bool {
+	if on, ok := f.set[name]; ok {
+		return on
+	}
+	return featureDefaults[name]
+}
+
+// KnownFeatures lists the valid flag names, sorted.
+func KnownFeatures() []string {
+	out := make([]string, 0, len(featureDefaults))
+	for name := range featureDefaults {
+		out = append(out, string(name))
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFeatures(t *testing.T) {
+	f, err := ParseFeatures(map[string]any{"games_feed": true, "Admin_Actions": "false"})
+	if err != nil {
+		t.Fatalf("ParseFeatures: %v", err)
+	}
+	if !f.Enabled(FeatureGamesFeed) || f.Enabled(FeatureAdminActions) {
+		t.Fatalf("configured flags not readable: %+v", f)
+	}
+	if !f.Enabled(FeatureLANJoiner) {
+		t.Fatalf("unset lan_joiner should keep its default (on)")
+	}
+	var zero Features
+	if !zero.Enabled(FeatureAdminActions) || zero.Enabled(FeatureGamesFeed) {
+		t.Fatalf("zero Features should report defaults")
+	}
+
+	_, err = ParseFeatures(map[string]any{"games_fed": true})
+	if err == nil || !strings.Contains(err.Error(), `unknown feature "games_fed"`) || !strings.Contains(err.Error(), "games_feed") {
+		t.Fatalf("typo not rejected with the known list: %v", err)
+	}
+	if _, err := ParseFeatures(map[string]any{"lan_joiner": "sometimes"}); err == nil {
+		t.Fatalf("non-bool value accepted")
+	}
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseViews validates a raw `proto.views` map of view id (Vid) to ordered
+// header tokens. View ids must be decimal and tokens identifiers, since both are
+// echoed into HdrRowRes/PageRes attributes. Token lists may be YAML lists or
+// comma/space separated strings (env overrides).
+func ParseViews(raw map[string]any) (map[string][]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	out := make(map[string][]string, len(raw))
+	for vid, v := range raw {
+		vid = strings.TrimSpace(vid)
+		if !isDecimal(vid) {
+			return nil, fmt.Errorf("view id %q is not a decimal Vid", vid)
+		}
+		var tokens []string
+		switch list := v.(type) {
+		case []any:
+			for _, t := range list {
+				s, ok := t.(string)
+				if !ok {
+					return nil, fmt.Errorf("view %s: token %v is not a string", vid, t)
+				}
+				tokens = append(tokens, strings.TrimSpace(s))
+			}
+		case []string:
+			for _, s := range list {
+				tokens = append(tokens, strings.TrimSpace(s))
+			}
+		case string:
+			tokens = strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' })
+		default:
+			return nil, fmt.Errorf("view %s: %v is not a token list", vid, v)
+		}
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("view %s: empty token list", vid)
+		}
+		for _, t := range tokens {
+			if !isIdentifier(t) {
+				return nil, fmt.Errorf("view %s: token %q is not an identifier", vid, t)
+			}
+		}
+		out[vid] = tokens
+	}
+	return out, nil
+}
+
+func isDecimal(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case i > 0 && r >= '0' && r <= '9':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,31 @@
+package config
+
+import "testing"
+
+func TestParseViews(t *testing.T) {
+	views, err := ParseViews(map[string]any{
+		"101": []any{"Rid", "GName", "NumP"},
+		"501": "User, PLev",
+	})
+	if err != nil {
+		t.Fatalf("ParseViews: %v", err)
+	}
+	if got := views["101"]; len(got) != 3 || got[0] != "Rid" || got[2] != "NumP" {
+		t.Fatalf("views[101]=%v", got)
+	}
+	if got := views["501"]; len(got) != 2 || got[0] != "User" || got[1] != "PLev" {
+		t.Fatalf("views[501]=%v", got)
+	}
+
+	for name, raw := range map[string]map[string]any{
+		"non-decimal vid": {"games": []any{"Rid"}},
+		"empty list":      {"101": []any{}},
+		"empty token":     {"101": []any{"Rid", ""}},
+		"bad token":       {"101": []any{`Rid"`}},
+		"leading digit":   {"101": []any{"1Rid"}},
+	} {
+		if _, err := ParseViews(raw); err == nil {
+			t.Fatalf("%s: accepted %v", name, raw)
+		}
+	}
+}
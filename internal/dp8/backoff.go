@@ -0,0 +1,39 @@
+package dp8
+
+import "time"
+
+// Idle poll bounds used when dp8.poll_min/poll_max are unset.
+const (
+	defaultPollMin = 1 * time.Millisecond
+	defaultPollMax = 20 * time.Millisecond
+)
+
+// pollBackoff paces Run's PopEvent loop while the shim has nothing queued: the
+// first idle sleep is min, each further one doubles up to max, and any event
+// resets it to min. A quiet server polls at max; a busy one never waits long.
+type pollBackoff struct {
+	min, max time.Duration
+	cur      time.Duration
+}
+
+func newPollBackoff(min, max time.Duration) pollBackoff {
+	if min <= 0 {
+		min = defaultPollMin
+	}
+	if max < min {
+		max = min
+	}
+	return pollBackoff{min: min, max: max, cur: min}
+}
+
+// idle returns how long to sleep for this empty poll and grows the next one.
+func (b *pollBackoff) idle() time.Duration {
+	d := b.cur
+	b.cur = min(b.cur*2, b.max)
+	return d
+}
+
+// reset drops back to the shortest sleep after an event arrives.
+func (b *pollBackoff) reset() {
+	b.cur = b.min
+}
@@ -0,0 +1,34 @@
+package dp8
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPollBackoff_GrowsToCapAndResets(t *testing.T) {
+	b := newPollBackoff(time.Millisecond, 10*time.Millisecond)
+	var got []time.Duration
+	for i := 0; i < 6; i++ {
+		got = append(got, b.idle())
+	}
+	want := []time.Duration{1, 2, 4, 8, 10, 10}
+	for i := range want {
+		if got[i] != want[i]*time.Millisecond {
+			t.Fatalf("idle sleeps=%v, want %v ms", got, want)
+		}
+	}
+
+	b.reset()
+	if d := b.idle(); d != time.Millisecond {
+		t.Fatalf("after reset idle=%s, want 1ms", d)
+	}
+
+	// Unset or inverted bounds fall back to sane values.
+	z := newPollBackoff(0, 0)
+	if d := z.idle(); d != defaultPollMin {
+		t.Fatalf("zero config idle=%s, want %s", d, defaultPollMin)
+	}
+	if d := z.idle(); d != defaultPollMin {
+		t.Fatalf("max below min should pin at min, got %s", d)
+	}
+}
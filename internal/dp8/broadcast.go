@@ -0,0 +1,46 @@
+package dp8
+
+import (
+	"log/slog"
+
+	"open-zone/internal/config"
+)
+
+// Broadcast enqueues payloadXML (tagged tag) to every connected, non-evicted
+// player. Each recipient goes through its own send queue, so a full queue drops
+// only that client's copy. It returns how many copies were queued.
+func (e *Engine) Broadcast(payloadXML string, tag string) int {
+	if e.players == nil {
+		return 0
+	}
+	targets := e.players.Connected()
+	queued := 0
+	for _, dpnid := range targets {
+		if e.enqueue(outMsg{
+			dpnid:      dpnid,
+			tag:        tag,
+			exp:        "broadcast",
+			payloadXML: payloadXML,
+			flags:      dpnSendGuaranteed,
+		}) {
+			queued++
+		}
+	}
+	slog.Info("dp8 broadcast", "tag", tag, "targeted", len(targets), "queued", queued, "dropped", len(targets)-queued)
+	return queued
+}
+
+// gamesUpdatedXML tells browsing clients the games list changed, so they can
+// re-request it instead of waiting for their next Page.
+const gamesUpdatedXML = `<GamesUpdated />`
+
+// GameRemoved is the state.HostStore game-removed hook: with the
+// games_updated_push feature on, it broadcasts a GamesUpdated push to every
+// connected player. It only enqueues, so it is safe under the store's lock.
+func (e *Engine) GameRemoved(rid string) {
+	if !e.cfg.Features.Enabled(config.FeatureGamesUpdatedPush) {
+		return
+	}
+	slog.Debug("game removed; pushing GamesUpdated", "rid", rid)
+	e.Broadcast(gamesUpdatedXML, "GamesUpdated")
+}
@@ -0,0 +1,128 @@
+package dp8
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"open-zone/internal/packetlog"
+	"open-zone/internal/proto"
+)
+
+// dropReason classifies why the engine discarded a message. Every drop goes
+// through Engine.drop so counts, log lines and NDJSON records line up by reason.
+type dropReason int
+
+const (
+	dropQueueFull   dropReason = iota // outbound: the client's send queue was full
+	dropEvicted                       // inbound: the session is evicted
+	dropRateLimited                   // inbound: over the per-client rate limit
+	dropHostCap                       // inbound HostData: the IP already has max hosts
+	dropTruncated                     // inbound: the shim delivered a partial payload
+	dropDeparted                      // outbound: still queued when the client left or was kicked
+	dropBinary                        // inbound: '<'-prefixed but not text (bad UTF-8 or mostly control bytes)
+	dropAttrLimit                     // inbound: over proto.max_attrs or proto.max_attr_len
+	numDropReasons
+)
+
+// dropReasons describes each reason. exp is the NDJSON Experiment of its
+// records; the older reasons keep the names they had before drops were
+// centralized, so existing NDJSON consumers still match them.
+var dropReasons = [numDropReasons]struct {
+	name  string
+	exp   string
+	dir   string // "in" or "out"
+	level slog.Level
+	hr    string // proto HR code for the log line and record only; nothing sends it to the client
+}{
+	dropQueueFull:   {"queue-full", "sendq", "out", slog.LevelWarn, ""},
+	dropEvicted:     {"evicted", "drop-evicted", "in", slog.LevelWarn, proto.HRForbidden},
+	dropRateLimited: {"rate-limit", "drop-rate-limit", "in", slog.LevelDebug, proto.HRTooBusy},  // the throttle start is logged at warn
+	dropHostCap:     {"host-cap", "drop-ip-host-cap", "in", slog.LevelDebug, proto.HRForbidden}, // the eviction is logged at warn
+	dropTruncated:   {"truncated", "drop-truncated", "in", slog.LevelWarn, proto.HRBadRequest},
+	dropDeparted:    {"departed", "drop-departed", "out", slog.LevelDebug, ""},
+	dropBinary:      {"binary", "drop-binary", "in", slog.LevelWarn, proto.HRBadRequest},
+	dropAttrLimit:   {"attr-limit", "drop-attr-limit", "in", slog.LevelWarn, proto.HRBadRequest},
+}
+
+func (r dropReason) String() string { return dropReasons[r].name }
+
+// drop accounts for n messages to or from dpnid discarded for reason: it bumps
+// the per-reason counter, logs one line and writes one "drop" NDJSON record.
+// attrs are extra slog key/value pairs, also appended to the record message.
+func (e *Engine) drop(reason dropReason, dpnid uint32, tag string, n int, attrs ...any) {
+	e.dropRecv(nil, reason, dpnid, tag, n, attrs...)
+}
+
+// dropRecv is drop for an inbound message that already has its own NDJSON
+// record: the reason is stamped onto rec, which is written instead of a separate
+// "drop" record, so a dropped message still yields exactly one record.
+func (e *Engine) dropRecv(rec *packetlog.Record, reason dropReason, dpnid uint32, tag string, n int, attrs ...any) {
+	if n <= 0 {
+		return
+	}
+	e.drops[reason].Add(uint64(n))
+	d := dropReasons[reason]
+
+	kv := []any{"reason", d.name, "dpnid", fmt.Sprintf("0x%08x", dpnid)}
+	if tag != "" {
+		kv = append(kv, "tag", tag)
+	}
+	if n > 1 {
+		kv = append(kv, "n", n)
+	}
+	if d.hr != "" {
+		kv = append(kv, "hr", d.hr)
+	}
+	extra := append(append([]any(nil), attrs...), e.remoteAttrs(dpnid)...)
+	slog.Log(context.Background(), d.level, "dp8 message dropped", append(kv, extra...)...)
+
+	if e.log == nil {
+		return
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "reason=%s n=%d", d.name, n)
+	if d.hr != "" {
+		fmt.Fprintf(&msg, " hr=%s", d.hr)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		fmt.Fprintf(&msg, " %s=%v", extra[i], extra[i+1])
+	}
+	if rec != nil {
+		rec.Experiment = d.exp
+		rec.Message += " " + msg.String()
+		e.log.Log(*rec)
+		return
+	}
+	e.log.Log(packetlog.Record{
+		RunID:       e.runID,
+		Timestamp:   proto.NowTS(),
+		Type:        "drop",
+		Direction:   d.dir,
+		ReplyMode:   "dp8shim",
+		Tag:         tag,
+		Experiment:  d.exp,
+		Message:     msg.String(),
+		Source:      dropPeer(d.dir == "in", dpnid),
+		Destination: dropPeer(d.dir == "out", dpnid),
+	})
+}
+
+// dropPeer is the dpnid=... Source or Destination of a drop record, or "" for
+// the other side.
+func dropPeer(ok bool, dpnid uint32) string {
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("dpnid=0x%08x", dpnid)
+}
+
+// dropCounts returns the running totals keyed by reason name.
+func (e *Engine) dropCounts() map[string]uint64 {
+	out := make(map[string]uint64, numDropReasons)
+	for r := dropReason(0); r < numDropReasons; r++ {
+		out[r.String()] = e.drops[r].Load()
+	}
+	return out
+}
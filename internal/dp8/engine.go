@@ -1,14 +1,19 @@
 package dp8
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"log/slog"
+	neturl "net/url"
+	"runtime/debug"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"open-zone/internal/config"
 	"open-zone/internal/dp8shim"
@@ -54,13 +59,26 @@ type Engine struct {
 	cfg   config.Config
 	runID string
 
-	shim    *dp8shim.Shim
-	log     *packetlog.Logger
-	proto   *proto.Engine
-	players *state.PlayerStore
+	shim  Shim
+	log   packetlog.Sink
+	proto *proto.Engine
 
-	buf  []byte
-	outQ chan outMsg
+	// protoHandle is proto.Handle; tests swap it to inject handler failures.
+	protoHandle func(now time.Time, dpnid uint32, remoteIP string, msg proto.Msg) []proto.Outbound
+	players     *state.PlayerStore
+
+	// now stamps player sessions (connect, disconnect); tests swap it.
+	now func() time.Time
+
+	buf   []byte
+	sendQ *sendQueues
+
+	// sendBatch messages go out per send worker wake, then sendPace is slept.
+	sendBatch int
+	sendPace  time.Duration
+
+	// poll paces Run's idle PopEvent loop (dp8.poll_min/poll_max).
+	poll pollBackoff
 
 	mu sync.RWMutex
 
@@ -70,16 +88,134 @@ type Engine struct {
 	// Some DP8 events do not include a DPNID. Keep the last seen remote summary so the
 	// next CREATE_PLAYER can pick it up if needed.
 	lastIndicate remoteSummary
+
+	// hosting tracks DPNIDs that have published HostData (role detection for per-IP caps).
+	hosting map[uint32]struct{}
+
+	// capture, when set, records raw inbound events (SetEventRecorder).
+	capture EventRecorder
+
+	// raw, when set, receives complete payloads, which then stay out of log
+	// (SetRawPayloadSink).
+	raw packetlog.Sink
+
+	// shimClosed is set once PopEvent reports dp8shim.ErrClosed.
+	shimClosed atomic.Bool
+
+	// sweeperPaused suspends max-age eviction (maintenance holds, long debug sessions).
+	sweeperPaused atomic.Bool
+
+	// limiter is nil when per-client rate limiting is disabled.
+	limiter *clientLimiter
+
+	// talkers counts inbound messages per DPNID; nil when limits.top_talkers is 0.
+	talkers *talkerRates
+
+	// drops counts discarded messages by reason (see drop).
+	drops [numDropReasons]atomic.Uint64
+
+	// Inbound payload classification (see Stats).
+	recvNonXML         atomic.Uint64
+	recvXMLParseFailed atomic.Uint64
+	recvXMLParsed      atomic.Uint64
+
+	// handlerPanics counts events dropped by handleEvent's recover.
+	handlerPanics atomic.Uint64
+
+	// slowHandlers counts handlers that overran dp8.handler_timeout (see handleTimed).
+	slowHandlers atomic.Uint64
+
+	// Shim event queue samples (see sampleShimQueue).
+	shimQueuePeak  atomic.Uint32
+	shimBacklogged atomic.Bool
+
+	// Stale host samples (see noteStaleHosts); only the watcher goroutine uses them.
+	staleHosts         int
+	staleHostsWarnedAt time.Time
 }
 
 type Stats struct {
 	PlayersOnline int
 	GamesHosted   int
+	StaleHosts    int // see state.HostStore.StaleHostsCount
+	ActiveGames   int // see state.HostStore.ActiveGamesCount
+
+	// Hosts are sessions that have published HostData; Browsers are the rest.
+	Hosts    int
+	Browsers int
+
+	// SendQueueDepth is the engine send backlog (all clients); ShimQueueDepth the
+	// shim's event queue.
+	SendQueueDepth int
+	ShimQueueDepth uint32
+
+	// ShimQueuePeak is the deepest sampled shim queue since start; ShimBacklogged
+	// is set while the last sample was over dp8.shim_queue_warn.
+	ShimQueuePeak  uint32
+	ShimBacklogged bool
+
+	SweeperPaused bool
+
+	// RecvNonXML counts RECEIVE payloads not starting with '<' (protocol variant?),
+	// RecvXMLParseFailed '<' payloads that failed to parse (malformed), and
+	// RecvXMLParsed those that parsed.
+	RecvNonXML         uint64
+	RecvXMLParseFailed uint64
+	RecvXMLParsed      uint64
+
+	// RecvThrottled counts parsed requests dropped by the per-client rate limit.
+	RecvThrottled uint64
+
+	// RecvEvictedDropped counts messages ignored from evicted sessions;
+	// SendDropped outbound messages dropped because the client's send queue was full.
+	RecvEvictedDropped uint64
+	SendDropped        uint64
+
+	// HandlerPanics counts events dropped because handling them panicked.
+	HandlerPanics uint64
+
+	// SlowHandlers counts messages whose handler overran dp8.handler_timeout.
+	SlowHandlers uint64
+
+	// Drops has every drop counter keyed by reason ("queue-full", "evicted",
+	// "rate-limit", "host-cap", "truncated", "departed", "binary", "attr-limit").
+	Drops map[string]uint64
+
+	// ProtoTags counts messages handled by the proto engine by tag (see proto.Stats).
+	ProtoTags map[string]uint64
+
+	// TopTalkers are the limits.top_talkers clients that sent the most messages
+	// in the last minute, busiest first.
+	TopTalkers []Talker
 }
 
+const (
+	// recvBufSize is the initial PopEvent buffer; growRecvBuf doubles it, up to
+	// maxRecvBufSize, when the shim has to cut a payload to fit it.
+	recvBufSize    = 64 * 1024
+	maxRecvBufSize = 1024 * 1024
+)
+
 const (
 	maxPlayerOnlineAge = 12 * time.Hour
 	playerSweepEvery   = 10 * time.Minute
+
+	// limiterIdle is how long a rate-limit bucket sits unused before the sweep
+	// prunes it; prune stretches it to the bucket's refill time (burst/rate) for
+	// low rates, so only full buckets are dropped.
+	limiterIdle = playerSweepEvery
+
+	// sendDrainTimeout bounds how long shutdown keeps flushing sendQ. It runs on its
+	// own context, well inside main's 60s shutdown watchdog.
+	sendDrainTimeout = 5 * time.Second
+
+	// clientSendQueueSize bounds each DPNID's send queue. A browse burst (HdrRow for
+	// every Vid plus pages) fits comfortably.
+	clientSendQueueSize = 256
+
+	// sendPaceDelay spaces send batches so a connect bundle does not hit the
+	// client in one burst.
+	sendPaceDelay = 2 * time.Millisecond
 )
 
 func (e *Engine) Stats() Stats {
@@ -92,11 +228,53 @@ func (e *Engine) Stats() Stats {
 		e.mu.RUnlock()
 	}
 	if e.proto != nil {
-		out.GamesHosted = e.proto.Stats().GamesHosted
+		ps := e.proto.Stats()
+		out.GamesHosted = ps.GamesHosted
+		out.StaleHosts = ps.StaleHosts
+		out.ActiveGames = ps.ActiveGames
+		out.ProtoTags = ps.Tags
+	}
+	e.mu.RLock()
+	out.Hosts = len(e.hosting)
+	e.mu.RUnlock()
+	if out.Browsers = out.PlayersOnline - out.Hosts; out.Browsers < 0 {
+		out.Browsers = 0
+	}
+	out.SendQueueDepth = e.sendQ.len()
+	out.ShimQueueDepth = e.shim.QueueDepth()
+	out.ShimQueuePeak = e.shimQueuePeak.Load()
+	out.ShimBacklogged = e.shimBacklogged.Load()
+	out.SweeperPaused = e.sweeperPaused.Load()
+	out.RecvNonXML = e.recvNonXML.Load()
+	out.RecvXMLParseFailed = e.recvXMLParseFailed.Load()
+	out.RecvXMLParsed = e.recvXMLParsed.Load()
+	out.RecvThrottled = e.drops[dropRateLimited].Load()
+	out.RecvEvictedDropped = e.drops[dropEvicted].Load()
+	out.SendDropped = e.drops[dropQueueFull].Load()
+	out.HandlerPanics = e.handlerPanics.Load()
+	out.SlowHandlers = e.slowHandlers.Load()
+	out.Drops = e.dropCounts()
+	if e.talkers != nil {
+		out.TopTalkers = e.talkers.top(time.Now(), e.cfg.TopTalkers)
 	}
 	return out
 }
 
+// SetEventRecorder records every inbound event and its raw payload to r. It must
+// be called before Run.
+func (e *Engine) SetEventRecorder(r EventRecorder) {
+	e.capture = r
+}
+
+// SetSweeperPaused pauses or resumes max-age player eviction without a restart.
+// While paused no players are evicted; over-age players are evicted on the first
+// sweep after resuming.
+func (e *Engine) SetSweeperPaused(paused bool) {
+	if e.sweeperPaused.Swap(paused) != paused {
+		slog.Info("player eviction sweeper state changed", "paused", paused)
+	}
+}
+
 func dp8MsgName(id uint32) string {
 	switch id {
 	case dpnMsgIDConnectComplete:
@@ -182,16 +360,73 @@ type remoteSummary struct {
 
 	// When hostname isn't an IP literal, do not log it. Only keep length for diagnostics.
 	hostLen int
+
+	// provider is the service-provider GUID (TCP/IP, IPX, modem, serial) and
+	// device the adapter GUID, both as "{XXXXXXXX-...}" when present.
+	provider string
+	device   string
+}
+
+// Service-provider CLSIDs from dplay8.h.
+var dp8Providers = map[string]string{
+	"{EBFE7BA0-628D-11D2-AE0F-006097B01411}": "tcpip",
+	"{53934290-628D-11D2-AE0F-006097B01411}": "ipx",
+	"{6D4A3650-628D-11D2-AE0F-006097B01411}": "modem",
+	"{743B5D60-628D-11D2-AE0F-006097B01411}": "serial",
+}
+
+// providerName is a short label for the provider ("tcpip"), or the GUID itself
+// when it is not a known CLSID.
+func (rs remoteSummary) providerName() string {
+	if name, ok := dp8Providers[rs.provider]; ok {
+		return name
+	}
+	return rs.provider
+}
+
+// addrAttrs returns the slog attrs for the remote address. Non-IP hostnames are
+// never included, only their length.
+func (rs remoteSummary) addrAttrs() []any {
+	attrs := make([]any, 0, 6)
+	if rs.ip != "" {
+		attrs = append(attrs, "remote_ip", rs.ip)
+	}
+	if rs.port != "" {
+		attrs = append(attrs, "remote_port", rs.port)
+	}
+	if rs.ip == "" && rs.hostLen > 0 {
+		attrs = append(attrs, "remote_host_len", rs.hostLen)
+	}
+	return attrs
+}
+
+// connectAttrs is addrAttrs plus the service provider and adapter, for the
+// connect log line.
+func (rs remoteSummary) connectAttrs() []any {
+	attrs := rs.addrAttrs()
+	if rs.provider != "" {
+		attrs = append(attrs, "sp", rs.providerName())
+	}
+	if rs.device != "" {
+		attrs = append(attrs, "device", rs.device)
+	}
+	return attrs
+}
+
+func (rs remoteSummary) empty() bool {
+	return rs == remoteSummary{}
 }
 
 func parseRemoteFromDP8URL(url string) remoteSummary {
 	// IDirectPlay8Address URLs typically include semicolon-separated key/values.
 	// Avoid logging hostnames (often machine names). Prefer IP literals only.
 	//
-	// Example keys: hostname=..., port=...
+	// Example keys: provider=%7B...%7D, device=%7B...%7D, hostname=..., port=...
 	var out remoteSummary
 	host := findDP8URLKV(url, "hostname")
 	out.port = findDP8URLKV(url, "port")
+	out.provider = dp8URLGUID(findDP8URLKV(url, "provider"))
+	out.device = dp8URLGUID(findDP8URLKV(url, "device"))
 
 	if host != "" && looksLikeIPv4(host) {
 		out.ip = host
@@ -212,6 +447,14 @@ func parseRemoteFromDP8URL(url string) remoteSummary {
 func findDP8URLKV(url, key string) string {
 	needle := key + "="
 	i := strings.Index(url, needle)
+	// Match whole keys only ("port=" must not hit inside "someport=").
+	for i > 0 && !strings.ContainsRune(":/;&", rune(url[i-1])) {
+		j := strings.Index(url[i+1:], needle)
+		if j < 0 {
+			return ""
+		}
+		i += 1 + j
+	}
 	if i < 0 {
 		return ""
 	}
@@ -223,6 +466,33 @@ func findDP8URLKV(url, key string) string {
 	return url[i : i+j]
 }
 
+// dp8URLGUID normalizes a %-encoded "{GUID}" URL value to upper-case
+// "{XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX}". Anything else yields "", so
+// arbitrary strings never reach the logs.
+func dp8URLGUID(v string) string {
+	if u, err := neturl.PathUnescape(v); err == nil {
+		v = u
+	}
+	v = strings.ToUpper(strings.Trim(v, "{}"))
+	if len(v) != 36 {
+		return ""
+	}
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return ""
+			}
+		default:
+			if !(c >= '0' && c <= '9' || c >= 'A' && c <= 'F') {
+				return ""
+			}
+		}
+	}
+	return "{" + v + "}"
+}
+
 func looksLikeIPv4(s string) bool {
 	// Very small check: only digits and dots, and at least one dot.
 	if strings.Count(s, ".") < 1 {
@@ -280,21 +550,33 @@ func findIPv4AndPort(s string) (ip string, port string) {
 	return "", ""
 }
 
-func NewEngine(cfg config.Config, runID string, shim *dp8shim.Shim, log *packetlog.Logger, p *proto.Engine, players *state.PlayerStore) (*Engine, error) {
+func NewEngine(cfg config.Config, runID string, shim Shim, log packetlog.Sink, p *proto.Engine, players *state.PlayerStore) (*Engine, error) {
 	if shim == nil {
 		return nil, errors.New("dp8shim nil")
 	}
-	return &Engine{
+	e := &Engine{
 		cfg:          cfg,
 		runID:        runID,
 		shim:         shim,
 		log:          log,
 		proto:        p,
+		protoHandle:  p.Handle,
 		players:      players,
-		buf:          make([]byte, 64*1024),
-		outQ:         make(chan outMsg, 2048),
+		now:          time.Now,
+		buf:          make([]byte, recvBufSize),
+		sendQ:        newSendQueues(clientSendQueueSize),
+		sendBatch:    max(cfg.SendBatchSize, 1),
+		sendPace:     sendPaceDelay,
+		poll:         newPollBackoff(cfg.PollMin, cfg.PollMax),
 		clientRemote: make(map[uint32]remoteSummary),
-	}, nil
+		hosting:      make(map[uint32]struct{}),
+		limiter:      newClientLimiter(cfg.ClientMsgsPerSec, cfg.ClientBurst),
+	}
+	if cfg.TopTalkers > 0 {
+		e.talkers = newTalkerRates()
+	}
+	e.sweeperPaused.Store(cfg.PlayerSweepPaused)
+	return e, nil
 }
 
 func (e *Engine) Run(ctx context.Context) error {
@@ -313,24 +595,63 @@ func (e *Engine) Run(ctx context.Context) error {
 		})
 	}
 
-	go e.sendWorker(ctx)
-	go e.playerSweeper(ctx)
+	// workers stop with ctx, or early when the loop below exits on its own.
+	workCtx, stopWorkers := context.WithCancel(ctx)
+	defer stopWorkers()
+	sendDone := make(chan struct{})
+	go func() {
+		defer close(sendDone)
+		e.sendWorker(workCtx)
+	}()
+	go e.playerSweeper(workCtx)
+	go e.shimQueueWatcher(workCtx)
+	go e.staleHostWatcher(workCtx)
+
+	idle := time.NewTimer(0)
+	defer idle.Stop()
+	<-idle.C
 
 	for {
 		select {
 		case <-ctx.Done():
+			// Stop taking inbound events, but let queued responses (e.g. connect
+			// bundles mid-handshake) go out before the shim is stopped.
+			<-sendDone
 			return context.Canceled
 		default:
 		}
 
 		evt, payload, ok, err := e.shim.PopEvent(e.buf)
+		if errors.Is(err, dp8shim.ErrClosed) {
+			// StopServer ran under us (shutdown ordering, or the shim was torn
+			// down). That is an orderly stop, not an engine failure; queued sends
+			// can no longer go out.
+			e.shimClosed.Store(true)
+			stopWorkers()
+			<-sendDone
+			slog.Info("dp8 shim closed; engine stopped")
+			return nil
+		}
 		if err != nil {
+			stopWorkers()
+			<-sendDone
 			return err
 		}
 		if !ok {
-			time.Sleep(5 * time.Millisecond)
+			// Wait out the backoff, but wake at once for shutdown; the loop top
+			// handles ctx.
+			idle.Reset(e.poll.idle())
+			select {
+			case <-ctx.Done():
+				idle.Stop()
+			case <-idle.C:
+			}
 			continue
 		}
+		e.poll.reset()
+		if e.capture != nil {
+			e.capture.RecordEvent(evt, payload)
+		}
 
 		if err := e.handleEvent(evt, payload); err != nil {
 			return err
@@ -349,103 +670,321 @@ func (e *Engine) playerSweeper(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case now := <-t.C:
-			evicted := e.players.SweepEvict(now.UTC(), maxPlayerOnlineAge)
-			for _, dpnid := range evicted {
-				slog.Warn("player evicted due to max online age", "dpnid", fmt.Sprintf("0x%08x", dpnid), "max_age_h", 12)
+			e.sweepPlayers(now.UTC())
+			if n := e.players.PurgeEvicted(now.UTC(), e.cfg.EvictedRetention); n > 0 {
+				slog.Info("purged evicted players", "n", n, "retention", e.cfg.EvictedRetention.String())
+			}
+			if e.limiter != nil {
+				e.limiter.prune(now.UTC(), limiterIdle)
+			}
+			if e.talkers != nil {
+				e.talkers.prune(now.UTC(), talkerWindow)
+			}
+			if n := e.pruneClientRemote(); n > 0 {
+				slog.Info("pruned remote entries for departed players", "n", n)
 			}
 		}
 	}
 }
 
-func (e *Engine) sendWorker(ctx context.Context) {
-	const burstDelay = 2 * time.Millisecond
+// forgetClientLocked drops dpnid's per-client state (remote address, hosting
+// role, rate counters, queued sends) and returns its remote and how many queued
+// messages were discarded. e.mu must be held.
+func (e *Engine) forgetClientLocked(dpnid uint32) (remoteSummary, int) {
+	rs := e.clientRemote[dpnid]
+	delete(e.clientRemote, dpnid)
+	delete(e.hosting, dpnid)
+	if e.limiter != nil {
+		e.limiter.forget(dpnid)
+	}
+	if e.talkers != nil {
+		e.talkers.forget(dpnid)
+	}
+	return rs, e.sendQ.forget(dpnid)
+}
+
+// pruneClientRemote drops clientRemote entries whose DPNID has left the
+// PlayerStore (a missed DESTROY_PLAYER/TERMINATE_SESSION) and returns how many.
+// Sends still queued for them are dropped as departed.
+func (e *Engine) pruneClientRemote() int {
+	if e.players == nil {
+		return 0
+	}
+	e.mu.Lock()
+	departed := map[uint32]int{}
+	for dpnid := range e.clientRemote {
+		if !e.players.Has(dpnid) {
+			_, departed[dpnid] = e.forgetClientLocked(dpnid)
+		}
+	}
+	e.mu.Unlock()
+	for dpnid, n := range departed {
+		e.drop(dropDeparted, dpnid, "", n)
+	}
+	return len(departed)
+}
 
+// sweepPlayers runs one eviction pass unless the sweeper is paused.
+func (e *Engine) sweepPlayers(now time.Time) []uint32 {
+	if e.players == nil || e.sweeperPaused.Load() {
+		return nil
+	}
+	evicted := e.players.SweepEvict(now, maxPlayerOnlineAge)
+	for _, dpnid := range evicted {
+		slog.Warn("player evicted due to max online age", "dpnid", fmt.Sprintf("0x%08x", dpnid), "max_age_h", 12)
+	}
+	return evicted
+}
+
+// sendWorker serves the per-client send queues round-robin until ctx is
+// cancelled, then drains what is left.
+func (e *Engine) sendWorker(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
+			e.drainOutQ()
 			return
-		case out := <-e.outQ:
-			b := proto.MakeZText(out.payloadXML)
-			if len(out.tail) > 0 {
-				// Trailer is appended after the NUL terminator.
-				b = append(b, out.tail...)
-			}
+		default:
+		}
+		if e.sendNextBatch() > 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			e.drainOutQ()
+			return
+		case <-e.sendQ.ready:
+		}
+	}
+}
 
-			sendErr := e.shim.SendTo(out.dpnid, b, out.flags)
-			tailNote := ""
-			if len(out.tail) > 0 {
-				tailNote = fmt.Sprintf(" tail=%d", len(out.tail))
-			}
-			if e.log != nil {
-				e.log.Log(packetlog.Record{
-					RunID:       e.runID,
-					Timestamp:   proto.NowTS(),
-					Type:        "dp8",
-					Direction:   "out",
-					Source:      "dpnid=0x00000000",
-					Destination: fmt.Sprintf("dpnid=0x%08x", out.dpnid),
-					Length:      len(b),
-					ReplyMode:   "dp8shim",
-					Tag:         out.tag,
-					Experiment:  out.exp,
-					Message:     fmt.Sprintf("err=%v payload=%s%s", sendErr, out.payloadXML, tailNote),
-				})
+// drainOutQ flushes queued messages until sendQ is empty or sendDrainTimeout passes.
+// After the shim has closed nothing can be sent, so the queue is discarded.
+func (e *Engine) drainOutQ() {
+	if e.shimClosed.Load() {
+		if n := e.sendQ.clear(); n > 0 {
+			slog.Warn("dp8 shim closed; discarding queued sends", "n", n)
+		}
+		return
+	}
+	deadline := time.Now().Add(sendDrainTimeout)
+
+	sent := 0
+	for {
+		if time.Now().After(deadline) {
+			slog.Warn("dp8 send queue drain timed out", "sent", sent, "remaining", e.sendQ.len())
+			return
+		}
+		n := e.sendNextBatch()
+		if n == 0 {
+			if sent > 0 {
+				slog.Info("dp8 send queue drained", "sent", sent)
 			}
-			time.Sleep(burstDelay)
+			return
 		}
+		sent += n
+	}
+}
+
+// sendNextBatch sends up to sendBatch queued messages, then paces once. Pops
+// keep each client's FIFO order. It returns how many were sent.
+func (e *Engine) sendNextBatch() int {
+	n := 0
+	for n < e.sendBatch {
+		out, ok := e.sendQ.pop()
+		if !ok {
+			break
+		}
+		e.send(out)
+		n++
+	}
+	if n > 0 {
+		time.Sleep(e.sendPace)
+	}
+	return n
+}
+
+// enqueue queues out on its client's send queue, dropping (and logging) it when
+// that client's queue is full. Other clients are unaffected.
+func (e *Engine) enqueue(out outMsg) bool {
+	if e.sendQ.push(out) {
+		return true
+	}
+	e.drop(dropQueueFull, out.dpnid, out.tag, 1, "exp", out.exp)
+	return false
+}
+
+// send hands out to the shim in a pooled buffer, recycled once SendTo returns
+// (the shim copies the payload).
+func (e *Engine) send(out outMsg) {
+	buf := getWireBuf()
+	b := out.wireInto(*buf, e.cfg.Proto.Framing)
+	sendErr := e.shim.SendTo(out.dpnid, b, out.flags)
+	n := len(b)
+	*buf = b
+	putWireBuf(buf)
+	e.logOutbound(out, n, func(rec *packetlog.Record) {
+		rec.Message = fmt.Sprintf("err=%v %s", sendErr, rec.Message)
+	})
+}
+
+// wire is the frame handed to SendTo: the XML framed per framing (NUL-terminated
+// by default, see proto.MakeFrameInto) plus any trailer.
+func (out outMsg) wire(framing string) []byte { return out.wireInto(nil, framing) }
+
+// wireInto is wire built in dst's storage.
+func (out outMsg) wireInto(dst []byte, framing string) []byte {
+	b := proto.MakeFrameInto(dst, out.payloadXML, framing)
+	if len(out.tail) > 0 {
+		// Trailer is appended after the frame (the NUL terminator by default).
+		b = append(b, out.tail...)
+	}
+	return b
+}
+
+// record is the outbound telemetry record for out; Message holds the payload,
+// or only its size when withPayload is false.
+func (out outMsg) record(runID string, n int, withPayload bool) packetlog.Record {
+	tailNote := ""
+	if len(out.tail) > 0 {
+		tailNote = fmt.Sprintf(" tail=%d", len(out.tail))
+	}
+	msg := fmt.Sprintf("payload=%s%s", out.payloadXML, tailNote)
+	if !withPayload {
+		msg = fmt.Sprintf("payload_len=%d%s", len(out.payloadXML), tailNote)
+	}
+	return packetlog.Record{
+		RunID:       runID,
+		Timestamp:   proto.NowTS(),
+		Type:        "dp8",
+		Direction:   "out",
+		Source:      "dpnid=0x00000000",
+		Destination: fmt.Sprintf("dpnid=0x%08x", out.dpnid),
+		Length:      n,
+		ReplyMode:   "dp8shim",
+		Tag:         out.tag,
+		Experiment:  out.exp,
+		Message:     msg,
 	}
 }
 
-func (e *Engine) handleEvent(evt dp8shim.Event, payload []byte) error {
+// growRecvBuf doubles the receive buffer up to maxRecvBufSize so the next payload
+// of this size arrives whole. The message that triggered it is already lost.
+func (e *Engine) growRecvBuf() {
+	if len(e.buf) >= maxRecvBufSize {
+		return
+	}
+	n := min(2*len(e.buf), maxRecvBufSize)
+	slog.Info("dp8 receive buffer grown after truncation", "from", len(e.buf), "to", n)
+	e.buf = make([]byte, n)
+}
+
+// handleEvent processes one shim event. A panic while handling it (a parser or
+// handler bug hit by a malformed payload) is logged and recorded, and the event
+// is dropped, so one bad message cannot take down every session.
+func (e *Engine) handleEvent(evt dp8shim.Event, payload []byte) (err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		e.handlerPanics.Add(1)
+		slog.Error(
+			"dp8 event handler panicked; event dropped",
+			"dpnid", fmt.Sprintf("0x%08x", evt.DPNID),
+			"msg", dp8MsgName(evt.MsgID),
+			"len", len(payload),
+			"tag_hint", safeTagHint(payload),
+			"panic", fmt.Sprint(r),
+			"stack", string(debug.Stack()),
+		)
+		if e.log != nil {
+			e.log.Log(packetlog.Record{
+				RunID:      e.runID,
+				Timestamp:  proto.NowTS(),
+				Type:       "dp8",
+				Direction:  "in",
+				Source:     fmt.Sprintf("dpnid=0x%08x", evt.DPNID),
+				Length:     len(payload),
+				ReplyMode:  "dp8shim",
+				Experiment: "panic",
+				Message:    fmt.Sprintf("msg=%s tag_hint=%s panic=%v", dp8MsgName(evt.MsgID), safeTagHint(payload), r),
+			})
+		}
+		err = nil
+	}()
+	return e.processEvent(evt, payload)
+}
+
+func (e *Engine) processEvent(evt dp8shim.Event, payload []byte) error {
+	sessionSecs := int64(-1) // set on disconnect of a known player
 	switch evt.MsgID {
 	case dpnMsgIDCreatePlayer:
 		var rs remoteSummary
 		if len(payload) > 0 {
 			rs = parseRemoteFromDP8URL(string(payload))
 		}
+		// In the store before clientRemote, so pruneClientRemote never sees a
+		// fresh entry without its player.
+		if e.players != nil {
+			e.players.Upsert(evt.DPNID, e.now().UTC())
+		}
 		e.mu.Lock()
 		if rs.ip == "" && rs.port == "" && rs.hostLen == 0 && (e.lastIndicate.ip != "" || e.lastIndicate.port != "" || e.lastIndicate.hostLen != 0) {
 			rs = e.lastIndicate
 		}
-		if rs.ip != "" || rs.port != "" || rs.hostLen != 0 {
+		if !rs.empty() {
 			e.clientRemote[evt.DPNID] = rs
 		}
 		e.mu.Unlock()
 		if e.players != nil {
-			e.players.Upsert(evt.DPNID, time.Now().UTC())
+			// Lets a session back after a quick restart resume its snapshot entry.
+			e.players.SetRemoteIP(evt.DPNID, rs.ip, e.now().UTC())
 		}
 		attrs := []any{"dpnid", fmt.Sprintf("0x%08x", evt.DPNID)}
-		if rs.ip != "" {
-			attrs = append(attrs, "remote_ip", rs.ip)
-		}
-		if rs.port != "" {
-			attrs = append(attrs, "remote_port", rs.port)
-		}
-		if rs.ip == "" && rs.hostLen > 0 {
-			attrs = append(attrs, "remote_host_len", rs.hostLen)
-		}
+		attrs = append(attrs, rs.connectAttrs()...)
 		slog.Info("dp8 client connected", attrs...)
+		e.enforceIPRolesOnConnect(evt.DPNID, rs.ip)
 	case dpnMsgIDDestroyPlayer:
 		e.mu.Lock()
-		rs := e.clientRemote[evt.DPNID]
-		delete(e.clientRemote, evt.DPNID)
+		rs, departed := e.forgetClientLocked(evt.DPNID)
 		e.mu.Unlock()
-		if e.players != nil && !e.players.Remove(evt.DPNID) {
-			slog.Warn("dp8 client disconnected but not present in PlayerStore", "dpnid", fmt.Sprintf("0x%08x", evt.DPNID))
+		e.drop(dropDeparted, evt.DPNID, "", departed)
+		if e.proto != nil {
+			e.proto.Departed(evt.DPNID)
 		}
 		attrs := []any{"dpnid", fmt.Sprintf("0x%08x", evt.DPNID)}
-		if rs.ip != "" {
-			attrs = append(attrs, "remote_ip", rs.ip)
-		}
-		if rs.port != "" {
-			attrs = append(attrs, "remote_port", rs.port)
-		}
-		if rs.ip == "" && rs.hostLen > 0 {
-			attrs = append(attrs, "remote_host_len", rs.hostLen)
+		if e.players != nil {
+			if d, ok := e.players.RemoveSession(evt.DPNID, e.now().UTC()); ok {
+				sessionSecs = int64(d / time.Second)
+				attrs = append(attrs, "duration_s", sessionSecs)
+			} else {
+				slog.Warn("dp8 client disconnected but not present in PlayerStore", "dpnid", fmt.Sprintf("0x%08x", evt.DPNID))
+			}
 		}
+		attrs = append(attrs, rs.addrAttrs()...)
 		slog.Info("dp8 client disconnected", attrs...)
 	case dpnMsgIDTerminateSession:
-		slog.Info("dp8 session terminated", "dpnid", fmt.Sprintf("0x%08x", evt.DPNID))
+		// TERMINATE_SESSION can arrive without a DESTROY_PLAYER for the DPNID; drop
+		// its per-client state the same way so nothing leaks.
+		attrs := []any{"dpnid", fmt.Sprintf("0x%08x", evt.DPNID)}
+		if evt.DPNID != 0 {
+			e.mu.Lock()
+			rs, departed := e.forgetClientLocked(evt.DPNID)
+			e.mu.Unlock()
+			e.drop(dropDeparted, evt.DPNID, "", departed)
+			if e.proto != nil {
+				e.proto.Departed(evt.DPNID)
+			}
+			if e.players != nil {
+				if d, ok := e.players.RemoveSession(evt.DPNID, e.now().UTC()); ok {
+					sessionSecs = int64(d / time.Second)
+					attrs = append(attrs, "duration_s", sessionSecs)
+				}
+			}
+			attrs = append(attrs, rs.addrAttrs()...)
+		}
+		slog.Info("dp8 session terminated", attrs...)
 	case dpnMsgIDIndicateConnect, dpnMsgIDConnectComplete:
 		if evt.MsgID == dpnMsgIDIndicateConnect && len(payload) > 0 {
 			e.mu.Lock()
@@ -467,44 +1006,82 @@ func (e *Engine) handleEvent(evt dp8shim.Event, payload []byte) error {
 		Experiment: "event",
 		Message:    fmt.Sprintf("msg=%s msg_id=0x%08x flags=0x%08x ts_unix_ms=%d", dp8MsgName(evt.MsgID), evt.MsgID, evt.Flags, evt.TSUnixMS),
 	}
+	if sessionSecs >= 0 {
+		rec.Message += fmt.Sprintf(" duration_s=%d", sessionSecs)
+	}
+
+	e.logRawInbound(rec, payload)
+
+	if evt.MsgID == dpnMsgIDReceive && e.talkers != nil {
+		e.talkers.observe(evt.DPNID, time.Now())
+	}
+
+	if evt.MsgID == dpnMsgIDReceive && e.cfg.Proto.Framing == proto.FramingLenPrefix {
+		// proto.framing "len": the message is inside the frame. A frame shorter
+		// than it declares stays as is and counts as non-XML below.
+		if body, err := proto.UnframeLenPrefixed(payload); err == nil {
+			payload = body
+		}
+	}
+
+	isXML := len(payload) > 0 && payload[0] == '<'
+	if evt.MsgID == dpnMsgIDReceive && !isXML {
+		// Not an app-protocol frame; a high count suggests a client protocol variant.
+		e.recvNonXML.Add(1)
+	}
 
 	// App protocol: NUL-terminated XML-ish messages.
-	if len(payload) > 0 && payload[0] == '<' {
+	if isXML {
+		if evt.Truncated() {
+			// A partial frame must not be parsed.
+			e.dropRecv(&rec, dropTruncated, evt.DPNID, "", 1, "len", len(payload), "tag_hint", safeTagHint(payload))
+			if len(payload) >= len(e.buf) {
+				e.growRecvBuf()
+			}
+			return nil
+		}
+		if looksBinary(payload) {
+			// A truncated or binary frame that happens to start with '<' would parse into
+			// garbage attributes.
+			e.dropRecv(&rec, dropBinary, evt.DPNID, "", 1, "len", len(payload), "tag_hint", safeTagHint(payload))
+			return nil
+		}
 		if e.players != nil && e.players.IsEvicted(evt.DPNID) {
 			// Hard session cap: do not process or respond to app-protocol messages for evicted sessions.
-			slog.Warn("dropping proto message from evicted player", "dpnid", fmt.Sprintf("0x%08x", evt.DPNID), "len", len(payload), "tag_hint", safeTagHint(payload))
-			if e.log != nil {
-				e.log.Log(rec)
-			}
+			e.dropRecv(&rec, dropEvicted, evt.DPNID, "", 1, "len", len(payload), "tag_hint", safeTagHint(payload))
 			return nil
 		}
-		msg, ok := proto.Parse(string(payload))
-		if !ok {
+		msg, err := proto.ParseWith(string(payload), proto.ParseOptions{
+			Strict:     e.cfg.Proto.StrictParse,
+			MaxAttrs:   e.cfg.Proto.MaxAttrs,
+			MaxAttrLen: e.cfg.Proto.MaxAttrLen,
+		})
+		if errors.Is(err, proto.ErrAttrLimit) {
+			e.dropRecv(&rec, dropAttrLimit, evt.DPNID, "", 1, "len", len(payload), "tag_hint", safeTagHint(payload), "err", err)
+			return nil
+		}
+		if err != nil {
+			e.recvXMLParseFailed.Add(1)
 			slog.Warn(
 				"proto message parse failed",
 				"dpnid", fmt.Sprintf("0x%08x", evt.DPNID),
 				"msg", dp8MsgName(evt.MsgID),
 				"len", len(payload),
 				"tag_hint", safeTagHint(payload),
+				"strict", e.cfg.Proto.StrictParse,
 			)
 		} else {
+			e.recvXMLParsed.Add(1)
 			rec.Tag = msg.Tag
-
-			remoteAttrs := func(dpnid uint32) []any {
-				e.mu.RLock()
-				rs := e.clientRemote[dpnid]
-				e.mu.RUnlock()
-				attrs := make([]any, 0, 4)
-				if rs.ip != "" {
-					attrs = append(attrs, "remote_ip", rs.ip)
-				}
-				if rs.port != "" {
-					attrs = append(attrs, "remote_port", rs.port)
-				}
-				if rs.ip == "" && rs.hostLen > 0 {
-					attrs = append(attrs, "remote_host_len", rs.hostLen)
+			if len(msg.Dupes) > 0 {
+				// Last value wins; a repeated key is malformed or probing, so surface it.
+				attrs := []any{
+					"dpnid", fmt.Sprintf("0x%08x", evt.DPNID),
+					"tag", msg.Tag,
+					"keys", strings.Join(msg.Dupes, ","),
 				}
-				return attrs
+				attrs = append(attrs, e.remoteAttrs(evt.DPNID)...)
+				slog.Warn("proto message has duplicate attributes", attrs...)
 			}
 
 			// Structured lifecycle logging (sanitized; do not log raw strings).
@@ -515,7 +1092,7 @@ func (e *Engine) handleEvent(evt dp8shim.Event, payload []byte) error {
 					"cx", msg.Attrs["Cx"],
 					"proto_ver", msg.Attrs["ProtoVer"],
 				}
-				attrs = append(attrs, remoteAttrs(evt.DPNID)...)
+				attrs = append(attrs, e.remoteAttrs(evt.DPNID)...)
 				slog.Info(
 					"client connect request",
 					attrs...,
@@ -527,7 +1104,7 @@ func (e *Engine) handleEvent(evt dp8shim.Event, payload []byte) error {
 						"dpnid", fmt.Sprintf("0x%08x", evt.DPNID),
 						"cx", msg.Attrs["Cx"],
 					}
-					attrs = append(attrs, remoteAttrs(evt.DPNID)...)
+					attrs = append(attrs, e.remoteAttrs(evt.DPNID)...)
 					slog.Warn("host state update with 0 items", attrs...)
 				}
 				attrs := []any{
@@ -538,7 +1115,7 @@ func (e *Engine) handleEvent(evt dp8shim.Event, payload []byte) error {
 					"has_del", hs.hasDel,
 					"item_ids", strings.Join(hs.itemIDs, ","),
 				}
-				attrs = append(attrs, remoteAttrs(evt.DPNID)...)
+				attrs = append(attrs, e.remoteAttrs(evt.DPNID)...)
 				slog.Info("host state update", attrs...)
 			case "SetLoc":
 				kind, n := summarizeLocation(msg.Attrs["Location"])
@@ -549,7 +1126,7 @@ func (e *Engine) handleEvent(evt dp8shim.Event, payload []byte) error {
 					"kind", kind,
 					"len", n,
 				}
-				attrs = append(attrs, remoteAttrs(evt.DPNID)...)
+				attrs = append(attrs, e.remoteAttrs(evt.DPNID)...)
 				slog.Info("location update", attrs...)
 			case "HdrRow":
 				attrs := []any{
@@ -557,7 +1134,7 @@ func (e *Engine) handleEvent(evt dp8shim.Event, payload []byte) error {
 					"cx", msg.Attrs["Cx"],
 					"vid", msg.Attrs["Vid"],
 				}
-				attrs = append(attrs, remoteAttrs(evt.DPNID)...)
+				attrs = append(attrs, e.remoteAttrs(evt.DPNID)...)
 				slog.Info("header row request", attrs...)
 			case "Page":
 				attrs := []any{
@@ -566,7 +1143,7 @@ func (e *Engine) handleEvent(evt dp8shim.Event, payload []byte) error {
 					"vid", msg.Attrs["Vid"],
 					"page_no", msg.Attrs["PageNo"],
 				}
-				attrs = append(attrs, remoteAttrs(evt.DPNID)...)
+				attrs = append(attrs, e.remoteAttrs(evt.DPNID)...)
 				slog.Info("page request", attrs...)
 			case "RowPg":
 				// Details refresh for a selected row.
@@ -576,8 +1153,16 @@ func (e *Engine) handleEvent(evt dp8shim.Event, payload []byte) error {
 					"vid", msg.Attrs["Vid"],
 					"rid", msg.Attrs["Rid"],
 				}
-				attrs = append(attrs, remoteAttrs(evt.DPNID)...)
+				attrs = append(attrs, e.remoteAttrs(evt.DPNID)...)
 				slog.Info("game details request", attrs...)
+			case "Join":
+				attrs := []any{
+					"dpnid", fmt.Sprintf("0x%08x", evt.DPNID),
+					"cx", msg.Attrs["Cx"],
+					"rid", msg.Attrs["Rid"],
+				}
+				attrs = append(attrs, e.remoteAttrs(evt.DPNID)...)
+				slog.Info("join request", attrs...)
 			default:
 				// Unknown message: still handled by proto engine fallback to keep the UI moving,
 				// but log at warn level for visibility.
@@ -586,17 +1171,44 @@ func (e *Engine) handleEvent(evt dp8shim.Event, payload []byte) error {
 					"tag", msg.Tag,
 					"attr_keys", strings.Join(sortedAttrKeys(msg.Attrs), ","),
 				}
-				attrs = append(attrs, remoteAttrs(evt.DPNID)...)
+				attrs = append(attrs, e.remoteAttrs(evt.DPNID)...)
 				slog.Warn("unrecognized proto message", attrs...)
 			}
 
-			// NDJSON (optional) keeps full attribute details for debugging.
-			rec.Message = fmt.Sprintf("%s attrs=%v", rec.Message, msg.Attrs)
+			// NDJSON (optional) keeps full attribute details for debugging, unless a
+			// raw payload sink holds them instead.
+			if e.raw != nil {
+				rec.Message = fmt.Sprintf("%s %s", rec.Message, attrKeysNote(msg.Attrs))
+			} else {
+				rec.Message = fmt.Sprintf("%s attrs=%v", rec.Message, msg.Attrs)
+			}
+
+			if e.limiter != nil {
+				if ok, started := e.limiter.allow(evt.DPNID, time.Now()); !ok {
+					if started {
+						attrs := []any{
+							"dpnid", fmt.Sprintf("0x%08x", evt.DPNID),
+							"tag", msg.Tag,
+							"rate", e.cfg.ClientMsgsPerSec,
+							"burst", e.cfg.ClientBurst,
+						}
+						attrs = append(attrs, e.remoteAttrs(evt.DPNID)...)
+						slog.Warn("client over rate limit; dropping requests", attrs...)
+					}
+					e.dropRecv(&rec, dropRateLimited, evt.DPNID, msg.Tag, 1)
+					return nil
+				}
+			}
+
+			if msg.Tag == "HostData" && !e.promoteHost(evt.DPNID) {
+				e.dropRecv(&rec, dropHostCap, evt.DPNID, msg.Tag, 1)
+				return nil
+			}
 
 			e.mu.RLock()
 			rs := e.clientRemote[evt.DPNID]
 			e.mu.RUnlock()
-			outs := e.proto.Handle(time.Now().UTC(), evt.DPNID, rs.ip, msg)
+			outs := e.handleTimed(evt.DPNID, rs.ip, msg)
 			for _, out := range outs {
 				switch out.Exp {
 				case "send-fallback":
@@ -605,7 +1217,7 @@ func (e *Engine) handleEvent(evt dp8shim.Event, payload []byte) error {
 						"tag", msg.Tag,
 						"resp_tag", out.Tag,
 					}
-					attrs = append(attrs, remoteAttrs(evt.DPNID)...)
+					attrs = append(attrs, e.remoteAttrs(evt.DPNID)...)
 					slog.Warn("proto fallback response used", attrs...)
 				case "send-rowpg-miss":
 					attrs := []any{
@@ -613,7 +1225,7 @@ func (e *Engine) handleEvent(evt dp8shim.Event, payload []byte) error {
 						"vid", msg.Attrs["Vid"],
 						"rid", msg.Attrs["Rid"],
 					}
-					attrs = append(attrs, remoteAttrs(evt.DPNID)...)
+					attrs = append(attrs, e.remoteAttrs(evt.DPNID)...)
 					slog.Warn("game details request for unknown rid", attrs...)
 				}
 			}
@@ -623,34 +1235,14 @@ func (e *Engine) handleEvent(evt dp8shim.Event, payload []byte) error {
 				case "ConnectRes", "ConInfoRes", "ConnectEv":
 					flags = dpnSendSyncGuaranteed
 				}
-				select {
-				case e.outQ <- outMsg{
+				e.enqueue(outMsg{
 					dpnid:      evt.DPNID,
 					tag:        out.Tag,
 					exp:        out.Exp,
 					payloadXML: out.PayloadXML,
 					tail:       out.Tail,
 					flags:      flags,
-				}:
-				default:
-					slog.Warn(
-						"dp8 send queue full; dropping outbound",
-						"dpnid", fmt.Sprintf("0x%08x", evt.DPNID),
-						"tag", out.Tag,
-						"exp", out.Exp,
-					)
-					if e.log != nil {
-						e.log.Log(packetlog.Record{
-							RunID:      e.runID,
-							Timestamp:  proto.NowTS(),
-							Type:       "event",
-							ReplyMode:  "dp8shim",
-							Experiment: "sendq",
-							Tag:        out.Tag,
-							Message:    "drop: send queue full",
-						})
-					}
-				}
+				})
 			}
 		}
 	}
@@ -661,6 +1253,14 @@ func (e *Engine) handleEvent(evt dp8shim.Event, payload []byte) error {
 	return nil
 }
 
+// remoteAttrs returns the slog attrs for dpnid's recorded remote address, if any.
+func (e *Engine) remoteAttrs(dpnid uint32) []any {
+	e.mu.RLock()
+	rs := e.clientRemote[dpnid]
+	e.mu.RUnlock()
+	return rs.addrAttrs()
+}
+
 func sortedAttrKeys(m map[string]string) []string {
 	if len(m) == 0 {
 		return nil
@@ -673,6 +1273,24 @@ func sortedAttrKeys(m map[string]string) []string {
 	return keys
 }
 
+// looksBinary reports whether an app-protocol payload is not text: invalid UTF-8,
+// or more than one in ten characters a control byte. Trailing NULs (the frame
+// terminator) and ordinary whitespace do not count.
+func looksBinary(payload []byte) bool {
+	b := bytes.TrimRight(payload, "\x00")
+	if !utf8.Valid(b) {
+		return true
+	}
+	var n, ctrl int
+	for _, r := range string(b) {
+		n++
+		if (r < 0x20 && r != '\t' && r != '\n' && r != '\r') || r == 0x7f {
+			ctrl++
+		}
+	}
+	return ctrl*10 > n
+}
+
 func safeTagHint(payload []byte) string {
 	// Extract a best-effort `<Tag` hint without logging any user-entered values.
 	// Only returns characters from a safe set.
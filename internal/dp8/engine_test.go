@@ -0,0 +1,1483 @@
+package dp8
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"open-zone/internal/config"
+	"open-zone/internal/dp8shim"
+	"open-zone/internal/dp8shim/fakeshim"
+	"open-zone/internal/dp8shim/replayshim"
+	"open-zone/internal/packetlog"
+	"open-zone/internal/proto"
+	"open-zone/internal/state"
+)
+
+func newTestEngine(t *testing.T, cfg config.Config, players *state.PlayerStore) *Engine {
+	t.Helper()
+	e, err := NewEngine(cfg, "run-test", fakeshim.New(), nil, nil, players)
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	return e
+}
+
+// outbound returns the records for messages sent to clients.
+func outbound(sink *packetlog.MemorySink) []packetlog.Record {
+	return sink.Filter(func(r packetlog.Record) bool { return r.Direction == "out" })
+}
+
+func TestEngine_SweeperPauseResume(t *testing.T) {
+	players := state.NewPlayerStore()
+	start := time.Unix(1700000000, 0).UTC()
+	players.Upsert(0x1, start)
+
+	e := newTestEngine(t, config.Config{PlayerSweepPaused: true}, players)
+	if !e.Stats().SweeperPaused {
+		t.Fatalf("expected paused from config")
+	}
+
+	later := start.Add(maxPlayerOnlineAge + time.Minute)
+	if got := e.sweepPlayers(later); len(got) != 0 {
+		t.Fatalf("paused sweep evicted %v", got)
+	}
+	if players.IsEvicted(0x1) {
+		t.Fatalf("player evicted while paused")
+	}
+
+	e.SetSweeperPaused(false)
+	if e.Stats().SweeperPaused {
+		t.Fatalf("expected resumed")
+	}
+	if got := e.sweepPlayers(later); len(got) != 1 || got[0] != 0x1 {
+		t.Fatalf("resumed sweep evicted %v", got)
+	}
+	if !players.IsEvicted(0x1) {
+		t.Fatalf("player not evicted after resume")
+	}
+}
+
+func createPlayer(t *testing.T, e *Engine, dpnid uint32, ip string) {
+	t.Helper()
+	url := "x-directplay:/provider=%7BEBFE7BA0-628D-11D2-AE0F-006097B01411%7D;hostname=" + ip + ";port=2302"
+	if err := e.handleEvent(dp8shim.Event{MsgID: dpnMsgIDCreatePlayer, DPNID: dpnid}, []byte(url)); err != nil {
+		t.Fatalf("create player: %v", err)
+	}
+}
+
+func receive(t *testing.T, e *Engine, dpnid uint32, payload string) {
+	t.Helper()
+	if err := e.handleEvent(dp8shim.Event{MsgID: dpnMsgIDReceive, DPNID: dpnid}, []byte(payload+"\x00")); err != nil {
+		t.Fatalf("receive: %v", err)
+	}
+}
+
+const testHostData = `<HostData Cx="0x0"><HostData><New><Item ItemId="0" GName="g" Map="m" /></New></HostData></HostData>`
+
+func TestEngine_PerIPRoleCaps(t *testing.T) {
+	players := state.NewPlayerStore()
+	hosts := state.NewHostStore()
+	pe := proto.NewEngine(proto.EngineConfig{Port: 2300}, hosts, players)
+	shim := fakeshim.New()
+	e, err := NewEngine(config.Config{MaxHostsPerIP: 1, MaxBrowsersPerIP: 2}, "run-test", shim, nil, pe, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const ip = "203.0.113.5"
+	// Three sessions fit (1 host + 2 browsers); the fourth exceeds the total.
+	for _, id := range []uint32{0x1, 0x2, 0x3, 0x4} {
+		createPlayer(t, e, id, ip)
+	}
+	if players.IsEvicted(0x1) || players.IsEvicted(0x2) || players.IsEvicted(0x3) {
+		t.Fatalf("sessions within cap were evicted")
+	}
+	if !players.IsEvicted(0x4) {
+		t.Fatalf("session beyond total cap not evicted")
+	}
+
+	// First host is allowed; a second host from the same IP is evicted and not stored.
+	receive(t, e, 0x1, testHostData)
+	receive(t, e, 0x2, testHostData)
+	if players.IsEvicted(0x1) {
+		t.Fatalf("first host evicted")
+	}
+	if !players.IsEvicted(0x2) {
+		t.Fatalf("second host from same IP not evicted")
+	}
+	if got := hosts.VisibleGamesCount(); got != 1 {
+		t.Fatalf("VisibleGamesCount=%d want 1", got)
+	}
+
+	// Rejected sessions are disconnected, not just ignored.
+	if got := shim.DisconnectedIDs(); !slices.Equal(got, []uint32{0x4, 0x2}) {
+		t.Fatalf("disconnected=%v want [0x4 0x2]", got)
+	}
+
+	// Other IPs are unaffected.
+	createPlayer(t, e, 0x10, "198.51.100.7")
+	receive(t, e, 0x10, testHostData)
+	if players.IsEvicted(0x10) {
+		t.Fatalf("other IP evicted")
+	}
+}
+
+func TestEngine_PerIPHostCapWithoutBrowserCap(t *testing.T) {
+	players := state.NewPlayerStore()
+	pe := proto.NewEngine(proto.EngineConfig{Port: 2300}, state.NewHostStore(), players)
+	e, err := NewEngine(config.Config{MaxHostsPerIP: 1}, "run-test", fakeshim.New(), nil, pe, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const ip = "203.0.113.5"
+	for id := uint32(1); id <= 5; id++ {
+		createPlayer(t, e, id, ip)
+	}
+	if players.Count() != 5 {
+		t.Fatalf("Count=%d; max_browsers_per_ip=0 must not limit browsers", players.Count())
+	}
+	receive(t, e, 0x1, testHostData)
+	receive(t, e, 0x2, testHostData)
+	if players.IsEvicted(0x1) || !players.IsEvicted(0x2) {
+		t.Fatalf("evicted 0x1=%v 0x2=%v; want the host cap enforced", players.IsEvicted(0x1), players.IsEvicted(0x2))
+	}
+}
+
+func TestEngine_ReceiveClassificationCounters(t *testing.T) {
+	players := state.NewPlayerStore()
+	pe := proto.NewEngine(proto.EngineConfig{Port: 2300}, state.NewHostStore(), players)
+	e, err := NewEngine(config.Config{}, "run-test", fakeshim.New(), nil, pe, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(payload []byte) {
+		t.Helper()
+		if err := e.handleEvent(dp8shim.Event{MsgID: dpnMsgIDReceive, DPNID: 0x1}, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send([]byte{0x7f, 0x00, 0x01})                // binary frame
+	send([]byte("hello\x00"))                     // text, not XML
+	send([]byte("<\x00"))                         // '<' but unparseable
+	send([]byte(`<Connect Cx="0x1" />` + "\x00")) // ok
+	send([]byte(`<HdrRow Cx="0x2" Vid="101" />` + "\x00"))
+
+	// Non-RECEIVE events are not classified.
+	if err := e.handleEvent(dp8shim.Event{MsgID: dpnMsgIDIndicateConnect}, []byte("x-directplay:/hostname=203.0.113.9")); err != nil {
+		t.Fatal(err)
+	}
+
+	st := e.Stats()
+	if st.RecvNonXML != 2 || st.RecvXMLParseFailed != 1 || st.RecvXMLParsed != 2 {
+		t.Fatalf("non_xml=%d parse_failed=%d parsed=%d", st.RecvNonXML, st.RecvXMLParseFailed, st.RecvXMLParsed)
+	}
+}
+
+func TestEngine_HandlerPanicDropsEventOnly(t *testing.T) {
+	players := state.NewPlayerStore()
+	pe := proto.NewEngine(proto.EngineConfig{Port: 2300}, state.NewHostStore(), players)
+	sink := &packetlog.MemorySink{}
+	e, err := NewEngine(config.Config{}, "run-test", fakeshim.New(), sink, pe, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handle := e.protoHandle
+	e.protoHandle = func(now time.Time, dpnid uint32, ip string, msg proto.Msg) []proto.Outbound {
+		if msg.Tag == "Boom" {
+			panic("handler bug")
+		}
+		return handle(now, dpnid, ip, msg)
+	}
+
+	evt := dp8shim.Event{MsgID: dpnMsgIDReceive, DPNID: 0x1}
+	if err := e.handleEvent(evt, []byte(`<Boom Cx="0x1" />`+"\x00")); err != nil {
+		t.Fatalf("panicking event returned %v", err)
+	}
+	if err := e.handleEvent(evt, []byte(`<HdrRow Cx="0x2" Vid="101" />`+"\x00")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := e.Stats().HandlerPanics; got != 1 {
+		t.Fatalf("HandlerPanics=%d want 1", got)
+	}
+	if n := e.sendQ.len(); n != 1 {
+		t.Fatalf("sendQ has %d messages after the panic, want the HdrRowRes", n)
+	}
+	panics := sink.Filter(func(r packetlog.Record) bool { return r.Experiment == "panic" })
+	if len(panics) != 1 || panics[0].Source != "dpnid=0x00000001" || !strings.Contains(panics[0].Message, "tag_hint=Boom") {
+		t.Fatalf("panic records=%+v", panics)
+	}
+}
+
+func TestEngine_SlowHandlerLogsWarning(t *testing.T) {
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	players := state.NewPlayerStore()
+	pe := proto.NewEngine(proto.EngineConfig{Port: 2300}, state.NewHostStore(), players)
+	// The limit is far above a fast handler's run time and far below the slow
+	// one's, so scheduler hiccups on a loaded CI box do not flip the result.
+	const limit = 100 * time.Millisecond
+	e, err := NewEngine(config.Config{HandlerTimeout: limit}, "run-test", fakeshim.New(), nil, pe, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handle := e.protoHandle
+	e.protoHandle = func(now time.Time, dpnid uint32, ip string, msg proto.Msg) []proto.Outbound {
+		switch msg.Tag {
+		case "HostData":
+			time.Sleep(3 * limit)
+		case "Boom":
+			panic("handler bug")
+		}
+		return handle(now, dpnid, ip, msg)
+	}
+
+	evt := dp8shim.Event{MsgID: dpnMsgIDReceive, DPNID: 0x1}
+	if err := e.handleEvent(evt, []byte(`<HdrRow Cx="0x1" Vid="101" />`+"\x00")); err != nil {
+		t.Fatal(err)
+	}
+	// A panicking handler returns at once; its timer must not fire later.
+	if err := e.handleEvent(evt, []byte(`<Boom Cx="0x2" />`+"\x00")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * limit)
+	if strings.Contains(logs.String(), "proto handler over timeout") || e.Stats().SlowHandlers != 0 {
+		t.Fatalf("fast or panicking handler warned: %s", logs.String())
+	}
+	if err := e.handleEvent(evt, []byte(testHostData+"\x00")); err != nil {
+		t.Fatal(err)
+	}
+
+	out := logs.String()
+	if !strings.Contains(out, `"msg":"proto handler over timeout; event loop stalled","tag":"HostData","dpnid":"0x00000001"`) ||
+		!strings.Contains(out, `"msg":"slow proto handler finished","tag":"HostData"`) {
+		t.Fatalf("logs=%s", out)
+	}
+	if got := e.Stats().SlowHandlers; got != 1 {
+		t.Fatalf("SlowHandlers=%d want 1", got)
+	}
+	// The slow message was still handled.
+	if n := e.sendQ.len(); n != 2 {
+		t.Fatalf("sendQ=%d want HdrRowRes and HostDataRes", n)
+	}
+}
+
+func TestEngine_PerClientRateLimit(t *testing.T) {
+	players := state.NewPlayerStore()
+	pe := proto.NewEngine(proto.EngineConfig{Port: 2300}, state.NewHostStore(), players)
+	// 1 msg/s refill keeps the test independent of wall-clock jitter.
+	e, err := NewEngine(config.Config{ClientMsgsPerSec: 1, ClientBurst: 3}, "run-test", fakeshim.New(), nil, pe, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createPlayer(t, e, 0x1, "203.0.113.5")
+	createPlayer(t, e, 0x2, "198.51.100.7")
+
+	drain := func() (n int) {
+		for {
+			if _, ok := e.sendQ.pop(); !ok {
+				return n
+			}
+			n++
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		receive(t, e, 0x1, `<Page Cx="0x1" Vid="101" PageNo="0" Num="0" Str="" />`)
+	}
+	if got := drain(); got != 3 {
+		t.Fatalf("offender responses=%d want 3 (burst)", got)
+	}
+	for i := 0; i < 2; i++ {
+		receive(t, e, 0x2, `<Page Cx="0x1" Vid="101" PageNo="0" Num="0" Str="" />`)
+	}
+	if got := drain(); got != 2 {
+		t.Fatalf("well-behaved client responses=%d want 2", got)
+	}
+	if got := e.Stats().RecvThrottled; got != 7 {
+		t.Fatalf("RecvThrottled=%d want 7", got)
+	}
+
+	// Disconnect frees the bucket.
+	if err := e.handleEvent(dp8shim.Event{MsgID: dpnMsgIDDestroyPlayer, DPNID: 0x1}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.limiter.len(); got != 1 {
+		t.Fatalf("buckets after disconnect=%d want 1", got)
+	}
+	if got := e.limiter.prune(time.Now().Add(2*limiterIdle), limiterIdle); got != 1 || e.limiter.len() != 0 {
+		t.Fatalf("prune removed %d, left %d", got, e.limiter.len())
+	}
+}
+
+func TestClientLimiter_PruneWaitsForRefill(t *testing.T) {
+	// 30 tokens at 0.01/s take 50 minutes to refill, longer than limiterIdle.
+	l := newClientLimiter(0.01, 30)
+	now := time.Now()
+	for i := 0; i < 30; i++ {
+		l.allow(0x1, now)
+	}
+	if got := l.prune(now.Add(2*limiterIdle), limiterIdle); got != 0 {
+		t.Fatalf("pruned %d buckets still refilling", got)
+	}
+	if got := l.prune(now.Add(51*time.Minute), limiterIdle); got != 1 {
+		t.Fatalf("pruned %d refilled buckets, want 1", got)
+	}
+}
+
+func TestEngine_TopTalkersRanksInboundTraffic(t *testing.T) {
+	players := state.NewPlayerStore()
+	pe := proto.NewEngine(proto.EngineConfig{Port: 2300}, state.NewHostStore(), players)
+	e, err := NewEngine(config.Config{TopTalkers: 2}, "run-test", fakeshim.New(), nil, pe, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(dpnid uint32, n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			if err := e.handleEvent(dp8shim.Event{MsgID: dpnMsgIDReceive, DPNID: dpnid}, []byte(`<HdrRow Cx="0x1" Vid="101" />`+"\x00")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	send(0x1, 3)
+	send(0x2, 12)
+	send(0x3, 7)
+
+	top := e.Stats().TopTalkers
+	if len(top) != 2 || top[0].DPNID != 0x2 || top[0].Msgs != 12 || top[1].DPNID != 0x3 || top[1].Msgs != 7 {
+		t.Fatalf("TopTalkers=%+v want 0x2 (12), 0x3 (7)", top)
+	}
+
+	// Counters go with the client.
+	if err := e.handleEvent(dp8shim.Event{MsgID: dpnMsgIDDestroyPlayer, DPNID: 0x2}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if top := e.Stats().TopTalkers; len(top) != 2 || top[0].DPNID != 0x3 || top[1].DPNID != 0x1 {
+		t.Fatalf("after disconnect TopTalkers=%+v", top)
+	}
+	if n := e.talkers.len(); n != 2 {
+		t.Fatalf("talkers tracked=%d want 2", n)
+	}
+
+	// limits.top_talkers: 0 turns counting off.
+	off, err := NewEngine(config.Config{}, "run-test", fakeshim.New(), nil, pe, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if off.talkers != nil || off.Stats().TopTalkers != nil {
+		t.Fatalf("talkers tracked with TopTalkers=0")
+	}
+}
+
+func TestEngine_SendWorkerDrainsQueueOnShutdown(t *testing.T) {
+	sink := &packetlog.MemorySink{}
+	e, err := NewEngine(config.Config{}, "run-test", fakeshim.New(), sink, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{"ConnectRes", "ConInfoRes", "ConnectEv"} {
+		e.enqueue(outMsg{dpnid: 0x1, tag: tag, payloadXML: "<" + tag + " />", flags: dpnSendSyncGuaranteed})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.sendWorker(ctx)
+	}()
+	select {
+	case <-done:
+	case <-time.After(sendDrainTimeout + time.Second):
+		t.Fatal("sendWorker did not exit after drain")
+	}
+
+	if n := e.sendQ.len(); n != 0 {
+		t.Fatalf("sendQ has %d messages left", n)
+	}
+	out := outbound(sink)
+	if len(out) != 3 {
+		t.Fatalf("sent %d messages, want 3", len(out))
+	}
+	for i, tag := range []string{"ConnectRes", "ConInfoRes", "ConnectEv"} {
+		if out[i].Tag != tag {
+			t.Fatalf("sent[%d]=%s want %s", i, out[i].Tag, tag)
+		}
+	}
+}
+
+func TestEngine_SaturatedClientDoesNotStarveOthers(t *testing.T) {
+	e := newTestEngine(t, config.Config{}, nil)
+
+	// Client 0x1 fills its queue and overflows; only its own messages are dropped.
+	for i := 0; i < clientSendQueueSize+10; i++ {
+		e.enqueue(outMsg{dpnid: 0x1, tag: "PageRes", flags: dpnSendGuaranteed})
+	}
+	if got := e.Stats().SendDropped; got != 10 {
+		t.Fatalf("SendDropped=%d want 10", got)
+	}
+	for _, tag := range []string{"ConnectRes", "ConInfoRes", "ConnectEv"} {
+		if !e.enqueue(outMsg{dpnid: 0x2, tag: tag, flags: dpnSendSyncGuaranteed}) {
+			t.Fatalf("client 0x2 %s dropped", tag)
+		}
+	}
+
+	// Round-robin: 0x2's bundle goes out interleaved with 0x1, in order and with its flags.
+	var got []string
+	for i := 0; i < 6; i++ {
+		out, ok := e.sendQ.pop()
+		if !ok {
+			t.Fatalf("queue empty after %d pops", i)
+		}
+		if out.dpnid == 0x2 {
+			if out.flags != dpnSendSyncGuaranteed {
+				t.Fatalf("%s flags=0x%x", out.tag, out.flags)
+			}
+			got = append(got, out.tag)
+		}
+	}
+	if strings.Join(got, ",") != "ConnectRes,ConInfoRes,ConnectEv" {
+		t.Fatalf("client 0x2 sends in first 6 pops: %v", got)
+	}
+
+	// Disconnect discards what is still queued for the client.
+	if err := e.handleEvent(dp8shim.Event{MsgID: dpnMsgIDDestroyPlayer, DPNID: 0x1}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := e.sendQ.len(); n != 0 {
+		t.Fatalf("sendQ=%d after disconnect, want 0", n)
+	}
+}
+
+func TestEngine_DisconnectRecordsSessionDuration(t *testing.T) {
+	players := state.NewPlayerStore()
+	sink := &packetlog.MemorySink{}
+	e, err := NewEngine(config.Config{}, "run-test", fakeshim.New(), sink, nil, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The store computes the interval from ConnectedAt to the given time.
+	t0 := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	players.Upsert(0x1, t0)
+	if d, ok := players.RemoveSession(0x1, t0.Add(95*time.Second)); !ok || d != 95*time.Second {
+		t.Fatalf("RemoveSession=%v,%v want 95s,true", d, ok)
+	}
+	if _, ok := players.RemoveSession(0x1, t0); ok {
+		t.Fatalf("RemoveSession found a removed player")
+	}
+
+	// The engine stamps it on the disconnect record.
+	e.now = func() time.Time { return t0.Add(90 * time.Second) }
+	players.Upsert(0x2, t0)
+	if err := e.handleEvent(dp8shim.Event{MsgID: dpnMsgIDDestroyPlayer, DPNID: 0x2}, nil); err != nil {
+		t.Fatal(err)
+	}
+	recs := sink.Records()
+	if n := len(recs); n != 1 {
+		t.Fatalf("records=%d want 1", n)
+	}
+	if msg := recs[0].Message; !strings.Contains(msg, "msg=DESTROY_PLAYER") || !strings.HasSuffix(msg, " duration_s=90") {
+		t.Fatalf("disconnect record message=%q", msg)
+	}
+}
+
+func TestEngine_TerminateSessionForgetsClient(t *testing.T) {
+	players := state.NewPlayerStore()
+	shim := fakeshim.New()
+	e, err := NewEngine(config.Config{TopTalkers: 5}, "run-test", shim, nil, nil, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remotes := func() int {
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+		return len(e.clientRemote)
+	}
+	shim.Connect(0x1, "203.0.113.5")
+	shim.Connect(0x2, "203.0.113.6")
+	shim.Connect(0x3, "203.0.113.7")
+	pump(t, e, shim)
+	if n := remotes(); n != 3 {
+		t.Fatalf("clientRemote=%d want 3", n)
+	}
+
+	// No DESTROY_PLAYER before the terminate.
+	shim.Inject(dp8shim.Event{MsgID: dpnMsgIDTerminateSession, DPNID: 0x1}, nil)
+	pump(t, e, shim)
+	if n := remotes(); n != 2 {
+		t.Fatalf("clientRemote=%d after terminate, want 2", n)
+	}
+	if players.Has(0x1) {
+		t.Fatalf("terminated player still in PlayerStore")
+	}
+
+	// The sweep catches entries whose player left the store some other way,
+	// dropping its queued sends as departed.
+	e.enqueue(outMsg{dpnid: 0x2, tag: "PageRes"})
+	players.Remove(0x2)
+	if n := e.pruneClientRemote(); n != 1 || remotes() != 1 {
+		t.Fatalf("pruned=%d clientRemote=%d, want 1 and 1", n, remotes())
+	}
+	if got := e.Stats().Drops["departed"]; got != 1 || e.sendQ.len() != 0 {
+		t.Fatalf("Drops[departed]=%d sendQ=%d, want 1 and 0", got, e.sendQ.len())
+	}
+}
+
+func TestEngine_KickEvictsWithoutDisconnectExport(t *testing.T) {
+	players := state.NewPlayerStore()
+	shim := fakeshim.New()
+	shim.DisconnectErr = dp8shim.ErrDisconnectUnavailable
+	e, err := NewEngine(config.Config{}, "run-test", shim, nil, nil, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createPlayer(t, e, 0x1, "203.0.113.5")
+	e.enqueue(outMsg{dpnid: 0x1, tag: "PageRes"})
+
+	// An older shim has no DP8_DisconnectClient: eviction still happens, no error.
+	found, err := e.Kick(0x1)
+	if err != nil || !found {
+		t.Fatalf("Kick(0x1) found=%v err=%v", found, err)
+	}
+	if !players.IsEvicted(0x1) {
+		t.Fatalf("kicked player not evicted")
+	}
+	if n := e.sendQ.len(); n != 0 {
+		t.Fatalf("queued sends for kicked player=%d", n)
+	}
+	// Kicking again still reports the (evicted) player as found.
+	if found, _ := e.Kick(0x1); !found {
+		t.Fatalf("second Kick(0x1) found=false")
+	}
+
+	if found, err := e.Kick(0x99); found || err != nil {
+		t.Fatalf("Kick(unknown) found=%v err=%v", found, err)
+	}
+}
+
+func TestEngine_BroadcastEnqueuesPerConnectedPlayer(t *testing.T) {
+	players := state.NewPlayerStore()
+	e := newTestEngine(t, config.Config{}, players)
+	for _, id := range []uint32{0x1, 0x2, 0x3} {
+		createPlayer(t, e, id, "203.0.113.5")
+	}
+	createPlayer(t, e, 0x4, "198.51.100.7")
+	players.TouchEvict(0x4, time.Now().UTC())
+
+	if got := e.Broadcast(`<MotdEv Text="hi" />`, "MotdEv"); got != 3 {
+		t.Fatalf("Broadcast queued %d, want 3", got)
+	}
+	seen := map[uint32]bool{}
+	for {
+		out, ok := e.sendQ.pop()
+		if !ok {
+			break
+		}
+		if out.tag != "MotdEv" || out.payloadXML != `<MotdEv Text="hi" />` {
+			t.Fatalf("unexpected outbound %+v", out)
+		}
+		seen[out.dpnid] = true
+	}
+	if len(seen) != 3 || !seen[0x1] || !seen[0x2] || !seen[0x3] {
+		t.Fatalf("recipients=%v, want 0x1..0x3", seen)
+	}
+}
+
+func TestEngine_GameRemovedPushesGamesUpdated(t *testing.T) {
+	game := `<HostData><HostData><New><Item ItemId="0" GName="g" Map="m" /></New></HostData></HostData>`
+	del := `<HostData><HostData><Del><Item Num="0" /></Del></HostData></HostData>`
+	popTags := func(e *Engine) map[uint32]string {
+		got := map[uint32]string{}
+		for {
+			out, ok := e.sendQ.pop()
+			if !ok {
+				return got
+			}
+			got[out.dpnid] += out.tag
+		}
+	}
+
+	for _, enabled := range []bool{false, true} {
+		features, err := config.ParseFeatures(map[string]any{"games_updated_push": enabled})
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := newTestEngine(t, config.Config{Features: features}, state.NewPlayerStore())
+		hosts := state.NewHostStore()
+		hosts.SetGameRemovedHook(e.GameRemoved)
+		createPlayer(t, e, 0x1, "203.0.113.5")
+		createPlayer(t, e, 0x2, "198.51.100.7")
+
+		hosts.ApplyHostData(0x1, game)
+		if got := popTags(e); len(got) != 0 {
+			t.Fatalf("enabled=%v: pushed on a new game: %v", enabled, got)
+		}
+		hosts.ApplyHostData(0x1, del)
+		got := popTags(e)
+		if !enabled {
+			if len(got) != 0 {
+				t.Fatalf("pushed while disabled: %v", got)
+			}
+			continue
+		}
+		if len(got) != 2 || got[0x1] != "GamesUpdated" || got[0x2] != "GamesUpdated" {
+			t.Fatalf("pushes=%v, want GamesUpdated to 0x1 and 0x2", got)
+		}
+
+		// An operator removal pushes too; removing it again does not.
+		hosts.ApplyHostData(0x1, game)
+		row := hosts.GamesRows(0, nil)[0]
+		hosts.RemoveByRid(row.Rid)
+		hosts.RemoveByRid(row.Rid)
+		if got := popTags(e); len(got) != 2 || got[0x1] != "GamesUpdated" || got[0x2] != "GamesUpdated" {
+			t.Fatalf("RemoveByRid pushes=%v, want one GamesUpdated each", got)
+		}
+	}
+}
+
+var _ Shim = (*fakeshim.Shim)(nil)
+
+// runEngine runs e on shim until the test ends.
+func runEngine(t *testing.T, e *Engine) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- e.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestEngine_Run_RequestResponses(t *testing.T) {
+	cases := []struct {
+		name  string
+		msg   string
+		tags  []string
+		flags uint32
+	}{
+		{"connect bundle", `<Connect Cx="0x123" ProtoVer="3.3" />`, []string{"ConnectRes", "ConInfoRes", "ConnectEv"}, dpnSendSyncGuaranteed},
+		{"headers", `<HdrRow Cx="0x65" Vid="101" />`, []string{"HdrRowRes"}, dpnSendGuaranteed},
+		{"empty page", `<Page Cx="0x0" Vid="101" PageNo="0" Num="0" Str="" />`, []string{"PageRes"}, dpnSendGuaranteed},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			players := state.NewPlayerStore()
+			pe := proto.NewEngine(proto.EngineConfig{Port: 2300}, state.NewHostStore(), players)
+			shim := fakeshim.New()
+			e, err := NewEngine(config.Config{DP8Port: 2300}, "run-test", shim, nil, pe, players)
+			if err != nil {
+				t.Fatal(err)
+			}
+			shim.Connect(0x1001, "203.0.113.5")
+			shim.Receive(0x1001, tc.msg)
+			runEngine(t, e)
+
+			sent, ok := shim.WaitSent(len(tc.tags), 2*time.Second)
+			if !ok {
+				t.Fatalf("sent %d messages, want %d", len(sent), len(tc.tags))
+			}
+			for i, tag := range tc.tags {
+				s := sent[i]
+				if s.DPNID != 0x1001 || s.Flags != tc.flags {
+					t.Fatalf("send[%d] dpnid=0x%x flags=0x%x", i, s.DPNID, s.Flags)
+				}
+				if !strings.HasPrefix(string(s.Payload), "<"+tag+" ") || s.Payload[len(s.Payload)-1] != 0 {
+					t.Fatalf("send[%d]=%q want NUL-terminated <%s ...>", i, s.Payload, tag)
+				}
+			}
+		})
+	}
+}
+
+func TestEngine_RawPayloadsOnlyInRawSink(t *testing.T) {
+	players := state.NewPlayerStore()
+	pe := proto.NewEngine(proto.EngineConfig{Port: 2300}, state.NewHostStore(), players)
+	shim := fakeshim.New()
+	mainLog, rawLog := &packetlog.MemorySink{}, &packetlog.MemorySink{}
+	e, err := NewEngine(config.Config{DP8Port: 2300, SendBatchSize: 8}, "run-test", shim, mainLog, pe, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetRawPayloadSink(rawLog)
+
+	createPlayer(t, e, 0x1, "203.0.113.5")
+	receive(t, e, 0x1, `<Connect Cx="0x123" ProtoVer="3.3" Name="SecretPlayerName" />`)
+	e.sendNextBatch()
+
+	contains := func(recs []packetlog.Record, sub string) bool {
+		for _, r := range recs {
+			if strings.Contains(r.Message, sub) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, secret := range []string{"SecretPlayerName", "<ConnectRes", `Cx="0x123"`} {
+		if !contains(rawLog.Records(), secret) {
+			t.Fatalf("raw sink is missing %q: %+v", secret, rawLog.Records())
+		}
+		if contains(mainLog.Records(), secret) {
+			t.Fatalf("main sink has %q: %+v", secret, mainLog.Records())
+		}
+	}
+	// The main log still records what happened, minus the values.
+	if !contains(mainLog.Records(), "attr_keys=Cx,Name,ProtoVer") || len(outbound(mainLog)) != 3 || !contains(outbound(mainLog), "payload_len=") {
+		t.Fatalf("main records=%+v", mainLog.Records())
+	}
+	if len(outbound(rawLog)) != 3 {
+		t.Fatalf("raw outbound=%+v", outbound(rawLog))
+	}
+}
+
+func TestEngine_ConnectLogsReplyRecords(t *testing.T) {
+	players := state.NewPlayerStore()
+	pe := proto.NewEngine(proto.EngineConfig{Port: 2300}, state.NewHostStore(), players)
+	shim := fakeshim.New()
+	sink := &packetlog.MemorySink{}
+	e, err := NewEngine(config.Config{DP8Port: 2300}, "run-test", shim, sink, pe, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shim.Connect(0x1001, "203.0.113.5")
+	shim.Receive(0x1001, `<Connect Cx="0x123" ProtoVer="3.3" />`)
+	runEngine(t, e)
+
+	want := []string{"ConnectRes", "ConInfoRes", "ConnectEv"}
+	deadline := time.Now().Add(2 * time.Second)
+	var out []packetlog.Record
+	for {
+		if out = outbound(sink); len(out) >= len(want) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(out) != len(want) {
+		t.Fatalf("out records=%+v want %v", out, want)
+	}
+	for i, tag := range want {
+		r := out[i]
+		if r.Type != "dp8" || r.Tag != tag || r.Destination != "dpnid=0x00001001" || r.RunID != "run-test" {
+			t.Fatalf("out[%d]=%+v want %s", i, r, tag)
+		}
+	}
+	in := sink.Filter(func(r packetlog.Record) bool { return r.Direction == "in" && r.Tag == "Connect" })
+	if len(in) != 1 {
+		t.Fatalf("in Connect records=%d want 1", len(in))
+	}
+}
+
+func TestEngine_KickDisconnectsTransport(t *testing.T) {
+	players := state.NewPlayerStore()
+	shim := fakeshim.New()
+	e, err := NewEngine(config.Config{}, "run-test", shim, nil, nil, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createPlayer(t, e, 0x1, "203.0.113.5")
+	if found, err := e.Kick(0x1); !found || err != nil {
+		t.Fatalf("Kick found=%v err=%v", found, err)
+	}
+	if ids := shim.DisconnectedIDs(); len(ids) != 1 || ids[0] != 0x1 {
+		t.Fatalf("disconnected=%v", ids)
+	}
+}
+
+func TestEngine_ReplayCaptureMutatesStoresWithoutSending(t *testing.T) {
+	f, err := os.Open("testdata/replay.ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	events, err := replayshim.ReadNDJSON(f)
+	if err != nil {
+		t.Fatalf("ReadNDJSON: %v", err)
+	}
+	if len(events) != 6 {
+		t.Fatalf("captured events=%d, want 6", len(events))
+	}
+
+	players := state.NewPlayerStore()
+	shim := replayshim.New(events)
+	sink := &packetlog.MemorySink{}
+	p := proto.NewEngine(proto.EngineConfig{Port: 2300}, state.NewHostStore(), players)
+	e, err := NewEngine(config.Config{}, "run-test", shim, sink, p, players)
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+
+	n, err := e.Replay(context.Background())
+	if err != nil || n != 6 {
+		t.Fatalf("Replay=%d,%v want 6,nil", n, err)
+	}
+
+	if got := players.Connected(); len(got) != 1 || got[0] != 0x0013a1f2 {
+		t.Fatalf("connected=%v, want only the host", got)
+	}
+	st := e.Stats()
+	if st.Hosts != 1 || st.RecvXMLParsed != 3 || st.SendQueueDepth != 0 || st.ShimQueueDepth != 0 {
+		t.Fatalf("stats=%+v", st)
+	}
+	if shim.Suppressed() != 0 {
+		t.Fatalf("replay reached SendTo %d times", shim.Suppressed())
+	}
+
+	var tags []string
+	for _, rec := range outbound(sink) {
+		if rec.ReplyMode != "replay" || !strings.HasPrefix(rec.Message, "not sent ") {
+			t.Fatalf("outbound record not marked as replay: %+v", rec)
+		}
+		tags = append(tags, rec.Tag)
+	}
+	if got := strings.Join(tags, " "); got != "ConnectRes ConInfoRes ConnectEv HostDataRes HdrRowRes" {
+		t.Fatalf("outbound tags=%q", got)
+	}
+}
+
+// pump hands every event queued on shim to the engine, as Run would.
+func pump(t *testing.T, e *Engine, shim *fakeshim.Shim) {
+	t.Helper()
+	for {
+		evt, payload, ok, err := shim.PopEvent(e.buf)
+		if err != nil || !ok {
+			return
+		}
+		if err := e.handleEvent(evt, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestEngine_EvictedDropLogsRemoteAddress(t *testing.T) {
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	players := state.NewPlayerStore()
+	shim := fakeshim.New()
+	sink := &packetlog.MemorySink{}
+	e, err := NewEngine(config.Config{}, "run-test", shim, sink, nil, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shim.Connect(0x7, "203.0.113.9")
+	pump(t, e, shim)
+	players.TouchEvict(0x7, time.Now().UTC())
+
+	shim.Receive(0x7, `<HdrRow Cx="0x65" Vid="101" />`)
+	pump(t, e, shim)
+
+	if got := e.Stats().RecvEvictedDropped; got != 1 {
+		t.Fatalf("RecvEvictedDropped=%d want 1", got)
+	}
+	var drop packetlog.Record
+	for _, r := range sink.Records() {
+		if r.Experiment == "drop-evicted" {
+			drop = r
+		}
+	}
+	if !strings.Contains(drop.Message, "remote_ip=203.0.113.9") || !strings.Contains(drop.Message, "remote_port=2302") {
+		t.Fatalf("drop record missing remote address: %+v", drop)
+	}
+	var line map[string]any
+	for _, l := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		if strings.Contains(l, `"msg":"dp8 message dropped"`) {
+			if err := json.Unmarshal([]byte(l), &line); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if line["remote_ip"] != "203.0.113.9" || line["reason"] != "evicted" || line["tag_hint"] == nil {
+		t.Fatalf("warn line=%v", line)
+	}
+}
+
+func TestEngine_RawCaptureReplaysExactly(t *testing.T) {
+	// Live run over the fake shim, recording raw events.
+	players := state.NewPlayerStore()
+	hosts := state.NewHostStore()
+	shim := fakeshim.New()
+	e, err := NewEngine(config.Config{}, "run-test", shim, nil, proto.NewEngine(proto.EngineConfig{Port: 2300}, hosts, players), players)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var capture bytes.Buffer
+	e.SetEventRecorder(replayshim.NewRecorder(&capture))
+
+	shim.Connect(0x1, "203.0.113.5")
+	shim.Receive(0x1, testHostData)
+	shim.Connect(0x2, "198.51.100.7")
+	shim.Receive(0x2, `<HdrRow Cx="0x65" Vid="101" />`)
+	shim.Disconnected(0x2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- e.Run(ctx) }()
+	deadline := time.Now().Add(2 * time.Second)
+	for shim.QueueDepth() > 0 || players.Count() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("live run did not settle: depth=%d players=%d", shim.QueueDepth(), players.Count())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	// Replay: the rebuilt stores match, including HostData items that NDJSON
+	// telemetry cannot carry.
+	events, err := replayshim.ReadCapture(&capture)
+	if err != nil {
+		t.Fatalf("ReadCapture: %v", err)
+	}
+	if len(events) != 5 {
+		t.Fatalf("captured events=%d want 5", len(events))
+	}
+	rPlayers := state.NewPlayerStore()
+	rHosts := state.NewHostStore()
+	rShim := replayshim.New(events)
+	r, err := NewEngine(config.Config{}, "run-replay", rShim, nil, proto.NewEngine(proto.EngineConfig{Port: 2300}, rHosts, rPlayers), rPlayers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.Replay(context.Background()); n != 5 || err != nil {
+		t.Fatalf("Replay=%d,%v", n, err)
+	}
+
+	if got, want := rPlayers.Connected(), players.Connected(); len(got) != 1 || got[0] != want[0] {
+		t.Fatalf("replayed connected=%v live=%v", got, want)
+	}
+	live, replayed := hosts.GamesRows(0, nil), rHosts.GamesRows(0, nil)
+	if len(replayed) != 1 || len(live) != 1 || replayed[0].Items["GName"] != live[0].Items["GName"] || replayed[0].Rid != live[0].Rid {
+		t.Fatalf("replayed games=%+v live=%+v", replayed, live)
+	}
+	if ip := replayed[0].Items["Ip2"]; ip != live[0].Items["Ip2"] {
+		t.Fatalf("replayed host IP=%q live=%q", ip, live[0].Items["Ip2"])
+	}
+	if rShim.Suppressed() != 0 {
+		t.Fatalf("replay reached SendTo")
+	}
+}
+
+func TestEngine_LenPrefixFramingBothWays(t *testing.T) {
+	players := state.NewPlayerStore()
+	cfg := config.Config{DP8Port: 2300, SendBatchSize: 8}
+	cfg.Proto = proto.EngineConfig{Port: 2300, Framing: proto.FramingLenPrefix}
+	pe := proto.NewEngine(cfg.Proto, state.NewHostStore(), players)
+	shim := fakeshim.New()
+	e, err := NewEngine(cfg, "run-test", shim, nil, pe, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createPlayer(t, e, 0x1, "203.0.113.5")
+	frame := proto.MakeLenPrefixed(`<Connect Cx="0x123" ProtoVer="3.3" />`)
+	if err := e.handleEvent(dp8shim.Event{MsgID: dpnMsgIDReceive, DPNID: 0x1}, frame); err != nil {
+		t.Fatal(err)
+	}
+	e.sendNextBatch()
+
+	sent := shim.Sent()
+	if len(sent) != 3 {
+		t.Fatalf("sent %d frames, want the connect bundle", len(sent))
+	}
+	for _, s := range sent {
+		body, err := proto.UnframeLenPrefixed(s.Payload)
+		if err != nil || bytes.IndexByte(s.Payload, 0) == len(s.Payload)-1 {
+			t.Fatalf("frame %q is not length-prefixed: %v", s.Payload, err)
+		}
+		if m, ok := proto.Parse(string(body)); !ok || m.Attrs["Cx"] != "0x123" {
+			t.Fatalf("frame body %q", body)
+		}
+	}
+}
+
+func TestEngine_SendBatchDrainsUpToBatchPerWake(t *testing.T) {
+	shim := fakeshim.New()
+	e, err := NewEngine(config.Config{SendBatchSize: 4}, "run-test", shim, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		e.enqueue(outMsg{dpnid: 0x1, tag: "PageRes", payloadXML: fmt.Sprintf("A%d", i)})
+	}
+	e.enqueue(outMsg{dpnid: 0x2, tag: "PageRes", payloadXML: "B0"})
+
+	if n := e.sendNextBatch(); n != 4 {
+		t.Fatalf("first batch sent %d, want 4", n)
+	}
+	if got := len(shim.Sent()); got != 4 {
+		t.Fatalf("transport saw %d sends, want 4", got)
+	}
+	if n := e.sendNextBatch(); n != 2 {
+		t.Fatalf("second batch sent %d, want the remaining 2", n)
+	}
+	if n := e.sendNextBatch(); n != 0 {
+		t.Fatalf("empty queue batch sent %d", n)
+	}
+
+	// Batching interleaves clients round-robin but keeps each client's order.
+	var a []string
+	for _, s := range shim.Sent() {
+		if s.DPNID == 0x1 {
+			a = append(a, strings.TrimSuffix(string(s.Payload), "\x00"))
+		}
+	}
+	if got := strings.Join(a, ","); got != "A0,A1,A2,A3,A4" {
+		t.Fatalf("client 0x1 payload order=%s", got)
+	}
+}
+
+func BenchmarkEngine_SendBatch(b *testing.B) {
+	for _, batch := range []int{1, 16} {
+		b.Run(fmt.Sprintf("batch=%d", batch), func(b *testing.B) {
+			e, err := NewEngine(config.Config{SendBatchSize: batch}, "run-bench", fakeshim.New(), nil, nil, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			const msgs = 64
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := 0; j < msgs; j++ {
+					e.enqueue(outMsg{dpnid: uint32(j % 4), tag: "PageRes", payloadXML: "<PageRes/>"})
+				}
+				for e.sendNextBatch() > 0 {
+				}
+			}
+			b.ReportMetric(float64(b.N*msgs)/b.Elapsed().Seconds(), "msgs/s")
+		})
+	}
+}
+
+// BenchmarkOutMsg_Wire compares building a frame per send (wire) with the pooled
+// buffer send uses; run with -benchmem to see the allocations saved.
+func BenchmarkOutMsg_Wire(b *testing.B) {
+	out := outMsg{dpnid: 0x1, tag: "PageRes", payloadXML: `<PageRes HR="0x00000000" Cx="0x1" Vid="101" Count="0" />`}
+	var sink int
+	b.Run("alloc", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sink += len(out.wire(""))
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf := getWireBuf()
+			w := out.wireInto(*buf, "")
+			sink += len(w)
+			*buf = w
+			putWireBuf(buf)
+		}
+	})
+	_ = sink
+}
+
+func TestEngine_RunStopsCleanlyWhenShimCloses(t *testing.T) {
+	players := state.NewPlayerStore()
+	shim := fakeshim.New()
+	pe := proto.NewEngine(proto.EngineConfig{Port: 2300}, state.NewHostStore(), players)
+	e, err := NewEngine(config.Config{}, "run-test", shim, nil, pe, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- e.Run(ctx) }()
+
+	shim.Connect(0x1, "203.0.113.5")
+	shim.Receive(0x1, `<HdrRow Cx="0x65" Vid="101" />`)
+	if _, ok := shim.WaitSent(1, 2*time.Second); !ok {
+		t.Fatalf("no response before shutdown")
+	}
+
+	// Shutdown stops the shim while Run is still polling; ctx is never cancelled.
+	shim.StopServer()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run after shim close = %v, want nil", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Run did not return after the shim closed")
+	}
+	if n := e.Stats().SendQueueDepth; n != 0 {
+		t.Fatalf("send queue depth=%d after close", n)
+	}
+	if err := shim.SendTo(0x1, []byte("x"), 0); !errors.Is(err, dp8shim.ErrClosed) {
+		t.Fatalf("SendTo after close = %v, want ErrClosed", err)
+	}
+}
+
+func TestEngine_SendDroppedCountsResponsesOverflowingQueue(t *testing.T) {
+	players := state.NewPlayerStore()
+	shim := fakeshim.New()
+	pe := proto.NewEngine(proto.EngineConfig{Port: 2300}, state.NewHostStore(), players)
+	e, err := NewEngine(config.Config{}, "run-test", shim, nil, pe, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// No send worker: every HdrRowRes stays queued until the client's queue is full.
+	shim.Connect(0x1, "203.0.113.5")
+	for i := 0; i < clientSendQueueSize+5; i++ {
+		shim.Receive(0x1, `<HdrRow Cx="0x65" Vid="101" />`)
+	}
+	pump(t, e, shim)
+
+	st := e.Stats()
+	if st.SendDropped != 5 || st.SendQueueDepth != clientSendQueueSize {
+		t.Fatalf("SendDropped=%d SendQueueDepth=%d, want 5 and %d", st.SendDropped, st.SendQueueDepth, clientSendQueueSize)
+	}
+}
+
+func TestEngine_ShimQueueBacklogWarnsOncePerCrossing(t *testing.T) {
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	shim := fakeshim.New()
+	e, err := NewEngine(config.Config{ShimQueueWarn: 100}, "run-test", shim, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	warns := func() int { return strings.Count(logs.String(), "dp8 shim event queue backing up") }
+
+	shim.SetQueueDepth(100)
+	if e.sampleShimQueue() || warns() != 0 {
+		t.Fatalf("warned at the threshold (depth 100): %s", logs.String())
+	}
+	shim.SetQueueDepth(250)
+	e.sampleShimQueue()
+	shim.SetQueueDepth(300)
+	if !e.sampleShimQueue() || warns() != 1 {
+		t.Fatalf("warns=%d above threshold, want 1 (logs: %s)", warns(), logs.String())
+	}
+	if st := e.Stats(); !st.ShimBacklogged || st.ShimQueuePeak != 300 || st.ShimQueueDepth != 300 {
+		t.Fatalf("stats while backlogged: %+v", st)
+	}
+
+	shim.SetQueueDepth(3)
+	e.sampleShimQueue()
+	if st := e.Stats(); st.ShimBacklogged || st.ShimQueuePeak != 300 || !strings.Contains(logs.String(), "dp8 shim event queue recovered") {
+		t.Fatalf("after recovery stats=%+v logs=%s", st, logs.String())
+	}
+	shim.SetQueueDepth(500)
+	e.sampleShimQueue()
+	if warns() != 2 {
+		t.Fatalf("warns=%d after a second crossing, want 2", warns())
+	}
+}
+
+func TestEngine_StaleHostsWarnWhenRisingRateLimited(t *testing.T) {
+	e, err := NewEngine(config.Config{}, "run-test", fakeshim.New(), nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if e.noteStaleHosts(now, 0) {
+		t.Fatal("warned with no stale hosts")
+	}
+	if !e.noteStaleHosts(now.Add(time.Minute), 2) {
+		t.Fatal("no warning when stale hosts rose")
+	}
+	// Still rising, but inside the warning interval.
+	if e.noteStaleHosts(now.Add(2*time.Minute), 3) {
+		t.Fatal("warned again inside staleHostsWarnEvery")
+	}
+	// Past the interval a steady count stays quiet; a rise warns again.
+	if e.noteStaleHosts(now.Add(time.Minute+staleHostsWarnEvery), 3) {
+		t.Fatal("warned on a steady count")
+	}
+	if !e.noteStaleHosts(now.Add(2*time.Minute+staleHostsWarnEvery), 4) {
+		t.Fatal("no warning on a rise after the interval")
+	}
+}
+
+func TestEngine_TruncatedPayloadSkippedAndBufferGrown(t *testing.T) {
+	players := state.NewPlayerStore()
+	shim := fakeshim.New()
+	sink := &packetlog.MemorySink{}
+	pe := proto.NewEngine(proto.EngineConfig{Port: 2300}, state.NewHostStore(), players)
+	e, err := NewEngine(config.Config{}, "run-test", shim, sink, pe, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shim.Connect(0x1, "203.0.113.5")
+
+	// The shim's own per-event cap: a short payload flagged as cut.
+	shim.Inject(dp8shim.Event{MsgID: fakeshim.MsgIDReceive, DPNID: 0x1, Flags: dp8shim.EventFlagTruncated}, []byte(`<HdrRow Cx="0x65" Vi`))
+	pump(t, e, shim)
+	if st := e.Stats(); st.Drops["truncated"] != 1 || st.RecvXMLParsed != 0 {
+		t.Fatalf("Drops[truncated]=%d RecvXMLParsed=%d, want 1 and 0", st.Drops["truncated"], st.RecvXMLParsed)
+	}
+	if len(e.buf) != recvBufSize {
+		t.Fatalf("buf grew to %d on a shim-side cut", len(e.buf))
+	}
+
+	// Larger than the receive buffer: dropped, and the buffer doubles so the
+	// same message fits next time.
+	big := `<HdrRow Cx="0x65" Vid="101" Pad="` + strings.Repeat("x", recvBufSize) + `" />`
+	shim.Receive(0x1, big)
+	pump(t, e, shim)
+	if st := e.Stats(); st.Drops["truncated"] != 2 || st.RecvXMLParsed != 0 {
+		t.Fatalf("Drops[truncated]=%d RecvXMLParsed=%d, want 2 and 0", st.Drops["truncated"], st.RecvXMLParsed)
+	}
+	if len(e.buf) != 2*recvBufSize {
+		t.Fatalf("buf=%d want %d", len(e.buf), 2*recvBufSize)
+	}
+	shim.Receive(0x1, big)
+	pump(t, e, shim)
+	if st := e.Stats(); st.Drops["truncated"] != 2 || st.RecvXMLParsed != 1 {
+		t.Fatalf("after growth Drops[truncated]=%d RecvXMLParsed=%d, want 2 and 1", st.Drops["truncated"], st.RecvXMLParsed)
+	}
+
+	var drops int
+	for _, r := range sink.Records() {
+		if strings.HasPrefix(r.Experiment, "drop-") {
+			drops++
+			if r.Experiment != "drop-truncated" || r.Type != "dp8" {
+				t.Fatalf("drop record %+v", r)
+			}
+		}
+	}
+	if drops != 2 {
+		t.Fatalf("drop records=%d want 2", drops)
+	}
+
+	// The cap holds.
+	e.buf = make([]byte, maxRecvBufSize)
+	e.growRecvBuf()
+	if len(e.buf) != maxRecvBufSize {
+		t.Fatalf("buf=%d past cap %d", len(e.buf), maxRecvBufSize)
+	}
+}
+
+func TestEngine_DropsBinaryPayloads(t *testing.T) {
+	players := state.NewPlayerStore()
+	shim := fakeshim.New()
+	sink := &packetlog.MemorySink{}
+	pe := proto.NewEngine(proto.EngineConfig{Port: 2300}, state.NewHostStore(), players)
+	e, err := NewEngine(config.Config{}, "run-test", shim, sink, pe, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shim.Connect(0x1, "203.0.113.5")
+	shim.Receive(0x1, "<HdrRow Cx=\"\xff\xfe\" Vid=\"101\" />")
+	shim.Receive(0x1, "<\x01\x02\x03\x04\x05\x06\x07\x08")
+	shim.Receive(0x1, `<HdrRow Cx="0x65" Vid="101" />`)
+	pump(t, e, shim)
+
+	st := e.Stats()
+	if st.Drops["binary"] != 2 || st.RecvXMLParsed != 1 {
+		t.Fatalf("Drops[binary]=%d RecvXMLParsed=%d, want 2 and 1", st.Drops["binary"], st.RecvXMLParsed)
+	}
+	if n := e.sendQ.len(); n != 1 {
+		t.Fatalf("queued replies=%d, want 1 (only the ASCII HdrRow)", n)
+	}
+	var drops int
+	for _, r := range sink.Records() {
+		if strings.HasPrefix(r.Experiment, "drop-") {
+			drops++
+			if r.Experiment != "drop-binary" || r.Direction != "in" {
+				t.Fatalf("drop record %+v", r)
+			}
+		}
+	}
+	if drops != 2 {
+		t.Fatalf("drop records=%d, want 2", drops)
+	}
+}
+
+func TestEngine_DropsMessagesOverAttrLimits(t *testing.T) {
+	players := state.NewPlayerStore()
+	shim := fakeshim.New()
+	sink := &packetlog.MemorySink{}
+	cfg := config.Config{Proto: proto.EngineConfig{Port: 2300, MaxAttrs: 8, MaxAttrLen: 64}}
+	pe := proto.NewEngine(cfg.Proto, state.NewHostStore(), players)
+	e, err := NewEngine(cfg, "run-test", shim, sink, pe, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shim.Connect(0x1, "203.0.113.5")
+	shim.Receive(0x1, `<HdrRow Cx="0x1" Vid="101" A="1" B="2" C="3" D="4" E="5" F="6" G="7" />`)
+	shim.Receive(0x1, `<HdrRow Cx="0x2" Vid="`+strings.Repeat("1", 65)+`" />`)
+	shim.Receive(0x1, `<HdrRow Cx="0x65" Vid="101" />`)
+	pump(t, e, shim)
+
+	st := e.Stats()
+	if st.Drops["attr-limit"] != 2 || st.RecvXMLParsed != 1 || st.RecvXMLParseFailed != 0 {
+		t.Fatalf("Drops[attr-limit]=%d parsed=%d parse_failed=%d, want 2, 1, 0", st.Drops["attr-limit"], st.RecvXMLParsed, st.RecvXMLParseFailed)
+	}
+	if n := e.sendQ.len(); n != 1 {
+		t.Fatalf("queued replies=%d, want 1", n)
+	}
+	drops := sink.Filter(func(r packetlog.Record) bool { return strings.HasPrefix(r.Experiment, "drop-") })
+	if len(drops) != 2 || drops[0].Experiment != "drop-attr-limit" || !strings.Contains(drops[0].Message, "hr="+proto.HRBadRequest) {
+		t.Fatalf("drop records=%+v", drops)
+	}
+}
+
+func TestEngine_DropPathsReportReason(t *testing.T) {
+	players := state.NewPlayerStore()
+	shim := fakeshim.New()
+	sink := &packetlog.MemorySink{}
+	pe := proto.NewEngine(proto.EngineConfig{Port: 2300}, state.NewHostStore(), players)
+	cfg := config.Config{MaxHostsPerIP: 1, MaxBrowsersPerIP: 4, ClientMsgsPerSec: 0.001, ClientBurst: 2}
+	e, err := NewEngine(cfg, "run-test", shim, sink, pe, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, ip := range map[uint32]string{0x1: "203.0.113.5", 0x2: "198.51.100.2", 0x3: "203.0.113.5", 0x4: "198.51.100.4", 0x5: "198.51.100.5"} {
+		shim.Connect(id, ip)
+	}
+	pump(t, e, shim)
+
+	// rate-limit: 0x1 spends its burst of 2, the third request is dropped.
+	shim.Receive(0x1, testHostData)
+	shim.Receive(0x1, `<HdrRow Cx="0x65" Vid="101" />`)
+	shim.Receive(0x1, `<HdrRow Cx="0x65" Vid="101" />`)
+	// host-cap: a second host from 0x1's IP.
+	shim.Receive(0x3, testHostData)
+	// evicted.
+	players.TouchEvict(0x2, time.Now().UTC())
+	shim.Receive(0x2, `<HdrRow Cx="0x65" Vid="101" />`)
+	// truncated: fills the receive buffer.
+	shim.Receive(0x4, "<Page "+strings.Repeat("x", len(e.buf)))
+	pump(t, e, shim)
+
+	// queue-full and departed act on the send queues (no send worker running).
+	for i := 0; i < clientSendQueueSize+1; i++ {
+		e.enqueue(outMsg{dpnid: 0x9, tag: "PageRes"})
+	}
+	e.enqueue(outMsg{dpnid: 0x5, tag: "PageRes"})
+	e.enqueue(outMsg{dpnid: 0x5, tag: "PageRes"})
+	shim.Disconnected(0x5)
+	pump(t, e, shim)
+
+	want := map[string]uint64{"queue-full": 1, "evicted": 1, "rate-limit": 1, "host-cap": 1, "truncated": 1, "departed": 2}
+	st := e.Stats()
+	for reason, n := range want {
+		if st.Drops[reason] != n {
+			t.Fatalf("Drops[%s]=%d want %d (all: %v)", reason, st.Drops[reason], n, st.Drops)
+		}
+	}
+	if st.SendDropped != 1 || st.RecvEvictedDropped != 1 || st.RecvThrottled != 1 {
+		t.Fatalf("legacy counters: %+v", st)
+	}
+
+	// One record per drop, under the Experiment names NDJSON consumers know.
+	exps := map[string]string{
+		"queue-full": "sendq", "evicted": "drop-evicted", "rate-limit": "drop-rate-limit",
+		"host-cap": "drop-ip-host-cap", "truncated": "drop-truncated", "departed": "drop-departed",
+	}
+	got := map[string]packetlog.Record{}
+	for _, r := range sink.Records() {
+		for reason, exp := range exps {
+			if r.Experiment == exp {
+				if _, dup := got[reason]; dup {
+					t.Fatalf("second %s record: %+v", reason, r)
+				}
+				got[reason] = r
+			}
+		}
+	}
+	for reason, n := range want {
+		r, ok := got[reason]
+		if !ok || !strings.Contains(r.Message, fmt.Sprintf("reason=%s n=%d", reason, n)) {
+			t.Fatalf("drop record for %s: %+v (ok=%v)", reason, r, ok)
+		}
+	}
+	if r := got["queue-full"]; r.Type != "drop" || r.Direction != "out" || r.Destination != "dpnid=0x00000009" || r.Tag != "PageRes" {
+		t.Fatalf("queue-full record=%+v", r)
+	}
+	// Inbound drops reuse the message's own record.
+	if r := got["host-cap"]; r.Type != "dp8" || r.Direction != "in" || r.Source != "dpnid=0x00000003" || !strings.Contains(r.Message, "remote_ip=203.0.113.5") {
+		t.Fatalf("host-cap record=%+v", r)
+	}
+	// Inbound rejections carry their HR code; outbound drops have none.
+	for reason, hr := range map[string]string{
+		"evicted": proto.HRForbidden, "rate-limit": proto.HRTooBusy, "host-cap": proto.HRForbidden,
+		"truncated": proto.HRBadRequest, "queue-full": "", "departed": "",
+	} {
+		msg := got[reason].Message
+		if hr == "" {
+			if strings.Contains(msg, " hr=") {
+				t.Fatalf("%s record has an HR: %s", reason, msg)
+			}
+		} else if !strings.Contains(msg, " hr="+hr) {
+			t.Fatalf("%s record=%q want hr=%s", reason, msg, hr)
+		}
+	}
+}
+
+func TestParseRemoteFromDP8URL(t *testing.T) {
+	cases := []struct {
+		name string
+		url  string
+		want remoteSummary
+		sp   string
+	}{
+		{
+			name: "tcpip with adapter",
+			url:  "x-directplay:/provider=%7BEBFE7BA0-628D-11D2-AE0F-006097B01411%7D;device=%7Bd8a8f3f2-5b0e-4c3a-9d6e-0123456789ab%7D;hostname=203.0.113.7;port=2302",
+			want: remoteSummary{ip: "203.0.113.7", port: "2302", provider: "{EBFE7BA0-628D-11D2-AE0F-006097B01411}", device: "{D8A8F3F2-5B0E-4C3A-9D6E-0123456789AB}"},
+			sp:   "tcpip",
+		},
+		{
+			name: "machine name is not kept",
+			url:  "x-directplay:/provider=%7BEBFE7BA0-628D-11D2-AE0F-006097B01411%7D;hostname=GAMING-PC;port=2302",
+			want: remoteSummary{port: "2302", hostLen: 9, provider: "{EBFE7BA0-628D-11D2-AE0F-006097B01411}"},
+			sp:   "tcpip",
+		},
+		{
+			name: "ipx provider",
+			url:  "x-directplay:/provider=%7B53934290-628D-11D2-AE0F-006097B01411%7D",
+			want: remoteSummary{provider: "{53934290-628D-11D2-AE0F-006097B01411}"},
+			sp:   "ipx",
+		},
+		{
+			name: "unknown provider keeps the guid",
+			url:  "x-directplay:/provider=%7B11111111-2222-3333-4444-555555555555%7D;hostname=198.51.100.1",
+			want: remoteSummary{ip: "198.51.100.1", provider: "{11111111-2222-3333-4444-555555555555}"},
+			sp:   "{11111111-2222-3333-4444-555555555555}",
+		},
+		{
+			name: "malformed guid and suffix key ignored",
+			url:  "x-directplay:/provider=tcp;device=%7Bnot-a-guid%7D;hostport=9;hostname=198.51.100.1",
+			want: remoteSummary{ip: "198.51.100.1"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := parseRemoteFromDP8URL(tc.url)
+			if got != tc.want {
+				t.Fatalf("got %+v, want %+v", got, tc.want)
+			}
+			if tc.sp != "" && got.providerName() != tc.sp {
+				t.Fatalf("providerName=%q want %q", got.providerName(), tc.sp)
+			}
+			for _, a := range got.connectAttrs() {
+				if a == "GAMING-PC" {
+					t.Fatalf("hostname leaked into attrs: %v", got.connectAttrs())
+				}
+			}
+		})
+	}
+}
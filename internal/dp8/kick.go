@@ -0,0 +1,40 @@
+package dp8
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"open-zone/internal/dp8shim"
+)
+
+// Kick evicts dpnid in the PlayerStore (so its messages are dropped), discards its
+// queued sends, and asks the shim to terminate the transport session. found reports
+// whether the player was known. A shim without DP8_DisconnectClient degrades to
+// store-only eviction and is not an error.
+func (e *Engine) Kick(dpnid uint32) (found bool, err error) {
+	if e.players != nil {
+		found = e.players.TouchEvict(dpnid, time.Now().UTC()) || e.players.IsEvicted(dpnid)
+	}
+	e.mu.RLock()
+	_, connected := e.clientRemote[dpnid]
+	e.mu.RUnlock()
+	found = found || connected
+	if !found {
+		return false, nil
+	}
+	e.drop(dropDeparted, dpnid, "", e.sendQ.forget(dpnid))
+
+	err = e.shim.Disconnect(dpnid)
+	switch {
+	case err == nil:
+		slog.Info("player kicked", "dpnid", fmt.Sprintf("0x%08x", dpnid))
+	case errors.Is(err, dp8shim.ErrDisconnectUnavailable):
+		slog.Warn("player evicted; transport session left open (shim lacks DP8_DisconnectClient)", "dpnid", fmt.Sprintf("0x%08x", dpnid))
+		err = nil
+	default:
+		slog.Warn("player evicted; transport disconnect failed", "dpnid", fmt.Sprintf("0x%08x", dpnid), "err", err)
+	}
+	return true, err
+}
@@ -0,0 +1,101 @@
+package dp8
+
+import (
+	"sync"
+	"time"
+)
+
+// Per-client inbound rate limiting.
+//
+// One client spamming Page/RowPg keeps the send worker busy on its behalf and
+// burns CPU in proto.Handle, so each DPNID gets a token bucket refilled at rate tokens/second up to
+// burst. Requests that find the bucket empty are dropped before proto.Handle.
+// Buckets are removed on DESTROY_PLAYER and pruned by the player sweeper when idle.
+
+type tokenBucket struct {
+	tokens    float64
+	last      time.Time
+	throttled bool // currently dropping; used to log once per throttling episode
+}
+
+type clientLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[uint32]*tokenBucket
+}
+
+// newClientLimiter returns nil (limiting disabled) when rate <= 0.
+func newClientLimiter(rate float64, burst int) *clientLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &clientLimiter{rate: rate, burst: float64(burst), buckets: make(map[uint32]*tokenBucket)}
+}
+
+// allow spends one token for dpnid. started is true on the first drop after the
+// client was last within budget.
+func (l *clientLimiter) allow(dpnid uint32, now time.Time) (ok, started bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.buckets[dpnid]
+	if b == nil {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[dpnid] = b
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * l.rate
+		if b.tokens > l.burst {
+			b.tokens = l.burst
+		}
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.throttled = false
+		return true, false
+	}
+	started = !b.throttled
+	b.throttled = true
+	return false, started
+}
+
+func (l *clientLimiter) forget(dpnid uint32) {
+	l.mu.Lock()
+	delete(l.buckets, dpnid)
+	l.mu.Unlock()
+}
+
+// prune drops buckets untouched for longer than idle (missed DESTROY_PLAYER
+// events). It waits at least refill, so a pruned bucket was already back to
+// burst and recreating it hands the client nothing extra.
+func (l *clientLimiter) prune(now time.Time, idle time.Duration) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	idle = max(idle, l.refill())
+	n := 0
+	for dpnid, b := range l.buckets {
+		if now.Sub(b.last) > idle {
+			delete(l.buckets, dpnid)
+			n++
+		}
+	}
+	return n
+}
+
+// refill is how long an empty bucket takes to fill back to burst.
+func (l *clientLimiter) refill() time.Duration {
+	return time.Duration(l.burst / l.rate * float64(time.Second))
+}
+
+func (l *clientLimiter) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
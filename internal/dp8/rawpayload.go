@@ -0,0 +1,64 @@
+package dp8
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"open-zone/internal/packetlog"
+)
+
+// SetRawPayloadSink sends complete inbound and outbound payloads to s
+// (telemetry.raw_payload_path). While it is set, the main telemetry log keeps
+// attribute names and payload sizes but no values: payloads only ever reach s.
+// It must be called before Run.
+func (e *Engine) SetRawPayloadSink(s packetlog.Sink) {
+	e.raw = s
+}
+
+// logRawInbound writes rec, the event's main record, to the raw sink with the
+// event payload appended. Payloads that are not UTF-8 are quoted.
+func (e *Engine) logRawInbound(rec packetlog.Record, payload []byte) {
+	if e.raw == nil || len(payload) == 0 {
+		return
+	}
+	rec.Message = fmt.Sprintf("%s payload=%s", rec.Message, payloadText(payload))
+	e.raw.Log(rec)
+}
+
+// logOutbound writes out's record, sent as n wire bytes, to the main log and,
+// when set, the raw sink. edit adjusts the record first (both copies). The main
+// copy carries the payload only without a raw sink.
+func (e *Engine) logOutbound(out outMsg, n int, edit func(*packetlog.Record)) {
+	if e.raw != nil {
+		rec := out.record(e.runID, n, true)
+		if edit != nil {
+			edit(&rec)
+		}
+		e.raw.Log(rec)
+	}
+	if e.log != nil {
+		rec := out.record(e.runID, n, e.raw == nil)
+		if edit != nil {
+			edit(&rec)
+		}
+		e.log.Log(rec)
+	}
+}
+
+// payloadText renders an inbound payload for the raw sink: the text without its
+// NUL terminator, or a Go-quoted string when it is not valid UTF-8.
+func payloadText(payload []byte) string {
+	b := bytes.TrimRight(payload, "\x00")
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	return fmt.Sprintf("%q", b)
+}
+
+// attrKeysNote is the main-log stand-in for "attrs=map[...]" while payload
+// values go to the raw sink only.
+func attrKeysNote(attrs map[string]string) string {
+	return "attr_keys=" + strings.Join(sortedAttrKeys(attrs), ",")
+}
@@ -0,0 +1,54 @@
+package dp8
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"open-zone/internal/packetlog"
+)
+
+// Replay runs every event the shim yields through the live event handler until
+// the shim reports an empty queue, for offline analysis of a capture (see
+// replayshim). Store mutations, stats and logging happen as they would live,
+// but nothing is sent: queued responses are logged with reply_mode "replay"
+// and never reach Shim.SendTo. The sweeper and send worker are not started.
+//
+// It returns the number of events replayed.
+func (e *Engine) Replay(ctx context.Context) (int, error) {
+	n := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		evt, payload, ok, err := e.shim.PopEvent(e.buf)
+		if err != nil {
+			return n, err
+		}
+		if !ok {
+			slog.Info("dp8 replay finished", "events", n)
+			return n, nil
+		}
+		if err := e.handleEvent(evt, payload); err != nil {
+			return n, fmt.Errorf("replay event %d: %w", n+1, err)
+		}
+		n++
+		e.discardQueued()
+	}
+}
+
+// discardQueued logs and drops everything on the send queues.
+func (e *Engine) discardQueued() {
+	for {
+		out, ok := e.sendQ.pop()
+		if !ok {
+			return
+		}
+		if e.log != nil || e.raw != nil {
+			e.logOutbound(out, len(out.wire(e.cfg.Proto.Framing)), func(rec *packetlog.Record) {
+				rec.ReplyMode = "replay"
+				rec.Message = "not sent " + rec.Message
+			})
+		}
+	}
+}
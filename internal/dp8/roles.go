@@ -0,0 +1,98 @@
+package dp8
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Per-IP role caps.
+//
+// A single machine legitimately runs one host and a couple of browsers; dozens of
+// sessions from one IP is abuse. Roles are not known at CREATE_PLAYER (every session
+// starts as a browser), so enforcement happens in two places:
+//   - connect: reject when the IP already holds hosts+browsers sessions, and
+//   - first HostData: reject when the IP already has the maximum number of hosts.
+//
+// Rejected sessions are kicked (evicted and, when the shim supports it,
+// disconnected) so they neither get answers nor keep their DP8 slot. A cap of 0
+// means no limit for that role.
+
+// ipRoleCountsLocked counts live sessions from ip by role, excluding skip.
+// Caller must hold e.mu.
+func (e *Engine) ipRoleCountsLocked(ip string, skip uint32) (hosts, browsers int) {
+	for dpnid, rs := range e.clientRemote {
+		if dpnid == skip || rs.ip != ip {
+			continue
+		}
+		if e.players.IsEvicted(dpnid) {
+			continue
+		}
+		if _, ok := e.hosting[dpnid]; ok {
+			hosts++
+		} else {
+			browsers++
+		}
+	}
+	return hosts, browsers
+}
+
+// enforceIPRolesOnConnect kicks dpnid when its IP is already at the session cap.
+// Every session starts as a browser, so this only applies with a browser cap.
+func (e *Engine) enforceIPRolesOnConnect(dpnid uint32, ip string) bool {
+	if e.cfg.MaxBrowsersPerIP <= 0 || e.players == nil || ip == "" {
+		return true
+	}
+	e.mu.RLock()
+	hosts, browsers := e.ipRoleCountsLocked(ip, dpnid)
+	e.mu.RUnlock()
+	if e.cfg.MaxHostsPerIP <= 0 && browsers < e.cfg.MaxBrowsersPerIP {
+		return true
+	}
+	if e.cfg.MaxHostsPerIP > 0 && hosts+browsers < e.cfg.MaxHostsPerIP+e.cfg.MaxBrowsersPerIP {
+		return true
+	}
+	slog.Warn(
+		"per-ip session cap reached; evicting new session",
+		"dpnid", fmt.Sprintf("0x%08x", dpnid),
+		"remote_ip", ip,
+		"hosts", hosts,
+		"browsers", browsers,
+		"max_hosts", e.cfg.MaxHostsPerIP,
+		"max_browsers", e.cfg.MaxBrowsersPerIP,
+	)
+	e.Kick(dpnid)
+	return false
+}
+
+// promoteHost marks dpnid as hosting on its first HostData. It returns false (and
+// kicks the session) when its IP already has the maximum number of hosts.
+func (e *Engine) promoteHost(dpnid uint32) bool {
+	e.mu.Lock()
+	if _, ok := e.hosting[dpnid]; ok {
+		e.mu.Unlock()
+		return true
+	}
+	ip := e.clientRemote[dpnid].ip
+	if e.cfg.MaxHostsPerIP <= 0 || e.players == nil || ip == "" {
+		e.hosting[dpnid] = struct{}{}
+		e.mu.Unlock()
+		return true
+	}
+	hosts, _ := e.ipRoleCountsLocked(ip, dpnid)
+	if hosts < e.cfg.MaxHostsPerIP {
+		e.hosting[dpnid] = struct{}{}
+		e.mu.Unlock()
+		return true
+	}
+	e.mu.Unlock()
+
+	slog.Warn(
+		"per-ip host cap reached; evicting session",
+		"dpnid", fmt.Sprintf("0x%08x", dpnid),
+		"remote_ip", ip,
+		"hosts", hosts,
+		"max_hosts", e.cfg.MaxHostsPerIP,
+	)
+	e.Kick(dpnid)
+	return false
+}
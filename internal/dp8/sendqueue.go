@@ -0,0 +1,108 @@
+package dp8
+
+import "sync"
+
+// sendQueues holds one bounded FIFO per DPNID and serves them round-robin, so a
+// slow or spammy client only delays (and, when full, drops) its own messages.
+// Per-client order is preserved, which keeps the connect bundle in sequence.
+type sendQueues struct {
+	perClient int
+
+	mu     sync.Mutex
+	queues map[uint32][]outMsg
+	order  []uint32 // DPNIDs with queued messages, in service order
+	total  int
+
+	// ready is signaled (non-blocking) whenever a message is pushed.
+	ready chan struct{}
+}
+
+func newSendQueues(perClient int) *sendQueues {
+	return &sendQueues{
+		perClient: perClient,
+		queues:    make(map[uint32][]outMsg),
+		ready:     make(chan struct{}, 1),
+	}
+}
+
+// push appends m to its client's queue. It returns false when that queue is full.
+func (q *sendQueues) push(m outMsg) bool {
+	q.mu.Lock()
+	cur := q.queues[m.dpnid]
+	if len(cur) >= q.perClient {
+		q.mu.Unlock()
+		return false
+	}
+	if len(cur) == 0 {
+		q.order = append(q.order, m.dpnid)
+	}
+	q.queues[m.dpnid] = append(cur, m)
+	q.total++
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// pop takes the next message from the client at the head of the rotation and
+// moves that client to the back if it still has messages queued.
+func (q *sendQueues) pop() (outMsg, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.order) == 0 {
+		return outMsg{}, false
+	}
+	dpnid := q.order[0]
+	q.order = q.order[1:]
+	cur := q.queues[dpnid]
+	m := cur[0]
+	cur[0] = outMsg{}
+	if cur = cur[1:]; len(cur) > 0 {
+		q.queues[dpnid] = cur
+		q.order = append(q.order, dpnid)
+	} else {
+		delete(q.queues, dpnid)
+	}
+	q.total--
+	return m, true
+}
+
+// forget discards everything queued for dpnid (e.g. after DESTROY_PLAYER).
+func (q *sendQueues) forget(dpnid uint32) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := len(q.queues[dpnid])
+	if n == 0 {
+		return 0
+	}
+	delete(q.queues, dpnid)
+	for i, id := range q.order {
+		if id == dpnid {
+			q.order = append(q.order[:i], q.order[i+1:]...)
+			break
+		}
+	}
+	q.total -= n
+	return n
+}
+
+// clear discards every queued message and returns how many there were.
+func (q *sendQueues) clear() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := q.total
+	clear(q.queues)
+	q.order = q.order[:0]
+	q.total = 0
+	return n
+}
+
+// len returns the number of queued messages across all clients.
+func (q *sendQueues) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.total
+}
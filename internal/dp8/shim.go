@@ -0,0 +1,22 @@
+package dp8
+
+import "open-zone/internal/dp8shim"
+
+// Shim is the DP8 transport the engine drives. *dp8shim.Shim (the Windows DLL
+// wrapper) implements it; fakeshim provides an in-memory version for tests.
+type Shim interface {
+	StartServer(port uint16) error
+	StopServer()
+	PopEvent(buf []byte) (dp8shim.Event, []byte, bool, error)
+	SendTo(dpnid uint32, payload []byte, flags uint32) error
+	QueueDepth() uint32
+	Disconnect(dpnid uint32) error
+}
+
+var _ Shim = (*dp8shim.Shim)(nil)
+
+// EventRecorder receives every event popped from the shim before it is handled
+// (see replayshim.Recorder for the raw capture file).
+type EventRecorder interface {
+	RecordEvent(evt dp8shim.Event, payload []byte)
+}
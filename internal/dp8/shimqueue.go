@@ -0,0 +1,48 @@
+package dp8
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// shimQueueSampleEvery is how often the shim's event queue depth is checked
+// against dp8.shim_queue_warn.
+const shimQueueSampleEvery = 5 * time.Second
+
+// shimQueueWatcher samples the shim queue until ctx ends. A growing queue means
+// Run is not draining DP8 events as fast as dpnet delivers them.
+func (e *Engine) shimQueueWatcher(ctx context.Context) {
+	if e.cfg.ShimQueueWarn <= 0 {
+		return
+	}
+	t := time.NewTicker(shimQueueSampleEvery)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			e.sampleShimQueue()
+		}
+	}
+}
+
+// sampleShimQueue records one depth sample and logs when the queue crosses the
+// threshold in either direction (once per crossing, not every sample). It
+// reports whether the queue is over the threshold.
+func (e *Engine) sampleShimQueue() bool {
+	depth := e.shim.QueueDepth()
+	if depth > e.shimQueuePeak.Load() {
+		e.shimQueuePeak.Store(depth) // single sampler goroutine; Stats only reads
+	}
+	warn := e.cfg.ShimQueueWarn
+	over := warn > 0 && int64(depth) > int64(warn)
+	switch {
+	case over && !e.shimBacklogged.Swap(true):
+		slog.Warn("dp8 shim event queue backing up; engine is not keeping up", "depth", depth, "threshold", warn)
+	case !over && e.shimBacklogged.Swap(false):
+		slog.Info("dp8 shim event queue recovered", "depth", depth, "threshold", warn)
+	}
+	return over
+}
@@ -0,0 +1,38 @@
+package dp8
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"open-zone/internal/proto"
+)
+
+// handleTimed runs the proto handler for msg under dp8.handler_timeout. The
+// handler cannot be interrupted mid-parse, so the timeout is soft: a handler
+// still running at the deadline is logged (tag, DPNID, remote) while it blocks
+// the Run loop, and again with its total time once it returns.
+func (e *Engine) handleTimed(dpnid uint32, remoteIP string, msg proto.Msg) []proto.Outbound {
+	now := time.Now()
+	limit := e.cfg.HandlerTimeout
+	if limit <= 0 {
+		return e.protoHandle(now.UTC(), dpnid, remoteIP, msg)
+	}
+
+	attrs := []any{"tag", msg.Tag, "dpnid", fmt.Sprintf("0x%08x", dpnid), "timeout", limit}
+	warned := make(chan struct{})
+	t := time.AfterFunc(limit, func() {
+		defer close(warned)
+		e.slowHandlers.Add(1)
+		slog.Warn("proto handler over timeout; event loop stalled", append(attrs, e.remoteAttrs(dpnid)...)...)
+	})
+	// A panicking handler unwinds past the check below; stop the timer anyway so
+	// it is not reported as stalled.
+	defer t.Stop()
+	outs := e.protoHandle(now.UTC(), dpnid, remoteIP, msg)
+	if !t.Stop() {
+		<-warned
+		slog.Warn("slow proto handler finished", append(attrs, "elapsed", time.Since(now).Round(time.Millisecond))...)
+	}
+	return outs
+}
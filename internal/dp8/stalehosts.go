@@ -0,0 +1,47 @@
+package dp8
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	// staleHostsSampleEvery is how often the stale host count is checked.
+	staleHostsSampleEvery = time.Minute
+	// staleHostsWarnEvery spaces out warnings while the count keeps climbing.
+	staleHostsWarnEvery = 10 * time.Minute
+)
+
+// staleHostWatcher samples the stale host count (see
+// state.HostStore.StaleHostsCount) until ctx ends, so hung hosts show up in the
+// log and not only in Stats.
+func (e *Engine) staleHostWatcher(ctx context.Context) {
+	if e.proto == nil {
+		return
+	}
+	t := time.NewTicker(staleHostsSampleEvery)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			e.noteStaleHosts(now.UTC(), e.proto.Stats().StaleHosts)
+		}
+	}
+}
+
+// noteStaleHosts records one sample of n stale hosts and warns when n has risen
+// since the last sample, at most once per staleHostsWarnEvery. It reports
+// whether it warned.
+func (e *Engine) noteStaleHosts(now time.Time, n int) bool {
+	prev := e.staleHosts
+	e.staleHosts = n // single sampler goroutine
+	if n <= prev || now.Sub(e.staleHostsWarnedAt) < staleHostsWarnEvery {
+		return false
+	}
+	e.staleHostsWarnedAt = now
+	slog.Warn("stale hosts rising; hosts stopped sending HostData", "stale_hosts", n, "previous", prev)
+	return true
+}
@@ -0,0 +1,130 @@
+package dp8
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Per-client inbound message rates.
+//
+// Every RECEIVE is counted against its DPNID in a sliding window of talkerSlots
+// buckets, so operators can see who is chattiest (admin status, SIGUSR1 dump)
+// before picking limits.client_msgs_per_sec. Counters are removed on
+// DESTROY_PLAYER and pruned by the player sweeper when idle.
+
+const (
+	talkerWindow = time.Minute
+	talkerSlots  = 12
+	talkerSlot   = talkerWindow / talkerSlots
+)
+
+// Talker is one client's inbound traffic over the last talkerWindow.
+type Talker struct {
+	DPNID uint32
+	Msgs  int     // messages received in the window
+	Rate  float64 // Msgs per second, averaged over the window
+}
+
+type talkerCounts struct {
+	// counts[i] holds messages for slot number slot[i] (time / talkerSlot); a
+	// bucket whose slot is older than the window is stale and reused.
+	counts [talkerSlots]int
+	slot   [talkerSlots]int64
+	last   time.Time
+}
+
+type talkerRates struct {
+	mu      sync.Mutex
+	clients map[uint32]*talkerCounts
+}
+
+func newTalkerRates() *talkerRates {
+	return &talkerRates{clients: make(map[uint32]*talkerCounts)}
+}
+
+// observe counts one inbound message from dpnid at now.
+func (t *talkerRates) observe(dpnid uint32, now time.Time) {
+	slot := now.UnixNano() / int64(talkerSlot)
+	i := slot % talkerSlots
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := t.clients[dpnid]
+	if c == nil {
+		c = &talkerCounts{}
+		t.clients[dpnid] = c
+	}
+	if c.slot[i] != slot {
+		c.slot[i] = slot
+		c.counts[i] = 0
+	}
+	c.counts[i]++
+	c.last = now
+}
+
+// inWindow sums c's buckets that fall inside the window ending at slot.
+func (c *talkerCounts) inWindow(slot int64) int {
+	n := 0
+	for i := range c.counts {
+		if slot-c.slot[i] < talkerSlots {
+			n += c.counts[i]
+		}
+	}
+	return n
+}
+
+// top returns the n clients with the most messages in the window ending at now,
+// busiest first (ties by DPNID). Clients silent for the whole window are left out.
+func (t *talkerRates) top(now time.Time, n int) []Talker {
+	if n <= 0 {
+		return nil
+	}
+	slot := now.UnixNano() / int64(talkerSlot)
+
+	t.mu.Lock()
+	out := make([]Talker, 0, len(t.clients))
+	for dpnid, c := range t.clients {
+		if msgs := c.inWindow(slot); msgs > 0 {
+			out = append(out, Talker{DPNID: dpnid, Msgs: msgs, Rate: float64(msgs) / talkerWindow.Seconds()})
+		}
+	}
+	t.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Msgs != out[j].Msgs {
+			return out[i].Msgs > out[j].Msgs
+		}
+		return out[i].DPNID < out[j].DPNID
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+func (t *talkerRates) forget(dpnid uint32) {
+	t.mu.Lock()
+	delete(t.clients, dpnid)
+	t.mu.Unlock()
+}
+
+// prune drops clients with no message for longer than idle (missed DESTROY_PLAYER events).
+func (t *talkerRates) prune(now time.Time, idle time.Duration) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for dpnid, c := range t.clients {
+		if now.Sub(c.last) > idle {
+			delete(t.clients, dpnid)
+			n++
+		}
+	}
+	return n
+}
+
+func (t *talkerRates) len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.clients)
+}
@@ -0,0 +1,35 @@
+package dp8
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTalkerRates_SlidingWindow(t *testing.T) {
+	tr := newTalkerRates()
+	t0 := time.Unix(1700000000, 0)
+	for i := 0; i < 30; i++ {
+		tr.observe(0x1, t0)
+	}
+	for i := 0; i < 10; i++ {
+		tr.observe(0x2, t0.Add(40*time.Second))
+	}
+
+	got := tr.top(t0.Add(45*time.Second), 5)
+	if len(got) != 2 || got[0].DPNID != 0x1 || got[0].Msgs != 30 || got[1].Msgs != 10 {
+		t.Fatalf("top=%+v", got)
+	}
+	if got[0].Rate != 0.5 {
+		t.Fatalf("rate=%v want 0.5", got[0].Rate)
+	}
+
+	// 0x1's burst has slid out of the window; 0x2's has not.
+	got = tr.top(t0.Add(talkerWindow+10*time.Second), 5)
+	if len(got) != 1 || got[0].DPNID != 0x2 || got[0].Msgs != 10 {
+		t.Fatalf("after window top=%+v", got)
+	}
+
+	if n := tr.prune(t0.Add(90*time.Second), talkerWindow); n != 1 || tr.len() != 1 {
+		t.Fatalf("pruned=%d left=%d", n, tr.len())
+	}
+}
@@ -0,0 +1,24 @@
+package dp8
+
+import "sync"
+
+// maxPooledWireBuf keeps the odd huge PageRes from pinning its buffer in the pool.
+const maxPooledWireBuf = 64 * 1024
+
+// wireBufs recycles outbound frame buffers so each send does not allocate.
+var wireBufs = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 1024)
+		return &b
+	},
+}
+
+func getWireBuf() *[]byte { return wireBufs.Get().(*[]byte) }
+
+func putWireBuf(b *[]byte) {
+	if cap(*b) > maxPooledWireBuf {
+		return
+	}
+	*b = (*b)[:0]
+	wireBufs.Put(b)
+}
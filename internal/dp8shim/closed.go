@@ -0,0 +1,7 @@
+package dp8shim
+
+import "errors"
+
+// ErrClosed is returned by PopEvent and SendTo after StopServer, so a poller
+// racing shutdown sees a clean, recognizable error instead of a native rc.
+var ErrClosed = errors.New("dp8shim: server stopped")
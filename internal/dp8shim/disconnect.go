@@ -0,0 +1,7 @@
+package dp8shim
+
+import "errors"
+
+// ErrDisconnectUnavailable is returned by Disconnect when the loaded shim predates
+// the DP8_DisconnectClient export.
+var ErrDisconnectUnavailable = errors.New("dp8shim: DP8_DisconnectClient not exported")
@@ -1,8 +1,10 @@
-//go:build windows
-
 // Package dp8shim provides a tiny Windows-only wrapper around the bundled
 // `dp8shim.dll`.
 //
 // The shim hosts a DirectPlay8 server and exposes a minimal C ABI used by the Go
 // process to pop queued events and send payloads to connected clients.
+//
+// On other platforms the package still builds (so callers can be compiled and
+// unit-tested), but Load always fails. Engine tests use the in-memory
+// fakeshim subpackage instead; offline capture replay uses replayshim.
 package dp8shim
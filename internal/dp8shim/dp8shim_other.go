@@ -0,0 +1,36 @@
+//go:build !windows
+
+package dp8shim
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errUnsupported = errors.New("dp8shim requires windows (dpnet.dll)")
+
+// Shim is a placeholder on non-Windows platforms; every transport call fails.
+type Shim struct{}
+
+func Load(path string) (*Shim, error) {
+	return nil, errUnsupported
+}
+
+func (s *Shim) StartServer(port uint16) error { return errUnsupported }
+
+func (s *Shim) StopServer() {}
+
+func (s *Shim) PopEvent(buf []byte) (Event, []byte, bool, error) {
+	return Event{}, nil, false, errUnsupported
+}
+
+func (s *Shim) SendTo(dpnid uint32, payload []byte, flags uint32) error { return errUnsupported }
+
+func (s *Shim) QueueDepth() uint32 { return 0 }
+
+func (s *Shim) ListenInfo() (ListenInfo, error) { return ListenInfo{}, errUnsupported }
+
+// Disconnect reports ErrDisconnectUnavailable so callers fall back to store-only eviction.
+func (s *Shim) Disconnect(dpnid uint32) error {
+	return fmt.Errorf("%w: %w", ErrDisconnectUnavailable, errUnsupported)
+}
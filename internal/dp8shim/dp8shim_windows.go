@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"unsafe"
 )
@@ -17,14 +18,12 @@ type Shim struct {
 	popEvent    *syscall.LazyProc
 	sendTo      *syscall.LazyProc
 	queueDepth  *syscall.LazyProc
-}
+	listenInfo  *syscall.LazyProc
+	disconnect  *syscall.LazyProc
 
-type Event struct {
-	MsgID    uint32
-	DPNID    uint32
-	DataLen  uint32
-	Flags    uint32
-	TSUnixMS uint64
+	// closed is set by StopServer; PopEvent/SendTo then return ErrClosed
+	// without calling into the DLL.
+	closed atomic.Bool
 }
 
 func Load(path string) (*Shim, error) {
@@ -36,6 +35,8 @@ func Load(path string) (*Shim, error) {
 		popEvent:    d.NewProc("DP8_PopEvent"),
 		sendTo:      d.NewProc("DP8_SendTo"),
 		queueDepth:  d.NewProc("DP8_GetQueueDepth"),
+		listenInfo:  d.NewProc("DP8_GetListenInfo"),
+		disconnect:  d.NewProc("DP8_DisconnectClient"),
 	}
 	// Force-load now so we fail fast.
 	if err := d.Load(); err != nil {
@@ -63,10 +64,16 @@ func Load(path string) (*Shim, error) {
 			missing = append(missing, r.name)
 		}
 	}
-	// Optional export. If missing, QueueDepth() will return 0.
+	// Optional exports. If missing, QueueDepth() returns 0 and ListenInfo()/Disconnect() fail.
 	if s.queueDepth != nil {
 		_ = s.queueDepth.Find()
 	}
+	if s.listenInfo != nil {
+		_ = s.listenInfo.Find()
+	}
+	if s.disconnect != nil {
+		_ = s.disconnect.Find()
+	}
 	if len(missing) > 0 {
 		return nil, fmt.Errorf(
 			"dp8shim %s is missing required exports: %s (rebuild dp8shim.dll from open-zone/dp8shim/dp8shim.cpp)",
@@ -88,13 +95,19 @@ func (s *Shim) StartServer(port uint16) error {
 	if hr != 0 {
 		return fmt.Errorf("DP8_StartServer failed hr=0x%08x (port=%d)", uint32(hr), port)
 	}
+	s.closed.Store(false)
 	return nil
 }
 
+// StopServer shuts the DP8 server down and marks the shim closed. It is safe to
+// call more than once.
 func (s *Shim) StopServer() {
 	if s == nil || s.stopServer == nil {
 		return
 	}
+	if s.closed.Swap(true) {
+		return
+	}
 	_, _, _ = s.stopServer.Call()
 }
 
@@ -102,6 +115,9 @@ func (s *Shim) PopEvent(buf []byte) (Event, []byte, bool, error) {
 	if s == nil || s.popEvent == nil {
 		return Event{}, nil, false, errors.New("dp8shim not loaded")
 	}
+	if s.closed.Load() {
+		return Event{}, nil, false, ErrClosed
+	}
 	var evt Event
 	var outPtr uintptr
 	var outCap uintptr
@@ -117,13 +133,19 @@ func (s *Shim) PopEvent(buf []byte) (Event, []byte, bool, error) {
 	_ = callErr
 	n := int32(r1)
 	if n < 0 {
+		if s.closed.Load() {
+			// StopServer ran while this call was in the DLL.
+			return Event{}, nil, false, ErrClosed
+		}
 		return Event{}, nil, false, fmt.Errorf("DP8_PopEvent failed rc=%d", n)
 	}
 	if n == 0 {
 		return Event{}, nil, false, nil
 	}
 	if evt.DataLen > uint32(len(buf)) {
+		// The DLL already clamps and flags this; keep Go safe with an older build.
 		evt.DataLen = uint32(len(buf))
+		evt.Flags |= EventFlagTruncated
 	}
 	return evt, buf[:evt.DataLen], true, nil
 }
@@ -132,6 +154,9 @@ func (s *Shim) SendTo(dpnid uint32, payload []byte, flags uint32) error {
 	if s == nil || s.sendTo == nil {
 		return errors.New("dp8shim not loaded")
 	}
+	if s.closed.Load() {
+		return ErrClosed
+	}
 	if len(payload) == 0 {
 		return errors.New("empty payload")
 	}
@@ -161,3 +186,39 @@ func (s *Shim) QueueDepth() uint32 {
 	r1, _, _ := s.queueDepth.Call()
 	return uint32(r1)
 }
+
+// ListenInfo reports the port/adapter the DP8 server actually bound.
+// Returns ErrListenInfoUnavailable on older shim builds without the export.
+func (s *Shim) ListenInfo() (ListenInfo, error) {
+	if s == nil || s.listenInfo == nil {
+		return ListenInfo{}, errors.New("dp8shim not loaded")
+	}
+	if err := s.listenInfo.Find(); err != nil {
+		return ListenInfo{}, ErrListenInfoUnavailable
+	}
+	return readListenInfo(func(outPort *uint16, outAdapter []byte) uint32 {
+		r1, _, _ := s.listenInfo.Call(
+			uintptr(unsafe.Pointer(outPort)),
+			uintptr(unsafe.Pointer(&outAdapter[0])),
+			uintptr(uint32(len(outAdapter))),
+		)
+		return uint32(r1)
+	})
+}
+
+// Disconnect terminates a player's DP8 transport session.
+// Returns ErrDisconnectUnavailable on older shim builds without the export.
+func (s *Shim) Disconnect(dpnid uint32) error {
+	if s == nil || s.disconnect == nil {
+		return errors.New("dp8shim not loaded")
+	}
+	if err := s.disconnect.Find(); err != nil {
+		return ErrDisconnectUnavailable
+	}
+	r1, _, _ := s.disconnect.Call(uintptr(dpnid))
+	hr := uint32(r1)
+	if (hr & 0x80000000) != 0 {
+		return fmt.Errorf("DP8_DisconnectClient failed hr=0x%08x", hr)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package dp8shim
+
+// Event mirrors the shim's DP8Event struct (see dp8shim/dp8shim.h).
+type Event struct {
+	MsgID    uint32
+	DPNID    uint32
+	DataLen  uint32
+	Flags    uint32
+	TSUnixMS uint64
+}
+
+// EventFlagTruncated is set in Event.Flags when the payload was cut short, either
+// by the shim's own per-event limit or to fit the caller's buffer. DataLen is then
+// the number of bytes delivered, not the original size.
+const EventFlagTruncated = 1
+
+// Truncated reports whether the payload is incomplete (see EventFlagTruncated).
+func (e Event) Truncated() bool { return e.Flags&EventFlagTruncated != 0 }
@@ -0,0 +1,184 @@
+// Package fakeshim is an in-memory stand-in for the DP8 shim so the dp8 engine
+// can be exercised on any platform. Tests inject events (as the DLL's callback
+// queue would) and inspect the sends the engine made.
+package fakeshim
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"open-zone/internal/dp8shim"
+)
+
+// DPN_MSGID_* values (from dplay8.h) for building events.
+const (
+	MsgIDCreatePlayer  uint32 = 0xffff0007
+	MsgIDDestroyPlayer uint32 = 0xffff0009
+	MsgIDReceive       uint32 = 0xffff0011
+)
+
+// Sent is one captured SendTo call.
+type Sent struct {
+	DPNID   uint32
+	Payload []byte
+	Flags   uint32
+}
+
+type queued struct {
+	evt     dp8shim.Event
+	payload []byte
+}
+
+// Shim implements the engine's transport interface in memory.
+type Shim struct {
+	mu           sync.Mutex
+	started      bool
+	closed       bool
+	port         uint16
+	events       []queued
+	sent         []Sent
+	disconnected []uint32
+
+	// SendErr/DisconnectErr, when set, are returned by SendTo/Disconnect.
+	SendErr       error
+	DisconnectErr error
+
+	// depth, when set by SetQueueDepth, is reported by QueueDepth instead of the
+	// real event count.
+	depth *uint32
+}
+
+func New() *Shim {
+	return &Shim{}
+}
+
+// Inject queues an event for PopEvent. DataLen is set from payload.
+func (s *Shim) Inject(evt dp8shim.Event, payload []byte) {
+	evt.DataLen = uint32(len(payload))
+	if evt.TSUnixMS == 0 {
+		evt.TSUnixMS = uint64(time.Now().UnixMilli())
+	}
+	s.mu.Lock()
+	s.events = append(s.events, queued{evt: evt, payload: append([]byte(nil), payload...)})
+	s.mu.Unlock()
+}
+
+// Connect injects CREATE_PLAYER with a DP8 URL carrying ip as the remote host.
+func (s *Shim) Connect(dpnid uint32, ip string) {
+	s.Inject(dp8shim.Event{MsgID: MsgIDCreatePlayer, DPNID: dpnid}, []byte("x-directplay:/provider=%7BEBFE7BA0-628D-11D2-AE0F-006097B01411%7D;hostname="+ip+";port=2302"))
+}
+
+// Receive injects a RECEIVE of an app-protocol message (NUL terminator added).
+func (s *Shim) Receive(dpnid uint32, msg string) {
+	s.Inject(dp8shim.Event{MsgID: MsgIDReceive, DPNID: dpnid}, []byte(msg+"\x00"))
+}
+
+// Disconnected injects DESTROY_PLAYER.
+func (s *Shim) Disconnected(dpnid uint32) {
+	s.Inject(dp8shim.Event{MsgID: MsgIDDestroyPlayer, DPNID: dpnid}, nil)
+}
+
+func (s *Shim) StartServer(port uint16) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return errors.New("fakeshim: already started")
+	}
+	s.started, s.closed, s.port = true, false, port
+	return nil
+}
+
+// StopServer marks the shim closed: PopEvent and SendTo then fail with
+// dp8shim.ErrClosed, like the DLL wrapper after shutdown.
+func (s *Shim) StopServer() {
+	s.mu.Lock()
+	s.started, s.closed = false, true
+	s.mu.Unlock()
+}
+
+// PopEvent copies the next injected payload into buf, truncating like the DLL.
+func (s *Shim) PopEvent(buf []byte) (dp8shim.Event, []byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return dp8shim.Event{}, nil, false, dp8shim.ErrClosed
+	}
+	if len(s.events) == 0 {
+		return dp8shim.Event{}, nil, false, nil
+	}
+	q := s.events[0]
+	s.events = s.events[1:]
+	n := copy(buf, q.payload)
+	q.evt.DataLen = uint32(n)
+	if n < len(q.payload) {
+		q.evt.Flags |= dp8shim.EventFlagTruncated
+	}
+	return q.evt, buf[:n], true, nil
+}
+
+func (s *Shim) SendTo(dpnid uint32, payload []byte, flags uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return dp8shim.ErrClosed
+	}
+	s.sent = append(s.sent, Sent{DPNID: dpnid, Payload: append([]byte(nil), payload...), Flags: flags})
+	return s.SendErr
+}
+
+func (s *Shim) QueueDepth() uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.depth != nil {
+		return *s.depth
+	}
+	return uint32(len(s.events))
+}
+
+// SetQueueDepth makes QueueDepth report n from now on, simulating a backlog
+// without queueing real events.
+func (s *Shim) SetQueueDepth(n uint32) {
+	s.mu.Lock()
+	s.depth = &n
+	s.mu.Unlock()
+}
+
+func (s *Shim) Disconnect(dpnid uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.DisconnectErr != nil {
+		return s.DisconnectErr
+	}
+	s.disconnected = append(s.disconnected, dpnid)
+	return nil
+}
+
+// Sent returns a copy of every SendTo so far.
+func (s *Shim) Sent() []Sent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Sent(nil), s.sent...)
+}
+
+// DisconnectedIDs returns the DPNIDs passed to a successful Disconnect.
+func (s *Shim) DisconnectedIDs() []uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]uint32(nil), s.disconnected...)
+}
+
+// WaitSent polls until at least n sends were captured or timeout passes.
+func (s *Shim) WaitSent(n int, timeout time.Duration) ([]Sent, bool) {
+	deadline := time.Now().Add(timeout)
+	for {
+		sent := s.Sent()
+		if len(sent) >= n {
+			return sent, true
+		}
+		if time.Now().After(deadline) {
+			return sent, false
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,43 @@
+package dp8shim
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ListenInfo is what the running DP8 server actually bound, as reported by
+// DP8_GetListenInfo.
+type ListenInfo struct {
+	Port uint16
+
+	// Adapter is the DP8 device (adapter) GUID, when reported.
+	Adapter string
+}
+
+// ErrListenInfoUnavailable is returned when the shim lacks DP8_GetListenInfo.
+var ErrListenInfoUnavailable = errors.New("dp8shim: DP8_GetListenInfo not exported")
+
+// PortOr returns the bound port, or fallback when none was reported.
+func (li ListenInfo) PortOr(fallback int) int {
+	if li.Port == 0 {
+		return fallback
+	}
+	return int(li.Port)
+}
+
+// listenInfoCall invokes DP8_GetListenInfo (or a test fake) and returns its HRESULT.
+type listenInfoCall func(outPort *uint16, outAdapter []byte) uint32
+
+func readListenInfo(call listenInfoCall) (ListenInfo, error) {
+	var port uint16
+	adapter := make([]byte, 40)
+	hr := call(&port, adapter)
+	if (hr & 0x80000000) != 0 {
+		return ListenInfo{}, fmt.Errorf("DP8_GetListenInfo failed hr=0x%08x", hr)
+	}
+	if i := bytes.IndexByte(adapter, 0); i >= 0 {
+		adapter = adapter[:i]
+	}
+	return ListenInfo{Port: port, Adapter: string(adapter)}, nil
+}
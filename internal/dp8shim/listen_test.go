@@ -0,0 +1,32 @@
+package dp8shim
+
+import "testing"
+
+func TestReadListenInfo_FakeReturnsPort(t *testing.T) {
+	li, err := readListenInfo(func(outPort *uint16, outAdapter []byte) uint32 {
+		*outPort = 2399
+		copy(outAdapter, "EBFE7BA0-628D-11D2-AE0F-006097B01411\x00")
+		return 0
+	})
+	if err != nil {
+		t.Fatalf("readListenInfo: %v", err)
+	}
+	if li.Port != 2399 || li.Adapter != "EBFE7BA0-628D-11D2-AE0F-006097B01411" {
+		t.Fatalf("li=%+v", li)
+	}
+	if got := li.PortOr(2300); got != 2399 {
+		t.Fatalf("PortOr=%d", got)
+	}
+}
+
+func TestReadListenInfo_FailureFallsBack(t *testing.T) {
+	li, err := readListenInfo(func(outPort *uint16, outAdapter []byte) uint32 {
+		return 0x80004005
+	})
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if got := li.PortOr(2300); got != 2300 {
+		t.Fatalf("PortOr=%d want configured fallback", got)
+	}
+}
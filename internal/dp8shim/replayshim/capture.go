@@ -0,0 +1,130 @@
+package replayshim
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"open-zone/internal/dp8shim"
+)
+
+// captureVersion is written on every raw capture line.
+const captureVersion = 1
+
+// captureLine is one raw capture record: the shim's event struct verbatim plus
+// the payload bytes (base64 in JSON).
+type captureLine struct {
+	V        int    `json:"v"`
+	MsgID    uint32 `json:"msg_id"`
+	DPNID    uint32 `json:"dpnid"`
+	DataLen  uint32 `json:"data_len"`
+	Flags    uint32 `json:"flags"`
+	TSUnixMS uint64 `json:"ts_unix_ms"`
+	Payload  []byte `json:"payload,omitempty"`
+}
+
+// Recorder writes a raw capture: one JSON line per inbound event with its exact
+// payload, for faithful replay via ReadCapture.
+//
+// Raw payloads are what clients sent (player names, chat, host addresses).
+// Treat capture files like credentials: restrict access and delete them when
+// the investigation is done.
+type Recorder struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+	err error
+}
+
+// CreateRecorder opens path for appending, readable by the owner only.
+func CreateRecorder(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// NewRecorder writes to w (tests, pipes). Close does not close w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// RecordEvent appends evt and payload. After the first write error the
+// recorder stops writing; Err reports it.
+func (r *Recorder) RecordEvent(evt dp8shim.Event, payload []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil || r.enc == nil {
+		return
+	}
+	r.err = r.enc.Encode(captureLine{
+		V:        captureVersion,
+		MsgID:    evt.MsgID,
+		DPNID:    evt.DPNID,
+		DataLen:  evt.DataLen,
+		Flags:    evt.Flags,
+		TSUnixMS: evt.TSUnixMS,
+		Payload:  payload,
+	})
+}
+
+// Err returns the first write error, if any.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enc = nil
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+// ReadCapture reads a raw capture written by Recorder.
+func ReadCapture(r io.Reader) ([]Captured, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	var out []Captured
+	line := 0
+	for sc.Scan() {
+		line++
+		raw := sc.Bytes()
+		if len(strings.TrimSpace(string(raw))) == 0 {
+			continue
+		}
+		var cl captureLine
+		if err := json.Unmarshal(raw, &cl); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if cl.V != captureVersion {
+			return nil, fmt.Errorf("line %d: unsupported capture version %d", line, cl.V)
+		}
+		out = append(out, Captured{
+			Line: line,
+			Event: dp8shim.Event{
+				MsgID:    cl.MsgID,
+				DPNID:    cl.DPNID,
+				DataLen:  cl.DataLen,
+				Flags:    cl.Flags,
+				TSUnixMS: cl.TSUnixMS,
+			},
+			Payload: cl.Payload,
+		})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
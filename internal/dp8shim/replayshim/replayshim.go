@@ -0,0 +1,204 @@
+// Package replayshim is a read-only DP8 transport that replays captured events
+// (from dp8 NDJSON telemetry) into the engine. Sends are discarded and counted,
+// so the engine's store mutations and logging can be studied offline on any
+// platform.
+package replayshim
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"open-zone/internal/dp8shim"
+	"open-zone/internal/packetlog"
+)
+
+// Captured is one inbound DP8 event and its payload.
+type Captured struct {
+	Line    int // source line in the capture, 0 if built in memory
+	Event   dp8shim.Event
+	Payload []byte
+}
+
+var (
+	dpnidPattern   = regexp.MustCompile(`dpnid=0x([0-9a-fA-F]+)`)
+	msgIDPattern   = regexp.MustCompile(`msg_id=0x([0-9a-fA-F]+)`)
+	flagsPattern   = regexp.MustCompile(`flags=0x([0-9a-fA-F]+)`)
+	tsPattern      = regexp.MustCompile(`ts_unix_ms=([0-9]+)`)
+	attrKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*:`)
+)
+
+// ReadNDJSON collects the inbound dp8 event records from a telemetry capture, in
+// file order. Other record types are skipped.
+//
+// Telemetry does not keep raw payloads: app-protocol messages are rebuilt as
+// "<Tag K="V" .../>" from the logged tag and attrs (nested bodies such as
+// HostData items are lost), and connect events carry no DP8 URL.
+func ReadNDJSON(r io.Reader) ([]Captured, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	var out []Captured
+	line := 0
+	for sc.Scan() {
+		line++
+		raw := sc.Bytes()
+		if len(strings.TrimSpace(string(raw))) == 0 {
+			continue
+		}
+		rec, err := packetlog.DecodeRecord(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if rec.Type != "dp8" || rec.Direction != "in" || rec.Experiment != "event" {
+			continue
+		}
+		evt := dp8shim.Event{
+			MsgID:    hexField(msgIDPattern, rec.Message),
+			DPNID:    hexField(dpnidPattern, rec.Source),
+			Flags:    hexField(flagsPattern, rec.Message),
+			TSUnixMS: decField(tsPattern, rec.Message),
+		}
+		if evt.MsgID == 0 {
+			return nil, fmt.Errorf("line %d: dp8 event without msg_id", line)
+		}
+		c := Captured{Line: line, Event: evt}
+		if rec.Tag != "" {
+			c.Payload = BuildPayload(rec.Tag, ParseAttrs(rec.Message))
+		}
+		c.Event.DataLen = uint32(len(c.Payload))
+		out = append(out, c)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// BuildPayload renders a NUL-terminated single-element app-protocol message
+// with attrs in key order.
+func BuildPayload(tag string, attrs map[string]string) []byte {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString("<" + tag)
+	for _, k := range keys {
+		fmt.Fprintf(&b, ` %s="%s"`, k, attrs[k])
+	}
+	b.WriteString("/>\x00")
+	return []byte(b.String())
+}
+
+// ParseAttrs recovers the attribute map from the engine's "... attrs=map[K:V K2:V2]"
+// suffix. Go's %v map format is not escaped, so a space followed by something that
+// does not look like "Key:" is treated as part of the previous value.
+func ParseAttrs(message string) map[string]string {
+	attrs := map[string]string{}
+	i := strings.LastIndex(message, "attrs=map[")
+	if i < 0 {
+		return attrs
+	}
+	body := strings.TrimSuffix(message[i+len("attrs=map["):], "]")
+	if body == "" {
+		return attrs
+	}
+	var key string
+	for _, tok := range strings.Split(body, " ") {
+		if loc := attrKeyPattern.FindStringIndex(tok); loc != nil {
+			key = tok[:loc[1]-1]
+			attrs[key] = tok[loc[1]:]
+			continue
+		}
+		if key != "" {
+			attrs[key] += " " + tok
+		}
+	}
+	return attrs
+}
+
+func hexField(re *regexp.Regexp, s string) uint32 {
+	m := re.FindStringSubmatch(s)
+	if m == nil {
+		return 0
+	}
+	v, err := strconv.ParseUint(m[1], 16, 32)
+	if err != nil {
+		return 0
+	}
+	return uint32(v)
+}
+
+func decField(re *regexp.Regexp, s string) uint64 {
+	m := re.FindStringSubmatch(s)
+	if m == nil {
+		return 0
+	}
+	v, _ := strconv.ParseUint(m[1], 10, 64)
+	return v
+}
+
+// Shim hands out captured events in order and never transmits anything.
+type Shim struct {
+	mu         sync.Mutex
+	events     []Captured
+	suppressed int
+}
+
+func New(events []Captured) *Shim {
+	return &Shim{events: append([]Captured(nil), events...)}
+}
+
+func (s *Shim) StartServer(port uint16) error { return nil }
+
+func (s *Shim) StopServer() {}
+
+// PopEvent copies the next captured payload into buf, truncating (and flagging
+// it) like the DLL.
+// ok is false once the capture is exhausted.
+func (s *Shim) PopEvent(buf []byte) (dp8shim.Event, []byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.events) == 0 {
+		return dp8shim.Event{}, nil, false, nil
+	}
+	c := s.events[0]
+	s.events = s.events[1:]
+	n := copy(buf, c.Payload)
+	c.Event.DataLen = uint32(n)
+	if n < len(c.Payload) {
+		c.Event.Flags |= dp8shim.EventFlagTruncated
+	}
+	return c.Event, buf[:n], true, nil
+}
+
+// SendTo discards the payload.
+func (s *Shim) SendTo(dpnid uint32, payload []byte, flags uint32) error {
+	s.mu.Lock()
+	s.suppressed++
+	s.mu.Unlock()
+	return nil
+}
+
+// QueueDepth is the number of captured events not yet replayed.
+func (s *Shim) QueueDepth() uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return uint32(len(s.events))
+}
+
+// Disconnect is a no-op; the engine's store-side eviction still runs.
+func (s *Shim) Disconnect(dpnid uint32) error { return nil }
+
+// Suppressed reports how many SendTo calls were discarded.
+func (s *Shim) Suppressed() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.suppressed
+}
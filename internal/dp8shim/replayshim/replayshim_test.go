@@ -0,0 +1,55 @@
+package replayshim
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAttrs(t *testing.T) {
+	got := ParseAttrs("msg=RECEIVE msg_id=0xffff0011 attrs=map[Cx:0x0 Flags:32 Location:STAGING AREA=test game]")
+	want := map[string]string{"Cx": "0x0", "Flags": "32", "Location": "STAGING AREA=test game"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("%s=%q, want %q (all: %v)", k, got[k], v, got)
+		}
+	}
+	if got := ParseAttrs("msg=RECEIVE"); len(got) != 0 {
+		t.Fatalf("expected no attrs, got %v", got)
+	}
+}
+
+func TestReadNDJSON_RebuildsEvents(t *testing.T) {
+	capture := `{"type":"dp8","direction":"in","src":"dpnid=0x0013a1f2","exp":"event","message":"msg=CREATE_PLAYER msg_id=0xffff0007 flags=0x00000000 ts_unix_ms=1767323045010"}
+{"type":"dp8","direction":"out","dst":"dpnid=0x0013a1f2","tag":"ConnectRes","message":"err=<nil> payload=<ConnectRes/>"}
+
+{"type":"dp8","direction":"in","src":"dpnid=0x0013a1f2","tag":"SetLoc","exp":"event","message":"msg=RECEIVE msg_id=0xffff0011 flags=0x00000002 ts_unix_ms=1767323045400 attrs=map[Cx:0x0 Location:STAGING AREA=test game]"}
+`
+	evs, err := ReadNDJSON(strings.NewReader(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evs) != 2 {
+		t.Fatalf("events=%d, want 2", len(evs))
+	}
+	if e := evs[0].Event; e.MsgID != 0xffff0007 || e.DPNID != 0x0013a1f2 || e.TSUnixMS != 1767323045010 || len(evs[0].Payload) != 0 {
+		t.Fatalf("create player=%+v payload=%q", e, evs[0].Payload)
+	}
+	want := "<SetLoc Cx=\"0x0\" Location=\"STAGING AREA=test game\"/>\x00"
+	if e := evs[1]; string(e.Payload) != want || e.Event.Flags != 2 || e.Event.DataLen != uint32(len(want)) || e.Line != 4 {
+		t.Fatalf("receive=%+v payload=%q", e.Event, e.Payload)
+	}
+
+	s := New(evs)
+	buf := make([]byte, 8)
+	_, p, ok, _ := s.PopEvent(buf)
+	_, p, ok, _ = s.PopEvent(buf)
+	if !ok || len(p) != 8 {
+		t.Fatalf("expected truncated payload, got ok=%v len=%d", ok, len(p))
+	}
+	if _, _, ok, _ := s.PopEvent(buf); ok || s.QueueDepth() != 0 {
+		t.Fatalf("expected exhausted capture")
+	}
+}
@@ -0,0 +1,83 @@
+package news
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// FeedGame is one hosted game in the /games.atom feed.
+type FeedGame struct {
+	Rid     string
+	Name    string
+	Map     string
+	Players string
+	MaxP    string
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID      string `xml:"id"`
+	Title   string `xml:"title"`
+	Updated string `xml:"updated"`
+	Summary string `xml:"summary"`
+}
+
+// feedHandler serves the visible games as an Atom feed for community sites.
+// encoding/xml escapes every field, so host-chosen names can't break the XML.
+type feedHandler struct {
+	title string
+	games func() []FeedGame
+	now   func() time.Time
+	gzip  bool // compress when the client accepts it
+}
+
+func (h *feedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	updated := h.now().UTC().Format(time.RFC3339)
+	feed := atomFeed{
+		ID:      "urn:open-zone:games",
+		Title:   h.title,
+		Updated: updated,
+	}
+	for _, g := range h.games() {
+		name := g.Name
+		if name == "" {
+			name = "(unnamed game)"
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      "urn:open-zone:game:" + g.Rid,
+			Title:   name,
+			Updated: updated,
+			Summary: fmt.Sprintf("Map: %s, Players: %s/%s", orDash(g.Map), orDash(g.Players), orDash(g.MaxP)),
+		})
+	}
+
+	b, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		http.Error(w, "Feed Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	writeBody(w, r, append([]byte(xml.Header), b...), h.gzip)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,55 @@
+package news
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFeedHandler_WellFormedAtom(t *testing.T) {
+	h := &feedHandler{
+		title: "games",
+		now:   func() time.Time { return time.Unix(1700000000, 0) },
+		games: func() []FeedGame {
+			return []FeedGame{
+				{Rid: "1", Name: `Tom & Jerry's <best> "game"`, Map: "Alps", Players: "2", MaxP: "8"},
+				{Rid: "2", Map: "Desert"},
+			}
+		},
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/games.atom", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status=%d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/atom+xml") {
+		t.Fatalf("Content-Type=%q", ct)
+	}
+
+	var feed atomFeed
+	if err := xml.Unmarshal(rec.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("feed is not well-formed XML: %v\n%s", err, rec.Body.String())
+	}
+	if feed.XMLName.Space != "http://www.w3.org/2005/Atom" {
+		t.Fatalf("namespace=%q", feed.XMLName.Space)
+	}
+	if len(feed.Entries) != 2 {
+		t.Fatalf("entries=%d want 2", len(feed.Entries))
+	}
+	e := feed.Entries[0]
+	if e.Title != `Tom & Jerry's <best> "game"` || e.ID != "urn:open-zone:game:1" {
+		t.Fatalf("entry[0]=%+v", e)
+	}
+	if e.Summary != "Map: Alps, Players: 2/8" {
+		t.Fatalf("summary=%q", e.Summary)
+	}
+	if feed.Entries[1].Title != "(unnamed game)" || feed.Entries[1].Summary != "Map: Desert, Players: -/-" {
+		t.Fatalf("entry[1]=%+v", feed.Entries[1])
+	}
+	if strings.Contains(rec.Body.String(), "<best>") {
+		t.Fatalf("game name not escaped:\n%s", rec.Body.String())
+	}
+}
@@ -0,0 +1,56 @@
+package news
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// acceptsGzip reports whether the request's Accept-Encoding allows gzip
+// (listed, or "*", without q=0).
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "gzip" && name != "*" {
+			continue
+		}
+		for _, p := range strings.Split(params, ";") {
+			k, v, _ := strings.Cut(p, "=")
+			if strings.TrimSpace(k) != "q" {
+				continue
+			}
+			if q, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// writeBody writes body with its Content-Length, gzip-compressed when allowGzip
+// is set and the client asked for it. HEAD gets the same headers and no body.
+// Callers set Content-Type first.
+func writeBody(w http.ResponseWriter, r *http.Request, body []byte, allowGzip bool) {
+	if allowGzip {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if acceptsGzip(r) {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			_, _ = zw.Write(body)
+			if err := zw.Close(); err == nil {
+				w.Header().Set("Content-Encoding", "gzip")
+				body = buf.Bytes()
+			}
+		}
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if r.Method == http.MethodHead {
+		// Same headers as GET, no body.
+		return
+	}
+	_, _ = w.Write(body)
+}
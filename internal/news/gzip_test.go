@@ -0,0 +1,75 @@
+package news
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler_GzipOnlyWhenRequestedAndAllowed(t *testing.T) {
+	get := func(h http.Handler, path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	provider := func() Data { return Data{Version: "1.0"} }
+
+	// News page: plain unless news.allow_gzip_text is set.
+	plain := newTestHandler(t, Options{}, provider)
+	if rec := get(plain, "/", "gzip"); rec.Header().Get("Content-Encoding") != "" || !strings.Contains(rec.Body.String(), "1.0") {
+		t.Fatalf("text gzipped without allow_gzip_text: headers=%v", rec.Header())
+	}
+
+	allowed := newTestHandler(t, Options{AllowGzipText: true}, provider)
+	if rec := get(allowed, "/", ""); rec.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("gzipped without Accept-Encoding: headers=%v", rec.Header())
+	}
+	if rec := get(allowed, "/", "gzip;q=0, identity"); rec.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("gzipped with q=0: headers=%v", rec.Header())
+	}
+	rec := get(allowed, "/", "deflate, gzip")
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("not gzipped: headers=%v", rec.Header())
+	}
+	if got, want := rec.Header().Get("Content-Length"), strconv.Itoa(rec.Body.Len()); got != want {
+		t.Fatalf("Content-Length=%s want compressed size %s", got, want)
+	}
+	if body := gunzip(t, rec.Body); !strings.Contains(body, "1.0") {
+		t.Fatalf("gunzipped body=%q", body)
+	}
+
+	// The games feed always negotiates.
+	feed := &feedHandler{title: "t", games: func() []FeedGame { return nil }, now: time.Now, gzip: true}
+	if rec := get(feed, "/games.atom", ""); rec.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("feed gzipped without Accept-Encoding")
+	}
+	rec = get(feed, "/games.atom", "gzip")
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("feed not gzipped: headers=%v", rec.Header())
+	}
+	if body := gunzip(t, rec.Body); !strings.Contains(body, "<feed") {
+		t.Fatalf("gunzipped feed=%q", body)
+	}
+}
+
+func gunzip(t *testing.T, r io.Reader) string {
+	t.Helper()
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("gunzip: %v", err)
+	}
+	return string(b)
+}
@@ -0,0 +1,93 @@
+package news
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// realIP resolves the client IP for r. The direct peer is used unless it falls in
+// one of the trusted proxy prefixes, in which case header (e.g. X-Forwarded-For)
+// is walked right to left and the first address that is not itself a trusted proxy
+// wins. The header is never consulted for untrusted peers, so clients cannot spoof it.
+func realIP(r *http.Request, header string, trusted []netip.Prefix) string {
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+	addr, err := netip.ParseAddr(peer)
+	if err != nil || header == "" || !inPrefixes(addr, trusted) {
+		return peer
+	}
+
+	var hops []string
+	for _, v := range r.Header.Values(header) {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// A malformed hop means the chain can't be trusted past this point.
+			break
+		}
+		hop = hop.Unmap()
+		if !inPrefixes(hop, trusted) {
+			return hop.String()
+		}
+	}
+	return peer
+}
+
+// withRealIP puts the client IP from realIP into r.RemoteAddr before next runs,
+// so every News route (the page, /games.atom) and http.Server's own logging see
+// the client rather than the proxy. The access line is logged at debug.
+func withRealIP(next http.Handler, header string, trusted []netip.Prefix) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := realIP(r, header, trusted)
+		slog.Debug("news request", "remote_ip", ip, "method", r.Method, "path", r.URL.Path)
+		port := "0"
+		if _, p, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			port = p
+		}
+		r2 := r.Clone(r.Context())
+		r2.RemoteAddr = net.JoinHostPort(ip, port)
+		next.ServeHTTP(w, r2)
+	})
+}
+
+func inPrefixes(addr netip.Addr, prefixes []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxies parses CIDRs (or bare IPs, treated as single hosts).
+func ParseTrustedProxies(raw []string) ([]netip.Prefix, error) {
+	out := make([]netip.Prefix, 0, len(raw))
+	for _, s := range raw {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p.Masked())
+	}
+	return out, nil
+}
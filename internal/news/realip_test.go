@@ -0,0 +1,77 @@
+package news
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRealIP_TrustedVsUntrustedPeer(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		peer   string
+		xff    []string
+		header string
+		want   string
+	}{
+		{"untrusted peer ignores header", "203.0.113.9:5000", []string{"198.51.100.7"}, "X-Forwarded-For", "203.0.113.9"},
+		{"trusted peer uses header", "10.1.2.3:5000", []string{"198.51.100.7"}, "X-Forwarded-For", "198.51.100.7"},
+		{"bare IP entry is trusted", "192.0.2.1:5000", []string{"198.51.100.7"}, "X-Forwarded-For", "198.51.100.7"},
+		{"rightmost untrusted hop wins", "10.1.2.3:5000", []string{"6.6.6.6, 198.51.100.7, 10.9.9.9"}, "X-Forwarded-For", "198.51.100.7"},
+		{"multiple header lines", "10.1.2.3:5000", []string{"6.6.6.6", "198.51.100.7"}, "X-Forwarded-For", "198.51.100.7"},
+		{"malformed hop falls back to peer", "10.1.2.3:5000", []string{"198.51.100.7, junk"}, "X-Forwarded-For", "10.1.2.3"},
+		{"all hops trusted falls back to peer", "10.1.2.3:5000", []string{"10.4.4.4"}, "X-Forwarded-For", "10.1.2.3"},
+		{"no header configured", "10.1.2.3:5000", []string{"198.51.100.7"}, "", "10.1.2.3"},
+		{"missing header", "10.1.2.3:5000", nil, "X-Forwarded-For", "10.1.2.3"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tc.peer
+			for _, v := range tc.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := realIP(r, tc.header, trusted); got != tc.want {
+				t.Fatalf("realIP=%q want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies_RejectsGarbage(t *testing.T) {
+	if _, err := ParseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Fatalf("expected error for bad CIDR")
+	}
+	if _, err := ParseTrustedProxies([]string{"not-an-ip"}); err == nil {
+		t.Fatalf("expected error for bad IP")
+	}
+}
+
+func TestWithRealIP_RewritesRemoteAddr(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen string
+	h := withRealIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.RemoteAddr
+	}), "X-Forwarded-For", trusted)
+
+	for _, tc := range []struct{ peer, want string }{
+		{"10.1.2.3:5000", "198.51.100.7:5000"},
+		{"203.0.113.9:5000", "203.0.113.9:5000"},
+	} {
+		r := httptest.NewRequest("GET", "/games.atom", nil)
+		r.RemoteAddr = tc.peer
+		r.Header.Set("X-Forwarded-For", "198.51.100.7")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		if seen != tc.want {
+			t.Fatalf("peer %s: RemoteAddr=%q want %q", tc.peer, seen, tc.want)
+		}
+	}
+}
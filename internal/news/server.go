@@ -3,63 +3,131 @@ package news
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 )
 
+// Line endings for the News body (news.line_ending).
+const (
+	LineEndingCRLF = "crlf" // normalize every newline to CRLF (default)
+	LineEndingLF   = "lf"   // serve the template output unchanged
+)
+
 type Server struct {
 	srv *http.Server
+	ln  net.Listener
+}
+
+// Addr is the address the server listens on (the bound port when started on :0).
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Options controls optional News behavior. The zero value serves the embedded template.
+type Options struct {
+	// TemplatePath overrides the embedded template when set.
+	TemplatePath string
+
+	// LegacyFormat serves the embedded news_legacy.tmpl (a fixed-width header
+	// block some older client builds expect) instead of news.tmpl
+	// (news.legacy_format). TemplatePath still wins when set.
+	LegacyFormat bool
+
+	// CacheTTL memoizes the rendered body for this long. <= 0 renders every request.
+	CacheTTL time.Duration
+
+	// RealIPHeader (e.g. X-Forwarded-For) carries the client IP when the direct
+	// peer is one of TrustedProxies. With no trusted proxies the header is ignored.
+	RealIPHeader   string
+	TrustedProxies []netip.Prefix
+
+	// GamesFeed serves GET /games.atom from Games. Both must be set to enable it.
+	GamesFeed bool
+	Games     func() []FeedGame
+
+	// ShowActiveGames adds the recently-updated games count to the page
+	// (news.show_active_games); callers fill Data.GamesActive/ActiveWindow.
+	ShowActiveGames bool
+
+	// PopularMaps is how many of the most hosted maps to list (news.popular_maps);
+	// 0 hides the line. Callers fill Data.PopularMaps.
+	PopularMaps int
+
+	// LineEnding is LineEndingCRLF (or empty) or LineEndingLF.
+	LineEnding string
+
+	// AllowGzipText lets the game News page be gzip-compressed for clients that
+	// send Accept-Encoding: gzip (news.allow_gzip_text). Off by default since the
+	// game client may not handle it; /games.atom always negotiates.
+	AllowGzipText bool
+
+	// TimeFormat (a Go time layout) and TimeZone render Data.ServerTime
+	// (news.time_format, news.time_zone). Empty/nil mean RFC3339 and UTC.
+	TimeFormat string
+	TimeZone   *time.Location
+
+	// TLSCert and TLSKey (PEM files, news.tls_cert and news.tls_key) serve over
+	// HTTPS when both are set; Start fails if they do not load. The game client
+	// fetches News over plain HTTP, so this only suits pages read by browsers.
+	TLSCert string
+	TLSKey  string
 }
 
-func Start(ctx context.Context, addr string, provider func() Data) (*Server, error) {
+// FormatServerTime renders t for Data.ServerTime per TimeFormat and TimeZone.
+func (o Options) FormatServerTime(t time.Time) string {
+	loc := o.TimeZone
+	if loc == nil {
+		loc = time.UTC
+	}
+	layout := o.TimeFormat
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	return t.In(loc).Format(layout)
+}
+
+func Start(ctx context.Context, addr string, opts Options, provider func() Data) (*Server, error) {
 	if addr == "" {
 		return nil, fmt.Errorf("news addr is empty")
 	}
 
-	tmpl, err := loadTemplate()
+	tmpl, err := loadTemplate(opts.TemplatePath, opts.LegacyFormat)
 	if err != nil {
 		return nil, err
 	}
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != "/" {
-			http.NotFound(w, r)
-			return
-		}
-		if r.Method != http.MethodGet && r.Method != http.MethodHead {
-			w.Header().Set("Allow", "GET, HEAD")
-			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
-		var data Data
-		if provider != nil {
-			data = provider()
-		}
-
-		var buf bytes.Buffer
-		if err := tmpl.Execute(&buf, data); err != nil {
-			http.Error(w, "News Template Error", http.StatusInternalServerError)
-			return
-		}
-
-		// The client is happiest with CRLF. Normalize to avoid mixed newline styles.
-		body := ensureCRLF(buf.String())
-
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		_, _ = ioWriteString(w, body)
-	})
+	mux.Handle("/", newHandler(tmpl, opts, provider))
+	if opts.GamesFeed && opts.Games != nil {
+		mux.Handle("/games.atom", &feedHandler{title: "Open ZoneMatch games", games: opts.Games, now: time.Now, gzip: true})
+	}
 
 	s := &http.Server{
 		Addr:              addr,
-		Handler:           mux,
+		Handler:           withRealIP(mux, opts.RealIPHeader, opts.TrustedProxies),
 		ReadHeaderTimeout: 10 * time.Second,
 	}
+	useTLS := opts.TLSCert != "" && opts.TLSKey != ""
+	if useTLS {
+		cert, err := tls.LoadX509KeyPair(opts.TLSCert, opts.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("news tls: %w", err)
+		}
+		s.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
 
-	ns := &Server{srv: s}
+	ns := &Server{srv: s, ln: ln}
 	go func() {
 		<-ctx.Done()
 		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
@@ -67,10 +135,92 @@ func Start(ctx context.Context, addr string, provider func() Data) (*Server, err
 		_ = s.Shutdown(ctx)
 	}()
 
-	go func() { _ = s.ListenAndServe() }()
+	if useTLS {
+		go func() { _ = s.ServeTLS(ln, "", "") }()
+	} else {
+		go func() { _ = s.Serve(ln) }()
+	}
 	return ns, nil
 }
 
+// handler serves the game News body. Rendering is memoized for opts.CacheTTL so
+// aggressive pollers don't re-run the template (and the store locks behind provider).
+type handler struct {
+	tmpl     *template.Template
+	provider func() Data
+	ttl      time.Duration
+	now      func() time.Time
+	rawLF    bool
+	gzip     bool
+
+	mu         sync.Mutex
+	body       string
+	renderedAt time.Time
+}
+
+func newHandler(tmpl *template.Template, opts Options, provider func() Data) *handler {
+	return &handler{
+		tmpl:     tmpl,
+		provider: provider,
+		ttl:      opts.CacheTTL,
+		now:      time.Now,
+		rawLF:    opts.LineEnding == LineEndingLF,
+		gzip:     opts.AllowGzipText,
+	}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := h.render()
+	if err != nil {
+		http.Error(w, "News Template Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writeBody(w, r, []byte(body), h.gzip)
+}
+
+// render returns the cached body while it is fresh, otherwise re-renders it.
+// The lock is held across rendering so concurrent misses call provider once.
+func (h *handler) render() (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.now()
+	if h.ttl > 0 && !h.renderedAt.IsZero() && now.Sub(h.renderedAt) < h.ttl {
+		return h.body, nil
+	}
+
+	var data Data
+	if h.provider != nil {
+		data = h.provider()
+	}
+
+	var buf bytes.Buffer
+	if err := h.tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	// The client is happiest with CRLF. Normalize to avoid mixed newline styles,
+	// unless LF output was asked for (test harnesses diffing the raw template).
+	h.body = buf.String()
+	if !h.rawLF {
+		h.body = ensureCRLF(h.body)
+	}
+	h.renderedAt = now
+	return h.body, nil
+}
+
 func ensureCRLF(s string) string {
 	// Convert lone LF into CRLF; keep existing CRLF as-is.
 	if !strings.Contains(s, "\n") {
@@ -81,8 +231,3 @@ func ensureCRLF(s string) string {
 	s = strings.ReplaceAll(s, "\n", "\r\n")
 	return s
 }
-
-func ioWriteString(w http.ResponseWriter, s string) (int, error) {
-	// Small helper to keep server.go free from an extra io import.
-	return w.Write([]byte(s))
-}
@@ -0,0 +1,127 @@
+package news
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestHandler(t *testing.T, opts Options, provider func() Data) *handler {
+	t.Helper()
+	tmpl, err := loadTemplate(opts.TemplatePath, opts.LegacyFormat)
+	if err != nil {
+		t.Fatalf("loadTemplate: %v", err)
+	}
+	return newHandler(tmpl, opts, provider)
+}
+
+func TestHandler_CacheCallsProviderOncePerTTL(t *testing.T) {
+	var calls atomic.Int32
+	h := newTestHandler(t, Options{CacheTTL: 5 * time.Second}, func() Data {
+		n := calls.Add(1)
+		return Data{Version: "1.0", PlayersOnline: int(n)}
+	})
+	now := time.Unix(1700000000, 0)
+	h.now = func() time.Time { return now }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(method string) {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(method, "/", nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("%s status=%d", method, rec.Code)
+			}
+		}([]string{http.MethodGet, http.MethodHead}[i%2])
+	}
+	wg.Wait()
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("provider calls within TTL=%d want 1", got)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !strings.Contains(rec.Body.String(), "Players online: 1") {
+		t.Fatalf("cached body=%q", rec.Body.String())
+	}
+
+	now = now.Add(5 * time.Second)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("provider calls after TTL=%d want 2", got)
+	}
+	if !strings.Contains(rec.Body.String(), "Players online: 2") {
+		t.Fatalf("refreshed body=%q", rec.Body.String())
+	}
+}
+
+func TestHandler_NoCacheRendersEveryRequest(t *testing.T) {
+	var calls atomic.Int32
+	h := newTestHandler(t, Options{}, func() Data {
+		calls.Add(1)
+		return Data{Version: "1.0"}
+	})
+	for i := 0; i < 3; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	if got := calls.Load(); got != 3 {
+		t.Fatalf("provider calls=%d want 3", got)
+	}
+}
+
+func TestHandler_LineEnding(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lines.tmpl")
+	if err := os.WriteFile(path, []byte("a {{ .Version }}\nb\r\nc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		mode string
+		want string
+	}{
+		{"", "a 1.0\r\nb\r\nc\r\n"},
+		{LineEndingCRLF, "a 1.0\r\nb\r\nc\r\n"},
+		{LineEndingLF, "a 1.0\nb\r\nc\n"},
+	} {
+		h := newTestHandler(t, Options{TemplatePath: path, LineEnding: tc.mode}, func() Data {
+			return Data{Version: "1.0"}
+		})
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if got := rec.Body.String(); got != tc.want {
+			t.Errorf("line_ending=%q body=%q want %q", tc.mode, got, tc.want)
+		}
+	}
+}
+
+func TestHandler_HeadSendsContentLengthWithoutBody(t *testing.T) {
+	h := newTestHandler(t, Options{}, func() Data { return Data{Version: "1.0"} })
+
+	get := httptest.NewRecorder()
+	h.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/", nil))
+	want := strconv.Itoa(get.Body.Len())
+	if get.Body.Len() == 0 || get.Header().Get("Content-Length") != want {
+		t.Fatalf("GET Content-Length=%q body len=%d", get.Header().Get("Content-Length"), get.Body.Len())
+	}
+
+	head := httptest.NewRecorder()
+	h.ServeHTTP(head, httptest.NewRequest(http.MethodHead, "/", nil))
+	if head.Code != http.StatusOK {
+		t.Fatalf("HEAD status=%d", head.Code)
+	}
+	if got := head.Header().Get("Content-Length"); got != want {
+		t.Fatalf("HEAD Content-Length=%q want %q", got, want)
+	}
+	if head.Body.Len() != 0 {
+		t.Fatalf("HEAD body=%q want empty", head.Body.String())
+	}
+}
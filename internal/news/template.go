@@ -3,20 +3,41 @@ package news
 import (
 	"embed"
 	"fmt"
+	"os"
+	"strings"
 	"text/template"
 )
 
-//go:embed templates/news.tmpl
+//go:embed templates/news.tmpl templates/news_legacy.tmpl
 var newsTemplatesFS embed.FS
 
-func loadTemplate() (*template.Template, error) {
-	b, err := newsTemplatesFS.ReadFile("templates/news.tmpl")
+// loadTemplate parses the News template from path when set, otherwise from the
+// embedded default (news_legacy.tmpl when legacy is set). Parse errors are
+// returned so startup can fail fast.
+func loadTemplate(path string, legacy bool) (*template.Template, error) {
+	if strings.TrimSpace(path) != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read news template %s: %w", path, err)
+		}
+		t, err := template.New("news.tmpl").Option("missingkey=zero").Parse(string(b))
+		if err != nil {
+			return nil, fmt.Errorf("parse news template %s: %w", path, err)
+		}
+		return t, nil
+	}
+
+	name := "news.tmpl"
+	if legacy {
+		name = "news_legacy.tmpl"
+	}
+	b, err := newsTemplatesFS.ReadFile("templates/" + name)
 	if err != nil {
-		return nil, fmt.Errorf("read embedded news template: %w", err)
+		return nil, fmt.Errorf("read embedded news template %s: %w", name, err)
 	}
-	t, err := template.New("news.tmpl").Option("missingkey=zero").Parse(string(b))
+	t, err := template.New(name).Option("missingkey=zero").Parse(string(b))
 	if err != nil {
-		return nil, fmt.Errorf("parse embedded news template: %w", err)
+		return nil, fmt.Errorf("parse embedded news template %s: %w", name, err)
 	}
 	return t, nil
 }
@@ -0,0 +1,169 @@
+package news
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadTemplate_EmbeddedDefault(t *testing.T) {
+	tmpl, err := loadTemplate("", false)
+	if err != nil {
+		t.Fatalf("loadTemplate: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, Data{Version: "1.2.3", PlayersOnline: 4}); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Players online: 4") || !strings.Contains(buf.String(), "Version: 1.2.3") {
+		t.Fatalf("body=%q", buf.String())
+	}
+}
+
+func TestLoadTemplate_ActiveGamesLineIsOptional(t *testing.T) {
+	tmpl, err := loadTemplate("", false)
+	if err != nil {
+		t.Fatalf("loadTemplate: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, Data{GamesHosted: 3, GamesActive: 1}); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if strings.Contains(buf.String(), "Active in last") {
+		t.Fatalf("active line shown without ActiveWindow: %q", buf.String())
+	}
+	buf.Reset()
+	if err := tmpl.Execute(&buf, Data{GamesHosted: 3, GamesActive: 1, ActiveWindow: "10m"}); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Games hosted: 3\nActive in last 10m: 1\n") {
+		t.Fatalf("body=%q", buf.String())
+	}
+}
+
+func TestLoadTemplate_PopularMapsLine(t *testing.T) {
+	tmpl, err := loadTemplate("", false)
+	if err != nil {
+		t.Fatalf("loadTemplate: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, Data{PopularMaps: []string{"DesertCombat (3)", "Urban (1)"}}); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if !strings.Contains(buf.String(), "\nPopular: DesertCombat (3), Urban (1)\n") {
+		t.Fatalf("body=%q", buf.String())
+	}
+	buf.Reset()
+	if err := tmpl.Execute(&buf, Data{}); err != nil {
+		t.Fatalf("execute empty: %v", err)
+	}
+	if strings.Contains(buf.String(), "Popular:") {
+		t.Fatalf("empty list rendered a Popular line: %q", buf.String())
+	}
+}
+
+func TestLoadTemplate_ServerFullLine(t *testing.T) {
+	tmpl, err := loadTemplate("", false)
+	if err != nil {
+		t.Fatalf("loadTemplate: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, Data{PlayersOnline: 8, Full: true}); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Players online: 8\nSERVER FULL\n") {
+		t.Fatalf("body=%q", buf.String())
+	}
+	buf.Reset()
+	if err := tmpl.Execute(&buf, Data{PlayersOnline: 7}); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if strings.Contains(buf.String(), "SERVER FULL") {
+		t.Fatalf("full line shown below capacity: %q", buf.String())
+	}
+}
+
+func TestLoadTemplate_CustomFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "custom.tmpl")
+	if err := os.WriteFile(path, []byte("CUSTOM {{ .Version }} games={{ .GamesHosted }}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := loadTemplate(path, false)
+	if err != nil {
+		t.Fatalf("loadTemplate: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, Data{Version: "9.9", GamesHosted: 2}); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if got := buf.String(); got != "CUSTOM 9.9 games=2" {
+		t.Fatalf("body=%q", got)
+	}
+}
+
+func TestLoadTemplate_ParseError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.tmpl")
+	if err := os.WriteFile(path, []byte("{{ .Version "), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadTemplate(path, false); err == nil {
+		t.Fatalf("expected parse error")
+	}
+}
+
+func TestLoadTemplate_LegacyFormat(t *testing.T) {
+	d := Data{Tagline: "Zone", Version: "1.2.3", ServerTime: "2026-01-02 03:04:05", PlayersOnline: 12, GamesHosted: 3, Full: true}
+	render := func(legacy bool) string {
+		t.Helper()
+		tmpl, err := loadTemplate("", legacy)
+		if err != nil {
+			t.Fatalf("loadTemplate(legacy=%v): %v", legacy, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, d); err != nil {
+			t.Fatalf("execute(legacy=%v): %v", legacy, err)
+		}
+		return buf.String()
+	}
+
+	want := "==========================================\n" +
+		"SERVER          : Zone\n" +
+		"PLAYERS ONLINE  :    12 FULL\n" +
+		"GAMES HOSTED    :     3\n" +
+		"VERSION         : 1.2.3\n" +
+		"SERVER TIME     : 2026-01-02 03:04:05\n" +
+		"==========================================\n"
+	if got := render(true); got != want {
+		t.Fatalf("legacy body=%q\nwant %q", got, want)
+	}
+	if got := render(false); strings.Contains(got, "=====") || !strings.Contains(got, "Players online: 12\nSERVER FULL\n") {
+		t.Fatalf("default body=%q", got)
+	}
+}
+
+func TestFormatServerTime_ConfiguredZoneAndFormat(t *testing.T) {
+	instant := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if got := (Options{}).FormatServerTime(instant); got != "2026-01-02T03:04:05Z" {
+		t.Fatalf("default=%q", got)
+	}
+
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+	opts := Options{TimeFormat: "Mon 02 Jan 15:04 MST", TimeZone: loc}
+	tmpl, err := loadTemplate("", false)
+	if err != nil {
+		t.Fatalf("loadTemplate: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, Data{ServerTime: opts.FormatServerTime(instant)}); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Server time on last cache: Thu 01 Jan 22:04 EST") {
+		t.Fatalf("body=%q", buf.String())
+	}
+}
@@ -11,6 +11,17 @@ type Data struct {
 	PlayersOnline int
 	GamesHosted   int
 
+	// Full is set when PlayersOnline has reached server.max_players.
+	Full bool
+
+	// GamesActive counts games updated within ActiveWindow (e.g. "10m"). The
+	// embedded template shows it only when ActiveWindow is set.
+	GamesActive  int
+	ActiveWindow string
+
+	// PopularMaps are "Map (count)" entries, most hosted first; empty hides the line.
+	PopularMaps []string
+
 	// Optional extra lines appended after the status block.
 	Message string
 }
@@ -0,0 +1,39 @@
+package packetlog
+
+import "sync"
+
+// MemorySink keeps every record in memory, for tests that assert what was
+// logged. It is safe for concurrent use; the zero value is ready.
+type MemorySink struct {
+	mu   sync.Mutex
+	recs []Record
+}
+
+var _ Sink = (*MemorySink)(nil)
+
+func (m *MemorySink) Log(rec Record) {
+	m.mu.Lock()
+	m.recs = append(m.recs, rec)
+	m.mu.Unlock()
+}
+
+// Close is a no-op; records stay readable afterwards.
+func (m *MemorySink) Close() error { return nil }
+
+// Records returns a copy of the records logged so far, in order.
+func (m *MemorySink) Records() []Record {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Record(nil), m.recs...)
+}
+
+// Filter returns the records for which keep reports true, in order.
+func (m *MemorySink) Filter(keep func(Record) bool) []Record {
+	var out []Record
+	for _, r := range m.Records() {
+		if keep(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
@@ -2,12 +2,23 @@ package packetlog
 
 import (
 	"bufio"
+	"compress/gzip"
 	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"regexp"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Record struct {
+	// SchemaVer is the record layout version; the Logger stamps SchemaVersion on
+	// every line it writes. Lines from before versioning decode as 0.
+	SchemaVer   int    `json:"schema_ver"`
 	RunID       string `json:"run_id"`
 	Timestamp   string `json:"ts"`
 	Type        string `json:"type"`
@@ -21,49 +32,320 @@ type Record struct {
 	Message     string `json:"message,omitempty"`
 }
 
+// SchemaVersion is the current Record layout. Bump it when a field changes
+// meaning or is removed; adding an optional field does not need a bump.
+const SchemaVersion = 1
+
+// DecodeRecord parses one NDJSON line. Unknown fields are ignored so older
+// readers keep working on newer files, and a missing schema_ver reads as 0 (the
+// unversioned layout, which v1 only extends).
+func DecodeRecord(line []byte) (Record, error) {
+	var rec Record
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return Record{}, err
+	}
+	if rec.SchemaVer < 0 {
+		return Record{}, fmt.Errorf("invalid schema_ver %d", rec.SchemaVer)
+	}
+	return rec, nil
+}
+
+// Redactor mutates a record before it is marshaled, e.g. to strip or hash IPs or
+// message bodies centrally instead of at every call site.
+type Redactor func(*Record)
+
+var ipv4Pattern = regexp.MustCompile(`\b(\d{1,3}\.\d{1,3}\.\d{1,3}\.)\d{1,3}\b`)
+
+// MaskIPv4LastOctet replaces the last octet of every IPv4 literal in Source and
+// Destination with "x" (203.0.113.7 -> 203.0.113.x).
+func MaskIPv4LastOctet(rec *Record) {
+	rec.Source = ipv4Pattern.ReplaceAllString(rec.Source, "${1}x")
+	rec.Destination = ipv4Pattern.ReplaceAllString(rec.Destination, "${1}x")
+}
+
+// Options controls optional Logger behavior. The zero value appends to a single file forever.
+type Options struct {
+	// MaxBytes rotates the file once it reaches this size on disk (compressed,
+	// with Gzip). Lines are counted as they reach the file, so a file can run
+	// over by up to one write buffer (256 KiB). <= 0 disables rotation.
+	MaxBytes int64
+
+	// MaxBackups is how many rotated files (path.1 .. path.N) are kept. Values < 1 keep one.
+	MaxBackups int
+
+	// Async moves marshaling and disk writes to a background goroutine so Log never
+	// waits on the file. Records are dropped (and counted) when the queue is full.
+	Async bool
+
+	// QueueSize bounds the async queue. Defaults to 4096.
+	QueueSize int
+
+	// FlushInterval is how often buffered lines are flushed: by the async writer,
+	// and with Gzip in sync mode too, where flushing every line would end a
+	// deflate block per record. Defaults to 250ms.
+	FlushInterval time.Duration
+
+	// Redactor, when set, runs on every record before it is written.
+	Redactor Redactor
+
+	// Gzip compresses the stream. It is implied when the path ends in ".gz".
+	Gzip bool
+
+	// Private creates the file readable by the owner only, for logs that hold
+	// client data (telemetry.raw_payload_path).
+	Private bool
+}
+
 type Logger struct {
-	mu sync.Mutex
-	f  *os.File
-	w  *bufio.Writer
+	mu   sync.Mutex
+	path string
+	opts Options
+	f    *os.File
+	gz   *gzip.Writer // nil unless Options.Gzip
+	w    *bufio.Writer
+	size int64 // bytes in the file, counted as they are written to it
+
+	// flushTimer is pending while a sync-mode gzip Log has lines not yet flushed.
+	flushTimer *time.Timer
+
+	// Async mode only. qmu guards closing q against concurrent Log calls.
+	qmu     sync.RWMutex
+	q       chan Record
+	closed  bool
+	done    chan struct{}
+	dropped atomic.Uint64
 }
 
-func New(path string) (*Logger, error) {
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
-	if err != nil {
+func New(path string, opts Options) (*Logger, error) {
+	if opts.MaxBackups < 1 {
+		opts.MaxBackups = 1
+	}
+	if strings.HasSuffix(strings.ToLower(path), ".gz") {
+		opts.Gzip = true
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 250 * time.Millisecond
+	}
+	l := &Logger{path: path, opts: opts}
+	if err := l.openLocked(); err != nil {
 		return nil, err
 	}
-	return &Logger{
-		f: f,
-		w: bufio.NewWriterSize(f, 256*1024),
-	}, nil
+	if opts.Async {
+		if opts.QueueSize <= 0 {
+			opts.QueueSize = 4096
+		}
+		l.opts = opts
+		l.q = make(chan Record, opts.QueueSize)
+		l.done = make(chan struct{})
+		go l.writer()
+	}
+	return l, nil
 }
 
+func (l *Logger) openLocked() error {
+	perm := os.FileMode(0o644)
+	if l.opts.Private {
+		perm = 0o600
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, perm)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	l.f = f
+	l.size = st.Size()
+	var dst io.Writer = &sizeWriter{w: f, n: &l.size}
+	if l.opts.Gzip {
+		// Appending starts a new gzip member; readers treat concatenated members as one stream.
+		l.gz = gzip.NewWriter(dst)
+		dst = l.gz
+	}
+	l.w = bufio.NewWriterSize(dst, 256*1024)
+	return nil
+}
+
+// sizeWriter counts the bytes that reach the file, so MaxBytes measures what
+// is on disk whether or not the stream is compressed.
+type sizeWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (s *sizeWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	*s.n += int64(n)
+	return n, err
+}
+
+// flushLocked pushes buffered lines through the gzip layer (if any) to the file.
+func (l *Logger) flushLocked() {
+	if l.w == nil {
+		return
+	}
+	_ = l.w.Flush()
+	if l.gz != nil {
+		_ = l.gz.Flush()
+	}
+}
+
+// timedFlush is the flushTimer callback.
+func (l *Logger) timedFlush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.flushTimer = nil
+	l.flushLocked()
+	l.rotateIfFullLocked()
+}
+
+// closeFileLocked flushes and closes the gzip layer before the file.
+func (l *Logger) closeFileLocked() error {
+	if l.f == nil {
+		return nil
+	}
+	_ = l.w.Flush()
+	var gzErr error
+	if l.gz != nil {
+		gzErr = l.gz.Close()
+	}
+	err := l.f.Close()
+	l.f, l.gz, l.w = nil, nil, nil
+	if err == nil {
+		err = gzErr
+	}
+	return err
+}
+
+// Close drains any queued records (async mode), flushes, and closes the file.
 func (l *Logger) Close() error {
+	if l.q != nil {
+		l.qmu.Lock()
+		if !l.closed {
+			l.closed = true
+			close(l.q)
+		}
+		l.qmu.Unlock()
+		<-l.done
+	}
+
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	if l.w != nil {
-		_ = l.w.Flush()
+	if l.flushTimer != nil {
+		l.flushTimer.Stop()
+		l.flushTimer = nil
 	}
-	if l.f != nil {
-		return l.f.Close()
+	return l.closeFileLocked()
+}
+
+// Dropped returns how many records were discarded because the async queue was full.
+func (l *Logger) Dropped() uint64 {
+	if l == nil {
+		return 0
 	}
-	return nil
+	return l.dropped.Load()
 }
 
 func (l *Logger) Log(rec Record) {
 	if l == nil {
 		return
 	}
+	if l.q != nil {
+		l.qmu.RLock()
+		defer l.qmu.RUnlock()
+		if l.closed {
+			return
+		}
+		select {
+		case l.q <- rec:
+		default:
+			l.dropped.Add(1)
+		}
+		return
+	}
+
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	l.writeLocked(rec)
+	if l.gz == nil {
+		l.flushLocked()
+		l.rotateIfFullLocked()
+		return
+	}
+	// Flushing gzip ends a deflate block; batch records for one FlushInterval.
+	if l.flushTimer == nil {
+		l.flushTimer = time.AfterFunc(l.opts.FlushInterval, l.timedFlush)
+	}
+}
 
+// writer batches queued records into the buffered file and flushes on a timer
+// (or when bufio fills). It exits after Close has closed the queue and it is drained.
+func (l *Logger) writer() {
+	defer close(l.done)
+	t := time.NewTicker(l.opts.FlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case rec, ok := <-l.q:
+			if !ok {
+				return
+			}
+			l.mu.Lock()
+			l.writeLocked(rec)
+			l.mu.Unlock()
+		case <-t.C:
+			l.mu.Lock()
+			l.flushLocked()
+			l.rotateIfFullLocked()
+			l.mu.Unlock()
+		}
+	}
+}
+
+func (l *Logger) writeLocked(rec Record) {
 	if l.w == nil {
 		return
 	}
+	if l.opts.Redactor != nil {
+		l.opts.Redactor(&rec)
+	}
+	rec.SchemaVer = SchemaVersion
 	line, err := json.Marshal(rec)
 	if err != nil {
 		return
 	}
 	_, _ = l.w.Write(append(line, '\n'))
-	_ = l.w.Flush()
+	l.rotateIfFullLocked()
+}
+
+// rotateIfFullLocked rotates once the file has reached MaxBytes.
+func (l *Logger) rotateIfFullLocked() {
+	if l.w == nil || l.opts.MaxBytes <= 0 || l.size < l.opts.MaxBytes {
+		return
+	}
+	if err := l.rotateLocked(); err != nil {
+		// Keep appending to whatever we have open; telemetry is best-effort.
+		slog.Warn("ndjson telemetry rotate failed", "path", l.path, "err", err)
+	}
+}
+
+// rotateLocked shifts path.N-1 -> path.N ... path -> path.1 and reopens path.
+// Buffered lines are flushed into the old file first, so nothing is lost.
+func (l *Logger) rotateLocked() error {
+	if err := l.closeFileLocked(); err != nil {
+		return err
+	}
+
+	_ = os.Remove(fmt.Sprintf("%s.%d", l.path, l.opts.MaxBackups))
+	for i := l.opts.MaxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	renameErr := os.Rename(l.path, l.path+".1")
+
+	if err := l.openLocked(); err != nil {
+		return err
+	}
+	return renameErr
 }
@@ -0,0 +1,273 @@
+package packetlog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogger_RotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dp8.ndjson")
+	l, err := New(path, Options{MaxBytes: 512, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for i := 0; i < 40; i++ {
+		l.Log(Record{RunID: "run-test", Type: "dp8", Message: fmt.Sprintf("record %02d", i)})
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		if _, err := os.Stat(p); err != nil {
+			t.Fatalf("expected %s: %v", p, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected only 2 backups, stat .3 err=%v", err)
+	}
+
+	// Every file must hold whole JSON lines; the last record lands in the live file.
+	var last Record
+	for _, p := range []string{path + ".1", path} {
+		f, err := os.Open(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			if err := json.Unmarshal(sc.Bytes(), &last); err != nil {
+				t.Fatalf("%s: bad line %q: %v", p, sc.Text(), err)
+			}
+		}
+		_ = f.Close()
+	}
+	if last.Message != "record 39" {
+		t.Fatalf("last message=%q", last.Message)
+	}
+}
+
+func TestLogger_AsyncDrainsOnClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dp8.ndjson")
+	l, err := New(path, Options{Async: true, QueueSize: 1024, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		l.Log(Record{RunID: "run-test", Type: "dp8", Message: fmt.Sprintf("record %02d", i)})
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	l.Log(Record{Type: "after-close"}) // must not panic
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(b), "\n"); got != 100 {
+		t.Fatalf("lines=%d want 100 (dropped=%d)", got, l.Dropped())
+	}
+}
+
+func TestLogger_AsyncDropsWhenQueueFull(t *testing.T) {
+	l := &Logger{q: make(chan Record, 1), done: make(chan struct{})}
+	l.Log(Record{})
+	l.Log(Record{})
+	l.Log(Record{})
+	if got := l.Dropped(); got != 2 {
+		t.Fatalf("dropped=%d want 2", got)
+	}
+}
+
+// The sync path flushes to the file on every record; the async path only enqueues.
+// Compare: go test -bench Logger -benchmem ./internal/packetlog
+func BenchmarkLogger_Sync(b *testing.B) {
+	benchmarkLogger(b, Options{})
+}
+
+func BenchmarkLogger_Async(b *testing.B) {
+	benchmarkLogger(b, Options{Async: true, QueueSize: 1 << 16})
+}
+
+func benchmarkLogger(b *testing.B, opts Options) {
+	l, err := New(filepath.Join(b.TempDir(), "bench.ndjson"), opts)
+	if err != nil {
+		b.Fatal(err)
+	}
+	rec := Record{
+		RunID:       "run-bench",
+		Type:        "dp8",
+		Direction:   "out",
+		Destination: "dpnid=0x00000001",
+		Tag:         "PageRes",
+		Message:     `err=<nil> payload=<PageRes HR="0x00000000" Cx="0x0" Vid="101" Count="0" />`,
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Log(rec)
+	}
+	b.StopTimer()
+	_ = l.Close()
+}
+
+func TestLogger_RedactorRunsBeforeWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dp8.ndjson")
+	l, err := New(path, Options{Redactor: func(rec *Record) {
+		MaskIPv4LastOctet(rec)
+		rec.Message = "[redacted]"
+	}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	l.Log(Record{
+		Type:        "dp8",
+		Source:      "ip=203.0.113.77 port=2302",
+		Destination: "198.51.100.254",
+		Message:     `attrs=map[GName:secret]`,
+	})
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Record
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("unmarshal %q: %v", b, err)
+	}
+	if got.Source != "ip=203.0.113.x port=2302" || got.Destination != "198.51.100.x" {
+		t.Fatalf("src=%q dst=%q", got.Source, got.Destination)
+	}
+	if got.Message != "[redacted]" || strings.Contains(string(b), "secret") {
+		t.Fatalf("message not redacted: %s", b)
+	}
+}
+
+func TestLogger_GzipRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		file string
+		opts Options
+	}{
+		{"suffix", "dp8.ndjson.gz", Options{}},
+		{"flag", "dp8.ndjson", Options{Gzip: true}},
+		{"flag async", "dp8.ndjson", Options{Gzip: true, Async: true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.file)
+			l, err := New(path, tc.opts)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			for i := 0; i < 3; i++ {
+				l.Log(Record{RunID: "run-test", Type: "dp8", Message: fmt.Sprintf("record %d", i)})
+			}
+			if err := l.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			zr, err := gzip.NewReader(f)
+			if err != nil {
+				t.Fatalf("gzip reader: %v", err)
+			}
+			sc := bufio.NewScanner(zr)
+			n := 0
+			for sc.Scan() {
+				var rec Record
+				if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+					t.Fatalf("line %d %q: %v", n, sc.Text(), err)
+				}
+				if want := fmt.Sprintf("record %d", n); rec.Message != want {
+					t.Fatalf("line %d message=%q want %q", n, rec.Message, want)
+				}
+				n++
+			}
+			if err := sc.Err(); err != nil {
+				t.Fatalf("scan: %v", err)
+			}
+			if n != 3 {
+				t.Fatalf("lines=%d want 3", n)
+			}
+		})
+	}
+}
+
+func TestLogger_GzipRotatesByCompressedSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dp8.ndjson.gz")
+	l, err := New(path, Options{MaxBytes: 4096, MaxBackups: 1, Async: true, QueueSize: 8192})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for i := 0; i < 5000; i++ {
+		l.Log(Record{RunID: "run-test", Type: "dp8", Message: fmt.Sprintf("record %04d", i)})
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// Counting uncompressed bytes would rotate at a fraction of MaxBytes on disk.
+	st, err := os.Stat(path + ".1")
+	if err != nil {
+		t.Fatalf("expected a rotated file: %v", err)
+	}
+	if st.Size() < 4096 {
+		t.Fatalf("rotated at %d bytes on disk, want >= 4096", st.Size())
+	}
+}
+
+func TestDecodeRecord_V0AndCurrent(t *testing.T) {
+	// v0: written before schema_ver existed.
+	v0 := `{"run_id":"r0","ts":"2024-01-02T03:04:05Z","type":"dp8","direction":"in","tag":"Page"}`
+	rec, err := DecodeRecord([]byte(v0))
+	if err != nil {
+		t.Fatalf("v0: %v", err)
+	}
+	if rec.SchemaVer != 0 || rec.RunID != "r0" || rec.Tag != "Page" {
+		t.Fatalf("v0 rec=%+v", rec)
+	}
+
+	// Current: written by the Logger, plus a field this reader does not know.
+	path := filepath.Join(t.TempDir(), "dp8.ndjson")
+	l, err := New(path, Options{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	l.Log(Record{RunID: "r1", Type: "dp8", Direction: "out", Tag: "PageRes"})
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := strings.TrimSpace(string(b))
+	if !strings.Contains(line, fmt.Sprintf(`"schema_ver":%d`, SchemaVersion)) {
+		t.Fatalf("line missing schema_ver: %s", line)
+	}
+	line = strings.TrimSuffix(line, "}") + `,"future_field":{"x":1}}`
+	rec, err = DecodeRecord([]byte(line))
+	if err != nil {
+		t.Fatalf("current: %v", err)
+	}
+	if rec.SchemaVer != SchemaVersion || rec.RunID != "r1" || rec.Tag != "PageRes" {
+		t.Fatalf("current rec=%+v", rec)
+	}
+
+	if _, err := DecodeRecord([]byte(`not json`)); err == nil {
+		t.Fatalf("garbage decoded without error")
+	}
+}
@@ -0,0 +1,38 @@
+package packetlog
+
+import "errors"
+
+// Sink is a telemetry destination. *Logger (the NDJSON file writer) is one;
+// callers should depend on Sink so destinations can be added without touching
+// every call site.
+type Sink interface {
+	Log(rec Record)
+	Close() error
+}
+
+var _ Sink = (*Logger)(nil)
+
+// MultiSink fans each record out to every sink, in order. Nil entries are skipped.
+type MultiSink []Sink
+
+func (m MultiSink) Log(rec Record) {
+	for _, s := range m {
+		if s != nil {
+			s.Log(rec)
+		}
+	}
+}
+
+// Close closes every sink and returns the joined errors.
+func (m MultiSink) Close() error {
+	var errs []error
+	for _, s := range m {
+		if s == nil {
+			continue
+		}
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
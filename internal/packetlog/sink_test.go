@@ -0,0 +1,68 @@
+package packetlog
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+type memSink struct {
+	recs   []Record
+	closed bool
+	err    error
+}
+
+func (m *memSink) Log(rec Record) { m.recs = append(m.recs, rec) }
+
+func (m *memSink) Close() error {
+	m.closed = true
+	return m.err
+}
+
+func TestMultiSink_FansOut(t *testing.T) {
+	a, b := &memSink{}, &memSink{err: errors.New("b failed")}
+	var s Sink = MultiSink{a, nil, b}
+
+	rec := Record{RunID: "run-test", Type: "dp8", Tag: "Connect"}
+	s.Log(rec)
+	for i, m := range []*memSink{a, b} {
+		if len(m.recs) != 1 || m.recs[0] != rec {
+			t.Fatalf("sink %d recs=%+v", i, m.recs)
+		}
+	}
+
+	err := s.Close()
+	if !a.closed || !b.closed {
+		t.Fatalf("closed a=%v b=%v", a.closed, b.closed)
+	}
+	if err == nil || err.Error() != "b failed" {
+		t.Fatalf("Close err=%v", err)
+	}
+}
+
+func TestMemorySink_ConcurrentLog(t *testing.T) {
+	var m MemorySink
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				m.Log(Record{Type: "dp8", Tag: "Connect"})
+			}
+		}()
+	}
+	m.Log(Record{Type: "startup"})
+	wg.Wait()
+
+	if n := len(m.Records()); n != 401 {
+		t.Fatalf("records=%d want 401", n)
+	}
+	got := m.Filter(func(r Record) bool { return r.Type == "startup" })
+	if len(got) != 1 {
+		t.Fatalf("startup records=%d", len(got))
+	}
+	if err := m.Close(); err != nil || len(m.Records()) != 401 {
+		t.Fatalf("Close err=%v records=%d", err, len(m.Records()))
+	}
+}
@@ -0,0 +1,74 @@
+package proto
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// KV is one outbound attribute. It has the same shape as a parsed Attr so replies
+// can echo Msg.Order directly.
+type KV = Attr
+
+var (
+	// ErrInvalidTag and ErrInvalidAttrName are returned by EncodeElement. The
+	// offending name is left out: it is often client-derived and ends up in logs.
+	ErrInvalidTag      = errors.New("proto: invalid tag name")
+	ErrInvalidAttrName = errors.New("proto: invalid attribute name")
+)
+
+// EncodeElement builds `<tag k="v" ... />`, or `<tag k="v" ...>children</tag>` when
+// children is non-empty, in attrs order. Every value is escaped; tag and keys must
+// be names (a letter or '_', then letters, digits, '_', '-' or '.'). children is
+// written as-is, so build it with EncodeElement too.
+func EncodeElement(tag string, attrs []KV, children string) (string, error) {
+	if !validName(tag) {
+		return "", ErrInvalidTag
+	}
+	var b strings.Builder
+	b.WriteByte('<')
+	b.WriteString(tag)
+	for i, a := range attrs {
+		if !validName(a.Key) {
+			return "", fmt.Errorf("%w (attribute %d)", ErrInvalidAttrName, i)
+		}
+		b.WriteByte(' ')
+		b.WriteString(a.Key)
+		b.WriteString(`="`)
+		b.WriteString(xmlEscapeAttr(a.Value))
+		b.WriteByte('"')
+	}
+	if children == "" {
+		b.WriteString(" />")
+		return b.String(), nil
+	}
+	b.WriteByte('>')
+	b.WriteString(children)
+	b.WriteString("</")
+	b.WriteString(tag)
+	b.WriteByte('>')
+	return b.String(), nil
+}
+
+func validName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case i > 0 && (c >= '0' && c <= '9' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// encodeFailed logs a reply that could not be encoded; the request gets no reply.
+func encodeFailed(in Msg, err error) []Outbound {
+	slog.Warn("proto reply not encoded", "tag", logHint(in.Tag), "err", err)
+	return nil
+}
@@ -0,0 +1,80 @@
+package proto
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeElement_EscapesValues(t *testing.T) {
+	got, err := EncodeElement("SetLocRes", []KV{{"Cx", "0x1"}, {"Location", `a"b<c>&d`}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<SetLocRes Cx="0x1" Location="a&quot;b&lt;c&gt;&amp;d" />`; got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	got, err = EncodeElement("HdrRowRes", []KV{{"Vid", "101"}}, `<Hdrs H0="Rid" />`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<HdrRowRes Vid="101"><Hdrs H0="Rid" /></HdrRowRes>`; got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestEncodeElement_RejectsBadNames(t *testing.T) {
+	for _, tag := range []string{"", "Bad Tag", "1Tag", "Tag>", `Tag"`, "Tag/"} {
+		if out, err := EncodeElement(tag, nil, ""); !errors.Is(err, ErrInvalidTag) {
+			t.Errorf("tag %q encoded as %s, err=%v", tag, out, err)
+		}
+	}
+	if out, err := EncodeElement("Ping", []KV{{"Flags=3 Name", "x"}}, ""); !errors.Is(err, ErrInvalidAttrName) {
+		t.Errorf("bad attribute name encoded as %s, err=%v", out, err)
+	} else if strings.Contains(err.Error(), "Flags") {
+		t.Errorf("err=%v carries the attribute name", err)
+	}
+	if _, err := EncodeElement("Row_2.x-y", []KV{{"H0", ""}}, ""); err != nil {
+		t.Errorf("valid name rejected: %v", err)
+	}
+}
+
+func TestEngine_FallbackEscapesEchoedValues(t *testing.T) {
+	eng := NewEngine(EngineConfig{Port: 2300}, nil, nil)
+	in, _ := Parse(`<Ping Cx="0x7" Note="1&2" />`)
+	outs := eng.Handle(time.Now().UTC(), 0, "", in)
+	if len(outs) != 1 {
+		t.Fatalf("outs=%v", outs)
+	}
+	if want := `<PingRes HR="0x00000000" Cx="0x7" Note="1&amp;2" />`; outs[0].PayloadXML != want {
+		t.Fatalf("payload=%s\nwant   %s", outs[0].PayloadXML, want)
+	}
+
+	// A key that is not a name gets no reply rather than a malformed one.
+	in, _ = Parse(`<Ping Cx="0x7" Flags=3 Name="x" />`)
+	if outs := eng.Handle(time.Now().UTC(), 0, "", in); len(outs) != 0 {
+		t.Fatalf("outs=%v want none", outs)
+	}
+}
+
+func TestEncodeFailed_QuotesAndTruncatesTag(t *testing.T) {
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	defer slog.SetDefault(prev)
+
+	evil := "Evil\nlevel=ERROR msg=forged"
+	_, err := EncodeElement("Ok", []KV{{evil, "v"}}, "")
+	if err == nil {
+		t.Fatal("bad attribute name encoded")
+	}
+	encodeFailed(Msg{Tag: evil}, err)
+	if out := logs.String(); strings.Count(out, "\n") != 1 || strings.Contains(out, "forged") ||
+		!strings.Contains(out, `tag="\"Evil\\nlevel=ERROR\""`) {
+		t.Fatalf("logs=%s", out)
+	}
+}
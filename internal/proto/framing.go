@@ -0,0 +1,58 @@
+package proto
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// Framing modes for app-protocol messages on the wire (proto.framing).
+const (
+	// FramingNUL is the stock client's framing: UTF-8 XML followed by one NUL.
+	FramingNUL = "nul"
+	// FramingLenPrefix is a 4-byte little-endian byte count followed by the UTF-8
+	// XML, with no terminator. For test harnesses and client experiments.
+	FramingLenPrefix = "len"
+)
+
+// lenPrefixSize is the FramingLenPrefix header size in bytes.
+const lenPrefixSize = 4
+
+// ErrFrame is returned for a length-prefixed frame that is too short for its
+// header or for the length it declares.
+var ErrFrame = errors.New("proto: bad length-prefixed frame")
+
+// MakeLenPrefixed frames s for FramingLenPrefix.
+func MakeLenPrefixed(s string) []byte {
+	return MakeLenPrefixedInto(nil, s)
+}
+
+// MakeLenPrefixedInto is MakeLenPrefixed writing into dst's storage (dst[:0]).
+// Trailing newlines are trimmed as in MakeZTextInto.
+func MakeLenPrefixedInto(dst []byte, s string) []byte {
+	s = strings.TrimRight(s, "\r\n")
+	b := binary.LittleEndian.AppendUint32(dst[:0], uint32(len(s)))
+	return append(b, s...)
+}
+
+// MakeFrameInto frames s per framing: FramingLenPrefix, or NUL termination for
+// FramingNUL and anything else (the zero value keeps today's wire format).
+func MakeFrameInto(dst []byte, s, framing string) []byte {
+	if framing == FramingLenPrefix {
+		return MakeLenPrefixedInto(dst, s)
+	}
+	return MakeZTextInto(dst, s)
+}
+
+// UnframeLenPrefixed returns the message inside a FramingLenPrefix frame. Bytes
+// past the declared length are ignored, like a trailer after a NUL terminator.
+func UnframeLenPrefixed(b []byte) ([]byte, error) {
+	if len(b) < lenPrefixSize {
+		return nil, ErrFrame
+	}
+	n := binary.LittleEndian.Uint32(b)
+	if uint64(n) > uint64(len(b)-lenPrefixSize) {
+		return nil, ErrFrame
+	}
+	return b[lenPrefixSize : lenPrefixSize+int(n)], nil
+}
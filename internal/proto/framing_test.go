@@ -0,0 +1,48 @@
+package proto
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFraming_RoundTrip(t *testing.T) {
+	const payload = `<PageRes HR="0x00000000" Cx="0x7" Vid="101" />`
+	for _, framing := range []string{"", FramingNUL, FramingLenPrefix} {
+		b := MakeFrameInto(nil, payload+"\r\n", framing)
+
+		body := b
+		if framing == FramingLenPrefix {
+			if len(b) != 4+len(payload) || b[len(b)-1] == 0 {
+				t.Fatalf("len frame=%q", b)
+			}
+			var err error
+			if body, err = UnframeLenPrefixed(b); err != nil {
+				t.Fatalf("UnframeLenPrefixed: %v", err)
+			}
+		} else if string(b) != string(MakeZText(payload)) {
+			t.Fatalf("framing %q changed the NUL frame: %q", framing, b)
+		}
+
+		m, err := ParseWith(string(body), ParseOptions{Strict: true})
+		if err != nil {
+			t.Fatalf("framing %q: ParseWith: %v", framing, err)
+		}
+		if m.Tag != "PageRes" || m.Attrs["Cx"] != "0x7" || m.Attrs["Vid"] != "101" {
+			t.Fatalf("framing %q: msg=%+v", framing, m)
+		}
+	}
+}
+
+func TestUnframeLenPrefixed_RejectsShortFrames(t *testing.T) {
+	b := MakeLenPrefixed("<X />")
+	for _, short := range [][]byte{nil, b[:3], b[:len(b)-1]} {
+		if _, err := UnframeLenPrefixed(short); !errors.Is(err, ErrFrame) {
+			t.Fatalf("UnframeLenPrefixed(%q) err=%v", short, err)
+		}
+	}
+	// A trailer past the declared length is not part of the message.
+	body, err := UnframeLenPrefixed(append(b, 0xde, 0xad))
+	if err != nil || string(body) != "<X />" {
+		t.Fatalf("body=%q err=%v", body, err)
+	}
+}
@@ -0,0 +1,13 @@
+package proto
+
+// HR values for response HR attributes and rejection logs. The client only
+// distinguishes success from failure (the high bit), so the failure codes are
+// standard HRESULTs picked to tell causes apart in logs and captures.
+const (
+	HROK         = "0x00000000" // S_OK
+	HRFail       = "0x80004005" // E_FAIL: the server cannot answer (no host store)
+	HRBadRequest = "0x80070057" // E_INVALIDARG: a required attribute is missing or malformed
+	HRForbidden  = "0x80070005" // E_ACCESSDENIED: the session may not do this (evicted, over a cap)
+	HRNotFound   = "0x80070490" // HRESULT_FROM_WIN32(ERROR_NOT_FOUND): no such game
+	HRTooBusy    = "0x800700AA" // HRESULT_FROM_WIN32(ERROR_BUSY): game full, rate limited
+)
@@ -0,0 +1,37 @@
+package proto
+
+import (
+	"errors"
+	"fmt"
+
+	"open-zone/internal/state"
+)
+
+// handleJoin acknowledges join intent for `<Join Rid="..."/>` with the host's
+// connection details, chosen the same way as the browse row's IpAddr/Ip2.
+func (p *Engine) handleJoin(j state.Joiner, in Msg) []Outbound {
+	cx := contextID(in)
+	rid := in.Attrs["Rid"]
+
+	fail := func(hr, exp string) []Outbound {
+		out := fmt.Sprintf(`<JoinRes HR="%s" Cx="%s" Rid="%s" />`, hr, cx, xmlEscapeAttr(rid))
+		return []Outbound{{Tag: "JoinRes", PayloadXML: out, Exp: exp}}
+	}
+	if p.host == nil {
+		return fail(HRFail, "send-safe-fail")
+	}
+	if rid == "" {
+		return fail(HRBadRequest, "send-join-bad")
+	}
+	t, err := p.host.JoinTarget(rid, j)
+	switch {
+	case errors.Is(err, state.ErrGameFull):
+		return fail(HRTooBusy, "send-join-full")
+	case err != nil:
+		return fail(HRNotFound, "send-join-miss")
+	}
+	out := fmt.Sprintf(`<JoinRes HR="`+HROK+`" Cx="%s" Rid="%s" IpAddr="%s" Ip2="%s" Port="%d" />`,
+		cx, xmlEscapeAttr(rid), xmlEscapeAttr(t.IpAddr), xmlEscapeAttr(t.Ip2), t.Port,
+	)
+	return []Outbound{{Tag: "JoinRes", PayloadXML: out, Exp: "send"}}
+}
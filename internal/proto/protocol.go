@@ -1,9 +1,14 @@
 package proto
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"open-zone/internal/state"
@@ -25,20 +30,91 @@ type EngineConfig struct {
 	// If unset, ConInfoRes defaults to IpAddr=127.0.0.1 and Port=<Port>.
 	AdvertiseIP   string
 	AdvertisePort int
+
+	// ConInfoIP, when set, is the IpAddr reported in ConInfoRes and takes precedence
+	// over AdvertiseIP (proto.con_info_ip). With neither set, ConInfoRes reflects the
+	// client's observed remote IP, falling back to 127.0.0.1.
+	ConInfoIP string
+
+	// DisableLANJoiner always browses the host's public address, never a
+	// same-subnet LAN IP (features.lan_joiner: false).
+	DisableLANJoiner bool
+
+	// Views maps a view id (Vid) to its ordered header tokens, overriding
+	// headerTokensForView for those views (proto.views).
+	Views map[string][]string
+
+	// MaxPageRows caps the rows in one PageRes regardless of what the client asks
+	// for (proto.max_page_rows); <= 0 uses DefaultMaxPageRows.
+	MaxPageRows int
+
+	// PageVersion adds `Ver="<state.HostStore.Version>"` to games-list PageRes
+	// (proto.page_version), so a diagnostic proxy or a future client can tell an
+	// unchanged list from a new one. Off by default: stock clients never asked for it.
+	PageVersion bool
+
+	// StrictParse drops inbound messages whose attributes are malformed instead of
+	// keeping the attributes before the bad one (proto.strict_parse). The dp8
+	// engine parses, so it reads this; see ParseStrict.
+	StrictParse bool
+
+	// MaxAttrs and MaxAttrLen cap an inbound message's attribute count and the
+	// length of any one key or value (proto.max_attrs, proto.max_attr_len); the
+	// dp8 engine drops messages over them. <= 0 is unlimited. See ParseOptions.
+	MaxAttrs   int
+	MaxAttrLen int
+
+	// Framing is how the dp8 engine frames messages on the wire, both ways:
+	// FramingNUL (or empty, the stock client) or FramingLenPrefix (proto.framing).
+	Framing string
+
+	// MOTD, when set, is pushed to each client as `<Msg Text="..." />` right after
+	// the connect bundle (server.motd).
+	MOTD string
+
+	// MaxPlayers is the server capacity (server.max_players); 0 is unlimited. With
+	// RejectWhenFull, a Connect from a player over it gets a ConnectRes with
+	// HRTooBusy and no rest of the bundle.
+	MaxPlayers     int
+	RejectWhenFull bool
 }
 
+// DefaultMaxPageRows bounds a PageRes when no cap is configured.
+const DefaultMaxPageRows = 256
+
 type Engine struct {
+	cfg EngineConfig // as passed to NewEngine; SelfCheck builds its probe from it
+
 	port        int
 	advertiseIP string
 	advPort     int
+	conInfoIP   string // configured ConInfoRes IpAddr; empty derives it per connection
+	noLANJoin   bool
+	views       map[string][]string
+	maxPageRows int
+	pageVersion bool
+	motd        string
+	maxPlayers  int // 0 unless RejectWhenFull
 
 	host    *state.HostStore
 	players *state.PlayerStore
+
+	tags *tagCounters // nil on the self-check probe
+
+	// clipWarnedVer is 1 + the HostStore version last warned about in
+	// "PageRes clipped", so each games list logs it once however often it is paged.
+	clipWarnedVer *atomic.Uint64
 }
 
 type Stats struct {
 	PlayersOnline int // DP8 sessions, not accounts.
 	GamesHosted   int
+	StaleHosts    int // visible hosts overdue for a HostData update
+	ActiveGames   int // visible hosts updated within the store's ActiveWindow
+
+	// Tags counts handled messages by inbound tag since start; tags without a
+	// dedicated handler share the "fallback" bucket.
+	Tags map[string]uint64
 }
 
 func NewEngine(cfg EngineConfig, host *state.HostStore, players *state.PlayerStore) *Engine {
@@ -47,58 +123,122 @@ func NewEngine(cfg EngineConfig, host *state.HostStore, players *state.PlayerSto
 	if advPort <= 0 {
 		advPort = cfg.Port
 	}
+	conInfoIP := strings.TrimSpace(cfg.ConInfoIP)
+	if conInfoIP == "" {
+		conInfoIP = advIP
+	}
 	if advIP == "" {
 		advIP = "127.0.0.1"
 	}
+	maxPageRows := cfg.MaxPageRows
+	if maxPageRows <= 0 {
+		maxPageRows = DefaultMaxPageRows
+	}
 	return &Engine{
+		cfg:         cfg,
 		port:        cfg.Port,
 		advertiseIP: advIP,
 		advPort:     advPort,
+		conInfoIP:   conInfoIP,
+		noLANJoin:   cfg.DisableLANJoiner,
+		views:       cfg.Views,
+		maxPageRows: maxPageRows,
+		pageVersion: cfg.PageVersion,
+		motd:        strings.TrimSpace(cfg.MOTD),
+		maxPlayers:  rejectOver(cfg),
 		host:        host,
 		players:     players,
+		tags:        &tagCounters{},
+
+		clipWarnedVer: &atomic.Uint64{},
 	}
 }
 
+func rejectOver(cfg EngineConfig) int {
+	if !cfg.RejectWhenFull {
+		return 0
+	}
+	return max(cfg.MaxPlayers, 0)
+}
+
 func (p *Engine) Stats() Stats {
 	var out Stats
 	if p.host != nil {
 		out.GamesHosted = p.host.VisibleGamesCount()
+		now := time.Now().UTC()
+		out.StaleHosts = p.host.StaleHostsCount(now)
+		out.ActiveGames = p.host.ActiveGamesCount(now, p.host.ActiveWindow())
 	}
 	if p.players != nil {
 		out.PlayersOnline = p.players.Count()
 	}
+	if p.tags != nil {
+		out.Tags = p.tags.snapshot()
+	}
 	return out
 }
 
 func (p *Engine) Handle(now time.Time, fromDPNID uint32, remoteIP string, in Msg) []Outbound {
+	if p.tags != nil {
+		p.tags.inc(in.Tag)
+	}
 	switch in.Tag {
 	case "Connect":
-		return p.handleConnect(now, in)
+		return p.handleConnect(now, fromDPNID, remoteIP, in)
 	case "HdrRow":
 		return p.handleHdrRow(in)
 	case "Page":
-		return p.handlePage(in)
+		return p.handlePage(p.joiner(fromDPNID, remoteIP), in)
 	case "RowPg":
-		return p.handleRowPg(in)
+		return p.handleRowPg(p.joiner(fromDPNID, remoteIP), in)
 	case "HostData":
 		return p.handleHostData(fromDPNID, remoteIP, in)
 	case "SetLoc":
 		return p.handleSetLoc(fromDPNID, remoteIP, in)
+	case "Join":
+		return p.handleJoin(p.joiner(fromDPNID, remoteIP), in)
 	default:
 		return p.handleFallback(in)
 	}
 }
 
-func (p *Engine) handleRowPg(in Msg) []Outbound {
+// SetObservedPort records a hosting session's externally observed game port
+// (see state.HostStore.SetObservedPort). It is not the DP8 lobby connection's
+// port, which says nothing about where the game listens.
+func (p *Engine) SetObservedPort(fromDPNID uint32, port int) {
+	if p.host != nil {
+		p.host.SetObservedPort(fromDPNID, port)
+	}
+}
+
+// Departed forgets what fromDPNID sent before it hosted (see
+// state.HostStore.ForgetPending); call it when its DP8 session ends.
+func (p *Engine) Departed(fromDPNID uint32) {
+	if p.host != nil {
+		p.host.ForgetPending(fromDPNID)
+	}
+}
+
+// joiner builds the browse context for fromDPNID so rows can offer a same-LAN
+// host address (see state.Joiner).
+func (p *Engine) joiner(fromDPNID uint32, remoteIP string) state.Joiner {
+	if p.noLANJoin {
+		return state.Joiner{}
+	}
+	j := state.Joiner{ObservedIP: strings.TrimSpace(remoteIP)}
+	if p.players != nil {
+		j.LocalIPs = p.players.LocalIPs(fromDPNID)
+	}
+	return j
+}
+
+func (p *Engine) handleRowPg(j state.Joiner, in Msg) []Outbound {
 	// Client sends `RowPg Vid="301" Rid="<rowId>" Num="0" Str="" Cx="0x16"`.
 	// This is a details refresh step prior to any transport-level join.
 	//
 	// Requirement: return `HR=0` and a row payload for the requested Rid, otherwise the UI
 	// treats the selection as unavailable.
-	cx := in.Attrs["Cx"]
-	if cx == "" {
-		cx = "0x0"
-	}
+	cx := contextID(in)
 	vid := in.Attrs["Vid"]
 	if vid == "" {
 		vid = "0"
@@ -113,50 +253,85 @@ func (p *Engine) handleRowPg(in Msg) []Outbound {
 	}
 	str := in.Attrs["Str"]
 
-	headers := headerTokensForView(vid)
+	headers := p.headerTokens(vid)
+	res := func(hr, count, children string) (string, error) {
+		return EncodeElement("RowPgRes", []KV{
+			{"HR", hr}, {"Cx", cx}, {"Vid", vid}, {"Rid", rid}, {"Num", num}, {"Str", str}, {"Count", count},
+		}, children)
+	}
 	if p.host == nil {
-		out := fmt.Sprintf(`<RowPgRes HR="0x80004005" Cx="%s" Vid="%s" Rid="%s" Num="%s" Str="%s" Count="0" />`,
-			cx, vid, rid, xmlEscapeAttr(num), xmlEscapeAttr(str),
-		)
+		out, err := res(HRFail, "0", "")
+		if err != nil {
+			return encodeFailed(in, err)
+		}
 		return []Outbound{{Tag: "RowPgRes", PayloadXML: out, Exp: "send-safe-fail"}}
 	}
 
-	row, ok := p.host.RowByRid(rid, headers)
+	row, ok := p.host.RowByRidFor(rid, headers, j)
 	if !ok {
 		// Not found: return success with 0 rows (client will show "no longer available").
-		out := fmt.Sprintf(`<RowPgRes HR="0x00000000" Cx="%s" Vid="%s" Rid="%s" Num="%s" Str="%s" Count="0" />`,
-			cx, vid, rid, xmlEscapeAttr(num), xmlEscapeAttr(str),
-		)
+		// HRNotFound would be more precise, but the UI needs HR=0 here.
+		out, err := res(HROK, "0", "")
+		if err != nil {
+			return encodeFailed(in, err)
+		}
 		return []Outbound{{Tag: "RowPgRes", PayloadXML: out, Exp: "send-rowpg-miss"}}
 	}
 
 	// IMPORTANT: mirror the same "Row as attributes" encoding as PageRes.
-	rowAttrs := make([]string, 0, len(headers))
+	rowXML, err := encodeRow(headers, row)
+	if err != nil {
+		return encodeFailed(in, err)
+	}
+	out, err := res(HROK, "1", rowXML)
+	if err != nil {
+		return encodeFailed(in, err)
+	}
+	return []Outbound{{Tag: "RowPgRes", PayloadXML: out, Exp: "send-rowpg-hit"}}
+}
+
+// encodeRow builds `<Row .../>` with exactly one attribute per header, in header
+// order; an empty first column falls back to the row's Rid.
+func encodeRow(headers []string, row state.GameRow) (string, error) {
+	attrs := make([]KV, 0, len(headers))
 	for i, h := range headers {
 		val := row.Items[h]
 		if i == 0 && val == "" {
 			val = row.Rid
 		}
-		rowAttrs = append(rowAttrs, fmt.Sprintf(`%s="%s"`, h, xmlEscapeAttr(val)))
+		attrs = append(attrs, KV{h, val})
 	}
-
-	out := fmt.Sprintf(
-		`<RowPgRes HR="0x00000000" Cx="%s" Vid="%s" Rid="%s" Num="%s" Str="%s" Count="1"><Row %s /></RowPgRes>`,
-		cx, vid, rid, xmlEscapeAttr(num), xmlEscapeAttr(str), strings.Join(rowAttrs, " "),
-	)
-	return []Outbound{{Tag: "RowPgRes", PayloadXML: out, Exp: "send-rowpg-hit"}}
+	return EncodeElement("Row", attrs, "")
 }
 
-func (p *Engine) handleConnect(now time.Time, in Msg) []Outbound {
-	cx := in.Attrs["Cx"]
-	if cx == "" {
-		cx = "0x0"
+func (p *Engine) handleConnect(now time.Time, fromDPNID uint32, remoteIP string, in Msg) []Outbound {
+	cx := contextID(in)
+	// Some clients list their interface addresses like HostData does (IpAddr/Ip2);
+	// keep them for same-LAN browse rows.
+	if p.players != nil {
+		if ips := state.ParseIPList(in.Attrs["IpAddr"] + " " + in.Attrs["Ip2"]); len(ips) > 0 {
+			p.players.SetLocalIPs(fromDPNID, ips)
+		}
 	}
 	pv := in.Attrs["ProtoVer"]
 	if pv == "" {
 		pv = "3.3"
 	}
 
+	// The connecting player is already counted (added on DP8 connect), so the
+	// server is over capacity only past maxPlayers. A rejected player is evicted
+	// at once so it stops counting (and holding the server full) before its
+	// disconnect arrives. Only a session's first Connect can be turned away: one
+	// already let in that repeats Connect keeps its slot.
+	if p.maxPlayers > 0 && p.players != nil && !p.players.Admitted(fromDPNID) && p.players.Count() > p.maxPlayers {
+		p.players.TouchEvict(fromDPNID, now)
+		out, err := EncodeElement("ConnectRes", []KV{{"HR", HRTooBusy}, {"Cx", cx}}, "")
+		if err != nil {
+			return encodeFailed(in, err)
+		}
+		return []Outbound{{Tag: "ConnectRes", PayloadXML: out, Exp: "send-server-full"}}
+	}
+
 	t2000 := SecondsSince2000UTC(now.UTC())
 	siid := uint32(now.UnixNano())
 	lid := uint32(now.UnixNano() >> 32)
@@ -164,18 +339,58 @@ func (p *Engine) handleConnect(now time.Time, in Msg) []Outbound {
 	appGuid := "77E2D9C2-504E-459F-8416-0848130BBE1E"
 	locale := "0x0409"
 
-	msg1 := fmt.Sprintf(
-		`<ConnectRes HR="0x00000000" Cx="%s" ProtoVer="%s" SIId="0x%08x" LId="0x%08x" ConSId="0x%08x" ConLId="0x%08x" Time="%d" Locale="%s" Random="0x%08x" AppGuid="%s" />`,
-		cx, pv, siid, lid, siid, lid, t2000, locale, randv, appGuid,
-	)
-	msg2 := fmt.Sprintf(`<ConInfoRes HR="0x00000000" Cx="%s" IpAddr="%s" Port="%d" />`, cx, xmlEscapeAttr(p.advertiseIP), p.advPort)
-	msg3 := fmt.Sprintf(`<ConnectEv HR="0x00000000" Cx="%s" Time="%d" />`, cx, t2000)
+	hex32 := func(v uint32) string { return fmt.Sprintf("0x%08x", v) }
+	msg1, err := EncodeElement("ConnectRes", []KV{
+		{"HR", HROK}, {"Cx", cx}, {"ProtoVer", pv},
+		{"SIId", hex32(siid)}, {"LId", hex32(lid)}, {"ConSId", hex32(siid)}, {"ConLId", hex32(lid)},
+		{"Time", strconv.FormatUint(t2000, 10)}, {"Locale", locale}, {"Random", hex32(randv)}, {"AppGuid", appGuid},
+	}, "")
+	if err != nil {
+		return encodeFailed(in, err)
+	}
+	msg2, err := EncodeElement("ConInfoRes", []KV{
+		{"HR", HROK}, {"Cx", cx}, {"IpAddr", p.conInfoAddr(remoteIP)}, {"Port", strconv.Itoa(p.advPort)},
+	}, "")
+	if err != nil {
+		return encodeFailed(in, err)
+	}
+	msg3, err := EncodeElement("ConnectEv", []KV{
+		{"HR", HROK}, {"Cx", cx}, {"Time", strconv.FormatUint(t2000, 10)},
+	}, "")
+	if err != nil {
+		return encodeFailed(in, err)
+	}
+	if p.players != nil {
+		p.players.Admit(fromDPNID)
+	}
 
-	return []Outbound{
+	outs := []Outbound{
 		{Tag: "ConnectRes", PayloadXML: msg1, Exp: "send"},
 		{Tag: "ConInfoRes", PayloadXML: msg2, Exp: "send"},
 		{Tag: "ConnectEv", PayloadXML: msg3, Exp: "send"},
 	}
+	// The MOTD goes last; the per-client send queue keeps it behind the bundle.
+	if p.motd != "" {
+		motd, err := EncodeElement("Msg", []KV{{"Text", p.motd}}, "")
+		if err != nil {
+			slog.Warn("motd not encoded", "err", err)
+		} else {
+			outs = append(outs, Outbound{Tag: "Msg", PayloadXML: motd, Exp: "send-motd"})
+		}
+	}
+	return outs
+}
+
+// conInfoAddr is the IpAddr reported in ConInfoRes: the configured address when
+// there is one, else the client's own observed view of the connection.
+func (p *Engine) conInfoAddr(remoteIP string) string {
+	if p.conInfoIP != "" {
+		return p.conInfoIP
+	}
+	if ip := net.ParseIP(strings.TrimSpace(remoteIP)); ip != nil && !ip.IsUnspecified() {
+		return ip.String()
+	}
+	return "127.0.0.1"
 }
 
 func (p *Engine) handleSetLoc(fromDPNID uint32, remoteIP string, in Msg) []Outbound {
@@ -187,13 +402,10 @@ func (p *Engine) handleSetLoc(fromDPNID uint32, remoteIP string, in Msg) []Outbo
 		p.host.SetLoc(fromDPNID, in.Attrs["Location"])
 	}
 
-	cx := in.Attrs["Cx"]
-	if cx == "" {
-		cx = "0x0"
-	}
+	cx := contextID(in)
 	flags := in.Attrs["Flags"]
 	loc := in.Attrs["Location"]
-	out := fmt.Sprintf(`<SetLocRes HR="0x00000000" Cx="%s" Flags="%s" Location="%s" />`, cx, xmlEscapeAttr(flags), xmlEscapeAttr(loc))
+	out := fmt.Sprintf(`<SetLocRes HR="`+HROK+`" Cx="%s" Flags="%s" Location="%s" />`, cx, xmlEscapeAttr(flags), xmlEscapeAttr(loc))
 	return []Outbound{{Tag: "SetLocRes", PayloadXML: out, Exp: "send-host"}}
 }
 
@@ -204,22 +416,21 @@ func (p *Engine) handleHostData(fromDPNID uint32, remoteIP string, in Msg) []Out
 		if strings.TrimSpace(remoteIP) != "" {
 			p.host.SetObservedRemoteIP(fromDPNID, remoteIP)
 		}
-		p.host.ApplyHostData(fromDPNID, in.Raw)
+		var gvErr *state.GameVError
+		if err := p.host.ApplyHostData(fromDPNID, in.Raw); errors.As(err, &gvErr) {
+			slog.Warn("host hidden from browse: GameV not allowed", "dpnid", fmt.Sprintf("0x%08x", fromDPNID), "gamev", logHint(gvErr.GameV))
+		} else if err != nil {
+			slog.Warn("HostData not applied", "dpnid", fmt.Sprintf("0x%08x", fromDPNID), "err", err)
+		}
 	}
 
-	cx := in.Attrs["Cx"]
-	if cx == "" {
-		cx = "0x0"
-	}
-	out := fmt.Sprintf(`<HostDataRes HR="0x00000000" Cx="%s" />`, cx)
+	cx := contextID(in)
+	out := fmt.Sprintf(`<HostDataRes HR="`+HROK+`" Cx="%s" />`, cx)
 	return []Outbound{{Tag: "HostDataRes", PayloadXML: out, Exp: "send-host"}}
 }
 
 func (p *Engine) handleHdrRow(in Msg) []Outbound {
-	cx := in.Attrs["Cx"]
-	if cx == "" {
-		cx = "0x0"
-	}
+	cx := contextID(in)
 	vid := in.Attrs["Vid"]
 	if vid == "" {
 		vid = "0"
@@ -228,24 +439,26 @@ func (p *Engine) handleHdrRow(in Msg) []Outbound {
 	// NOTE: the client requests header rows for many views in a burst on entering the Games UI.
 	// Responding consistently across view ids reduces partial-initialization states.
 
-	headers := headerTokensForView(vid)
+	headers := p.headerTokens(vid)
 
 	// Header encoding: `<Hdrs H0="Rid" H1="GName" ... H15="InGame" />` (no Num attr).
-	var b strings.Builder
-	fmt.Fprintf(&b, `<HdrRowRes HR="0x00000000" Cx="%s" Vid="%s">`, cx, vid)
-	b.WriteString(`<Hdrs`)
+	hdrs := make([]KV, 0, len(headers))
 	for i, h := range headers {
-		fmt.Fprintf(&b, ` H%d="%s"`, i, xmlEscapeAttr(h))
+		hdrs = append(hdrs, KV{"H" + strconv.Itoa(i), h})
+	}
+	hdrsXML, err := EncodeElement("Hdrs", hdrs, "")
+	if err != nil {
+		return encodeFailed(in, err)
 	}
-	b.WriteString(` /></HdrRowRes>`)
-	return []Outbound{{Tag: "HdrRowRes", PayloadXML: b.String(), Exp: "send"}}
+	out, err := EncodeElement("HdrRowRes", []KV{{"HR", HROK}, {"Cx", cx}, {"Vid", vid}}, hdrsXML)
+	if err != nil {
+		return encodeFailed(in, err)
+	}
+	return []Outbound{{Tag: "HdrRowRes", PayloadXML: out, Exp: "send"}}
 }
 
-func (p *Engine) handlePage(in Msg) []Outbound {
-	cx := in.Attrs["Cx"]
-	if cx == "" {
-		cx = "0x0"
-	}
+func (p *Engine) handlePage(j state.Joiner, in Msg) []Outbound {
+	cx := contextID(in)
 	vid := in.Attrs["Vid"]
 	if vid == "" {
 		vid = "0"
@@ -265,19 +478,56 @@ func (p *Engine) handlePage(in Msg) []Outbound {
 	// Non-empty page response:
 	// - Rows are encoded as repeated `<Row .../>` elements under `<PageRes ...>`.
 	// - Per-row values are carried as attributes on the `<Row .../>` element.
-	headers := headerTokensForView(vid)
+	var headers []string
+	if p.pageViewKnown(vid) {
+		headers = p.headerTokens(vid)
+	} else {
+		// Answer with an empty page rather than games columns the view never asked for.
+		slog.Warn("Page for unknown view; sent empty PageRes", "vid", logHint(vid))
+	}
 
 	rows := []state.GameRow(nil)
-	if p.host != nil && vid == "101" {
-		// Return all hosted rows (no artificial cap).
-		rows = p.host.GamesRows(0, headers)
+	var ver []KV
+	if p.host != nil && vid == viewGames {
+		if p.pageVersion {
+			// Read before the rows: a change in between makes the page look stale, not current.
+			ver = []KV{{"Ver", strconv.FormatUint(p.host.Version(), 10)}}
+		}
+		// One row past the cap tells us whether it clipped. A search filters every
+		// game first, so matches past the first page's worth are still found.
+		search := strings.TrimSpace(str)
+		if search == "" {
+			rows = p.host.GamesRowsFor(p.maxPageRows+1, headers, j)
+		} else {
+			rows = filterGName(p.host.GamesRowsFor(0, headers, j), search)
+		}
+		if len(rows) > p.maxPageRows {
+			if v := p.host.Version() + 1; p.clipWarnedVer.Swap(v) != v {
+				// Only search already holds every match; count the rest for the log.
+				matched := len(rows)
+				if search == "" {
+					matched = len(p.host.GamesRowsFor(0, nil, j))
+				}
+				slog.Warn("PageRes clipped at proto.max_page_rows", "vid", vid, "max_page_rows", p.maxPageRows,
+					"matching", matched, "str", logHint(search))
+			}
+			rows = rows[:p.maxPageRows]
+		}
+	}
+
+	res := func(children string) (string, error) {
+		return EncodeElement("PageRes", append([]KV{
+			{"HR", HROK}, {"Cx", cx}, {"Vid", vid}, {"ViewId", vid}, {"PageNo", pageNo}, {"PageNumber", pageNo},
+			{"VType", "0"}, {"ViewType", "0"}, {"VIdx", "0"}, {"ViewIndex", "0"}, {"VTotal", "0"}, {"ViewTotal", "0"},
+			{"Count", strconv.Itoa(len(rows))}, {"Num", num}, {"Str", str},
+		}, ver...), children)
 	}
 
 	if len(rows) == 0 {
-		out := fmt.Sprintf(
-			`<PageRes HR="0x00000000" Cx="%s" Vid="%s" ViewId="%s" PageNo="%s" PageNumber="%s" VType="0" ViewType="0" VIdx="0" ViewIndex="0" VTotal="0" ViewTotal="0" Count="0" Num="%s" Str="%s" />`,
-			cx, vid, vid, pageNo, pageNo, xmlEscapeAttr(num), xmlEscapeAttr(str),
-		)
+		out, err := res("")
+		if err != nil {
+			return encodeFailed(in, err)
+		}
 		return []Outbound{{Tag: "PageRes", PayloadXML: out, Exp: "send"}}
 	}
 
@@ -289,34 +539,70 @@ func (p *Engine) handlePage(in Msg) []Outbound {
 	// - For the Games list view (`Vid=101`), rows must be encoded as repeated `<Row ...>...</Row>`
 	//   elements directly under `<PageRes ...>`. Wrapping in `<MPageRes>` (or `<List>`) has caused
 	//   regressions where the UI renders 0 rows or fails to populate row string arrays.
-	fmt.Fprintf(&b, `<PageRes HR="0x00000000" Cx="%s" Vid="%s" ViewId="%s" PageNo="%s" PageNumber="%s" VType="0" ViewType="0" VIdx="0" ViewIndex="0" VTotal="0" ViewTotal="0" Count="%d" Num="%s" Str="%s">`,
-		cx, vid, vid, pageNo, pageNo, len(rows), xmlEscapeAttr(num), xmlEscapeAttr(str),
-	)
-
 	for _, r := range rows {
 		// IMPORTANT:
 		// - emit EXACTLY `len(headers)` attributes
 		// - keep attribute order matching `headerTokensForView(vid)` order
 		// - do NOT include extra attrs like `Num="16"` (it shifts columns)
-		rowAttrs := make([]string, 0, len(headers))
-		for i, h := range headers {
-			val := r.Items[h]
-			if i == 0 && val == "" {
-				val = r.Rid
-			}
-			rowAttrs = append(rowAttrs, fmt.Sprintf(`%s="%s"`, h, xmlEscapeAttr(val)))
+		rowXML, err := encodeRow(headers, r)
+		if err != nil {
+			return encodeFailed(in, err)
+		}
+		b.WriteString(rowXML)
+	}
+	out, err := res(b.String())
+	if err != nil {
+		return encodeFailed(in, err)
+	}
+
+	return []Outbound{{Tag: "PageRes", PayloadXML: out, Exp: "send-page-rows"}}
+}
+
+// filterGName keeps the rows whose GName contains search, ignoring case. It is
+// the games view's answer to the client's search box (Page Str).
+func filterGName(rows []state.GameRow, search string) []state.GameRow {
+	search = strings.ToLower(search)
+	out := rows[:0]
+	for _, r := range rows {
+		if strings.Contains(strings.ToLower(r.Items["GName"]), search) {
+			out = append(out, r)
 		}
+	}
+	return out
+}
 
-		fmt.Fprintf(&b, `<Row %s />`, strings.Join(rowAttrs, " "))
+// headerTokens returns the configured tokens for vid, else the built-in set.
+// The built-in games set gains a trailing Region column when the host store
+// tags regions (state.region_map); configured views list it themselves.
+func (p *Engine) headerTokens(vid string) []string {
+	if tokens, ok := p.views[vid]; ok {
+		return tokens
 	}
-	b.WriteString(`</PageRes>`)
+	tokens := headerTokensForView(vid)
+	if vid != viewPlayers && p.host != nil && p.host.RegionsEnabled() {
+		tokens = append(tokens, "Region")
+	}
+	return tokens
+}
 
-	return []Outbound{{Tag: "PageRes", PayloadXML: b.String(), Exp: "send-page-rows"}}
+// View ids (Vid) the server answers Page requests for.
+const (
+	viewGames   = "101" // games list
+	viewPlayers = "501" // players in a game (GAMEVIEW_GAME_PLAYERS)
+)
+
+// pageViewKnown reports whether Page requests for vid get a real answer: the
+// built-in views and any configured in proto.views.
+func (p *Engine) pageViewKnown(vid string) bool {
+	if _, ok := p.views[vid]; ok {
+		return true
+	}
+	return vid == viewGames || vid == viewPlayers
 }
 
 func headerTokensForView(vid string) []string {
 	switch vid {
-	case "501":
+	case viewPlayers:
 		// Player listing view (GAMEVIEW_GAME_PLAYERS)
 		return []string{"User", "PTeam", "PChar", "PLev"}
 	default:
@@ -343,6 +629,52 @@ func headerTokensForView(vid string) []string {
 	}
 }
 
+// maxCxHexDigits bounds the echoed context id. Observed clients send small
+// 32-bit values (`Cx="0x16"`); anything longer is treated as malformed.
+const maxCxHexDigits = 8
+
+// contextID returns the request's `Cx` value in a form that is safe to echo.
+//
+// Cx is echoed into every response, so an unbounded value would let a client
+// amplify payload sizes. Missing values default to "0x0"; values that are not
+// `0x` + 1..8 hex digits are normalized to "0x0" and logged.
+func contextID(in Msg) string {
+	cx, ok := in.Attrs["Cx"]
+	if !ok || cx == "" {
+		return "0x0"
+	}
+	if validCx(cx) {
+		return cx
+	}
+	slog.Warn("invalid Cx normalized", "tag", in.Tag, "len", len(cx), "prefix", logHint(cx))
+	return "0x0"
+}
+
+// logHint quotes at most the first 16 bytes of a client-supplied value for logs.
+func logHint(v string) string {
+	if len(v) > 16 {
+		v = v[:16]
+	}
+	return strconv.Quote(v)
+}
+
+func validCx(cx string) bool {
+	if len(cx) < 3 || len(cx) > 2+maxCxHexDigits {
+		return false
+	}
+	if cx[0] != '0' || (cx[1] != 'x' && cx[1] != 'X') {
+		return false
+	}
+	for i := 2; i < len(cx); i++ {
+		c := cx[i]
+		if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
 func xmlEscapeAttr(s string) string {
 	// This is not a full XML serializer; it is the minimal escaping required to keep
 	// our attribute values well-formed for basic parsers.
@@ -369,17 +701,42 @@ func (p *Engine) handleFallback(in Msg) []Outbound {
 	// Generic fallback: many messages appear to follow request `<X .../>`
 	// and response `<XRes .../>`. Responding avoids hard stalls and often prevents
 	// UI-side error paths for message families not explicitly handled.
-	if in.Tag == "" || strings.ContainsAny(in.Tag, "<>\"' /\\") {
+	if in.Tag == "" {
 		return nil
 	}
-	attrs := make([]string, 0, len(in.Attrs))
-	for k, v := range in.Attrs {
-		attrs = append(attrs, fmt.Sprintf(`%s="%s"`, k, v))
+	attr := func(k, v string) KV {
+		if k == "Cx" {
+			v = contextID(in)
+		}
+		return KV{k, v}
+	}
+	// Echo parsed attributes in wire order; any the caller synthesized (present in
+	// Attrs but not Order) follow in sorted order so logs stay deterministic.
+	attrs := make([]KV, 0, len(in.Attrs)+1)
+	attrs = append(attrs, KV{"HR", HROK})
+	seen := make(map[string]bool, len(in.Order))
+	for _, a := range in.Order {
+		v, ok := in.Attrs[a.Key]
+		if !ok || seen[a.Key] {
+			continue
+		}
+		seen[a.Key] = true
+		attrs = append(attrs, attr(a.Key, v))
+	}
+	extra := make([]string, 0, len(in.Attrs)-len(seen))
+	for k := range in.Attrs {
+		if !seen[k] {
+			extra = append(extra, k)
+		}
+	}
+	sort.Strings(extra)
+	for _, k := range extra {
+		attrs = append(attrs, attr(k, in.Attrs[k]))
+	}
+	// A tag or key that is not a name (the client can send anything) gets no reply.
+	out, err := EncodeElement(in.Tag+"Res", attrs, "")
+	if err != nil {
+		return encodeFailed(in, err)
 	}
-	sort.Strings(attrs) // deterministic logs
-	parts := make([]string, 0, len(attrs)+1)
-	parts = append(parts, `HR="0x00000000"`)
-	parts = append(parts, attrs...)
-	out := fmt.Sprintf("<%sRes %s />", in.Tag, strings.Join(parts, " "))
 	return []Outbound{{Tag: in.Tag + "Res", PayloadXML: out, Exp: "send-fallback"}}
 }
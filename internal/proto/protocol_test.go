@@ -1,6 +1,9 @@
 package proto
 
 import (
+	"bytes"
+	"fmt"
+	"log/slog"
 	"strings"
 	"testing"
 	"time"
@@ -94,3 +97,461 @@ func TestEngine_Page_OneRowFromHostStore(t *testing.T) {
 		t.Fatalf("attr order unexpected (Rid,GName,GameV): %d,%d,%d payload=%s", iRid, iGName, iGameV, p)
 	}
 }
+
+func TestContextID_ValidOversizedMalformed(t *testing.T) {
+	cases := []struct {
+		name string
+		cx   string
+		want string
+	}{
+		{"valid", "0x16", "0x16"},
+		{"valid upper", "0XABCDEF01", "0XABCDEF01"},
+		{"missing", "", "0x0"},
+		{"oversized", "0x" + strings.Repeat("f", 4096), "0x0"},
+		{"no prefix", "123", "0x0"},
+		{"non hex", "0xZZ", "0x0"},
+		{"prefix only", "0x", "0x0"},
+		{"injection", `0x1" Evil="1`, "0x0"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			attrs := map[string]string{}
+			if tc.cx != "" {
+				attrs["Cx"] = tc.cx
+			}
+			if got := contextID(Msg{Tag: "Connect", Attrs: attrs}); got != tc.want {
+				t.Fatalf("contextID(%q)=%q want %q", tc.cx, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEngine_OversizedCxNotEchoed(t *testing.T) {
+	e := NewEngine(EngineConfig{Port: 2300}, nil, nil)
+	huge := "0x" + strings.Repeat("a", 64*1024)
+	for _, tag := range []string{"Connect", "HdrRow", "Page", "Unknown"} {
+		outs := e.Handle(time.Now().UTC(), 0, "", Msg{
+			Tag:   tag,
+			Attrs: map[string]string{"Cx": huge, "Vid": "101"},
+		})
+		if len(outs) == 0 {
+			t.Fatalf("%s: no outbound", tag)
+		}
+		for _, out := range outs {
+			if strings.Contains(out.PayloadXML, huge) || len(out.PayloadXML) > 4096 {
+				t.Fatalf("%s: oversized Cx echoed (len=%d)", tag, len(out.PayloadXML))
+			}
+			if !strings.Contains(out.PayloadXML, `Cx="0x0"`) {
+				t.Fatalf("%s: payload=%s", tag, out.PayloadXML)
+			}
+		}
+	}
+}
+
+func TestEngine_Page_MaxPageRowsCapsResponse(t *testing.T) {
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	defer slog.SetDefault(prev)
+
+	host := state.NewHostStore()
+	e := NewEngine(EngineConfig{Port: 2300, MaxPageRows: 3}, host, nil)
+	now := time.Now().UTC()
+	for i := uint32(1); i <= 5; i++ {
+		host.ApplyHostData(i, fmt.Sprintf(`<HostData><HostData><New><Item ItemId="0" GName="g%d" Map="m" /></New></HostData></HostData>`, i))
+	}
+
+	page := Msg{Tag: "Page", Attrs: map[string]string{"Cx": "0x0", "Vid": "101", "PageNo": "0", "Num": "0", "Str": ""}}
+	outs := e.Handle(now, 0x9, "", page)
+	if len(outs) != 1 {
+		t.Fatalf("outs=%v", outs)
+	}
+	p := outs[0].PayloadXML
+	if n := strings.Count(p, "<Row "); n != 3 || !strings.Contains(p, `Count="3"`) {
+		t.Fatalf("rows=%d payload=%s", n, p)
+	}
+
+	// The clip is logged once per games list version, with the matching count.
+	e.Handle(now, 0x9, "", page)
+	if n := strings.Count(logs.String(), "PageRes clipped"); n != 1 || !strings.Contains(logs.String(), "matching=5") {
+		t.Fatalf("clip logs=%s", logs.String())
+	}
+	logs.Reset()
+	host.ApplyHostData(0x6, `<HostData><HostData><New><Item ItemId="0" GName="other" Map="m" /></New></HostData></HostData>`)
+	search := Msg{Tag: "Page", Attrs: map[string]string{"Cx": "0x0", "Vid": "101", "PageNo": "0", "Num": "0", "Str": "g"}}
+	e.Handle(now, 0x9, "", search)
+	if !strings.Contains(logs.String(), "matching=5") {
+		t.Fatalf("search clip logs=%s", logs.String())
+	}
+
+	// Unset falls back to the default cap.
+	if d := NewEngine(EngineConfig{}, host, nil); d.maxPageRows != DefaultMaxPageRows {
+		t.Fatalf("default maxPageRows=%d", d.maxPageRows)
+	}
+}
+
+func TestEngine_Page_UnknownViewIsEmpty(t *testing.T) {
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	defer slog.SetDefault(prev)
+
+	host := state.NewHostStore()
+	host.ApplyHostData(0x1, `<HostData><HostData><New><Item ItemId="0" GName="g" Map="m" /></New></HostData></HostData>`)
+	e := NewEngine(EngineConfig{Port: 2300}, host, nil)
+
+	page := Msg{Tag: "Page", Attrs: map[string]string{"Cx": "0x7", "Vid": "999", "PageNo": "0", "Num": "0", "Str": ""}}
+	outs := e.Handle(time.Now().UTC(), 0x9, "", page)
+	if len(outs) != 1 || outs[0].Tag != "PageRes" {
+		t.Fatalf("outs=%v", outs)
+	}
+	want := `<PageRes HR="0x00000000" Cx="0x7" Vid="999" ViewId="999" PageNo="0" PageNumber="0" ` +
+		`VType="0" ViewType="0" VIdx="0" ViewIndex="0" VTotal="0" ViewTotal="0" Count="0" Num="0" Str="" />`
+	if outs[0].PayloadXML != want {
+		t.Fatalf("payload=%s\nwant   %s", outs[0].PayloadXML, want)
+	}
+	if !strings.Contains(logs.String(), `msg="Page for unknown view; sent empty PageRes" vid="\"999\""`) {
+		t.Fatalf("logs=%s", logs.String())
+	}
+
+	// A view configured in proto.views is not unknown.
+	logs.Reset()
+	e = NewEngine(EngineConfig{Port: 2300, Views: map[string][]string{"999": {"Rid"}}}, host, nil)
+	e.Handle(time.Now().UTC(), 0x9, "", page)
+	if logs.Len() != 0 {
+		t.Fatalf("configured view logged: %s", logs.String())
+	}
+}
+
+func TestEngine_Page_VersionOnlyWhenEnabled(t *testing.T) {
+	host := state.NewHostStore()
+	host.ApplyHostData(0x1, `<HostData><HostData><New><Item ItemId="0" GName="g" Map="m" /></New></HostData></HostData>`)
+	games := Msg{Tag: "Page", Attrs: map[string]string{"Cx": "0x7", "Vid": "101", "PageNo": "0", "Num": "0", "Str": ""}}
+	players := Msg{Tag: "Page", Attrs: map[string]string{"Cx": "0x8", "Vid": "501", "PageNo": "0", "Num": "0", "Str": ""}}
+
+	e := NewEngine(EngineConfig{Port: 2300}, host, nil)
+	if outs := e.Handle(time.Now().UTC(), 0x9, "", games); len(outs) != 1 || strings.Contains(outs[0].PayloadXML, "Ver=") {
+		t.Fatalf("default games page=%v", outs)
+	}
+
+	e = NewEngine(EngineConfig{Port: 2300, PageVersion: true}, host, nil)
+	want := fmt.Sprintf(`Ver="%d"`, host.Version())
+	if outs := e.Handle(time.Now().UTC(), 0x9, "", games); len(outs) != 1 || !strings.Contains(outs[0].PayloadXML, want) {
+		t.Fatalf("games page=%v want %s", outs, want)
+	}
+	if outs := e.Handle(time.Now().UTC(), 0x9, "", players); len(outs) != 1 || strings.Contains(outs[0].PayloadXML, "Ver=") {
+		t.Fatalf("players page=%v", outs)
+	}
+}
+
+func TestEngine_RegionColumnWhenRegionMapSet(t *testing.T) {
+	regions, err := state.ParseRegionMap([]string{"203.0.113.0/24=EU"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := state.NewHostStoreWithConfig(state.HostConfig{RegionMap: regions})
+	host.ApplyHostData(0x1, `<HostData><HostData><New><Item ItemId="0" GName="g" Map="m" /></New></HostData></HostData>`)
+	host.SetObservedRemoteIP(0x1, "203.0.113.9")
+	e := NewEngine(EngineConfig{Port: 2300}, host, nil)
+
+	hdr := e.Handle(time.Now().UTC(), 0x9, "", Msg{Tag: "HdrRow", Attrs: map[string]string{"Cx": "0x1", "Vid": "101"}})
+	if len(hdr) != 1 || !strings.Contains(hdr[0].PayloadXML, `H16="Region"`) {
+		t.Fatalf("hdr=%v", hdr)
+	}
+	page := e.Handle(time.Now().UTC(), 0x9, "", Msg{Tag: "Page", Attrs: map[string]string{"Cx": "0x2", "Vid": "101", "PageNo": "0", "Num": "0", "Str": ""}})
+	if len(page) != 1 || !strings.Contains(page[0].PayloadXML, `InGame="0" Region="EU"`) {
+		t.Fatalf("page=%v", page)
+	}
+
+	players := e.Handle(time.Now().UTC(), 0x9, "", Msg{Tag: "HdrRow", Attrs: map[string]string{"Cx": "0x3", "Vid": "501"}})
+	if len(players) != 1 || strings.Contains(players[0].PayloadXML, "Region") {
+		t.Fatalf("players hdr=%v", players)
+	}
+}
+
+func TestEngine_Page_StrFiltersGamesByName(t *testing.T) {
+	host := state.NewHostStore()
+	for i, name := range []string{"Arena Night", "Desert Run", "ARENA pros"} {
+		host.ApplyHostData(uint32(i+1), `<HostData><HostData><New><Item ItemId="0" GName="`+name+`" Map="m" /></New></HostData></HostData>`)
+	}
+	e := NewEngine(EngineConfig{Port: 2300}, host, nil)
+	page := func(str string) string {
+		t.Helper()
+		outs := e.Handle(time.Now().UTC(), 0x9, "", Msg{Tag: "Page", Attrs: map[string]string{"Cx": "0x7", "Vid": "101", "PageNo": "0", "Num": "0", "Str": str}})
+		if len(outs) != 1 || outs[0].Tag != "PageRes" {
+			t.Fatalf("Str=%q outs=%v", str, outs)
+		}
+		return outs[0].PayloadXML
+	}
+
+	got := page("arena")
+	if !strings.Contains(got, `Count="2" Num="0" Str="arena"`) ||
+		!strings.Contains(got, `GName="Arena Night"`) || !strings.Contains(got, `GName="ARENA pros"`) || strings.Contains(got, "Desert") {
+		t.Fatalf("search page=%s", got)
+	}
+	if got := page(""); !strings.Contains(got, `Count="3" Num="0" Str=""`) {
+		t.Fatalf("unfiltered page=%s", got)
+	}
+	if got := page("nomatch"); !strings.Contains(got, `Count="0" Num="0" Str="nomatch"`) || strings.Contains(got, "<Row") {
+		t.Fatalf("no-match page=%s", got)
+	}
+}
+
+func TestEngine_Page_SameLANJoinerGetsHostLANAddress(t *testing.T) {
+	host := state.NewHostStore()
+	players := state.NewPlayerStore()
+	e := NewEngine(EngineConfig{Port: 2300}, host, players)
+	now := time.Now().UTC()
+
+	// Host and joiner share the public address 203.0.113.50.
+	players.Upsert(0x1, now)
+	e.Handle(now, 0x1, "203.0.113.50", Msg{
+		Tag:   "HostData",
+		Attrs: map[string]string{"Cx": "0x0"},
+		Raw:   `<HostData><HostData><New><Item ItemId="0" GName="LAN Game" Map="m" Ip2="192.168.1.20" /></New></HostData></HostData>`,
+	})
+	players.Upsert(0x2, now)
+	e.Handle(now, 0x2, "203.0.113.50", Msg{Tag: "Connect", Attrs: map[string]string{"Cx": "0x1", "IpAddr": "192.168.1.77"}})
+
+	page := Msg{Tag: "Page", Attrs: map[string]string{"Cx": "0x0", "Vid": "101", "PageNo": "0", "Num": "0", "Str": ""}}
+	outs := e.Handle(now, 0x2, "203.0.113.50", page)
+	if len(outs) != 1 || !strings.Contains(outs[0].PayloadXML, `IpAddr="192.168.1.20" Ip2="203.0.113.50"`) {
+		t.Fatalf("same-LAN joiner payload=%v", outs)
+	}
+
+	// A joiner elsewhere on the internet still gets the public address.
+	players.Upsert(0x3, now)
+	outs = e.Handle(now, 0x3, "198.51.100.9", page)
+	if len(outs) != 1 || !strings.Contains(outs[0].PayloadXML, `IpAddr="203.0.113.50"`) {
+		t.Fatalf("remote joiner payload=%v", outs)
+	}
+}
+
+func TestEngine_SelfCheck(t *testing.T) {
+	players := state.NewPlayerStore()
+	e := NewEngine(EngineConfig{Port: 2300, AdvertiseIP: "203.0.113.7"}, state.NewHostStore(), players)
+	if err := e.SelfCheck(); err != nil {
+		t.Fatalf("SelfCheck: %v", err)
+	}
+	// Without a configured address ConInfoRes reports the client's own view.
+	if err := NewEngine(EngineConfig{Port: 2300}, nil, nil).SelfCheck(); err != nil {
+		t.Fatalf("SelfCheck without advertise_ip: %v", err)
+	}
+	if n := players.Count(); n != 0 {
+		t.Fatalf("self-check left %d players behind", n)
+	}
+}
+
+func TestEngine_SelfCheckRejectsMisconfiguredEngine(t *testing.T) {
+	for name, cfg := range map[string]EngineConfig{
+		"no port":        {},
+		"port too large": {Port: 70000},
+		"bad advertise":  {Port: 2300, AdvertiseIP: `1.2.3.4" Port="1`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := NewEngine(cfg, nil, nil).SelfCheck(); err == nil {
+				t.Fatal("SelfCheck passed for a misconfigured engine")
+			}
+		})
+	}
+}
+
+func TestEngine_FallbackEchoesAttrsInWireOrder(t *testing.T) {
+	in, ok := Parse(`<Ping Zeta="1" Cx="0x7" Alpha="2" Mid="3" />`)
+	if !ok {
+		t.Fatal("Parse ok=false")
+	}
+	var keys []string
+	for _, a := range in.Order {
+		keys = append(keys, a.Key)
+	}
+	if got := strings.Join(keys, ","); got != "Zeta,Cx,Alpha,Mid" {
+		t.Fatalf("Order=%s", got)
+	}
+
+	// A synthesized attribute (not on the wire) sorts after the parsed ones.
+	in.Attrs["Extra"] = "x"
+	outs := NewEngine(EngineConfig{Port: 2300}, nil, nil).Handle(time.Now().UTC(), 0, "", in)
+	if len(outs) != 1 {
+		t.Fatalf("outs=%v", outs)
+	}
+	want := `<PingRes HR="0x00000000" Zeta="1" Cx="0x7" Alpha="2" Mid="3" Extra="x" />`
+	if outs[0].PayloadXML != want {
+		t.Fatalf("payload=%s\nwant   %s", outs[0].PayloadXML, want)
+	}
+}
+
+func TestEngine_MOTDFollowsConnectBundle(t *testing.T) {
+	connect := Msg{Tag: "Connect", Attrs: map[string]string{"Cx": "0x1"}}
+
+	outs := NewEngine(EngineConfig{Port: 2300}, nil, nil).Handle(time.Now().UTC(), 0, "", connect)
+	if len(outs) != 3 {
+		t.Fatalf("without MOTD outs=%d want 3", len(outs))
+	}
+
+	eng := NewEngine(EngineConfig{Port: 2300, MOTD: `Welcome <back> & "enjoy"`}, nil, nil)
+	outs = eng.Handle(time.Now().UTC(), 0, "", connect)
+	var tags []string
+	for _, o := range outs {
+		tags = append(tags, o.Tag)
+	}
+	if got := strings.Join(tags, ","); got != "ConnectRes,ConInfoRes,ConnectEv,Msg" {
+		t.Fatalf("tags=%s", got)
+	}
+	if want := `<Msg Text="Welcome &lt;back&gt; &amp; &quot;enjoy&quot;" />`; outs[3].PayloadXML != want {
+		t.Fatalf("motd=%s\nwant %s", outs[3].PayloadXML, want)
+	}
+	if err := eng.SelfCheck(); err != nil {
+		t.Fatalf("SelfCheck with MOTD: %v", err)
+	}
+}
+
+func TestEngine_ConnectRejectedOverCapacity(t *testing.T) {
+	players := state.NewPlayerStore()
+	now := time.Now().UTC()
+	players.Upsert(0x1, now)
+	players.Upsert(0x2, now)
+	connect := Msg{Tag: "Connect", Attrs: map[string]string{"Cx": "0x1"}}
+
+	// At capacity (the connecting player is counted) the bundle still goes out.
+	eng := NewEngine(EngineConfig{Port: 2300, MaxPlayers: 2, RejectWhenFull: true}, nil, players)
+	if outs := eng.Handle(now, 0x2, "", connect); len(outs) != 3 {
+		t.Fatalf("at capacity outs=%d want the 3-message bundle", len(outs))
+	}
+
+	players.Upsert(0x3, now)
+	outs := eng.Handle(now, 0x3, "", connect)
+	if len(outs) != 1 || outs[0].Tag != "ConnectRes" {
+		t.Fatalf("over capacity outs=%v", outs)
+	}
+	if want := `<ConnectRes HR="` + HRTooBusy + `" Cx="0x1" />`; outs[0].PayloadXML != want {
+		t.Fatalf("payload=%s\nwant   %s", outs[0].PayloadXML, want)
+	}
+	// The rejected player no longer counts, so it cannot keep the server full.
+	if n := players.Count(); n != 2 || !players.IsEvicted(0x3) {
+		t.Fatalf("after reject Count=%d evicted=%v, want 2 and evicted", n, players.IsEvicted(0x3))
+	}
+	// A player already let in that repeats Connect while the server is over
+	// capacity keeps its slot.
+	players.Upsert(0x5, now)
+	if outs := eng.Handle(now, 0x2, "", connect); len(outs) != 3 || players.IsEvicted(0x2) {
+		t.Fatalf("repeat Connect outs=%d evicted=%v, want the bundle and not evicted", len(outs), players.IsEvicted(0x2))
+	}
+	players.Remove(0x5)
+	players.Remove(0x2)
+	players.Upsert(0x4, now)
+	if outs := eng.Handle(now, 0x4, "", connect); len(outs) != 3 {
+		t.Fatalf("after a slot freed outs=%d want the 3-message bundle", len(outs))
+	}
+
+	// Without reject_when_full, max_players only feeds the News page.
+	soft := NewEngine(EngineConfig{Port: 2300, MaxPlayers: 2}, nil, players)
+	if outs := soft.Handle(now, 0x3, "", connect); len(outs) != 3 {
+		t.Fatalf("reject_when_full off: outs=%d want 3", len(outs))
+	}
+}
+
+func TestEngine_ConInfoResIP(t *testing.T) {
+	connect := Msg{Tag: "Connect", Attrs: map[string]string{"Cx": "0x1"}}
+	for name, tc := range map[string]struct {
+		cfg    EngineConfig
+		remote string
+		want   string
+	}{
+		"con_info_ip wins": {EngineConfig{Port: 2300, AdvertiseIP: "198.51.100.1", ConInfoIP: "203.0.113.9"}, "192.0.2.5", "203.0.113.9"},
+		"advertise_ip":     {EngineConfig{Port: 2300, AdvertiseIP: "198.51.100.1"}, "192.0.2.5", "198.51.100.1"},
+		"observed remote":  {EngineConfig{Port: 2300}, "192.0.2.5", "192.0.2.5"},
+		"nothing to go on": {EngineConfig{Port: 2300}, "", "127.0.0.1"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			outs := NewEngine(tc.cfg, nil, nil).Handle(time.Now().UTC(), 0, tc.remote, connect)
+			if len(outs) != 3 || !strings.Contains(outs[1].PayloadXML, `IpAddr="`+tc.want+`"`) {
+				t.Fatalf("ConInfoRes=%v, want IpAddr=%s", outs, tc.want)
+			}
+		})
+	}
+}
+
+func TestEngine_StatsCountsTags(t *testing.T) {
+	e := NewEngine(EngineConfig{Port: 2300}, state.NewHostStore(), state.NewPlayerStore())
+	if err := e.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	for _, tag := range []string{"Connect", "HdrRow", "HdrRow", "Page", "RowPg", "Ping", "Bogus", "Bogus"} {
+		e.Handle(now, 0x1, "", Msg{Tag: tag, Attrs: map[string]string{"Cx": "0x1"}})
+	}
+	want := map[string]uint64{"Connect": 1, "HdrRow": 2, "Page": 1, "RowPg": 1, "HostData": 0, "SetLoc": 0, "Join": 0, "fallback": 3}
+	got := e.Stats().Tags
+	if len(got) != len(want) {
+		t.Fatalf("Tags=%v, want %v", got, want)
+	}
+	for tag, n := range want {
+		if got[tag] != n {
+			t.Fatalf("Tags[%s]=%d want %d (all: %v)", tag, got[tag], n, got)
+		}
+	}
+}
+
+func TestEngine_HdrRowUsesConfiguredViews(t *testing.T) {
+	e := NewEngine(EngineConfig{Port: 2300, Views: map[string][]string{"101": {"Rid", "GName", "Ping"}}}, nil, nil)
+	hdr := func(vid string) string {
+		outs := e.Handle(time.Now().UTC(), 0, "", Msg{Tag: "HdrRow", Attrs: map[string]string{"Cx": "0x65", "Vid": vid}})
+		if len(outs) != 1 || outs[0].Tag != "HdrRowRes" {
+			t.Fatalf("outs=%v", outs)
+		}
+		return outs[0].PayloadXML
+	}
+	if p := hdr("101"); !strings.Contains(p, `<Hdrs H0="Rid" H1="GName" H2="Ping" />`) {
+		t.Fatalf("configured view not used: %s", p)
+	}
+	if p := hdr("501"); !strings.Contains(p, `<Hdrs H0="User" H1="PTeam" H2="PChar" H3="PLev" />`) {
+		t.Fatalf("unconfigured view lost its built-in tokens: %s", p)
+	}
+}
+
+func TestEngine_JoinReturnsHostConnectionDetails(t *testing.T) {
+	host := state.NewHostStore()
+	e := NewEngine(EngineConfig{Port: 2300}, host, nil)
+	seed := func(dpnid uint32, ip, name, item string) string {
+		e.Handle(time.Now().UTC(), dpnid, ip, Msg{Tag: "HostData", Raw: `<HostData><HostData><New>` + item + `</New></HostData></HostData>`})
+		for _, r := range host.GamesRows(0, nil) {
+			if r.Items["GName"] == name {
+				return r.Rid
+			}
+		}
+		t.Fatalf("no row for %s", name)
+		return ""
+	}
+	open := seed(0x1, "203.0.113.5", "open", `<Item ItemId="0" GName="open" Map="m" NumP="1" MaxP="8" Ip2="10.0.0.4" Port="6080" />`)
+	full := seed(0x2, "198.51.100.7", "full", `<Item ItemId="0" GName="full" Map="m" NumP="4" MaxP="4" />`)
+
+	join := func(rid string) string {
+		outs := e.Handle(time.Now().UTC(), 0x9, "", Msg{Tag: "Join", Attrs: map[string]string{"Cx": "0x44", "Rid": rid}})
+		if len(outs) != 1 || outs[0].Tag != "JoinRes" {
+			t.Fatalf("outs=%v", outs)
+		}
+		return outs[0].PayloadXML
+	}
+	if p, want := join(open), `<JoinRes HR="0x00000000" Cx="0x44" Rid="`+open+`" IpAddr="203.0.113.5" Ip2="203.0.113.5" Port="6080" />`; p != want {
+		t.Fatalf("hit:\n got %s\nwant %s", p, want)
+	}
+	if p := join("999"); p != `<JoinRes HR="`+HRNotFound+`" Cx="0x44" Rid="999" />` {
+		t.Fatalf("miss: %s", p)
+	}
+	if p := join(full); !strings.Contains(p, `HR="`+HRTooBusy+`"`) || strings.Contains(p, "IpAddr") {
+		t.Fatalf("full: %s", p)
+	}
+	if p := join(""); !strings.Contains(p, `HR="`+HRBadRequest+`"`) {
+		t.Fatalf("no rid: %s", p)
+	}
+
+	// Without a host store, Join and RowPg cannot answer at all.
+	bare := NewEngine(EngineConfig{Port: 2300}, nil, nil)
+	for _, tag := range []string{"Join", "RowPg"} {
+		outs := bare.Handle(time.Now().UTC(), 0x9, "", Msg{Tag: tag, Attrs: map[string]string{"Cx": "0x44", "Rid": open}})
+		if len(outs) != 1 || !strings.Contains(outs[0].PayloadXML, `HR="`+HRFail+`"`) {
+			t.Fatalf("%s without host store: %v", tag, outs)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package proto
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// selfCheckCx is the context id of the synthetic Connect; every reply must echo it.
+const selfCheckCx = "0x5e1f"
+
+// selfCheckRemote is the synthetic Connect's observed client address
+// (TEST-NET-1), which ConInfoRes reports when no address is configured.
+const selfCheckRemote = "192.0.2.1"
+
+// connectBundle is the reply sequence a client needs to get past
+// "Connecting to ZoneMatch Server...".
+var connectBundle = []string{"ConnectRes", "ConInfoRes", "ConnectEv"}
+
+// SelfCheck runs a synthetic Connect through the engine and verifies the reply is
+// the three-message connect bundle, each payload well formed. It runs against a
+// fresh engine built from p's config without stores, counters or MOTD, so it
+// leaves no state behind.
+func (p *Engine) SelfCheck() error {
+	cfg := p.cfg
+	cfg.MOTD = ""
+	probe := NewEngine(cfg, nil, nil)
+	probe.tags = nil
+
+	outs := probe.Handle(time.Now().UTC(), 0, selfCheckRemote, Msg{
+		Tag:   "Connect",
+		Attrs: map[string]string{"Cx": selfCheckCx, "ProtoVer": "3.3"},
+	})
+	if len(outs) != len(connectBundle) {
+		return fmt.Errorf("connect self-check: got %d replies, want %d", len(outs), len(connectBundle))
+	}
+	for i, want := range connectBundle {
+		out := outs[i]
+		if out.Tag != want {
+			return fmt.Errorf("connect self-check: reply %d is %s, want %s", i, out.Tag, want)
+		}
+		m, ok := Parse(out.PayloadXML)
+		if !ok || m.Tag != want {
+			return fmt.Errorf("connect self-check: %s payload does not parse: %q", want, out.PayloadXML)
+		}
+		if hr := m.Attrs["HR"]; hr != HROK {
+			return fmt.Errorf("connect self-check: %s HR=%q", want, hr)
+		}
+		if cx := m.Attrs["Cx"]; cx != selfCheckCx {
+			return fmt.Errorf("connect self-check: %s Cx=%q, want %s", want, cx, selfCheckCx)
+		}
+		if want == "ConInfoRes" {
+			want := p.conInfoIP
+			if want == "" {
+				want = selfCheckRemote
+			}
+			if err := checkConInfo(m, want); err != nil {
+				return fmt.Errorf("connect self-check: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkConInfo verifies ConInfoRes points clients at a usable address: the
+// configured address, round-tripped intact, and a port they can dial.
+func checkConInfo(m Msg, wantIP string) error {
+	if ip := m.Attrs["IpAddr"]; ip == "" || ip != wantIP {
+		return fmt.Errorf("ConInfoRes IpAddr=%q, want %q", ip, wantIP)
+	}
+	port, err := strconv.Atoi(m.Attrs["Port"])
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("ConInfoRes Port=%q is not a usable port", m.Attrs["Port"])
+	}
+	return nil
+}
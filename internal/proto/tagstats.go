@@ -0,0 +1,35 @@
+package proto
+
+import "sync/atomic"
+
+// handledTags are the inbound tags Handle dispatches to a dedicated handler; each
+// gets its own counter. Everything else is counted under fallbackBucket so a
+// misbehaving client cannot grow the stats map without bound.
+var handledTags = [...]string{"Connect", "HdrRow", "Page", "RowPg", "HostData", "SetLoc", "Join"}
+
+const fallbackBucket = "fallback"
+
+// tagCounters counts handled messages by inbound tag (see Stats.Tags).
+type tagCounters struct {
+	known    [len(handledTags)]atomic.Uint64
+	fallback atomic.Uint64
+}
+
+func (c *tagCounters) inc(tag string) {
+	for i, t := range handledTags {
+		if t == tag {
+			c.known[i].Add(1)
+			return
+		}
+	}
+	c.fallback.Add(1)
+}
+
+func (c *tagCounters) snapshot() map[string]uint64 {
+	out := make(map[string]uint64, len(handledTags)+1)
+	for i, t := range handledTags {
+		out[t] = c.known[i].Load()
+	}
+	out[fallbackBucket] = c.fallback.Load()
+	return out
+}
@@ -1,36 +1,93 @@
 package proto
 
-import "strings"
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
 
 type Msg struct {
 	Tag   string
 	Attrs map[string]string
 
+	// Order lists the attributes in the order they appeared on the wire. Attrs stays
+	// the lookup path; Order is for replies that echo attributes back faithfully.
+	Order []Attr
+
+	// Dupes lists keys that appeared more than once (each key once, in first-repeat
+	// order). The last value wins in Attrs and Order; callers may log these as
+	// suspicious.
+	Dupes []string
+
 	// Raw is the full inbound payload as text (NULs trimmed), not just the first element.
 	// We keep this so handlers can parse nested tags (ex HostData).
 	Raw string
 }
 
+// Attr is one key/value pair from an element's start tag.
+type Attr struct {
+	Key   string
+	Value string
+}
+
+// ParseOptions controls ParseWith. The zero value is Parse.
+type ParseOptions struct {
+	// Strict fails the whole message on a malformed attribute region (an
+	// unquoted value, a stray token, an unterminated quote) instead of keeping
+	// what came before it (proto.strict_parse).
+	Strict bool
+
+	// MaxAttrs and MaxAttrLen bound the attribute count and the length of any one
+	// key or value (proto.max_attrs, proto.max_attr_len); <= 0 is unlimited.
+	MaxAttrs   int
+	MaxAttrLen int
+}
+
+var (
+	// ErrMalformed is returned by ParseWith for input that is not an element.
+	ErrMalformed = errors.New("proto: malformed message")
+	// ErrAttrLimit is returned by ParseWith when a message exceeds
+	// ParseOptions.MaxAttrs or MaxAttrLen.
+	ErrAttrLimit = errors.New("proto: attribute limit exceeded")
+)
+
+// Parse reads the first element of s leniently: attribute parsing stops at the
+// first malformed attribute and keeps what came before it.
 func Parse(s string) (Msg, bool) {
+	m, err := ParseWith(s, ParseOptions{})
+	return m, err == nil
+}
+
+// ParseStrict is Parse with ParseOptions.Strict.
+func ParseStrict(s string) (Msg, bool) {
+	m, err := ParseWith(s, ParseOptions{Strict: true})
+	return m, err == nil
+}
+
+// ParseWith reads the first element of s per opts. Errors wrap ErrMalformed or
+// ErrAttrLimit.
+func ParseWith(s string, opts ParseOptions) (Msg, error) {
+	strict := opts.Strict
 	s = strings.TrimSpace(s)
 	if s == "" || s[0] != '<' {
-		return Msg{}, false
+		return Msg{}, ErrMalformed
 	}
 	// Drop any trailing NULs (client uses NUL termination).
 	s = strings.TrimRight(s, "\x00")
 
 	end := strings.IndexByte(s, '>')
 	if end < 0 {
-		return Msg{}, false
+		return Msg{}, ErrMalformed
 	}
 	head := strings.TrimSpace(s[1:end])
 	if head == "" {
-		return Msg{}, false
+		return Msg{}, ErrMalformed
 	}
 	head = strings.TrimSuffix(head, "/")
 	head = strings.TrimSpace(head)
 	if head == "" {
-		return Msg{}, false
+		return Msg{}, ErrMalformed
 	}
 
 	tag := head
@@ -41,37 +98,79 @@ func Parse(s string) (Msg, bool) {
 		head = ""
 	}
 	if tag == "" {
-		return Msg{}, false
+		return Msg{}, ErrMalformed
 	}
 
 	attrs := map[string]string{}
+	var order []Attr
+	var dupes []string
 	rest := strings.TrimSpace(head)
 	for rest != "" {
 		eq := strings.Index(rest, "=\"")
 		if eq < 0 {
+			if strict {
+				return Msg{}, ErrMalformed
+			}
 			break
 		}
 		key := strings.TrimSpace(rest[:eq])
+		if strict && !validAttrKey(key) {
+			return Msg{}, ErrMalformed
+		}
 		rest = rest[eq+2:]
 		q := strings.IndexByte(rest, '"')
 		if q < 0 {
+			if strict {
+				return Msg{}, ErrMalformed
+			}
 			break
 		}
 		val := rest[:q]
 		rest = strings.TrimSpace(rest[q+1:])
+		if opts.MaxAttrLen > 0 && (len(key) > opts.MaxAttrLen || len(val) > opts.MaxAttrLen) {
+			return Msg{}, fmt.Errorf("%w: attribute over %d bytes", ErrAttrLimit, opts.MaxAttrLen)
+		}
 		if key != "" {
+			if _, dup := attrs[key]; dup {
+				if !slices.Contains(dupes, key) {
+					dupes = append(dupes, key)
+				}
+				// Last value wins, as in the map; keep the first position.
+				for i := range order {
+					if order[i].Key == key {
+						order[i].Value = val
+					}
+				}
+			} else {
+				if opts.MaxAttrs > 0 && len(order) == opts.MaxAttrs {
+					return Msg{}, fmt.Errorf("%w: over %d attributes", ErrAttrLimit, opts.MaxAttrs)
+				}
+				order = append(order, Attr{Key: key, Value: val})
+			}
 			attrs[key] = val
 		}
 	}
-	return Msg{Tag: tag, Attrs: attrs, Raw: s}, true
+	return Msg{Tag: tag, Attrs: attrs, Order: order, Dupes: dupes, Raw: s}, nil
+}
+
+// validAttrKey reports whether key is a single bare name. Leniently, `A=1 B="2"`
+// yields the key "A=1 B"; strict mode rejects it.
+func validAttrKey(key string) bool {
+	return key != "" && !strings.ContainsAny(key, " \t\r\n=\"<>/")
 }
 
 func MakeZText(s string) []byte {
+	return MakeZTextInto(nil, s)
+}
+
+// MakeZTextInto is MakeZText writing into dst's storage (dst[:0]), so callers can
+// reuse one buffer across messages.
+func MakeZTextInto(dst []byte, s string) []byte {
 	// NUL-terminated UTF-8 (matches observed inbound messages).
 	//
 	// Important: do NOT append '\n'. Protocol frames are
 	// `... />\0` (no newline). Adding a newline can change parsing behavior.
 	s = strings.TrimRight(s, "\r\n")
-	b := []byte(s)
+	b := append(dst[:0], s...)
 	return append(b, 0)
 }
@@ -1,6 +1,11 @@
 package proto
 
-import "testing"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
 
 func TestParse_TrimsNULAndParsesAttrs(t *testing.T) {
 	in := "<Connect Cx=\"0x123\" ProtoVer=\"3.3\" />\x00\x00"
@@ -22,6 +27,26 @@ func TestParse_TrimsNULAndParsesAttrs(t *testing.T) {
 	}
 }
 
+func TestParse_DuplicateAttrLastWinsAndIsFlagged(t *testing.T) {
+	m, ok := Parse(`<HostData Cx="0x0" Flags="1" Cx="0x1" Cx="0x2" />`)
+	if !ok {
+		t.Fatalf("Parse ok=false")
+	}
+	if m.Attrs["Cx"] != "0x2" {
+		t.Fatalf("Cx=%q want last value 0x2", m.Attrs["Cx"])
+	}
+	if len(m.Dupes) != 1 || m.Dupes[0] != "Cx" {
+		t.Fatalf("Dupes=%v want [Cx]", m.Dupes)
+	}
+	if len(m.Order) != 2 || m.Order[0] != (Attr{"Cx", "0x2"}) {
+		t.Fatalf("Order=%v", m.Order)
+	}
+
+	if m, _ := Parse(`<HostData Cx="0x0" />`); m.Dupes != nil {
+		t.Fatalf("Dupes=%v for a clean message", m.Dupes)
+	}
+}
+
 func TestMakeZText_AppendsNULAndTrimsNewlines(t *testing.T) {
 	b := MakeZText("<X />\r\n")
 	if len(b) == 0 || b[len(b)-1] != 0 {
@@ -32,3 +57,68 @@ func TestMakeZText_AppendsNULAndTrimsNewlines(t *testing.T) {
 	}
 }
 
+func TestParse_TrailingUnquotedToken(t *testing.T) {
+	in := `<HostData Cx="0x1" Flags=3 Name="x" />`
+
+	m, ok := Parse(in)
+	if !ok {
+		t.Fatalf("lenient Parse ok=false")
+	}
+	// Today's behavior: the unquoted value folds into the next key.
+	if m.Attrs["Cx"] != "0x1" || m.Attrs["Flags=3 Name"] != "x" || len(m.Attrs) != 2 {
+		t.Fatalf("lenient attrs=%v", m.Attrs)
+	}
+	if _, ok := ParseStrict(in); ok {
+		t.Fatalf("strict ParseStrict ok=true for unquoted attribute")
+	}
+
+	tail := `<HostData Cx="0x1" Junk />`
+	if m, ok := Parse(tail); !ok || m.Attrs["Cx"] != "0x1" {
+		t.Fatalf("lenient trailing token ok=%v attrs=%v", ok, m.Attrs)
+	}
+	if _, ok := ParseStrict(tail); ok {
+		t.Fatalf("strict ParseStrict ok=true for trailing token")
+	}
+
+	if _, ok := ParseStrict(`<HostData Cx="0x1`); ok {
+		t.Fatalf("strict ParseStrict ok=true for unterminated quote")
+	}
+	// The element closes, but inside the open quote.
+	if _, ok := ParseStrict(`<X A="b >`); ok {
+		t.Fatalf("strict ParseStrict ok=true for unterminated quote before >")
+	}
+	if m, ok := ParseStrict(`<HostData Cx="0x1" Flags="3" />`); !ok || len(m.Order) != 2 {
+		t.Fatalf("strict well-formed ok=%v order=%v", ok, m.Order)
+	}
+}
+
+func TestParseWith_AttrLimits(t *testing.T) {
+	opts := ParseOptions{MaxAttrs: 4, MaxAttrLen: 16}
+
+	var many strings.Builder
+	many.WriteString("<Page")
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(&many, ` A%d="x"`, i)
+	}
+	many.WriteString(" />\x00")
+	if _, err := ParseWith(many.String(), opts); !errors.Is(err, ErrAttrLimit) {
+		t.Fatalf("5 attrs err=%v want ErrAttrLimit", err)
+	}
+
+	long := `<Page Cx="0x1" Str="` + strings.Repeat("a", 17) + `" />`
+	if _, err := ParseWith(long, opts); !errors.Is(err, ErrAttrLimit) {
+		t.Fatalf("17-byte value err=%v want ErrAttrLimit", err)
+	}
+
+	// At the limits, and repeats of a key, still parse; unlimited ignores both.
+	ok := `<Page Cx="0x1" Vid="101" PageNo="0" Str="` + strings.Repeat("a", 16) + `" Cx="0x2" />`
+	if m, err := ParseWith(ok, opts); err != nil || len(m.Order) != 4 || m.Attrs["Cx"] != "0x2" {
+		t.Fatalf("at limits: msg=%+v err=%v", m, err)
+	}
+	if _, ok := Parse(many.String()); !ok {
+		t.Fatalf("Parse applied a limit")
+	}
+	if _, err := ParseWith("hello", opts); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("non-element err=%v want ErrMalformed", err)
+	}
+}
@@ -1,12 +1,16 @@
 package state
 
 import (
+	"errors"
+	"fmt"
 	"net"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // GameRow is the "PageRes -> Row" representation:
@@ -15,23 +19,194 @@ import (
 type GameRow struct {
 	Rid   string
 	Items map[string]string
+
+	// Seeded marks a synthetic game from LoadSeed.
+	Seeded bool
 }
 
+// Browse sort modes for GamesRows.
+const (
+	SortDPNID   = "dpnid"   // connect order (default)
+	SortQuality = "quality" // most joinable first, see qualityScore
+)
+
+// HostConfig controls optional HostStore behavior. The zero value keeps the defaults.
+type HostConfig struct {
+	// Sort selects the GamesRows order: SortDPNID (or empty) or SortQuality.
+	Sort string
+
+	// Quality weights the SortQuality score.
+	Quality QualityWeights
+
+	// AllowPrivateIPs permits private advertised IPs as the browse secondary even
+	// when a public observed IP exists (mixed LAN/internet deployments).
+	AllowPrivateIPs bool
+
+	// A visible host is "stale" when its last HostData is older than StaleFactor
+	// times its typical update interval (and at least StaleMin). Zero values use
+	// defaultStaleFactor/defaultStaleMin.
+	StaleFactor float64
+	StaleMin    time.Duration
+
+	// ActiveWindow is how recent a host's last update must be to count as an
+	// active game (see ActiveGamesCount). Zero uses defaultActiveWindow.
+	ActiveWindow time.Duration
+
+	// RidBase is the first rid handed out (state.rid_base). Zero means 1. Rids
+	// wrap back to 1 below INT_MAX.
+	RidBase uint32
+
+	// IgnoreObservedIP stops trusting the transport-reported host address (it is
+	// a proxy or relay, not the host) and browses the host's advertised IPs,
+	// public ones first (state.trust_observed_ip: false). Same-LAN matching, which
+	// compares observed addresses, is off too.
+	IgnoreObservedIP bool
+
+	// AllowedGameV lists the server-item GameV values a host may advertise
+	// (host.allowed_gamev). A host advertising any other GameV is kept out of
+	// browse until it sends an allowed one. Empty accepts any GameV.
+	AllowedGameV []string
+
+	// MaxAttrs and MaxAttrLen cap each HostData Item's attribute count and the
+	// length of any one key or value (proto.max_attrs, proto.max_attr_len). A
+	// payload with an Item over them is not applied. <= 0 is unlimited.
+	MaxAttrs   int
+	MaxAttrLen int
+
+	// RegionMap tags hosts with a region from their observed IP (state.region_map,
+	// see ParseRegionMap); the tag is the Region browse column. Unused when
+	// IgnoreObservedIP is set, since the observed IP is then the relay's.
+	RegionMap []RegionRange
+}
+
+// ErrGameVNotAllowed is returned (wrapped in a GameVError) by ApplyHostData for a
+// GameV outside HostConfig.AllowedGameV.
+var ErrGameVNotAllowed = errors.New("state: GameV not allowed")
+
+// GameVError reports the rejected GameV, which is host-controlled text.
+type GameVError struct {
+	GameV string
+}
+
+func (e *GameVError) Error() string {
+	return fmt.Sprintf("%v: %q", ErrGameVNotAllowed, e.GameV)
+}
+
+func (e *GameVError) Unwrap() error { return ErrGameVNotAllowed }
+
+// ErrAttrLimit is returned by ApplyHostData for a payload with an Item over
+// HostConfig.MaxAttrs or MaxAttrLen; nothing from it is applied.
+var ErrAttrLimit = errors.New("state: HostData item over attribute limits")
+
+const (
+	defaultStaleFactor = 3
+	defaultStaleMin    = 30 * time.Second
+
+	defaultActiveWindow = 10 * time.Minute
+
+	// staleMinSamples is how many update gaps a host needs before it has a
+	// "typical" interval worth comparing against.
+	staleMinSamples = 2
+)
+
+// QualityWeights are added to a game's score for each property it has.
+type QualityWeights struct {
+	HasPlayers float64
+	NotFull    float64
+	Recent     float64
+
+	// NoPassword is off (0) by default: no capture has confirmed which HostData
+	// field marks a passworded game, so hostPassworded only guesses at it.
+	NoPassword float64
+
+	// RecentWindow is how fresh lastUpdate must be to count as Recent.
+	RecentWindow time.Duration
+}
+
+// DefaultQualityWeights favors games that can actually be joined. The
+// unconfirmed password signal is left out (see NoPassword).
+func DefaultQualityWeights() QualityWeights {
+	return QualityWeights{
+		HasPlayers:   2,
+		NotFull:      4,
+		Recent:       1,
+		NoPassword:   0,
+		RecentWindow: 2 * time.Minute,
+	}
+}
+
+// hostKey keys a host session: a real session's DPNID, or a value above the
+// 32-bit DPNID space for a seeded one (see seedKeyBase), so the two can never
+// collide.
+type hostKey uint64
+
 type HostStore struct {
 	mu    sync.Mutex
-	hosts map[uint32]*hostSession
+	cfg   HostConfig
+	hosts map[hostKey]*hostSession
+	now   func() time.Time
+
+	// byRid maps a decimal rid to the session holding it, so rid lookups (details,
+	// join, admin removal) don't scan hosts. Entries are added when a rid is
+	// assigned and removed with the session; see hostByRidLocked.
+	byRid map[string]hostKey
+
+	// pending holds SetLoc/observed-IP state for DPNIDs that have not sent HostData
+	// yet. Browsers can send SetLoc too, so a session (and rid) is only created once
+	// HostData arrives. Entries go on disconnect (ForgetPending) and otherwise
+	// expire after pendingHostTTL; pendingSweptAt is when the map was last swept.
+	pending        map[uint32]pendingHost
+	pendingSweptAt time.Time
 
 	// nextRid is a server-assigned, UI-friendly row id (fits in signed 32-bit).
 	// Do not use DPNID directly: it is a uint32 and can exceed INT_MAX, which the client
 	// parses into a signed int and will clamp/normalize (breaking Join).
 	nextRid uint32
+
+	// reserveRids, when set, persists rid high-water marks that rids are handed
+	// out below (see SetRidReservation). reserving is set while one is being
+	// written; after a failure none is tried again before reserveRetryAt.
+	reserveRids    func(HostSnapshot) error
+	ridBlock       uint32
+	reservedRid    uint32
+	reserving      bool
+	reserveRetryAt time.Time
+
+	// ridsAssigned counts games that became visible this run (one per rid handed out).
+	ridsAssigned int
+
+	// version counts changes to what browse shows (see Version).
+	version uint64
+
+	// seeded counts sessions added by LoadSeed (see seedKeyBase).
+	seeded int
+
+	// onGameRemoved is called when a listed game disappears (see SetGameRemovedHook).
+	onGameRemoved func(rid string)
+}
+
+// pendingHostTTL bounds how long SetLoc state waits for a HostData.
+const pendingHostTTL = 5 * time.Minute
+
+type pendingHost struct {
+	location         string
+	observedRemoteIP string
+	observedPort     int
+	at               time.Time
 }
 
 type hostSession struct {
 	// last update time for debugging / eviction.
 	lastUpdate time.Time
 
+	// HostData cadence: time of the last HostData and a moving average of the gaps
+	// between them (see StaleHostsCount).
+	lastHostData     time.Time
+	hostDataInterval time.Duration
+	hostDataGaps     int
+
 	// server-assigned row id (decimal string in payloads); must be <= INT_MAX.
+	// 0 until the session first becomes visible (see assignRidLocked).
 	rid uint32
 
 	// Free-form location string set by SetLoc.
@@ -41,6 +216,17 @@ type hostSession struct {
 	// This is preferred over client-published interface IPs for internet join.
 	observedRemoteIP string
 
+	// observedPort, when set, is the host's external game port (port-forwarding
+	// that differs from the internal one); it overrides the HostData Port.
+	observedPort int
+
+	// gameVRejected hides the session from browse: its last advertised GameV is
+	// not in HostConfig.AllowedGameV.
+	gameVRejected bool
+
+	// seeded marks a synthetic session from LoadSeed.
+	seeded bool
+
 	// SERVER_ITEM_ID == 0: game/session metadata.
 	server map[string]string
 
@@ -49,37 +235,144 @@ type hostSession struct {
 }
 
 func NewHostStore() *HostStore {
+	return NewHostStoreWithConfig(HostConfig{})
+}
+
+func NewHostStoreWithConfig(cfg HostConfig) *HostStore {
 	return &HostStore{
-		hosts:   map[uint32]*hostSession{},
-		nextRid: 1,
+		cfg:     cfg,
+		hosts:   map[hostKey]*hostSession{},
+		byRid:   map[string]hostKey{},
+		pending: map[uint32]pendingHost{},
+		now:     time.Now,
+		nextRid: max(cfg.RidBase, 1),
 	}
 }
 
 func (s *HostStore) getOrCreateLocked(from uint32) *hostSession {
-	h := s.hosts[from]
+	h := s.hosts[hostKey(from)]
 	if h == nil {
 		h = &hostSession{
 			server:  map[string]string{},
 			players: map[string]map[string]string{},
 		}
-		// Assign a stable, small rid for this host session.
-		// Keep it below INT_MAX to match the game's use of `int rowId`.
-		if s.nextRid == 0 || s.nextRid >= 0x7fffffff {
-			s.nextRid = 1
+		if p, ok := s.pending[from]; ok {
+			h.location = p.location
+			h.observedRemoteIP = p.observedRemoteIP
+			h.observedPort = p.observedPort
+			delete(s.pending, from)
 		}
-		h.rid = s.nextRid
-		s.nextRid++
-		s.hosts[from] = h
+		s.putHostLocked(hostKey(from), h)
 	}
 	return h
 }
 
+// hostVisible reports whether a session has enough metadata to show in browse.
+// Without a game name, map, or ip2 it is just a transient session. A session
+// with a disallowed GameV is never visible.
+func hostVisible(h *hostSession) bool {
+	if h.gameVRejected {
+		return false
+	}
+	return h.server["GName"] != "" || h.server["Map"] != "" || h.server["Ip2"] != ""
+}
+
+// assignRidLocked gives h a stable, small rid the first time it becomes visible,
+// so connecting-but-not-hosting clients don't burn rids toward the wrap.
+// Keep it below INT_MAX to match the game's use of `int rowId`.
+func (s *HostStore) assignRidLocked(k hostKey, h *hostSession) {
+	if h.rid != 0 || !hostVisible(h) {
+		return
+	}
+	if s.nextRid == 0 || s.nextRid >= maxRid {
+		s.nextRid = 1
+	}
+	s.reserveRidsLocked()
+	h.rid = s.nextRid
+	s.nextRid++
+	if !h.seeded {
+		s.ridsAssigned++
+	}
+	s.byRid[ridKey(h.rid)] = k
+}
+
+// ridKey is rid as it appears on the wire and in byRid.
+func ridKey(rid uint32) string {
+	return strconv.FormatUint(uint64(rid), 10)
+}
+
+// hostByRidLocked returns the session holding rid, or nil.
+func (s *HostStore) hostByRidLocked(rid string) (hostKey, *hostSession) {
+	k, ok := s.byRid[rid]
+	if !ok {
+		return 0, nil
+	}
+	h := s.hosts[k]
+	if h == nil || h.rid == 0 || ridKey(h.rid) != rid {
+		return 0, nil
+	}
+	return k, h
+}
+
+// putHostLocked (re)stores k's session, restoring its rid index entry.
+func (s *HostStore) putHostLocked(k hostKey, h *hostSession) {
+	s.hosts[k] = h
+	if h.rid != 0 {
+		s.byRid[ridKey(h.rid)] = k
+	}
+}
+
+// removeHostLocked drops k's session and its rid index entry.
+func (s *HostStore) removeHostLocked(k hostKey) {
+	if h := s.hosts[k]; h != nil && h.rid != 0 && s.byRid[ridKey(h.rid)] == k {
+		delete(s.byRid, ridKey(h.rid))
+	}
+	delete(s.hosts, k)
+}
+
+// pendingLocked returns the live pending entry for from. Stale entries of other
+// DPNIDs are swept at most once per pendingHostTTL, so a SetLoc costs O(1)
+// amortized however many browsers are pending.
+func (s *HostStore) pendingLocked(from uint32, now time.Time) pendingHost {
+	if now.Sub(s.pendingSweptAt) >= pendingHostTTL {
+		for dpnid, p := range s.pending {
+			if now.Sub(p.at) > pendingHostTTL {
+				delete(s.pending, dpnid)
+			}
+		}
+		s.pendingSweptAt = now
+	}
+	p, ok := s.pending[from]
+	if ok && now.Sub(p.at) > pendingHostTTL {
+		return pendingHost{}
+	}
+	return p
+}
+
+// ForgetPending drops from's pre-HostData state (SetLoc, observed address) when
+// its session ends. A hosting session is left alone.
+func (s *HostStore) ForgetPending(from uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, from)
+}
+
 func (s *HostStore) SetLoc(from uint32, location string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	h := s.getOrCreateLocked(from)
-	h.location = location
-	h.lastUpdate = time.Now().UTC()
+	now := s.now().UTC()
+	if h := s.hosts[hostKey(from)]; h != nil {
+		if h.location != location {
+			h.location = location
+			s.version++
+		}
+		h.lastUpdate = now
+		return
+	}
+	p := s.pendingLocked(from, now)
+	p.location = location
+	p.at = now
+	s.pending[from] = p
 }
 
 func (s *HostStore) SetObservedRemoteIP(from uint32, ip string) {
@@ -89,66 +382,187 @@ func (s *HostStore) SetObservedRemoteIP(from uint32, ip string) {
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	h := s.getOrCreateLocked(from)
-	h.observedRemoteIP = ip
-	h.lastUpdate = time.Now().UTC()
+	now := s.now().UTC()
+	if h := s.hosts[hostKey(from)]; h != nil {
+		if h.observedRemoteIP != ip {
+			h.observedRemoteIP = ip
+			s.version++
+		}
+		h.lastUpdate = now
+		return
+	}
+	p := s.pendingLocked(from, now)
+	p.observedRemoteIP = ip
+	p.at = now
+	s.pending[from] = p
 }
 
-func (s *HostStore) ApplyHostData(from uint32, payload string) {
+// SetObservedPort records the host's external game port, which browse rows and
+// joins use instead of the port the host advertised. Ports outside 1..65535 are
+// ignored, as is every port when observed addresses are untrusted
+// (IgnoreObservedIP: they belong to the relay).
+func (s *HostStore) SetObservedPort(from uint32, port int) {
+	if port <= 0 || port > 65535 || s.cfg.IgnoreObservedIP {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now().UTC()
+	if h := s.hosts[hostKey(from)]; h != nil {
+		if h.observedPort != port {
+			h.observedPort = port
+			s.version++
+		}
+		h.lastUpdate = now
+		return
+	}
+	p := s.pendingLocked(from, now)
+	p.observedPort = port
+	p.at = now
+	s.pending[from] = p
+}
+
+// ApplyHostData merges a HostData payload into from's session. A payload with
+// an Item over the attribute limits is dropped (ErrAttrLimit). Otherwise it is
+// stored; when its server item starts advertising a GameV outside
+// HostConfig.AllowedGameV the session is hidden from browse and the error is a
+// GameVError. Later payloads that keep it hidden return nil, so callers report a
+// rejection once per session (again only if it comes back and is rejected anew).
+func (s *HostStore) ApplyHostData(from uint32, payload string) error {
 	// payload is the full raw `<HostData ...> ...` string (NUL trimmed).
-	items := scanSelfClosingElements(payload, "Item")
+	items, err := scanHostDataItems(payload, attrLimits{s.cfg.MaxAttrs, s.cfg.MaxAttrLen})
+	if err != nil {
+		return err
+	}
 	if len(items) == 0 {
-		return
+		return nil
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	h := s.getOrCreateLocked(from)
-	h.lastUpdate = time.Now().UTC()
+	now := s.now().UTC()
+	h.lastUpdate = now
+	if !h.lastHostData.IsZero() {
+		gap := now.Sub(h.lastHostData)
+		if h.hostDataGaps == 0 {
+			h.hostDataInterval = gap
+		} else {
+			h.hostDataInterval = (3*h.hostDataInterval + gap) / 4
+		}
+		h.hostDataGaps++
+	}
+	h.lastHostData = now
 
-	for _, attrs := range items {
+	for _, it := range items {
+		attrs := it.attrs
 		itemID := attrs["ItemId"]
+		if it.section == sectionDel {
+			// Everything under <Del> is a delete, whichever id it carries:
+			// `<Del><Item Num="2" /></Del>` or `<Del><Item ItemId="2" /></Del>`.
+			if itemID == "" {
+				itemID = attrs["Num"]
+			}
+			if itemID != "" {
+				s.deleteItemLocked(hostKey(from), h, itemID)
+			}
+			continue
+		}
 		if itemID == "" {
-			// Delete-style payloads can omit ItemId and carry the identifier in `Num`:
-			// `<Del><Item Num="0" /><Item Num="2" /></Del>`
-			// In that case, ItemId is not present and the identifier is carried in `Num`.
-			//
-			// We only treat this as a delete when the element is "id-only" (no Str, no other attrs),
-			// to avoid mixing this with other Item encodings like `<Item Num="i" Str="..."/>`.
-			if num, ok := attrs["Num"]; ok && len(attrs) == 1 {
-				if num == "0" {
-					// Deleting the server item implies the hosted game is gone.
-					h.server = map[string]string{}
-				} else {
-					delete(h.players, num)
-				}
-				if len(h.server) == 0 && len(h.players) == 0 {
-					delete(s.hosts, from)
-				}
+			// A bare `<Item Num="N" />` outside any section is a legacy delete. We only
+			// treat it so when the element is "id-only" (no Str, no other attrs), to
+			// avoid mixing this with other Item encodings like `<Item Num="i" Str="..."/>`.
+			if num, ok := attrs["Num"]; ok && len(attrs) == 1 && it.section == "" {
+				s.deleteItemLocked(hostKey(from), h, num)
 			}
 			continue
 		}
+		// A <Del> earlier in this payload may have dropped the session; an upsert
+		// after it (delete-then-re-add) brings it back.
+		s.putHostLocked(hostKey(from), h)
 		if itemID == "0" {
 			// SERVER_ITEM_ID (game/session metadata)
-			for k, v := range attrs {
-				if k == "ItemId" {
-					continue
-				}
-				h.server[k] = v
-			}
+			s.mergeItemLocked(h.server, attrs)
 			continue
 		}
 		p := h.players[itemID]
 		if p == nil {
 			p = map[string]string{}
 			h.players[itemID] = p
+			s.version++
+		}
+		s.mergeItemLocked(p, attrs)
+	}
+	gv, ok := h.server["GameV"]
+	if rejected := ok && !s.gameVAllowed(gv); rejected != h.gameVRejected {
+		h.gameVRejected = rejected
+		s.version++
+		if rejected {
+			err = &GameVError{GameV: gv}
+		}
+	}
+	if k := hostKey(from); s.hosts[k] == h {
+		s.assignRidLocked(k, h)
+	}
+	return err
+}
+
+// mergeItemLocked copies attrs (except ItemId) into dst, bumping the version
+// if any value changed.
+func (s *HostStore) mergeItemLocked(dst, attrs map[string]string) {
+	for k, v := range attrs {
+		if k == "ItemId" {
+			continue
+		}
+		if old, ok := dst[k]; !ok || old != v {
+			dst[k] = v
+			s.version++
 		}
-		for k, v := range attrs {
-			if k == "ItemId" {
-				continue
+	}
+}
+
+// Version changes whenever anything browse shows may have changed (HostData
+// content, deletes, location, observed address, GameV visibility) and stays put
+// otherwise, e.g. when a host re-sends identical HostData. Compare two reads
+// to tell whether a games page could differ.
+func (s *HostStore) Version() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.version
+}
+
+// gameVAllowed reports whether gv is in HostConfig.AllowedGameV (any when empty).
+func (s *HostStore) gameVAllowed(gv string) bool {
+	if len(s.cfg.AllowedGameV) == 0 {
+		return true
+	}
+	gv = strings.TrimSpace(gv)
+	for _, want := range s.cfg.AllowedGameV {
+		if gv == want {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteItemLocked removes item id ("0" is the server item, which implies the
+// hosted game is gone) and drops the session once nothing is left.
+func (s *HostStore) deleteItemLocked(k hostKey, h *hostSession, id string) {
+	if id == "0" {
+		if len(h.server) > 0 {
+			listed := h.rid != 0 && hostVisible(h)
+			h.server = map[string]string{}
+			s.version++
+			if listed {
+				s.gameRemovedLocked(h)
 			}
-			p[k] = v
 		}
+	} else if _, ok := h.players[id]; ok {
+		delete(h.players, id)
+		s.version++
+	}
+	if len(h.server) == 0 && len(h.players) == 0 {
+		s.removeHostLocked(k)
 	}
 }
 
@@ -218,19 +632,77 @@ func isPrivateIP(s string) bool {
 	return ip.IsLoopback() || ip.IsPrivate()
 }
 
-func hostBrowseIPs(h *hostSession) (ipAddr, ip2 string) {
+func isLoopbackIP(s string) bool {
+	ip := net.ParseIP(strings.TrimSpace(s))
+	return ip != nil && ip.IsLoopback()
+}
+
+func hostBrowseIPs(h *hostSession, cfg HostConfig, j Joiner) (ipAddr, ip2 string) {
 	if h == nil {
 		return "", ""
 	}
+	ipAddr, ip2 = hostBrowseIPsAnyJoiner(h, cfg)
+	if cfg.IgnoreObservedIP {
+		return ipAddr, ip2
+	}
+	// Same NAT as the joiner: the public address would need hairpinning, so offer
+	// the host's LAN address first and keep the public one as the secondary.
+	if lan := sameLANHostIP(h, j); lan != "" {
+		if ipAddr == "" || ipAddr == lan {
+			return lan, lan
+		}
+		return lan, ipAddr
+	}
+	return ipAddr, ip2
+}
+
+// hostPort is the port joiners should dial: the observed external port, else the
+// HostData Port, else 0 when neither is a valid port.
+func hostPort(h *hostSession) int {
+	if h.observedPort > 0 {
+		return h.observedPort
+	}
+	if p, err := strconv.Atoi(strings.TrimSpace(h.server["Port"])); err == nil && p > 0 && p <= 65535 {
+		return p
+	}
+	return 0
+}
+
+// hostBrowseIPsAnyJoiner picks the browse IPs that work for a joiner anywhere on
+// the internet.
+func hostBrowseIPsAnyJoiner(h *hostSession, cfg HostConfig) (ipAddr, ip2 string) {
 	adv1, adv2 := hostAdvertisedIPs(h.server)
+	if cfg.IgnoreObservedIP && adv1 != "" {
+		// Without a trusted observed address, lead with a public advertised IP. A host
+		// that advertises nothing still gets the observed one below (better than no
+		// IpAddr, which blocks Join).
+		if adv2 != "" && isPrivateIP(adv1) && !isPrivateIP(adv2) {
+			adv1, adv2 = adv2, adv1
+		}
+		// Same filter as the observed path below: a private secondary only goes
+		// out when AllowPrivateIPs says joiners can reach it.
+		if adv2 != "" && !cfg.AllowPrivateIPs && isPrivateIP(adv2) {
+			adv2 = adv1
+		}
+		return adv1, adv2
+	}
+
+	// A loopback observed IP means the host runs on the server machine; other players
+	// can't use it, so prefer whatever the host advertised.
+	observed := strings.TrimSpace(h.observedRemoteIP)
+	if observed != "" && adv1 != "" && isLoopbackIP(observed) {
+		observed = ""
+	}
 
 	// Prefer observed remote IP for the primary (server-seen address; works across NAT).
-	if strings.TrimSpace(h.observedRemoteIP) != "" {
-		ipAddr = h.observedRemoteIP
+	if observed != "" {
+		ipAddr = observed
 		// Use client-advertised secondary only if it is a public IP; otherwise other players would try to join a private IP and timeout.
-		if adv1 != "" && adv1 != ipAddr && !isPrivateIP(adv1) {
+		// AllowPrivateIPs lifts that filter for deployments where LAN joiners need the private address.
+		usable := func(ip string) bool { return cfg.AllowPrivateIPs || !isPrivateIP(ip) }
+		if adv1 != "" && adv1 != ipAddr && usable(adv1) {
 			ip2 = adv1
-		} else if adv2 != "" && adv2 != ipAddr && !isPrivateIP(adv2) {
+		} else if adv2 != "" && adv2 != ipAddr && usable(adv2) {
 			ip2 = adv2
 		} else {
 			ip2 = ipAddr
@@ -242,6 +714,38 @@ func hostBrowseIPs(h *hostSession) (ipAddr, ip2 string) {
 	return adv1, adv2
 }
 
+// RegionsEnabled reports whether hosts are tagged with a region (Region column).
+func (s *HostStore) RegionsEnabled() bool {
+	return len(s.cfg.RegionMap) > 0 && !s.cfg.IgnoreObservedIP
+}
+
+// Region returns the region for the session's observed IP, or "" when it has
+// none, the IP is in no configured range, or regions are off.
+func (s *HostStore) Region(from uint32) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := s.hosts[hostKey(from)]
+	if h == nil {
+		return ""
+	}
+	return s.regionLocked(h)
+}
+
+func (s *HostStore) regionLocked(h *hostSession) string {
+	if s.cfg.IgnoreObservedIP {
+		return ""
+	}
+	return regionFor(s.cfg.RegionMap, h.observedRemoteIP)
+}
+
+// TotalGamesHosted is how many games have been listed since the store was created,
+// counting each hosting session once however long it stays up.
+func (s *HostStore) TotalGamesHosted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ridsAssigned
+}
+
 func (s *HostStore) VisibleGamesCount() int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -251,8 +755,7 @@ func (s *HostStore) VisibleGamesCount() int {
 		if h == nil {
 			continue
 		}
-		// Require at least a game name OR map OR ip2; otherwise it's just a transient session.
-		if h.server["GName"] == "" && h.server["Map"] == "" && h.server["Ip2"] == "" {
+		if !hostVisible(h) || h.rid == 0 {
 			continue
 		}
 		n++
@@ -260,18 +763,143 @@ func (s *HostStore) VisibleGamesCount() int {
 	return n
 }
 
+// ActiveGamesCount is VisibleGamesCount limited to hosts updated within window
+// of now, so long-quiet sessions that have not been swept yet are left out.
+func (s *HostStore) ActiveGamesCount(now time.Time, window time.Duration) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, h := range s.hosts {
+		if h == nil || h.rid == 0 || !hostVisible(h) {
+			continue
+		}
+		if now.Sub(h.lastUpdate) <= window {
+			n++
+		}
+	}
+	return n
+}
+
+// maxTopMapLen caps a map name on the News page (in runes).
+const maxTopMapLen = 32
+
+// topMapName makes a host-supplied Map value safe for the line-based News text:
+// control characters (CR/LF would start a new line) and invalid UTF-8 are
+// dropped and the result is capped at maxTopMapLen runes.
+func topMapName(m string) string {
+	m = strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, m)
+	m = strings.TrimSpace(m)
+	if utf8.RuneCountInString(m) > maxTopMapLen {
+		m = strings.TrimSpace(string([]rune(m)[:maxTopMapLen]))
+	}
+	return m
+}
+
+// TopMaps returns up to n of the most common non-empty Map values across visible
+// games, formatted "Map (count)", most common first and ties by name. Names are
+// sanitized first (see topMapName). n <= 0 means no limit.
+func (s *HostStore) TopMaps(n int) []string {
+	s.mu.Lock()
+	counts := map[string]int{}
+	for _, h := range s.hosts {
+		if h == nil || h.rid == 0 || !hostVisible(h) {
+			continue
+		}
+		if m := topMapName(h.server["Map"]); m != "" {
+			counts[m]++
+		}
+	}
+	s.mu.Unlock()
+
+	maps := make([]string, 0, len(counts))
+	for m := range counts {
+		maps = append(maps, m)
+	}
+	sort.Slice(maps, func(i, j int) bool {
+		if counts[maps[i]] != counts[maps[j]] {
+			return counts[maps[i]] > counts[maps[j]]
+		}
+		return maps[i] < maps[j]
+	})
+	if n > 0 && len(maps) > n {
+		maps = maps[:n]
+	}
+	out := make([]string, len(maps))
+	for i, m := range maps {
+		out[i] = fmt.Sprintf("%s (%d)", m, counts[m])
+	}
+	return out
+}
+
+// ActiveWindow returns the configured active-game window (browse.active_window).
+func (s *HostStore) ActiveWindow() time.Duration {
+	if s.cfg.ActiveWindow > 0 {
+		return s.cfg.ActiveWindow
+	}
+	return defaultActiveWindow
+}
+
+// StaleHostsCount returns how many visible hosts have gone quiet for much longer
+// than their usual HostData interval: likely hung, but not yet swept.
+func (s *HostStore) StaleHostsCount(now time.Time) int {
+	factor := s.cfg.StaleFactor
+	if factor <= 0 {
+		factor = defaultStaleFactor
+	}
+	minGap := s.cfg.StaleMin
+	if minGap <= 0 {
+		minGap = defaultStaleMin
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, h := range s.hosts {
+		if h == nil || h.rid == 0 || !hostVisible(h) || h.hostDataGaps < staleMinSamples {
+			continue
+		}
+		limit := time.Duration(float64(h.hostDataInterval) * factor)
+		if limit < minGap {
+			limit = minGap
+		}
+		if now.Sub(h.lastHostData) > limit {
+			n++
+		}
+	}
+	return n
+}
+
 func (s *HostStore) GamesRows(maxRows int, headers []string) []GameRow {
+	return s.GamesRowsFor(maxRows, headers, Joiner{})
+}
+
+// GamesRowsFor is GamesRows with browse IPs chosen for joiner j (see Joiner).
+func (s *HostStore) GamesRowsFor(maxRows int, headers []string, j Joiner) []GameRow {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	// maxRows <= 0 means "no cap".
 
-	// Deterministic order: sort by DPNID.
-	keys := make([]uint32, 0, len(s.hosts))
+	// Deterministic order: sort by DPNID (ties broken by DPNID in other modes too).
+	keys := make([]hostKey, 0, len(s.hosts))
 	for k := range s.hosts {
 		keys = append(keys, k)
 	}
 	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	if s.cfg.Sort == SortQuality {
+		now := s.now().UTC()
+		scores := make(map[hostKey]float64, len(keys))
+		for _, k := range keys {
+			scores[k] = qualityScore(s.hosts[k], now, s.cfg.Quality)
+		}
+		sort.SliceStable(keys, func(i, j int) bool { return scores[keys[i]] > scores[keys[j]] })
+	}
 
 	outCap := len(keys)
 	if maxRows > 0 {
@@ -286,12 +914,11 @@ func (s *HostStore) GamesRows(maxRows int, headers []string) []GameRow {
 		if h == nil {
 			continue
 		}
-		// Require at least a game name OR map OR ip2; otherwise it's just a transient session.
-		if h.server["GName"] == "" && h.server["Map"] == "" && h.server["Ip2"] == "" {
+		if !hostVisible(h) || h.rid == 0 {
 			continue
 		}
 
-		rid := strconv.FormatUint(uint64(h.rid), 10)
+		rid := ridKey(h.rid)
 		items := map[string]string{}
 
 		// Populate known columns strictly from observed HostData keys.
@@ -299,10 +926,13 @@ func (s *HostStore) GamesRows(maxRows int, headers []string) []GameRow {
 		copyIfNonEmpty(items, "GName", h.server["GName"])
 		copyIfNonEmpty(items, "GameV", h.server["GameV"])
 		copyIfNonEmpty(items, "Locale", h.server["Locale"])
-		if ipAddr, ip2 := hostBrowseIPs(h); ipAddr != "" {
+		if ipAddr, ip2 := hostBrowseIPs(h, s.cfg, j); ipAddr != "" {
 			items["IpAddr"] = ipAddr
 			items["Ip2"] = ip2
 		}
+		if port := hostPort(h); port > 0 {
+			items["Port"] = strconv.Itoa(port)
+		}
 		copyIfNonEmpty(items, "SFlags", h.server["SFlags"])
 		copyIfNonEmpty(items, "Flags", h.server["Flags"])
 		copyIfNonEmpty(items, "Map", h.server["Map"])
@@ -312,50 +942,171 @@ func (s *HostStore) GamesRows(maxRows int, headers []string) []GameRow {
 		copyIfNonEmpty(items, "Difficulty", h.server["Difficulty"])
 		copyIfNonEmpty(items, "Time", h.server["Time"])
 		copyIfNonEmpty(items, "TimeL", h.server["TimeL"])
+		items["InGame"] = hostInGame(h)
+		copyIfNonEmpty(items, "Region", s.regionLocked(h))
 
 		// Fill anything missing with empty string; encoder will output empty Str="".
 		_ = headers
 
-		out = append(out, GameRow{Rid: rid, Items: items})
+		out = append(out, GameRow{Rid: rid, Items: items, Seeded: h.seeded})
 	}
 	return out
 }
 
+// RemoveByRid drops the hosted game with the given rid, e.g. an operator clearing
+// a stuck listing. It reports whether the game existed. A host that is still
+// connected can reappear, under a new rid, once it sends its game info again.
+func (s *HostStore) RemoveByRid(rid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, h := s.hostByRidLocked(rid)
+	if h == nil {
+		return false
+	}
+	listed := hostVisible(h)
+	s.removeHostLocked(k)
+	if k <= hostKey(^uint32(0)) {
+		delete(s.pending, uint32(k))
+	}
+	s.version++
+	if listed {
+		s.gameRemovedLocked(h)
+	}
+	return true
+}
+
+// SetGameRemovedHook registers fn to be told the rid of each listed game that
+// disappears: its host deleted the game (HostData Del of the server item) or an
+// operator removed it (RemoveByRid). fn runs with the store locked, so it must
+// not call back into the store; nil clears the hook.
+func (s *HostStore) SetGameRemovedHook(fn func(rid string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onGameRemoved = fn
+}
+
+func (s *HostStore) gameRemovedLocked(h *hostSession) {
+	if s.onGameRemoved != nil {
+		s.onGameRemoved(ridKey(h.rid))
+	}
+}
+
 func (s *HostStore) RowByRid(rid string, headers []string) (GameRow, bool) {
+	return s.RowByRidFor(rid, headers, Joiner{})
+}
+
+// RowByRidFor is RowByRid with browse IPs chosen for joiner j (see Joiner).
+func (s *HostStore) RowByRidFor(rid string, headers []string, j Joiner) (GameRow, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	for _, h := range s.hosts {
-		if h == nil {
-			continue
-		}
-		if strconv.FormatUint(uint64(h.rid), 10) != rid {
-			continue
-		}
+	// Sessions without a rid were never visible and have no row yet.
+	_, h := s.hostByRidLocked(rid)
+	if h == nil || !hostVisible(h) {
+		return GameRow{}, false
+	}
 
-		items := map[string]string{}
-		items["Rid"] = rid
-		copyIfNonEmpty(items, "GName", h.server["GName"])
-		copyIfNonEmpty(items, "GameV", h.server["GameV"])
-		copyIfNonEmpty(items, "Locale", h.server["Locale"])
-		if ipAddr, ip2 := hostBrowseIPs(h); ipAddr != "" {
-			items["IpAddr"] = ipAddr
-			items["Ip2"] = ip2
+	items := map[string]string{}
+	items["Rid"] = rid
+	copyIfNonEmpty(items, "GName", h.server["GName"])
+	copyIfNonEmpty(items, "GameV", h.server["GameV"])
+	copyIfNonEmpty(items, "Locale", h.server["Locale"])
+	if ipAddr, ip2 := hostBrowseIPs(h, s.cfg, j); ipAddr != "" {
+		items["IpAddr"] = ipAddr
+		items["Ip2"] = ip2
+	}
+	if port := hostPort(h); port > 0 {
+		items["Port"] = strconv.Itoa(port)
+	}
+	copyIfNonEmpty(items, "SFlags", h.server["SFlags"])
+	copyIfNonEmpty(items, "Flags", h.server["Flags"])
+	copyIfNonEmpty(items, "Map", h.server["Map"])
+	copyIfNonEmpty(items, "World", h.server["World"])
+	copyIfNonEmpty(items, "NumP", h.server["NumP"])
+	copyIfNonEmpty(items, "MaxP", h.server["MaxP"])
+	copyIfNonEmpty(items, "Difficulty", h.server["Difficulty"])
+	copyIfNonEmpty(items, "Time", h.server["Time"])
+	copyIfNonEmpty(items, "TimeL", h.server["TimeL"])
+	items["InGame"] = hostInGame(h)
+	copyIfNonEmpty(items, "Region", s.regionLocked(h))
+
+	_ = headers
+	return GameRow{Rid: rid, Items: items, Seeded: h.seeded}, true
+}
+
+// stagingArea is the SetLoc location kind of a host still in its pre-game lobby.
+const stagingArea = "STAGING AREA"
+
+// hostInGame encodes the InGame column as the client expects it: "1" once the
+// game has launched, "0" while it is still in the lobby. A HostData InGame or
+// Status field wins; otherwise the host's SetLoc location decides (anything past
+// the staging area counts as launched), and a host with neither is in the lobby.
+func hostInGame(h *hostSession) string {
+	for _, k := range []string{"InGame", "Status"} {
+		if v, ok := h.server[k]; ok && strings.TrimSpace(v) != "" {
+			return boolCol(inGameValue(v))
 		}
-		copyIfNonEmpty(items, "SFlags", h.server["SFlags"])
-		copyIfNonEmpty(items, "Flags", h.server["Flags"])
-		copyIfNonEmpty(items, "Map", h.server["Map"])
-		copyIfNonEmpty(items, "World", h.server["World"])
-		copyIfNonEmpty(items, "NumP", h.server["NumP"])
-		copyIfNonEmpty(items, "MaxP", h.server["MaxP"])
-		copyIfNonEmpty(items, "Difficulty", h.server["Difficulty"])
-		copyIfNonEmpty(items, "Time", h.server["Time"])
-		copyIfNonEmpty(items, "TimeL", h.server["TimeL"])
+	}
+	kind, _, _ := strings.Cut(h.location, "=")
+	kind = strings.TrimSpace(kind)
+	return boolCol(kind != "" && !strings.EqualFold(kind, stagingArea))
+}
 
-		_ = headers
-		return GameRow{Rid: rid, Items: items}, true
+// inGameValue reads an InGame/Status value: a non-zero number or a word like
+// "true" or "playing" means the game is running.
+func inGameValue(v string) bool {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if n, err := strconv.ParseInt(v, 0, 64); err == nil {
+		return n != 0
+	}
+	switch v {
+	case "true", "yes", "ingame", "in game", "playing", "started", "running":
+		return true
+	}
+	return false
+}
+
+func boolCol(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// qualityScore ranks a session by how joinable it looks: has players, not full,
+// recently updated, and not passworded. Unknown values earn no weight.
+func qualityScore(h *hostSession, now time.Time, w QualityWeights) float64 {
+	if h == nil {
+		return 0
 	}
-	return GameRow{}, false
+	var score float64
+	numP, errN := strconv.Atoi(strings.TrimSpace(h.server["NumP"]))
+	maxP, errM := strconv.Atoi(strings.TrimSpace(h.server["MaxP"]))
+	if errN == nil && numP > 0 {
+		score += w.HasPlayers
+	}
+	if errN == nil && errM == nil && maxP > 0 && numP < maxP {
+		score += w.NotFull
+	}
+	if !h.lastUpdate.IsZero() && w.RecentWindow > 0 && now.Sub(h.lastUpdate) <= w.RecentWindow {
+		score += w.Recent
+	}
+	if w.NoPassword != 0 && !hostPassworded(h.server) {
+		score += w.NoPassword
+	}
+	return score
+}
+
+// hostPassworded is best-effort: the password field name has not been confirmed
+// on the wire, so accept the likely spellings and treat "0"/"" as open. It only
+// counts once browse.quality.no_password is set.
+func hostPassworded(server map[string]string) bool {
+	for _, k := range []string{"Pwd", "Password"} {
+		if v := strings.TrimSpace(server[k]); v != "" && v != "0" {
+			return true
+		}
+	}
+	return false
 }
 
 func copyIfNonEmpty(dst map[string]string, k, v string) {
@@ -372,11 +1123,90 @@ func min(a, b int) int {
 	return b
 }
 
-// scanSelfClosingElements finds `<name ... />` elements and returns their attributes.
-// This is intentionally narrow and ASCII-focused (matches on-wire payloads).
-func scanSelfClosingElements(payload, name string) []map[string]string {
+// HostData sections an Item can sit under.
+const (
+	sectionNew = "New"
+	sectionMod = "Mod"
+	sectionDel = "Del"
+)
+
+// hostDataItem is one `<Item .../>` from a HostData payload and the section
+// (sectionNew/Mod/Del) enclosing it, or "" when it is in none.
+type hostDataItem struct {
+	attrs   map[string]string
+	section string
+}
+
+func scanHostDataItems(payload string, lim attrLimits) ([]hostDataItem, error) {
+	els, err := scanSelfClosingElements(payload, "Item", lim)
+	if err != nil {
+		return nil, err
+	}
+	ranges := map[string][][2]int{}
+	for _, sec := range []string{sectionNew, sectionMod, sectionDel} {
+		ranges[sec] = sectionRanges(payload, sec)
+	}
+	var out []hostDataItem
+	for _, el := range els {
+		it := hostDataItem{attrs: el.attrs}
+	find:
+		for sec, rs := range ranges {
+			for _, r := range rs {
+				if el.pos > r[0] && el.pos < r[1] {
+					it.section = sec
+					break find
+				}
+			}
+		}
+		out = append(out, it)
+	}
+	return out, nil
+}
+
+// sectionRanges returns the [open, close) offsets of each `<name ...>...</name>`
+// section. Self-closing `<name/>` is empty and skipped; an unterminated section
+// runs to the end of the payload.
+func sectionRanges(payload, name string) [][2]int {
+	open, closing := "<"+name, "</"+name+">"
+	var out [][2]int
+	for i := 0; i < len(payload); {
+		j := strings.Index(payload[i:], open)
+		if j < 0 {
+			break
+		}
+		j += i
+		end := strings.IndexByte(payload[j:], '>')
+		if end < 0 {
+			break
+		}
+		head := payload[j+len(open) : j+end]
+		if (head != "" && !strings.ContainsAny(head[:1], " \t\r\n")) || strings.HasSuffix(head, "/") {
+			// `<NewThing>` or `<New/>`: not an open section.
+			i = j + end + 1
+			continue
+		}
+		k := strings.Index(payload[j:], closing)
+		if k < 0 {
+			out = append(out, [2]int{j, len(payload)})
+			break
+		}
+		k += j
+		out = append(out, [2]int{j, k})
+		i = k + len(closing)
+	}
+	return out
+}
+
+type scannedElement struct {
+	pos   int // offset of the element's '<'
+	attrs map[string]string
+}
+
+// scanSelfClosingElements finds `<name ... />` elements and returns their attributes
+// and offsets. This is intentionally narrow and ASCII-focused (matches on-wire payloads).
+func scanSelfClosingElements(payload, name string, lim attrLimits) ([]scannedElement, error) {
 	needle := "<" + name
-	out := []map[string]string{}
+	out := []scannedElement{}
 
 	for i := 0; i < len(payload); {
 		j := strings.Index(payload[i:], needle)
@@ -404,16 +1234,25 @@ func scanSelfClosingElements(payload, name string) []map[string]string {
 			continue
 		}
 
-		attrs := parseAttrs(tag[len(name):])
+		attrs, err := parseAttrs(tag[len(name):], lim)
+		if err != nil {
+			return nil, err
+		}
 		if len(attrs) > 0 {
-			out = append(out, attrs)
+			out = append(out, scannedElement{pos: j, attrs: attrs})
 		}
 		i = k + 1
 	}
-	return out
+	return out, nil
+}
+
+// attrLimits bounds parseAttrs; zero fields are unlimited.
+type attrLimits struct {
+	maxAttrs int
+	maxLen   int
 }
 
-func parseAttrs(s string) map[string]string {
+func parseAttrs(s string, lim attrLimits) (map[string]string, error) {
 	attrs := map[string]string{}
 	rest := strings.TrimSpace(s)
 	rest = strings.TrimSuffix(rest, "/")
@@ -431,9 +1270,15 @@ func parseAttrs(s string) map[string]string {
 		}
 		val := rest[:q]
 		rest = strings.TrimSpace(rest[q+1:])
+		if lim.maxLen > 0 && (len(key) > lim.maxLen || len(val) > lim.maxLen) {
+			return nil, fmt.Errorf("%w: attribute over %d bytes", ErrAttrLimit, lim.maxLen)
+		}
 		if key != "" {
+			if _, ok := attrs[key]; !ok && lim.maxAttrs > 0 && len(attrs) == lim.maxAttrs {
+				return nil, fmt.Errorf("%w: over %d attributes", ErrAttrLimit, lim.maxAttrs)
+			}
 			attrs[key] = val
 		}
 	}
-	return attrs
+	return attrs, nil
 }
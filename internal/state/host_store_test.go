@@ -1,6 +1,11 @@
 package state
 
-import "testing"
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestParseHostIpList(t *testing.T) {
 	ip1, ip2 := parseHostIpList(" 192.0.2.10  198.51.100.11 ")
@@ -67,6 +72,174 @@ func TestHostStore_ObservedIPOverridesPrivateIp2(t *testing.T) {
 	}
 }
 
+func TestHostStore_ObservedPortOverridesAdvertised(t *testing.T) {
+	s := NewHostStore()
+	from := uint32(0x34343434)
+	// Set before HostData: the pending entry carries it over.
+	s.SetObservedPort(from, 16073)
+	s.ApplyHostData(from, `<HostData Cx="0x0"><HostData><New>`+
+		`<Item ItemId="0" GName="Forwarded" Map="Test" Ip2="203.0.113.4" Port="6073" NumP="1" MaxP="8" />`+
+		`</New></HostData></HostData>`)
+
+	rows := s.GamesRows(0, nil)
+	if len(rows) != 1 {
+		t.Fatalf("rows=%d", len(rows))
+	}
+	if got := rows[0].Items["Port"]; got != "16073" {
+		t.Fatalf("row Port=%q want observed 16073", got)
+	}
+	if r, ok := s.RowByRid(rows[0].Rid, nil); !ok || r.Items["Port"] != "16073" {
+		t.Fatalf("RowByRid Port=%q ok=%v", r.Items["Port"], ok)
+	}
+	if tgt, err := s.JoinTarget(rows[0].Rid, Joiner{}); err != nil || tgt.Port != 16073 {
+		t.Fatalf("JoinTarget=%+v err=%v", tgt, err)
+	}
+
+	// Out-of-range ports are ignored; without an observed port the advertised one shows.
+	s.SetObservedPort(from, 70000)
+	other := uint32(0x35353535)
+	s.ApplyHostData(other, `<HostData Cx="0x0"><HostData><New>`+
+		`<Item ItemId="0" GName="Direct" Map="Test" Ip2="203.0.113.5" Port="6080" />`+
+		`</New></HostData></HostData>`)
+	for _, r := range s.GamesRows(0, nil) {
+		want := map[string]string{"Forwarded": "16073", "Direct": "6080"}[r.Items["GName"]]
+		if r.Items["Port"] != want {
+			t.Fatalf("%s Port=%q want %s", r.Items["GName"], r.Items["Port"], want)
+		}
+	}
+}
+
+func TestHostStore_AllowedGameV(t *testing.T) {
+	s := NewHostStoreWithConfig(HostConfig{AllowedGameV: []string{"1.1"}})
+	host := func(from uint32, name, gamev string) error {
+		return s.ApplyHostData(from, `<HostData Cx="0x0"><HostData><New>`+
+			`<Item ItemId="0" GName="`+name+`" Map="Test" GameV="`+gamev+`" />`+
+			`</New></HostData></HostData>`)
+	}
+	if err := host(0x1, "Current", "1.1"); err != nil {
+		t.Fatalf("allowed GameV: %v", err)
+	}
+	if err := host(0x2, "Old", "1.0"); !errors.Is(err, ErrGameVNotAllowed) {
+		t.Fatalf("disallowed GameV err=%v", err)
+	}
+	rows := s.GamesRows(0, nil)
+	if len(rows) != 1 || rows[0].Items["GName"] != "Current" {
+		t.Fatalf("rows=%+v want only Current", rows)
+	}
+
+	// The rejection is reported once per session, not on every HostData.
+	if err := host(0x2, "Old", "1.0"); err != nil {
+		t.Fatalf("repeat rejection err=%v, want nil", err)
+	}
+
+	// Updating to an allowed GameV brings the host back.
+	if err := host(0x2, "Old", "1.1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.VisibleGamesCount(); n != 2 {
+		t.Fatalf("visible=%d want 2", n)
+	}
+
+	// A listed host that switches to a disallowed GameV hides its details too.
+	rid := s.GamesRows(0, nil)[0].Rid
+	var gvErr *GameVError
+	if err := host(0x1, "Current", "0.9"); !errors.As(err, &gvErr) || gvErr.GameV != "0.9" {
+		t.Fatalf("err=%v, want GameVError for 0.9", err)
+	}
+	if _, ok := s.RowByRid(rid, nil); ok {
+		t.Fatalf("RowByRid(%s) returned a hidden host", rid)
+	}
+}
+
+func TestHostStore_ItemAttrLimits(t *testing.T) {
+	s := NewHostStoreWithConfig(HostConfig{MaxAttrs: 4, MaxAttrLen: 8})
+	apply := func(from uint32, item string) error {
+		return s.ApplyHostData(from, `<HostData><HostData><New>`+item+`</New></HostData></HostData>`)
+	}
+	if err := apply(0x1, `<Item ItemId="0" GName="ok" Map="m" />`); err != nil {
+		t.Fatal(err)
+	}
+	if err := apply(0x2, `<Item ItemId="0" GName="wide" Map="m" A="1" B="2" />`); !errors.Is(err, ErrAttrLimit) {
+		t.Fatalf("5 attrs err=%v", err)
+	}
+	if err := apply(0x3, `<Item ItemId="0" GName="overlong1" />`); !errors.Is(err, ErrAttrLimit) {
+		t.Fatalf("9-byte value err=%v", err)
+	}
+	if rows := s.GamesRows(0, nil); len(rows) != 1 || rows[0].Items["GName"] != "ok" {
+		t.Fatalf("rows=%+v want only ok", rows)
+	}
+}
+
+func TestHostStore_RegionFromObservedIP(t *testing.T) {
+	regions, err := ParseRegionMap([]string{"203.0.0.0/8=World", "203.0.113.0/24 = EU", "198.51.100.7=NA"})
+	if err != nil {
+		t.Fatalf("ParseRegionMap: %v", err)
+	}
+	if _, err := ParseRegionMap([]string{"203.0.113.0/24"}); err == nil {
+		t.Fatal("entry without a region accepted")
+	}
+
+	s := NewHostStoreWithConfig(HostConfig{RegionMap: regions})
+	game := `<HostData><HostData><New><Item ItemId="0" GName="g" Map="m" /></New></HostData></HostData>`
+	s.ApplyHostData(0x1, game)
+	s.SetObservedRemoteIP(0x1, "203.0.113.9")
+	s.ApplyHostData(0x2, game)
+	s.SetObservedRemoteIP(0x2, "192.0.2.1")
+
+	if got := s.Region(0x1); got != "EU" {
+		t.Fatalf("Region(0x1)=%q want EU (most specific range)", got)
+	}
+	row, ok := s.RowByRid("1", nil)
+	if !ok || row.Items["Region"] != "EU" {
+		t.Fatalf("row=%+v ok=%v", row, ok)
+	}
+	rows := s.GamesRows(0, nil)
+	if len(rows) != 2 || rows[0].Items["Region"] != "EU" {
+		t.Fatalf("rows=%+v", rows)
+	}
+	if _, ok := rows[1].Items["Region"]; ok {
+		t.Fatalf("unmapped host tagged: %+v", rows[1])
+	}
+}
+
+func TestHostStore_VersionTracksChanges(t *testing.T) {
+	s := NewHostStore()
+	game := `<HostData><HostData><New><Item ItemId="0" GName="g" Map="m" NumP="1" /></New></HostData></HostData>`
+	step := func(name string, changed bool, f func()) {
+		t.Helper()
+		before := s.Version()
+		f()
+		if after := s.Version(); (after != before) != changed {
+			t.Fatalf("%s: version %d -> %d, changed=%v", name, before, after, changed)
+		}
+	}
+
+	step("first HostData", true, func() { s.ApplyHostData(0x1, game) })
+	step("identical HostData", false, func() { s.ApplyHostData(0x1, game) })
+	step("reads", false, func() {
+		s.GamesRows(0, nil)
+		s.RowByRid("1", nil)
+		s.VisibleGamesCount()
+	})
+	step("NumP change", true, func() {
+		s.ApplyHostData(0x1, `<HostData><HostData><Mod><Item ItemId="0" NumP="2" /></Mod></HostData></HostData>`)
+	})
+	step("player joins", true, func() {
+		s.ApplyHostData(0x1, `<HostData><HostData><New><Item ItemId="2" Name="a" /></New></HostData></HostData>`)
+	})
+	step("location set", true, func() { s.SetLoc(0x1, "STAGING AREA=1") })
+	step("same location again", false, func() { s.SetLoc(0x1, "STAGING AREA=1") })
+	step("observed IP set", true, func() { s.SetObservedRemoteIP(0x1, "203.0.113.4") })
+	step("same observed IP again", false, func() { s.SetObservedRemoteIP(0x1, "203.0.113.4") })
+	step("delete of unknown player", false, func() {
+		s.ApplyHostData(0x1, `<HostData><HostData><Del><Item Num="9" /></Del></HostData></HostData>`)
+	})
+	step("player leaves", true, func() {
+		s.ApplyHostData(0x1, `<HostData><HostData><Del><Item Num="2" /></Del></HostData></HostData>`)
+	})
+	step("operator removal", true, func() { s.RemoveByRid("1") })
+}
+
 func TestHostStore_DeleteStyleRemovesHost(t *testing.T) {
 	s := NewHostStore()
 	from := uint32(0x22222222)
@@ -88,3 +261,565 @@ func TestHostStore_DeleteStyleRemovesHost(t *testing.T) {
 		t.Fatalf("VisibleGamesCount=%d", got)
 	}
 }
+
+func TestHostStore_RidLookupAfterDeleteAndRecreate(t *testing.T) {
+	s := NewHostStore()
+	game := `<New><Item ItemId="0" GName="g" Map="Test" Ip2="203.0.113.4" /></New>`
+	lookup := func(rid string) bool {
+		_, rowOK := s.RowByRid(rid, nil)
+		_, err := s.JoinTarget(rid, Joiner{})
+		if rowOK != (err == nil) {
+			t.Fatalf("rid %s: RowByRid ok=%v JoinTarget err=%v", rid, rowOK, err)
+		}
+		return rowOK
+	}
+
+	s.ApplyHostData(0x1, `<HostData><HostData>`+game+`</HostData></HostData>`)
+	first := s.GamesRows(0, nil)[0].Rid
+	if !lookup(first) {
+		t.Fatalf("rid %s not found", first)
+	}
+
+	// Delete-then-re-add in one payload keeps the session and its rid.
+	s.ApplyHostData(0x1, `<HostData><HostData><Del><Item Num="0" /></Del>`+game+`</HostData></HostData>`)
+	if !lookup(first) {
+		t.Fatalf("rid %s lost after delete-then-re-add", first)
+	}
+
+	// A full delete drops the rid; hosting again gets a new one.
+	s.ApplyHostData(0x1, `<HostData><HostData><Del><Item Num="0" /></Del></HostData></HostData>`)
+	if lookup(first) {
+		t.Fatalf("deleted rid %s still found", first)
+	}
+	s.ApplyHostData(0x1, `<HostData><HostData>`+game+`</HostData></HostData>`)
+	second := s.GamesRows(0, nil)[0].Rid
+	if second == first || !lookup(second) || lookup(first) {
+		t.Fatalf("recreated rid=%s (first %s)", second, first)
+	}
+
+	if !s.RemoveByRid(second) || lookup(second) || s.RemoveByRid(second) {
+		t.Fatalf("RemoveByRid(%s) left the rid resolvable", second)
+	}
+	if n := len(s.byRid); n != 0 {
+		t.Fatalf("byRid has %d entries after every host is gone", n)
+	}
+}
+
+func TestHostStore_DeleteByNumOrItemIdRemovesPlayers(t *testing.T) {
+	for name, del := range map[string]string{
+		"Num":    `<Item Num="2" />`,
+		"ItemId": `<Item ItemId="2" />`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := NewHostStore()
+			from := uint32(0x33333333)
+			s.ApplyHostData(from, `<HostData><HostData><New>`+
+				`<Item ItemId="0" GName="x" Map="y" />`+
+				`<Item ItemId="2" Name="alice" />`+
+				`<Item ItemId="3" Name="bob" />`+
+				`</New></HostData></HostData>`)
+
+			s.ApplyHostData(from, `<HostData><HostData><Del>`+del+`</Del></HostData></HostData>`)
+			h := s.hosts[hostKey(from)]
+			if h == nil || h.players["2"] != nil || h.players["3"] == nil {
+				t.Fatalf("after delete players=%v", h.players)
+			}
+
+			// Deleting the server item the same way ends the game.
+			s.ApplyHostData(from, `<HostData><HostData><Del>`+strings.Replace(del, `"2"`, `"0"`, 1)+`</Del></HostData></HostData>`)
+			if got := s.VisibleGamesCount(); got != 0 {
+				t.Fatalf("VisibleGamesCount=%d after server item delete", got)
+			}
+		})
+	}
+
+	// Outside <Del>, an id-only ItemId item is an upsert, not a delete.
+	s := NewHostStore()
+	s.ApplyHostData(0x1, `<HostData><HostData><New><Item ItemId="0" GName="x" /><Item ItemId="2" Name="a" /></New></HostData></HostData>`)
+	s.ApplyHostData(0x1, `<HostData><HostData><Mod><Item ItemId="2" /></Mod></HostData></HostData>`)
+	if s.hosts[0x1].players["2"] == nil {
+		t.Fatalf("id-only ItemId outside <Del> removed the player")
+	}
+}
+
+func TestHostStore_GamesRows_QualitySort(t *testing.T) {
+	if w := DefaultQualityWeights(); w.NoPassword != 0 {
+		t.Fatalf("default NoPassword=%v; the password field is unconfirmed", w.NoPassword)
+	}
+	w := DefaultQualityWeights()
+	w.NoPassword = 1
+	s := NewHostStoreWithConfig(HostConfig{Sort: SortQuality, Quality: w})
+	seed := func(from uint32, item string) {
+		s.ApplyHostData(from, `<HostData><HostData><New><Item ItemId="0" `+item+` /></New></HostData></HostData>`)
+	}
+	// Lower DPNIDs would win under the default sort; quality must reorder them.
+	seed(0x10, `GName="empty" NumP="0" MaxP="8"`)               // not full, recent, open: 6
+	seed(0x20, `GName="full" NumP="8" MaxP="8"`)                // players, recent, open: 4
+	seed(0x30, `GName="locked" NumP="2" MaxP="8" Password="1"`) // players, not full, recent: 7
+	seed(0x40, `GName="best" NumP="3" MaxP="8"`)                // everything: 8
+	seed(0x50, `GName="stale" NumP="3" MaxP="8"`)               // players, not full, open: 7
+	s.mu.Lock()
+	s.hosts[0x50].lastUpdate = time.Now().UTC().Add(-time.Hour)
+	s.mu.Unlock()
+
+	rows := s.GamesRows(0, nil)
+	var got []string
+	for _, r := range rows {
+		got = append(got, r.Items["GName"])
+	}
+	want := []string{"best", "locked", "stale", "empty", "full"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("order=%v want %v", got, want)
+	}
+
+	// Default sort keeps connect (DPNID) order.
+	d := NewHostStore()
+	d.ApplyHostData(0x20, `<New><Item ItemId="0" GName="b" /></New>`)
+	d.ApplyHostData(0x10, `<New><Item ItemId="0" GName="a" /></New>`)
+	if rows := d.GamesRows(0, nil); len(rows) != 2 || rows[0].Items["GName"] != "a" {
+		t.Fatalf("default order=%v", rows)
+	}
+}
+
+func TestHostBrowseIPs_PrecedenceMatrix(t *testing.T) {
+	const (
+		pubObs  = "203.0.113.1"
+		privObs = "192.168.1.50"
+		loObs   = "127.0.0.1"
+		pubA    = "198.51.100.10"
+		pubB    = "198.51.100.11"
+		privA   = "10.0.0.5"
+		privB   = "172.16.0.9"
+	)
+	cases := []struct {
+		name     string
+		observed string
+		ipAddr   string // HostData IpAddr
+		ip2      string // HostData Ip2 (may be a list)
+		want1    string
+		want2    string
+	}{
+		// No observed IP: advertised values pass through (LAN fallback).
+		{"none/none", "", "", "", "", ""},
+		{"none/ip2 public pair", "", "", pubA + " " + pubB, pubA, pubB},
+		{"none/ip2 private pair", "", "", privA + " " + privB, privA, privB},
+		{"none/ip2 single", "", "", pubA, pubA, pubA},
+		{"none/ipaddr only", "", pubA, "", pubA, pubA},
+		{"none/ipaddr+ip2 distinct", "", pubA, pubB, pubA, pubB},
+		{"none/ipaddr+ip2 list containing ipaddr", "", pubA, pubA + " " + pubB, pubA, pubB},
+		{"none/ipaddr+ip2 same", "", pubA, pubA, pubA, pubA},
+		{"none/comma list", "", "", pubA + "," + privA, pubA, privA},
+
+		// Public observed IP: primary is observed; secondary only if advertised public.
+		{"pub/none", pubObs, "", "", pubObs, pubObs},
+		{"pub/adv public", pubObs, "", pubA, pubObs, pubA},
+		{"pub/adv private", pubObs, "", privA, pubObs, pubObs},
+		{"pub/adv private then public", pubObs, "", privA + " " + pubA, pubObs, pubA},
+		{"pub/adv public then private", pubObs, "", pubA + " " + privA, pubObs, pubA},
+		{"pub/adv both private", pubObs, "", privA + " " + privB, pubObs, pubObs},
+		{"pub/adv equals observed", pubObs, "", pubObs, pubObs, pubObs},
+		{"pub/adv observed then public", pubObs, "", pubObs + " " + pubA, pubObs, pubA},
+		{"pub/ipaddr private ip2 public", pubObs, privA, pubA, pubObs, pubA},
+		{"pub/ipaddr public ip2 private", pubObs, pubA, privA, pubObs, pubA},
+		{"pub/adv unparseable", pubObs, "", "not-an-ip", pubObs, pubObs},
+
+		// Private observed IP (host on the server's LAN): still primary.
+		{"priv/none", privObs, "", "", privObs, privObs},
+		{"priv/adv public", privObs, "", pubA, privObs, pubA},
+		{"priv/adv private", privObs, "", privA, privObs, privObs},
+
+		// Loopback observed IP (host on the server machine): useless to others, so
+		// advertised IPs win when present.
+		{"loopback/none", loObs, "", "", loObs, loObs},
+		{"loopback/adv public", loObs, "", pubA + " " + pubB, pubA, pubB},
+		{"loopback/adv private", loObs, "", privA, privA, privA},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &hostSession{server: map[string]string{}, observedRemoteIP: tc.observed}
+			if tc.ipAddr != "" {
+				h.server["IpAddr"] = tc.ipAddr
+			}
+			if tc.ip2 != "" {
+				h.server["Ip2"] = tc.ip2
+			}
+			got1, got2 := hostBrowseIPs(h, HostConfig{}, Joiner{})
+			if got1 != tc.want1 || got2 != tc.want2 {
+				t.Fatalf("hostBrowseIPs=(%q,%q) want (%q,%q)", got1, got2, tc.want1, tc.want2)
+			}
+		})
+	}
+}
+
+func TestHostStore_AllowPrivateIPsPermitsPrivateSecondary(t *testing.T) {
+	payload := `<HostData Cx="0x0"><HostData><New>` +
+		`<Item ItemId="0" GName="Mixed Host" Map="Test" Ip2="10.0.0.186" />` +
+		`</New></HostData></HostData>`
+	for _, tc := range []struct {
+		allow bool
+		want2 string
+	}{
+		{false, "203.0.113.1"},
+		{true, "10.0.0.186"},
+	} {
+		s := NewHostStoreWithConfig(HostConfig{AllowPrivateIPs: tc.allow})
+		s.SetObservedRemoteIP(0x44, "203.0.113.1")
+		s.ApplyHostData(0x44, payload)
+		rows := s.GamesRows(0, nil)
+		if len(rows) != 1 {
+			t.Fatalf("rows=%d", len(rows))
+		}
+		if got := rows[0].Items["IpAddr"]; got != "203.0.113.1" {
+			t.Fatalf("allow=%v IpAddr=%q want observed", tc.allow, got)
+		}
+		if got := rows[0].Items["Ip2"]; got != tc.want2 {
+			t.Fatalf("allow=%v Ip2=%q want %q", tc.allow, got, tc.want2)
+		}
+	}
+}
+
+func TestHostStore_TrustObservedIP(t *testing.T) {
+	// A host behind a relay: the transport sees the relay, the host advertises its
+	// LAN and public addresses.
+	payload := `<HostData Cx="0x0"><HostData><New>` +
+		`<Item ItemId="0" GName="Relayed" Map="Test" IpAddr="10.0.0.7" Ip2="198.51.100.20" />` +
+		`</New></HostData></HostData>`
+	bare := `<HostData Cx="0x0"><HostData><New>` +
+		`<Item ItemId="0" GName="Bare" Map="Test" />` +
+		`</New></HostData></HostData>`
+	for _, tc := range []struct {
+		name             string
+		ignore, allow    bool
+		want1, want2     string
+		bare1, bareWant2 string
+	}{
+		{"trusted", false, false, "203.0.113.9", "198.51.100.20", "203.0.113.9", "203.0.113.9"},
+		// The LAN address is not published unless private IPs are allowed.
+		{"untrusted", true, false, "198.51.100.20", "198.51.100.20", "203.0.113.9", "203.0.113.9"},
+		{"untrusted allow private", true, true, "198.51.100.20", "10.0.0.7", "203.0.113.9", "203.0.113.9"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewHostStoreWithConfig(HostConfig{IgnoreObservedIP: tc.ignore, AllowPrivateIPs: tc.allow})
+			s.SetObservedRemoteIP(0x44, "203.0.113.9")
+			s.ApplyHostData(0x44, payload)
+			s.SetObservedRemoteIP(0x55, "203.0.113.9")
+			s.ApplyHostData(0x55, bare)
+
+			// A joiner behind the same (relay) address must not get the LAN path
+			// unless the observed address is trusted.
+			j := Joiner{ObservedIP: "203.0.113.9", LocalIPs: []string{"10.0.0.12"}}
+			rows := s.GamesRowsFor(0, nil, j)
+			if len(rows) != 2 {
+				t.Fatalf("rows=%d", len(rows))
+			}
+			got := map[string][2]string{}
+			for _, r := range rows {
+				got[r.Items["GName"]] = [2]string{r.Items["IpAddr"], r.Items["Ip2"]}
+			}
+			want := [2]string{tc.want1, tc.want2}
+			if !tc.ignore {
+				want = [2]string{"10.0.0.7", "203.0.113.9"}
+			}
+			if got["Relayed"] != want {
+				t.Fatalf("Relayed IPs=%v want %v", got["Relayed"], want)
+			}
+			if g := got["Bare"]; g != [2]string{tc.bare1, tc.bareWant2} {
+				t.Fatalf("Bare IPs=%v want (%s,%s)", g, tc.bare1, tc.bareWant2)
+			}
+
+			// Without a joiner, the any-internet choice applies.
+			rows = s.GamesRows(0, nil)
+			for _, r := range rows {
+				if r.Items["GName"] == "Relayed" {
+					if r.Items["IpAddr"] != tc.want1 || r.Items["Ip2"] != tc.want2 {
+						t.Fatalf("anon IPs=(%s,%s) want (%s,%s)", r.Items["IpAddr"], r.Items["Ip2"], tc.want1, tc.want2)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHostStore_SetLocWithoutHostDataCreatesNoSession(t *testing.T) {
+	s := NewHostStore()
+	browser, host := uint32(0x44444444), uint32(0x55555555)
+
+	// A browser sends SetLoc (and the server records its IP) but never hosts.
+	s.SetObservedRemoteIP(browser, "198.51.100.20")
+	s.SetLoc(browser, "STAGING AREA=not hosting")
+	if len(s.hosts) != 0 {
+		t.Fatalf("phantom host sessions: %d", len(s.hosts))
+	}
+	if s.nextRid != 1 {
+		t.Fatalf("rid consumed without HostData: nextRid=%d", s.nextRid)
+	}
+
+	// A real host still gets the first rid and keeps its pre-HostData SetLoc state.
+	s.SetLoc(host, "STAGING AREA=real game")
+	s.ApplyHostData(host, `<HostData><HostData><New><Item ItemId="0" GName="g" Map="m" /></New></HostData></HostData>`)
+	h := s.hosts[hostKey(host)]
+	if h == nil || h.rid != 1 {
+		t.Fatalf("host session=%+v, want rid 1", h)
+	}
+	if h.location != "STAGING AREA=real game" {
+		t.Fatalf("location=%q", h.location)
+	}
+	if _, ok := s.pending[host]; ok {
+		t.Fatalf("pending entry not consumed by HostData")
+	}
+
+	// The browser's pending state expires instead of lingering.
+	s.mu.Lock()
+	s.pendingLocked(0, time.Now().UTC().Add(pendingHostTTL+time.Second))
+	n := len(s.pending)
+	s.mu.Unlock()
+	if n != 0 {
+		t.Fatalf("stale pending entries: %d", n)
+	}
+
+	// A browser that disconnects leaves nothing behind.
+	s.SetLoc(browser, "STAGING AREA=not hosting")
+	s.ForgetPending(browser)
+	if _, ok := s.pending[browser]; ok {
+		t.Fatalf("pending entry kept after disconnect")
+	}
+}
+
+func TestHostStore_RidsAssignedOnlyToVisibleGames(t *testing.T) {
+	s := NewHostStore()
+	// Player-only HostData: a session exists but is not visible, so no rid yet.
+	s.ApplyHostData(0x1, `<HostData><HostData><New><Item ItemId="2" Name="p1" /></New></HostData></HostData>`)
+	if h := s.hosts[0x1]; h == nil || h.rid != 0 {
+		t.Fatalf("invisible session=%+v, want rid 0", h)
+	}
+	if _, ok := s.RowByRid("0", nil); ok {
+		t.Fatalf("RowByRid matched a session without a rid")
+	}
+	if rows := s.GamesRows(0, nil); len(rows) != 0 {
+		t.Fatalf("rows=%d want 0", len(rows))
+	}
+
+	// Another host becomes visible first and takes rid 1.
+	s.ApplyHostData(0x2, `<HostData><HostData><New><Item ItemId="0" GName="second" /></New></HostData></HostData>`)
+	// The first session gains a Map and gets the next rid.
+	s.ApplyHostData(0x1, `<HostData><HostData><Mod><Item ItemId="0" Map="m" /></Mod></HostData></HostData>`)
+	if s.hosts[0x2].rid != 1 || s.hosts[0x1].rid != 2 {
+		t.Fatalf("rids: 0x1=%d 0x2=%d, want 2 and 1", s.hosts[0x1].rid, s.hosts[0x2].rid)
+	}
+
+	// The rid is stable across later updates.
+	s.ApplyHostData(0x1, `<HostData><HostData><Mod><Item ItemId="0" GName="first" /></Mod></HostData></HostData>`)
+	row, ok := s.RowByRid("2", nil)
+	if !ok || row.Items["GName"] != "first" {
+		t.Fatalf("RowByRid(2)=%+v ok=%v", row, ok)
+	}
+	if got := len(s.GamesRows(0, nil)); got != 2 {
+		t.Fatalf("rows=%d want 2", got)
+	}
+}
+
+func TestHostBrowseIPs_SameSubnetJoinerPrefersLANAddress(t *testing.T) {
+	h := &hostSession{
+		observedRemoteIP: "203.0.113.50",
+		server:           map[string]string{"Ip2": "172.25.96.1 192.168.1.20"},
+	}
+	cases := []struct {
+		name         string
+		j            Joiner
+		want1, want2 string
+	}{
+		{"no joiner context", Joiner{}, "203.0.113.50", "203.0.113.50"},
+		{"same NAT, same subnet", Joiner{ObservedIP: "203.0.113.50", LocalIPs: []string{"192.168.1.77"}}, "192.168.1.20", "203.0.113.50"},
+		{"same NAT, other subnet", Joiner{ObservedIP: "203.0.113.50", LocalIPs: []string{"192.168.2.77"}}, "203.0.113.50", "203.0.113.50"},
+		{"same subnet, different NAT", Joiner{ObservedIP: "198.51.100.9", LocalIPs: []string{"192.168.1.77"}}, "203.0.113.50", "203.0.113.50"},
+		{"same NAT, no local IPs", Joiner{ObservedIP: "203.0.113.50"}, "203.0.113.50", "203.0.113.50"},
+		{"public local IPs ignored", Joiner{ObservedIP: "203.0.113.50", LocalIPs: []string{"203.0.113.50"}}, "203.0.113.50", "203.0.113.50"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got1, got2 := hostBrowseIPs(h, HostConfig{}, tc.j)
+			if got1 != tc.want1 || got2 != tc.want2 {
+				t.Fatalf("hostBrowseIPs=(%q,%q) want (%q,%q)", got1, got2, tc.want1, tc.want2)
+			}
+		})
+	}
+}
+
+func TestHostStore_StaleHostsDetectedAfterUpdateGap(t *testing.T) {
+	s := NewHostStoreWithConfig(HostConfig{StaleFactor: 3, StaleMin: 10 * time.Second})
+	clock := time.Unix(1700000000, 0).UTC()
+	s.now = func() time.Time { return clock }
+	update := func(from uint32) {
+		s.ApplyHostData(from, `<HostData><HostData><Mod><Item ItemId="0" GName="g" NumP="1" /></Mod></HostData></HostData>`)
+	}
+
+	// Two hosts update every 20s; one also has too little history to judge.
+	for i := 0; i < 4; i++ {
+		update(0x1)
+		update(0x2)
+		clock = clock.Add(20 * time.Second)
+	}
+	update(0x3)
+	if got := s.StaleHostsCount(clock); got != 0 {
+		t.Fatalf("stale=%d while updating on schedule", got)
+	}
+
+	// 0x1 keeps updating; 0x2 goes quiet (its last update was 20s ago).
+	// 3x the 20s interval is 60s.
+	for i := 0; i < 2; i++ {
+		clock = clock.Add(20 * time.Second)
+		update(0x1)
+	}
+	if got := s.StaleHostsCount(clock); got != 0 {
+		t.Fatalf("stale=%d at exactly 60s gap, want 0", got)
+	}
+	clock = clock.Add(5 * time.Second)
+	update(0x1)
+	if got := s.StaleHostsCount(clock); got != 1 {
+		t.Fatalf("stale=%d after 65s gap, want 1 (host 0x2)", got)
+	}
+
+	// A fresh update clears it.
+	update(0x2)
+	if got := s.StaleHostsCount(clock); got != 0 {
+		t.Fatalf("stale=%d after 0x2 updated", got)
+	}
+}
+
+func TestHostStore_ActiveGamesCountSkipsQuietHosts(t *testing.T) {
+	s := NewHostStore()
+	clock := time.Unix(1700000000, 0).UTC()
+	s.now = func() time.Time { return clock }
+	update := func(from uint32) {
+		s.ApplyHostData(from, `<HostData><HostData><Mod><Item ItemId="0" GName="g" NumP="1" /></Mod></HostData></HostData>`)
+	}
+
+	update(0x1) // goes stale
+	clock = clock.Add(15 * time.Minute)
+	update(0x2) // fresh
+
+	if got := s.VisibleGamesCount(); got != 2 {
+		t.Fatalf("visible=%d want 2", got)
+	}
+	if got := s.ActiveGamesCount(clock, s.ActiveWindow()); got != 1 {
+		t.Fatalf("active=%d within %s, want 1", got, s.ActiveWindow())
+	}
+	if got := s.ActiveGamesCount(clock, time.Hour); got != 2 {
+		t.Fatalf("active=%d within 1h, want 2", got)
+	}
+}
+
+func TestHostStore_TopMapsCountsAndOrders(t *testing.T) {
+	s := NewHostStore()
+	if got := s.TopMaps(3); len(got) != 0 {
+		t.Fatalf("empty store TopMaps=%v", got)
+	}
+	for i, m := range []string{"Urban", "DesertCombat", "Alps", "DesertCombat", "Urban", "DesertCombat", ""} {
+		s.ApplyHostData(uint32(i+1), `<HostData><HostData><New><Item ItemId="0" GName="g" Map="`+m+`" NumP="1" /></New></HostData></HostData>`)
+	}
+
+	want := []string{"DesertCombat (3)", "Urban (2)", "Alps (1)"}
+	if got := s.TopMaps(0); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("TopMaps(0)=%v want %v", got, want)
+	}
+	if got := s.TopMaps(2); strings.Join(got, ",") != strings.Join(want[:2], ",") {
+		t.Fatalf("TopMaps(2)=%v want %v", got, want[:2])
+	}
+
+	// Host-controlled names cannot inject News lines, and long ones are capped.
+	t2 := NewHostStore()
+	for i, m := range []string{"Evil\r\nServer: fake", "\x01\x7f", strings.Repeat("x", 100)} {
+		t2.ApplyHostData(uint32(i+1), `<HostData><HostData><New><Item ItemId="0" GName="g" Map="m" /></New></HostData></HostData>`)
+		t2.mu.Lock()
+		t2.hosts[hostKey(i+1)].server["Map"] = m
+		t2.mu.Unlock()
+	}
+	got := t2.TopMaps(0)
+	want = []string{"EvilServer: fake (1)", strings.Repeat("x", maxTopMapLen) + " (1)"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("sanitized TopMaps=%q want %q", got, want)
+	}
+}
+
+func TestHostStore_RemoveByRid(t *testing.T) {
+	s := NewHostStore()
+	s.ApplyHostData(0x1, `<HostData><HostData><New><Item ItemId="0" GName="a" /></New></HostData></HostData>`)
+	s.ApplyHostData(0x2, `<HostData><HostData><New><Item ItemId="0" GName="b" /></New></HostData></HostData>`)
+
+	if s.RemoveByRid("9") {
+		t.Fatalf("RemoveByRid(unknown) = true")
+	}
+	if !s.RemoveByRid("1") {
+		t.Fatalf("RemoveByRid(1) = false")
+	}
+	if _, ok := s.RowByRid("1", nil); ok || s.VisibleGamesCount() != 1 {
+		t.Fatalf("rid 1 still listed; visible=%d", s.VisibleGamesCount())
+	}
+	if s.RemoveByRid("1") {
+		t.Fatalf("second RemoveByRid(1) = true")
+	}
+}
+
+func TestHostStore_ApplyHostDataHonorsSections(t *testing.T) {
+	s := NewHostStore()
+	from := uint32(0x44444444)
+	s.ApplyHostData(from, `<HostData><HostData><New>`+
+		`<Item ItemId="0" GName="x" Map="y" />`+
+		`<Item ItemId="2" Name="alice" />`+
+		`</New></HostData></HostData>`)
+
+	// One payload: a full-attribute Item under <Del> deletes, the <New> one upserts.
+	s.ApplyHostData(from, `<HostData><HostData>`+
+		`<Del><Item ItemId="2" Name="alice" /></Del>`+
+		`<New Count="1"><Item ItemId="3" Name="bob" /></New>`+
+		`</HostData></HostData>`)
+	h := s.hosts[hostKey(from)]
+	if h.players["2"] != nil || h.players["3"] == nil {
+		t.Fatalf("players=%v, want only 3", h.players)
+	}
+
+	// Deleting the server item with its attributes still present ends the game,
+	// and a re-add later in the same payload brings it back.
+	s.ApplyHostData(from, `<HostData><HostData><Del><Item ItemId="0" GName="x" /><Item ItemId="3" /></Del></HostData></HostData>`)
+	if got := s.VisibleGamesCount(); got != 0 {
+		t.Fatalf("VisibleGamesCount=%d after <Del> of ItemId=0", got)
+	}
+	s.ApplyHostData(from, `<HostData><HostData><Del><Item ItemId="0" /></Del><New><Item ItemId="0" GName="again" /></New></HostData></HostData>`)
+	if rows := s.GamesRows(0, nil); len(rows) != 1 || rows[0].Items["GName"] != "again" {
+		t.Fatalf("rows=%v after delete-then-re-add", rows)
+	}
+}
+
+func TestHostStore_InGameColumn(t *testing.T) {
+	s := NewHostStore()
+	host := func(from uint32, item string) {
+		s.ApplyHostData(from, `<HostData><HostData><New><Item ItemId="0" `+item+` /></New></HostData></HostData>`)
+	}
+	s.SetLoc(0x10, "STAGING AREA=lobby game")
+	host(0x10, `GName="lobby" NumP="2" MaxP="8"`)
+	s.SetLoc(0x20, "STAGING AREA=soon")
+	host(0x20, `GName="launched" NumP="2" MaxP="8"`)
+	s.SetLoc(0x20, "GAME=launched")
+	host(0x30, `GName="flagged" InGame="1"`)
+	s.SetLoc(0x40, "GAME=x")
+	host(0x40, `GName="status lobby" Status="0"`)
+	host(0x50, `GName="no loc"`)
+
+	want := map[string]string{
+		"lobby":        "0",
+		"launched":     "1",
+		"flagged":      "1",
+		"status lobby": "0",
+		"no loc":       "0",
+	}
+	for _, r := range s.GamesRows(0, nil) {
+		name := r.Items["GName"]
+		if got := r.Items["InGame"]; got != want[name] {
+			t.Fatalf("%s: InGame=%q want %q", name, got, want[name])
+		}
+		row, ok := s.RowByRid(r.Rid, nil)
+		if !ok || row.Items["InGame"] != want[name] {
+			t.Fatalf("%s: RowByRid InGame=%q want %q", name, row.Items["InGame"], want[name])
+		}
+	}
+}
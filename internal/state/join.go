@@ -0,0 +1,54 @@
+package state
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// DefaultGamePort is the Dungeon Siege session port joiners dial when the host
+// did not advertise one (see the README's NAT notes).
+const DefaultGamePort = 6073
+
+var (
+	// ErrUnknownGame is returned for a rid with no visible game.
+	ErrUnknownGame = errors.New("state: unknown game")
+	// ErrGameFull is returned when the game reports NumP >= MaxP.
+	ErrGameFull = errors.New("state: game is full")
+)
+
+// JoinTarget is where a joiner should connect for a game.
+type JoinTarget struct {
+	IpAddr string
+	Ip2    string
+	Port   int
+}
+
+// JoinTarget resolves rid to the host's connection details for joiner j, using
+// the same address choice as the browse rows.
+func (s *HostStore) JoinTarget(rid string, j Joiner) (JoinTarget, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, h := s.hostByRidLocked(rid)
+	if h == nil || !hostVisible(h) {
+		return JoinTarget{}, ErrUnknownGame
+	}
+	if hostFull(h.server) {
+		return JoinTarget{}, ErrGameFull
+	}
+	t := JoinTarget{Port: DefaultGamePort}
+	t.IpAddr, t.Ip2 = hostBrowseIPs(h, s.cfg, j)
+	if p := hostPort(h); p > 0 {
+		t.Port = p
+	}
+	return t, nil
+}
+
+// hostFull reports NumP >= MaxP. Missing or unparseable counts are not full, so
+// a host that never reported them can still be joined.
+func hostFull(server map[string]string) bool {
+	numP, errN := strconv.Atoi(strings.TrimSpace(server["NumP"]))
+	maxP, errM := strconv.Atoi(strings.TrimSpace(server["MaxP"]))
+	return errN == nil && errM == nil && maxP > 0 && numP >= maxP
+}
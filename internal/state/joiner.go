@@ -0,0 +1,79 @@
+package state
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// Joiner is the browsing client's network context for one Page/RowPg request.
+//
+// When the joiner and the host sit behind the same NAT (same observed public IP),
+// joining the public address needs NAT hairpinning, which many routers lack. If the
+// joiner reported its local IPs, browse rows then prefer a host-advertised private
+// IP on the same subnet. The zero value disables the check.
+type Joiner struct {
+	// ObservedIP is the joiner's remote address as seen by the server.
+	ObservedIP string
+	// LocalIPs are the joiner's self-reported interface addresses.
+	LocalIPs []string
+}
+
+// lanPrefixBits is the assumed subnet size: the client reports addresses, not
+// masks, and /24 is what home and small dedicated LANs use.
+const lanPrefixBits = 24
+
+// sameLANHostIP returns the first host-advertised private IPv4 that shares a /24
+// with one of j's local IPs, provided host and joiner share an observed public IP.
+func sameLANHostIP(h *hostSession, j Joiner) string {
+	observed := strings.TrimSpace(j.ObservedIP)
+	if observed == "" || len(j.LocalIPs) == 0 || observed != strings.TrimSpace(h.observedRemoteIP) {
+		return ""
+	}
+	var joinerNets []netip.Prefix
+	for _, s := range j.LocalIPs {
+		if p, ok := lanPrefix(s); ok {
+			joinerNets = append(joinerNets, p)
+		}
+	}
+	if len(joinerNets) == 0 {
+		return ""
+	}
+	for _, cand := range hostAdvertisedIPList(h.server) {
+		p, ok := lanPrefix(cand)
+		if !ok {
+			continue
+		}
+		for _, jn := range joinerNets {
+			if p == jn {
+				return cand
+			}
+		}
+	}
+	return ""
+}
+
+// lanPrefix returns the /24 of a private, non-loopback IPv4 address.
+func lanPrefix(s string) (netip.Prefix, bool) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(s))
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	addr = addr.Unmap()
+	if !addr.Is4() || !addr.IsPrivate() {
+		return netip.Prefix{}, false
+	}
+	p, err := addr.Prefix(lanPrefixBits)
+	return p, err == nil
+}
+
+// hostAdvertisedIPList returns every IP the host advertised (IpAddr, then Ip2's list).
+func hostAdvertisedIPList(server map[string]string) []string {
+	return ParseIPList(server["IpAddr"] + " " + server["Ip2"])
+}
+
+// ParseIPList splits a space- or comma-separated list of IPs, dropping empties.
+func ParseIPList(raw string) []string {
+	return strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\r' || r == '\n'
+	})
+}
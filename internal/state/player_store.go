@@ -1,6 +1,8 @@
 package state
 
 import (
+	"slices"
+	"sort"
 	"sync"
 	"time"
 )
@@ -8,16 +10,50 @@ import (
 type PlayerStore struct {
 	mu      sync.RWMutex
 	players map[uint32]Player
+
+	// seen counts distinct sessions added; peak is the most non-evicted players
+	// present at once. Both cover the store's lifetime.
+	seen int
+	peak int
+
+	// tombstones are evicted DPNIDs purged by PurgeEvicted whose transport
+	// session may still be open. They stay evicted (and unrevivable by Upsert)
+	// until Remove/RemoveSession reports the disconnect, or until PurgeEvicted
+	// drops them a further retention later.
+	tombstones map[uint32]tombstone
+
+	// restored holds snapshot entries (see Restore) not yet matched to a new
+	// session. They are not players: SetRemoteIP applies one only to a session
+	// with the same DPNID and remote IP before restoreUntil, and until then it
+	// counts nowhere.
+	restored     map[uint32]Player
+	restoreUntil time.Time
+}
+
+// tombstone is what PurgeEvicted keeps of a purged player.
+type tombstone struct {
+	connectedAt time.Time
+	purgedAt    time.Time
 }
 
 type Player struct {
 	DPNID       uint32
 	ConnectedAt time.Time
 	EvictedAt   time.Time
+
+	// LocalIPs are interface addresses the client reported (used for same-LAN joins).
+	LocalIPs []string
+
+	// RemoteIP is the transport address the session connected from (see
+	// SetRemoteIP); a snapshot keeps it to recognize the client after a restart.
+	RemoteIP string
+
+	// Admitted is set by Admit once the session has been sent the connect bundle.
+	Admitted bool
 }
 
 func NewPlayerStore() *PlayerStore {
-	return &PlayerStore{players: map[uint32]Player{}}
+	return &PlayerStore{players: map[uint32]Player{}, tombstones: map[uint32]tombstone{}, restored: map[uint32]Player{}}
 }
 
 func (s *PlayerStore) Upsert(dpnid uint32, now time.Time) {
@@ -31,20 +67,69 @@ func (s *PlayerStore) Upsert(dpnid uint32, now time.Time) {
 	if p, ok := s.players[dpnid]; ok && !p.EvictedAt.IsZero() {
 		return
 	}
+	if _, ok := s.tombstones[dpnid]; ok {
+		return
+	}
+	if _, ok := s.players[dpnid]; !ok {
+		s.seen++
+	}
 	s.players[dpnid] = Player{DPNID: dpnid, ConnectedAt: now}
+	s.peak = max(s.peak, s.countLocked())
+}
+
+// Peak returns the high-water mark of concurrent (non-evicted) players.
+func (s *PlayerStore) Peak() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.peak
+}
+
+// Seen returns how many distinct player sessions have connected.
+func (s *PlayerStore) Seen() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.seen
 }
 
 func (s *PlayerStore) Remove(dpnid uint32) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	_, ok := s.players[dpnid]
+	_, dead := s.tombstones[dpnid]
+	delete(s.players, dpnid)
+	delete(s.tombstones, dpnid)
+	return ok || dead
+}
+
+// RemoveSession is Remove that also reports how long the player was connected
+// as of now. ok is false (and the duration 0) when dpnid was not present; like
+// Remove, a tombstoned DPNID counts as present.
+func (s *PlayerStore) RemoveSession(dpnid uint32, now time.Time) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var connectedAt time.Time
+	if p, ok := s.players[dpnid]; ok {
+		connectedAt = p.ConnectedAt
+	} else if ts, ok := s.tombstones[dpnid]; ok {
+		connectedAt = ts.connectedAt
+	} else {
+		return 0, false
+	}
 	delete(s.players, dpnid)
-	return ok
+	delete(s.tombstones, dpnid)
+	if now.IsZero() {
+		now = time.Now().UTC()
+	}
+	return max(now.Sub(connectedAt), 0), true
 }
 
 func (s *PlayerStore) Count() int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.countLocked()
+}
+
+func (s *PlayerStore) countLocked() int {
 	n := 0
 	for _, p := range s.players {
 		if p.EvictedAt.IsZero() {
@@ -54,9 +139,128 @@ func (s *PlayerStore) Count() int {
 	return n
 }
 
+// SetRemoteIP records the address dpnid connected from. If a restored entry
+// (see Restore) has the same DPNID and address and the restore grace has not
+// run out, the session is taken to be that client back after a restart and
+// keeps its connect time and eviction; any other restored entry for dpnid is
+// discarded, since DPNIDs are handed out again after a restart.
+func (s *PlayerStore) SetRemoteIP(dpnid uint32, ip string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.players[dpnid]
+	if !ok {
+		return
+	}
+	if now.IsZero() {
+		now = time.Now().UTC()
+	}
+	p.RemoteIP = ip
+	if r, ok := s.restored[dpnid]; ok {
+		delete(s.restored, dpnid)
+		if ip != "" && r.RemoteIP == ip && now.Before(s.restoreUntil) {
+			p.ConnectedAt, p.EvictedAt = r.ConnectedAt, r.EvictedAt
+		}
+	}
+	s.players[dpnid] = p
+}
+
+// Admit records that dpnid was let in by the protocol Connect handshake.
+func (s *PlayerStore) Admit(dpnid uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.players[dpnid]
+	if !ok {
+		return
+	}
+	p.Admitted = true
+	s.players[dpnid] = p
+}
+
+// Admitted reports whether Admit was called for dpnid's current session.
+func (s *PlayerStore) Admitted(dpnid uint32) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.players[dpnid].Admitted
+}
+
+// SetLocalIPs records the client's self-reported interface addresses.
+func (s *PlayerStore) SetLocalIPs(dpnid uint32, ips []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.players[dpnid]
+	if !ok {
+		return
+	}
+	p.LocalIPs = append([]string(nil), ips...)
+	s.players[dpnid] = p
+}
+
+// LocalIPs returns the addresses recorded by SetLocalIPs, or nil.
+func (s *PlayerStore) LocalIPs(dpnid uint32) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.players[dpnid].LocalIPs
+}
+
+// Connected returns the DPNIDs of non-evicted players in ascending order.
+func (s *PlayerStore) Connected() []uint32 {
+	s.mu.RLock()
+	out := make([]uint32, 0, len(s.players))
+	for dpnid, p := range s.players {
+		if p.EvictedAt.IsZero() {
+			out = append(out, dpnid)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// Oldest returns up to n non-evicted players that connected by now, longest
+// connected first (ties by DPNID). A zero ConnectedAt sorts as oldest.
+func (s *PlayerStore) Oldest(n int, now time.Time) []Player {
+	if n <= 0 {
+		return nil
+	}
+	if now.IsZero() {
+		now = time.Now().UTC()
+	}
+	s.mu.RLock()
+	out := make([]Player, 0, len(s.players))
+	for _, p := range s.players {
+		if p.EvictedAt.IsZero() && !p.ConnectedAt.After(now) {
+			p.LocalIPs = slices.Clone(p.LocalIPs)
+			out = append(out, p)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].ConnectedAt.Equal(out[j].ConnectedAt) {
+			return out[i].ConnectedAt.Before(out[j].ConnectedAt)
+		}
+		return out[i].DPNID < out[j].DPNID
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// Has reports whether dpnid is in the store, evicted (or purged) or not.
+func (s *PlayerStore) Has(dpnid uint32) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.players[dpnid]
+	_, dead := s.tombstones[dpnid]
+	return ok || dead
+}
+
 func (s *PlayerStore) IsEvicted(dpnid uint32) bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	if _, ok := s.tombstones[dpnid]; ok {
+		return true
+	}
 	p, ok := s.players[dpnid]
 	return ok && !p.EvictedAt.IsZero()
 }
@@ -79,6 +283,45 @@ func (s *PlayerStore) TouchEvict(dpnid uint32, now time.Time) bool {
 	return true
 }
 
+// PurgeEvicted drops the records of players evicted at least retention ago and
+// returns how many it removed. Evicted entries normally go on DestroyPlayer; this
+// bounds the map when that never arrives (e.g. the transport was left open). The
+// DPNID is kept as a tombstone so the session stays evicted while it may still
+// be connected; tombstones are dropped (and counted) after another retention, so
+// sessions that never disconnect do not pile up either. <= 0 keeps all. Restored entries (see Restore) still unmatched
+// when their grace runs out are dropped too, whatever the retention; they are
+// not counted.
+func (s *PlayerStore) PurgeEvicted(now time.Time, retention time.Duration) int {
+	if now.IsZero() {
+		now = time.Now().UTC()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.restored) > 0 && !now.Before(s.restoreUntil) {
+		clear(s.restored)
+	}
+	if retention <= 0 {
+		return 0
+	}
+
+	n := 0
+	for dpnid, p := range s.players {
+		if !p.EvictedAt.IsZero() && now.Sub(p.EvictedAt) >= retention {
+			delete(s.players, dpnid)
+			s.tombstones[dpnid] = tombstone{connectedAt: p.ConnectedAt, purgedAt: now}
+			n++
+		}
+	}
+	for dpnid, ts := range s.tombstones {
+		if now.Sub(ts.purgedAt) >= retention {
+			delete(s.tombstones, dpnid)
+			n++
+		}
+	}
+	return n
+}
+
 // SweepEvict evicts players connected longer than maxAge.
 // Returns the list of DPNIDs newly evicted in this sweep.
 func (s *PlayerStore) SweepEvict(now time.Time, maxAge time.Duration) []uint32 {
@@ -0,0 +1,122 @@
+package state
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPlayerStore_PeakIsHighWaterMark(t *testing.T) {
+	s := NewPlayerStore()
+	now := time.Now().UTC()
+	for _, id := range []uint32{1, 2, 3} {
+		s.Upsert(id, now)
+	}
+	s.Remove(1)
+	s.Remove(2)
+	s.Upsert(4, now)
+	s.Upsert(4, now) // a refresh is not a new player
+
+	if got := s.Count(); got != 2 {
+		t.Fatalf("Count=%d want 2", got)
+	}
+	if got := s.Peak(); got != 3 {
+		t.Fatalf("Peak=%d want 3 (max concurrent, not current)", got)
+	}
+	if got := s.Seen(); got != 4 {
+		t.Fatalf("Seen=%d want 4", got)
+	}
+
+	// Evicted players do not count toward concurrency.
+	s.TouchEvict(3, now)
+	s.TouchEvict(4, now)
+	s.Upsert(5, now)
+	s.Upsert(6, now)
+	if got := s.Peak(); got != 3 {
+		t.Fatalf("Peak=%d after evictions want 3", got)
+	}
+	s.Upsert(7, now)
+	s.Upsert(8, now)
+	if got := s.Peak(); got != 4 {
+		t.Fatalf("Peak=%d want 4", got)
+	}
+}
+
+func TestPlayerStore_OldestSkipsEvictedAndSortsByAge(t *testing.T) {
+	s := NewPlayerStore()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.Upsert(1, now.Add(-10*time.Minute))
+	s.Upsert(2, now.Add(-time.Hour))
+	s.Upsert(3, now.Add(-30*time.Minute))
+	s.Upsert(4, now.Add(-2*time.Hour))
+	s.TouchEvict(4, now) // oldest, but evicted
+	s.Upsert(5, now.Add(-time.Minute))
+	// A zero connect time sorts as oldest.
+	s.mu.Lock()
+	s.players[6] = Player{DPNID: 6}
+	s.mu.Unlock()
+
+	ids := func(ps []Player) []uint32 {
+		out := make([]uint32, 0, len(ps))
+		for _, p := range ps {
+			out = append(out, p.DPNID)
+		}
+		return out
+	}
+	if got := ids(s.Oldest(3, now)); !slices.Equal(got, []uint32{6, 2, 3}) {
+		t.Fatalf("Oldest(3)=%v want [6 2 3]", got)
+	}
+	if got := ids(s.Oldest(10, now)); !slices.Equal(got, []uint32{6, 2, 3, 1, 5}) {
+		t.Fatalf("Oldest(10)=%v want [6 2 3 1 5]", got)
+	}
+	if got := s.Oldest(0, now); got != nil {
+		t.Fatalf("Oldest(0)=%v want nil", got)
+	}
+}
+
+func TestPlayerStore_PurgeEvictedKeepsRecent(t *testing.T) {
+	s := NewPlayerStore()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, id := range []uint32{1, 2, 3} {
+		s.Upsert(id, now.Add(-3*time.Hour))
+	}
+	s.TouchEvict(1, now.Add(-2*time.Hour)) // past retention
+	s.TouchEvict(2, now.Add(-10*time.Minute))
+
+	if n := s.PurgeEvicted(now, 0); n != 0 {
+		t.Fatalf("PurgeEvicted(retention=0)=%d want 0", n)
+	}
+	if n := s.PurgeEvicted(now, time.Hour); n != 1 {
+		t.Fatalf("PurgeEvicted=%d want 1", n)
+	}
+	if s.LocalIPs(1) != nil || slices.ContainsFunc(s.Oldest(10, now), func(p Player) bool { return p.DPNID == 1 }) {
+		t.Fatal("old evicted entry 1 still present")
+	}
+	// The purged session may still be connected: it stays evicted until its
+	// disconnect, and a late Upsert does not revive it.
+	s.Upsert(1, now)
+	if !s.IsEvicted(1) || !s.Has(1) {
+		t.Fatal("purged entry 1 no longer evicted")
+	}
+	if d, ok := s.RemoveSession(1, now); !ok || d != 3*time.Hour || s.Has(1) {
+		t.Fatalf("disconnect of tombstoned 1: d=%v ok=%v has=%v", d, ok, s.Has(1))
+	}
+	if !s.IsEvicted(2) {
+		t.Fatal("recent evicted entry 2 purged")
+	}
+	if got := s.Connected(); !slices.Equal(got, []uint32{3}) {
+		t.Fatalf("Connected=%v want [3]", got)
+	}
+
+	// A tombstone whose disconnect never arrives is dropped a retention later.
+	s.TouchEvict(3, now)
+	if n := s.PurgeEvicted(now.Add(time.Hour), time.Hour); n != 2 || !s.Has(3) || !s.IsEvicted(2) {
+		t.Fatalf("PurgeEvicted=%d has(3)=%v, want 2 and a tombstone", n, s.Has(3))
+	}
+	if n := s.PurgeEvicted(now.Add(2*time.Hour), time.Hour); n != 2 || s.Has(3) || len(s.tombstones) != 0 {
+		t.Fatalf("PurgeEvicted=%d tombstones=%v, want 2's and 3's dropped", n, s.tombstones)
+	}
+	if s.Remove(3) {
+		t.Fatal("Remove of a forgotten DPNID reported it present")
+	}
+}
@@ -0,0 +1,64 @@
+package state
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// RegionRange tags hosts whose observed IP falls in Prefix with Region.
+type RegionRange struct {
+	Prefix netip.Prefix
+	Region string
+}
+
+// ParseRegionMap parses `state.region_map` entries of the form "CIDR=Region"
+// (a bare IP is a single host). The result is ordered most specific prefix
+// first, so the longest match wins in regionFor.
+func ParseRegionMap(raw []string) ([]RegionRange, error) {
+	out := make([]RegionRange, 0, len(raw))
+	for _, entry := range raw {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		cidr, region, ok := strings.Cut(entry, "=")
+		cidr, region = strings.TrimSpace(cidr), strings.TrimSpace(region)
+		if !ok || region == "" {
+			return nil, fmt.Errorf("%q: want CIDR=Region", entry)
+		}
+		var p netip.Prefix
+		if strings.Contains(cidr, "/") {
+			parsed, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				return nil, err
+			}
+			p = parsed.Masked()
+		} else {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, err
+			}
+			p = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		out = append(out, RegionRange{Prefix: p, Region: region})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Prefix.Bits() > out[j].Prefix.Bits() })
+	return out, nil
+}
+
+// regionFor returns the region of the first range containing ip, or "".
+func regionFor(ranges []RegionRange, ip string) string {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	for _, r := range ranges {
+		if r.Prefix.Contains(addr) {
+			return r.Region
+		}
+	}
+	return ""
+}
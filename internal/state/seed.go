@@ -0,0 +1,93 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// SeedGame is one synthetic game in a seed file (state.seed_path), for demos and
+// UI testing without real hosts.
+type SeedGame struct {
+	GName  string `json:"gname"`
+	Map    string `json:"map"`
+	IpAddr string `json:"ip_addr"`
+	Ip2    string `json:"ip2,omitempty"`
+	Port   int    `json:"port,omitempty"`
+	NumP   int    `json:"num_p"`
+	MaxP   int    `json:"max_p"`
+
+	// Items are extra server-item attributes (GameV, Difficulty, ...), as a host
+	// would send them in HostData.
+	Items map[string]string `json:"items,omitempty"`
+}
+
+// Seeded sessions are keyed from seedKeyBase up, above every 32-bit DPNID, so a
+// real host never lands on one.
+const (
+	seedKeyBase  hostKey = 1 << 32
+	maxSeedGames         = 256
+)
+
+// LoadSeed reads a JSON list of SeedGame from path and lists each as a
+// synthetic host session with its own rid. Seeded games never disconnect, are
+// marked GameRow.Seeded, and are left out of TotalGamesHosted; the snapshot only
+// keeps the rid counter, so they are never persisted either. Nothing is added
+// unless every entry is valid.
+func (s *HostStore) LoadSeed(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var games []SeedGame
+	if err := json.Unmarshal(b, &games); err != nil {
+		return fmt.Errorf("seed %s: %w", path, err)
+	}
+	for i, g := range games {
+		if strings.TrimSpace(g.GName) == "" {
+			return fmt.Errorf("seed %s: game %d: gname is required", path, i)
+		}
+		if g.Port < 0 || g.Port > 65535 || g.NumP < 0 || g.MaxP < 0 {
+			return fmt.Errorf("seed %s: game %d (%s): invalid port or player counts", path, i, g.GName)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seeded+len(games) > maxSeedGames {
+		return fmt.Errorf("seed %s: more than %d seeded games", path, maxSeedGames)
+	}
+	now := s.now().UTC()
+	for _, g := range games {
+		server := make(map[string]string, len(g.Items)+7)
+		for k, v := range g.Items {
+			server[k] = v
+		}
+		server["GName"] = g.GName
+		copyIfNonEmpty(server, "Map", g.Map)
+		copyIfNonEmpty(server, "IpAddr", g.IpAddr)
+		copyIfNonEmpty(server, "Ip2", g.Ip2)
+		if g.Port > 0 {
+			server["Port"] = strconv.Itoa(g.Port)
+		}
+		server["NumP"] = strconv.Itoa(g.NumP)
+		server["MaxP"] = strconv.Itoa(g.MaxP)
+
+		k := seedKeyBase + hostKey(s.seeded)
+		s.seeded++
+		h := &hostSession{
+			lastUpdate: now,
+			seeded:     true,
+			server:     server,
+			players:    map[string]map[string]string{},
+		}
+		s.putHostLocked(k, h)
+		s.assignRidLocked(k, h)
+	}
+	if len(games) > 0 {
+		s.version++
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHostStore_LoadSeedListsSyntheticGames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seed.json")
+	seed := `[
+  {"gname": "Demo One", "map": "Arena", "ip_addr": "203.0.113.10", "port": 2302, "num_p": 2, "max_p": 8, "items": {"GameV": "1.0"}},
+  {"gname": "Demo Two", "map": "Canyon", "ip_addr": "198.51.100.20", "num_p": 0, "max_p": 4}
+]`
+	if err := os.WriteFile(path, []byte(seed), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewHostStore()
+	if err := s.LoadSeed(path); err != nil {
+		t.Fatalf("LoadSeed: %v", err)
+	}
+	rows := s.GamesRows(0, nil)
+	if len(rows) != 2 {
+		t.Fatalf("rows=%+v", rows)
+	}
+	one, two := rows[0], rows[1]
+	if one.Items["GName"] == "Demo Two" {
+		one, two = two, one
+	}
+	if !one.Seeded || !two.Seeded || one.Rid == two.Rid {
+		t.Fatalf("rows not seeded with distinct rids: %+v", rows)
+	}
+	if one.Items["Map"] != "Arena" || one.Items["IpAddr"] != "203.0.113.10" || one.Items["Port"] != "2302" ||
+		one.Items["NumP"] != "2" || one.Items["MaxP"] != "8" || one.Items["GameV"] != "1.0" {
+		t.Fatalf("Demo One row=%+v", one.Items)
+	}
+	if two.Items["GName"] != "Demo Two" || two.Items["IpAddr"] != "198.51.100.20" {
+		t.Fatalf("Demo Two row=%+v", two.Items)
+	}
+	if n := s.TotalGamesHosted(); n != 0 {
+		t.Fatalf("TotalGamesHosted=%d counts seeded games", n)
+	}
+
+	// A real host is not seeded and is counted.
+	s.ApplyHostData(0x1, `<HostData><HostData><New><Item ItemId="0" GName="real" Map="m" /></New></HostData></HostData>`)
+	if row, ok := s.RowByRid("3", nil); !ok || row.Seeded || s.TotalGamesHosted() != 1 {
+		t.Fatalf("real row=%+v ok=%v total=%d", row, ok, s.TotalGamesHosted())
+	}
+
+	// A real host on the top DPNID does not clobber a seeded game.
+	s.ApplyHostData(0xffffffff, `<HostData><HostData><New><Item ItemId="0" GName="top" Map="m" /></New></HostData></HostData>`)
+	rows = s.GamesRows(0, nil)
+	if len(rows) != 4 {
+		t.Fatalf("rows=%d after host on top DPNID", len(rows))
+	}
+	for _, r := range rows {
+		if r.Items["GName"] == "top" && !s.RemoveByRid(r.Rid) {
+			t.Fatalf("RemoveByRid(%s) failed", r.Rid)
+		}
+	}
+
+	// An invalid file adds nothing.
+	if err := os.WriteFile(path, []byte(`[{"gname": "ok"}, {"map": "no name"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.LoadSeed(path); err == nil || len(s.GamesRows(0, nil)) != 3 {
+		t.Fatalf("bad seed err=%v rows=%d", err, len(s.GamesRows(0, nil)))
+	}
+}
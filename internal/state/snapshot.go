@@ -0,0 +1,266 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// maxRid is the first rid never handed out: the client parses rids into a signed
+// 32-bit int.
+const maxRid = 0x7fffffff
+
+// HostSnapshot is the HostStore state worth keeping across restarts. Sessions
+// themselves die with the process (their DPNIDs are gone); the rid counter must
+// not, or a new game could reuse an rid a still-running client remembers.
+type HostSnapshot struct {
+	V       int    `json:"v"`
+	NextRid uint32 `json:"next_rid"`
+}
+
+const hostSnapshotVersion = 1
+
+// Snapshot captures the rid counter, already past every rid assigned so far
+// (and past the reserved block, see SetRidReservation).
+func (s *HostStore) Snapshot() HostSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return HostSnapshot{V: hostSnapshotVersion, NextRid: max(s.nextRid, s.reservedRid)}
+}
+
+// ridReserveRetry is how long rid reservation waits after a failed persist
+// before trying again.
+const ridReserveRetry = 10 * time.Second
+
+// SetRidReservation makes rid assignment crash-safe: rids are only handed out
+// below a high-water mark that persist has already written, so a restart from
+// the last persisted snapshot never reuses one (at the cost of skipping up to
+// block). The first mark, block rids ahead, is written before it returns; later
+// ones are written in the background once fewer than half a block of reserved
+// rids remain, so the disk is never touched under the store lock. If persist
+// falls behind or fails, rids are still issued; a failure is retried after
+// ridReserveRetry, and persist is expected to log it.
+func (s *HostStore) SetRidReservation(block uint32, persist func(HostSnapshot) error) error {
+	s.mu.Lock()
+	s.reserveRids = persist
+	s.ridBlock = max(block, 1)
+	s.reservedRid = 0
+	s.reserving = true
+	hi := s.ridMarkLocked(s.nextRid)
+	s.mu.Unlock()
+	return s.persistRidMark(persist, hi)
+}
+
+// ridMarkLocked is the high-water mark a block past from, kept below maxRid.
+// s.mu must be held.
+func (s *HostStore) ridMarkLocked(from uint32) uint32 {
+	hi := uint64(max(from, 1)) + uint64(s.ridBlock)
+	if hi >= maxRid {
+		hi = maxRid - 1
+	}
+	return uint32(hi)
+}
+
+// reserveRidsLocked starts writing the next high-water mark when fewer than half
+// a block of reserved rids are left. s.mu must be held.
+func (s *HostStore) reserveRidsLocked() {
+	if s.reserveRids == nil || s.reserving || s.nextRid < s.reservedRid && s.reservedRid-s.nextRid > s.ridBlock/2 {
+		return
+	}
+	if time.Now().Before(s.reserveRetryAt) {
+		return
+	}
+	hi := s.ridMarkLocked(max(s.nextRid, s.reservedRid))
+	if hi <= s.reservedRid {
+		return
+	}
+	s.reserving = true
+	go func(persist func(HostSnapshot) error) { _ = s.persistRidMark(persist, hi) }(s.reserveRids)
+}
+
+// persistRidMark writes hi and, once it is on disk, lets rids up to it be
+// issued. s.reserving must be set by the caller; it is cleared here.
+func (s *HostStore) persistRidMark(persist func(HostSnapshot) error, hi uint32) error {
+	err := persist(HostSnapshot{V: hostSnapshotVersion, NextRid: hi})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reserving = false
+	if err != nil {
+		s.reserveRetryAt = time.Now().Add(ridReserveRetry)
+		return err
+	}
+	s.reservedRid = max(s.reservedRid, hi)
+	return nil
+}
+
+// Restore resumes rid assignment from snap, never moving the counter backwards.
+// An out-of-range counter (a corrupt file, or one saved right at the wrap) is
+// ignored.
+func (s *HostStore) Restore(snap HostSnapshot) {
+	if snap.NextRid == 0 || snap.NextRid >= maxRid {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if snap.NextRid > s.nextRid {
+		s.nextRid = snap.NextRid
+	}
+}
+
+// PlayerSnapshot is the PlayerStore session state worth keeping across a quick
+// restart: when each DPNID connected and whether it was evicted, so the max-age
+// sweep neither restarts its clock nor lets an evicted session back in.
+type PlayerSnapshot struct {
+	V       int              `json:"v"`
+	Players []SnapshotPlayer `json:"players"`
+}
+
+// SnapshotPlayer is one PlayerStore entry in a PlayerSnapshot.
+type SnapshotPlayer struct {
+	DPNID       uint32    `json:"dpnid"`
+	ConnectedAt time.Time `json:"connected_at"`
+	EvictedAt   time.Time `json:"evicted_at,omitzero"`
+	RemoteIP    string    `json:"remote_ip,omitempty"`
+}
+
+const playerSnapshotVersion = 1
+
+// Snapshot captures every player, evicted or not, in DPNID order, plus restored
+// entries still waiting for their DPNID to reconnect.
+func (s *PlayerStore) Snapshot() PlayerSnapshot {
+	s.mu.RLock()
+	out := make([]SnapshotPlayer, 0, len(s.players)+len(s.restored))
+	for _, m := range []map[uint32]Player{s.players, s.restored} {
+		for _, p := range m {
+			out = append(out, SnapshotPlayer{DPNID: p.DPNID, ConnectedAt: p.ConnectedAt, EvictedAt: p.EvictedAt, RemoteIP: p.RemoteIP})
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].DPNID < out[j].DPNID })
+	return PlayerSnapshot{V: playerSnapshotVersion, Players: out}
+}
+
+// RestoreGrace is how long after Restore a reconnecting client can still be
+// matched to its restored entry; clients back after a quick restart reconnect
+// well within it.
+const RestoreGrace = 5 * time.Minute
+
+// Restore keeps the players in snap that are not already in the store (a live
+// session always wins) aside for RestoreGrace after now. A new session only
+// takes one over when SetRemoteIP sees the same DPNID from the same address:
+// DPNIDs are reused after a restart, so the id alone would hand an old age or
+// eviction to a stranger. Until then a restored entry is not online: it is left
+// out of Count, Connected, Peak, Has and IsEvicted. Entries without an address
+// (older snapshots) never match; unmatched entries are dropped by the first
+// PurgeEvicted after the grace.
+func (s *PlayerStore) Restore(snap PlayerSnapshot, now time.Time) {
+	if now.IsZero() {
+		now = time.Now().UTC()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.restoreUntil = now.Add(RestoreGrace)
+	for _, sp := range snap.Players {
+		if _, ok := s.players[sp.DPNID]; ok {
+			continue
+		}
+		if _, ok := s.tombstones[sp.DPNID]; ok {
+			continue
+		}
+		s.restored[sp.DPNID] = Player{DPNID: sp.DPNID, ConnectedAt: sp.ConnectedAt, EvictedAt: sp.EvictedAt, RemoteIP: sp.RemoteIP}
+	}
+}
+
+// ReadHostSnapshot loads a snapshot written by WriteHostSnapshot. A missing file
+// returns an error wrapping os.ErrNotExist.
+func ReadHostSnapshot(path string) (HostSnapshot, error) {
+	var snap HostSnapshot
+	if err := readSnapshot(path, "host", &snap); err != nil {
+		return HostSnapshot{}, err
+	}
+	if snap.V != hostSnapshotVersion {
+		return HostSnapshot{}, fmt.Errorf("host snapshot %s: unsupported version %d", path, snap.V)
+	}
+	return snap, nil
+}
+
+// ReadPlayerSnapshot loads a snapshot written by WritePlayerSnapshot. A missing
+// file returns an error wrapping os.ErrNotExist.
+func ReadPlayerSnapshot(path string) (PlayerSnapshot, error) {
+	var snap PlayerSnapshot
+	if err := readSnapshot(path, "player", &snap); err != nil {
+		return PlayerSnapshot{}, err
+	}
+	if snap.V != playerSnapshotVersion {
+		return PlayerSnapshot{}, fmt.Errorf("player snapshot %s: unsupported version %d", path, snap.V)
+	}
+	return snap, nil
+}
+
+func readSnapshot(path, kind string, snap any) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, snap); err != nil {
+		return fmt.Errorf("%s snapshot %s: %w", kind, path, err)
+	}
+	return nil
+}
+
+// WriteHostSnapshot saves snap to path via a temp file and rename, so a crash
+// mid-write leaves the previous snapshot intact.
+func WriteHostSnapshot(path string, snap HostSnapshot) error {
+	return writeSnapshot(path, snap)
+}
+
+// WritePlayerSnapshot saves snap to path like WriteHostSnapshot.
+func WritePlayerSnapshot(path string, snap PlayerSnapshot) error {
+	return writeSnapshot(path, snap)
+}
+
+func writeSnapshot(path string, snap any) error {
+	b, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	// Flush the data before the rename makes it the snapshot, so a crash cannot
+	// leave an empty file behind the new name.
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// syncDir flushes dir's entries so a completed rename survives a crash. Some
+// platforms (Windows) cannot sync a directory; there the rename is left to the
+// filesystem.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
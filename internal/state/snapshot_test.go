@@ -0,0 +1,223 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHostSnapshot_RestoreResumesRidsAboveMax(t *testing.T) {
+	host := func(s *HostStore, from uint32) string {
+		s.ApplyHostData(from, `<HostData><HostData><New><Item ItemId="0" GName="g`+strconv.Itoa(int(from))+`" /></New></HostData></HostData>`)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return strconv.FormatUint(uint64(s.hosts[hostKey(from)].rid), 10)
+	}
+
+	before := NewHostStore()
+	for from := uint32(1); from <= 3; from++ {
+		host(before, from)
+	}
+	path := filepath.Join(t.TempDir(), "hosts.json")
+	if err := WriteHostSnapshot(path, before.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := ReadHostSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := NewHostStore()
+	after.Restore(snap)
+	if rid := host(after, 0x10); rid != "4" {
+		t.Fatalf("first rid after restore=%s, want 4", rid)
+	}
+
+	// Restore never moves the counter back, and ignores out-of-range values.
+	after.Restore(HostSnapshot{V: 1, NextRid: 2})
+	after.Restore(HostSnapshot{V: 1, NextRid: maxRid})
+	if rid := host(after, 0x11); rid != "5" {
+		t.Fatalf("rid=%s, want 5", rid)
+	}
+
+	if _, err := ReadHostSnapshot(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("missing file err=%v, want os.ErrNotExist", err)
+	}
+}
+
+func TestHostStore_RidBase(t *testing.T) {
+	s := NewHostStoreWithConfig(HostConfig{RidBase: 1000})
+	s.ApplyHostData(0x1, `<HostData><HostData><New><Item ItemId="0" GName="g" /></New></HostData></HostData>`)
+	if rows := s.GamesRows(0, nil); len(rows) != 1 || rows[0].Rid != "1000" {
+		t.Fatalf("rows=%v, want rid 1000", rows)
+	}
+}
+
+func TestPlayerSnapshot_RoundTripKeepsAgeAndEviction(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := NewPlayerStore()
+	before.Upsert(0x10, t0)
+	before.SetRemoteIP(0x10, "203.0.113.1", t0)
+	before.Upsert(0x20, t0.Add(time.Hour))
+	before.SetRemoteIP(0x20, "203.0.113.2", t0)
+	before.TouchEvict(0x20, t0.Add(2*time.Hour))
+	before.Upsert(0x40, t0.Add(time.Hour))
+	before.SetRemoteIP(0x40, "203.0.113.4", t0)
+
+	path := filepath.Join(t.TempDir(), "players.json")
+	if err := WritePlayerSnapshot(path, before.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := ReadPlayerSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restart := t0.Add(3 * time.Hour)
+	after := NewPlayerStore()
+	after.Upsert(0x30, restart) // a live session is kept as is
+	after.Restore(snap, restart)
+
+	// Restored sessions are not online until their client connects again.
+	if n, got := after.Count(), after.Connected(); n != 1 || !slices.Equal(got, []uint32{0x30}) || after.Peak() != 1 {
+		t.Fatalf("after Restore Count=%d Connected=%v Peak=%d, want only 0x30", n, got, after.Peak())
+	}
+	if after.Has(0x10) || after.IsEvicted(0x20) {
+		t.Fatal("restored entries visible before CREATE_PLAYER")
+	}
+	if got := after.Snapshot().Players; len(got) != 4 {
+		t.Fatalf("snapshot dropped pending restores: %v", got)
+	}
+
+	// The same DPNID from the same address is the client back: an evicted one
+	// stays locked out, and the age survives.
+	after.Upsert(0x20, restart.Add(time.Minute))
+	after.SetRemoteIP(0x20, "203.0.113.2", restart.Add(time.Minute))
+	if !after.IsEvicted(0x20) || after.Count() != 1 {
+		t.Fatal("an evicted restored player came back online")
+	}
+	after.Upsert(0x10, restart.Add(time.Minute))
+	after.SetRemoteIP(0x10, "203.0.113.1", restart.Add(time.Minute))
+	if got := after.Connected(); !slices.Equal(got, []uint32{0x10, 0x30}) || after.IsEvicted(0x10) {
+		t.Fatalf("Connected=%v", got)
+	}
+	// A reused DPNID from another address is a new client with a fresh clock.
+	after.Upsert(0x40, restart.Add(time.Minute))
+	after.SetRemoteIP(0x40, "198.51.100.9", restart.Add(time.Minute))
+	if ev := after.SweepEvict(t0.Add(12*time.Hour), 12*time.Hour); !slices.Equal(ev, []uint32{0x10}) {
+		t.Fatalf("SweepEvict=%v, want [0x10] on its original clock", ev)
+	}
+	if n := after.PurgeEvicted(t0.Add(36*time.Hour), 24*time.Hour); n != 2 || len(after.Snapshot().Players) != 2 {
+		t.Fatalf("purged=%d, snapshot=%v", n, after.Snapshot().Players)
+	}
+
+	// Past the grace nothing matches, and unmatched entries are dropped.
+	late := NewPlayerStore()
+	late.Restore(snap, restart)
+	late.Upsert(0x20, restart.Add(RestoreGrace))
+	late.SetRemoteIP(0x20, "203.0.113.2", restart.Add(RestoreGrace))
+	if late.IsEvicted(0x20) {
+		t.Fatal("restored eviction applied after the grace")
+	}
+	if n := late.PurgeEvicted(restart.Add(RestoreGrace), 0); n != 0 || len(late.Snapshot().Players) != 1 {
+		t.Fatalf("purged=%d, snapshot=%v, want only the live 0x20", n, late.Snapshot().Players)
+	}
+
+	if _, err := ReadPlayerSnapshot(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("missing file err=%v, want os.ErrNotExist", err)
+	}
+}
+
+func TestHostStore_RidReservationPersistsBeforeIssuing(t *testing.T) {
+	host := func(s *HostStore, from uint32) string {
+		s.ApplyHostData(from, `<HostData><HostData><New><Item ItemId="0" GName="g" /></New></HostData></HostData>`)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return strconv.FormatUint(uint64(s.hosts[hostKey(from)].rid), 10)
+	}
+	// settle waits for a background reservation to finish.
+	settle := func(s *HostStore) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+			s.mu.Lock()
+			busy := s.reserving
+			s.mu.Unlock()
+			if !busy {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("reservation never finished")
+			}
+		}
+	}
+
+	var (
+		mu        sync.Mutex
+		persisted []uint32
+		fail      bool
+	)
+	s := NewHostStore()
+	err := s.SetRidReservation(4, func(snap HostSnapshot) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			return errors.New("disk full")
+		}
+		persisted = append(persisted, snap.NextRid)
+		return nil
+	})
+	// The first mark is on disk before any rid is issued.
+	if err != nil || !slices.Equal(persisted, []uint32{5}) {
+		t.Fatalf("err=%v persisted=%v", err, persisted)
+	}
+
+	var issued []string
+	for from := uint32(1); from <= 3; from++ {
+		issued = append(issued, host(s, from))
+		settle(s)
+	}
+	// rid 3 leaves fewer than half a block reserved, so 9 is written ahead.
+	if !slices.Equal(persisted, []uint32{5, 9}) || !slices.Equal(issued, []string{"1", "2", "3"}) {
+		t.Fatalf("persisted=%v issued=%v", persisted, issued)
+	}
+	if got := s.Snapshot().NextRid; got != 9 {
+		t.Fatalf("Snapshot NextRid=%d, want the reservation 9", got)
+	}
+
+	// A crash now restores from the last reservation, past every issued rid.
+	after := NewHostStore()
+	after.Restore(HostSnapshot{V: 1, NextRid: persisted[len(persisted)-1]})
+	if rid := host(after, 0x10); rid != "9" {
+		t.Fatalf("first rid after crash=%s, want 9", rid)
+	}
+
+	// A failed write still issues rids, and is not retried on every one.
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+	for from := uint32(4); from <= 8; from++ {
+		host(s, from)
+		settle(s)
+	}
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	host(s, 9)
+	settle(s)
+	if !slices.Equal(persisted, []uint32{5, 9}) {
+		t.Fatalf("persisted=%v, want no retry inside ridReserveRetry", persisted)
+	}
+	// After the back-off the next rid reserves again.
+	s.mu.Lock()
+	s.reserveRetryAt = time.Time{}
+	s.mu.Unlock()
+	host(s, 10)
+	settle(s)
+	if !slices.Equal(persisted, []uint32{5, 9, 14}) {
+		t.Fatalf("persisted=%v, want a retry reserving 14", persisted)
+	}
+}